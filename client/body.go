@@ -0,0 +1,206 @@
+// Copyright 2017 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"github.com/andybalholm/brotli"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// Encodings requested from servers, and decoded before the body is read.
+const AcceptEncoding = "gzip, deflate, br"
+
+// A Body is a response body that is decoded from its Content-Encoding as it is
+// read, counting the bytes received and the bytes after decoding.  Bodies with
+// an encoding that can't be decoded are passed through unchanged.  If it has a
+// limit, the body ends after that many bytes, however large it really is.
+type Body struct {
+	// Content-Encoding of the body as received, if any
+	Encoding string
+	// Whether the body is still encoded with Encoding
+	Undecoded bool
+	raw       *byteCounter
+	r         io.Reader
+	closer    io.Closer
+	decoded   int64
+	complete  bool
+	// Most bytes to return after decoding, if set
+	limit int64
+	// Content-Length of the body as decoded, or -1 if not known up front
+	declared  int64
+	truncated bool
+}
+
+// Wrap the body of resp, removing the headers that describe the encoding if
+// it will be decoded, as the standard library does for gzip.
+func decodeBody(resp *http.Response) *Body {
+	if resp.Body == nil {
+		resp.Body = http.NoBody
+	}
+	b := &Body{raw: &byteCounter{r: resp.Body}, closer: resp.Body, declared: resp.ContentLength}
+	encoding := strings.ToLower(strings.TrimSpace(resp.Header.Get("Content-Encoding")))
+	switch encoding {
+	case "", "identity":
+	case "gzip", "x-gzip", "deflate", "br":
+		b.Encoding = encoding
+		resp.Header.Del("Content-Encoding")
+		resp.Header.Del("Content-Length")
+		resp.ContentLength = -1
+		resp.Uncompressed = true
+		b.declared = -1
+	default:
+		b.Encoding = encoding
+		b.Undecoded = true
+	}
+	resp.Body = b
+	return b
+}
+
+// End the body after n bytes, or never if n is 0.  Reading stops there, so a
+// huge body is never read in full.
+func (b *Body) SetLimit(n int64) {
+	b.limit = n
+}
+
+// Whether the body was longer than the limit, either from reading it or
+// because its Content-Length said so.
+func (b *Body) Truncated() bool {
+	return b.truncated || (b.limit > 0 && b.declared > b.limit)
+}
+
+func (b *Body) Read(p []byte) (int, error) {
+	if b.r == nil {
+		if err := b.start(); err != nil {
+			return 0, err
+		}
+	}
+	if b.limit > 0 {
+		remaining := b.limit - b.decoded
+		if remaining <= 0 {
+			return 0, b.atLimit()
+		}
+		if int64(len(p)) > remaining {
+			p = p[:remaining]
+		}
+	}
+	n, err := b.r.Read(p)
+	b.decoded += int64(n)
+	if err == io.EOF {
+		b.complete = true
+	}
+	return n, err
+}
+
+// Set up the decoder, which may need to read the start of the body.
+func (b *Body) start() error {
+	if b.Undecoded {
+		b.r = b.raw
+		return nil
+	}
+	switch b.Encoding {
+	case "gzip", "x-gzip":
+		zr, err := gzip.NewReader(b.raw)
+		if err != nil {
+			return err
+		}
+		b.r = zr
+	case "deflate":
+		// Properly a zlib stream, but some servers send raw deflate data
+		br := bufio.NewReader(b.raw)
+		if head, err := br.Peek(2); err == nil && isZlibHeader(head) {
+			zr, err := zlib.NewReader(br)
+			if err != nil {
+				return err
+			}
+			b.r = zr
+		} else {
+			b.r = flate.NewReader(br)
+		}
+	case "br":
+		b.r = brotli.NewReader(b.raw)
+	default:
+		b.r = b.raw
+	}
+	return nil
+}
+
+// Check whether there is more of the body past the limit, which ends the body
+// either way.
+func (b *Body) atLimit() error {
+	if b.complete || b.truncated {
+		return io.EOF
+	}
+	var one [1]byte
+	n, err := io.ReadFull(b.r, one[:])
+	if n > 0 {
+		b.truncated = true
+	} else if err == io.EOF || err == io.ErrUnexpectedEOF {
+		b.complete = true
+	} else if err != nil {
+		return err
+	}
+	return io.EOF
+}
+
+func isZlibHeader(head []byte) bool {
+	return head[0]&0x0f == 8 && (uint16(head[0])<<8|uint16(head[1]))%31 == 0
+}
+
+func (b *Body) Close() error {
+	return b.closer.Close()
+}
+
+// Bytes received so far, bytes read after decoding, and whether the whole body
+// has been read.  A truncated body is never complete.
+func (b *Body) Sizes() (transferred, decoded int64, complete bool) {
+	return b.raw.n, b.decoded, b.complete
+}
+
+// A Body that returns prefix, the start of b already read, followed by the
+// rest of b.  Bytes received are still counted in b.
+func (b *Body) replay(prefix []byte) *Body {
+	var r io.Reader = bytes.NewReader(prefix)
+	if !b.complete && b.r != nil {
+		r = io.MultiReader(r, b.r)
+	}
+	return &Body{
+		Encoding:  b.Encoding,
+		Undecoded: b.Undecoded,
+		raw:       b.raw,
+		r:         r,
+		closer:    b.closer,
+		limit:     b.limit,
+		declared:  b.declared,
+		truncated: b.truncated,
+	}
+}
+
+type byteCounter struct {
+	r io.Reader
+	n int64
+}
+
+func (c *byteCounter) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
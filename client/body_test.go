@@ -0,0 +1,163 @@
+// Copyright 2017 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"github.com/andybalholm/brotli"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func encodedResponse(t *testing.T, encoding, body string) *http.Response {
+	var buf bytes.Buffer
+	var w io.WriteCloser
+	switch encoding {
+	case "gzip":
+		w = gzip.NewWriter(&buf)
+	case "deflate":
+		w = zlib.NewWriter(&buf)
+	case "raw-deflate":
+		w, _ = flate.NewWriter(&buf, flate.DefaultCompression)
+		encoding = "deflate"
+	case "br":
+		w = brotli.NewWriter(&buf)
+	default:
+		buf.WriteString(body)
+	}
+	if w != nil {
+		w.Write([]byte(body))
+		w.Close()
+	}
+	resp := cachedResponse(200, "")
+	resp.Body = ioutil.NopCloser(bytes.NewReader(buf.Bytes()))
+	resp.ContentLength = int64(buf.Len())
+	resp.Header.Set("Content-Length", "1")
+	if encoding != "" {
+		resp.Header.Set("Content-Encoding", encoding)
+	}
+	return resp
+}
+
+func TestDecodeBody(t *testing.T) {
+	text := strings.Repeat("compressible ", 100)
+	for _, encoding := range []string{"gzip", "deflate", "raw-deflate", "br", ""} {
+		resp := encodedResponse(t, encoding, text)
+		wire := resp.ContentLength
+		decodeBody(resp)
+		if got := readBody(t, resp); got != text {
+			t.Errorf("%s: body not decoded: %q", encoding, got)
+			continue
+		}
+		body := resp.Body.(*Body)
+		transferred, decoded, complete := body.Sizes()
+		if transferred != wire || decoded != int64(len(text)) || !complete {
+			t.Errorf("%s: unexpected sizes %d, %d, %v", encoding, transferred, decoded, complete)
+		}
+		if encoding != "" && (resp.Header.Get("Content-Encoding") != "" || resp.ContentLength != -1) {
+			t.Errorf("%s: expected encoding headers to be removed, got %v", encoding, resp.Header)
+		}
+	}
+}
+
+func TestDecodeBody_Unsupported(t *testing.T) {
+	resp := encodedResponse(t, "", "not really zstd")
+	resp.Header.Set("Content-Encoding", "zstd")
+	decodeBody(resp)
+	if got := readBody(t, resp); got != "not really zstd" {
+		t.Errorf("Expected body to be passed through, got %q", got)
+	}
+	if body := resp.Body.(*Body); !body.Undecoded || body.Encoding != "zstd" {
+		t.Errorf("Expected undecoded zstd body, got %+v", body)
+	}
+	if resp.Header.Get("Content-Encoding") != "zstd" {
+		t.Error("Expected Content-Encoding to be kept for an undecoded body.")
+	}
+}
+
+func TestRequestURL_Decoded(t *testing.T) {
+	cache, _ := NewResponseCache("", 0)
+	resp := encodedResponse(t, "gzip", "hello, hello, hello, hello")
+	wire := resp.ContentLength
+	mockClient := makeMockHttpClient(resp)
+	c := &httpClient{Client: mockClient, Cache: cache}
+	u := &url.URL{Scheme: "http", Host: "localhost", Path: "/"}
+	got, err := c.RequestURL(u)
+	if err != nil {
+		t.Fatalf("Got error: %v", err)
+	}
+	if got.Request.Header.Get("Accept-Encoding") != AcceptEncoding {
+		t.Errorf("Expected Accept-Encoding to be sent, got %v", got.Request.Header)
+	}
+	if body := readBody(t, got); body != "hello, hello, hello, hello" {
+		t.Errorf("Expected decoded body, got %q", body)
+	}
+	// Caching reads the body, but the size on the wire is still known
+	if transferred, _, _ := got.Body.(*Body).Sizes(); transferred != wire {
+		t.Errorf("Expected %d bytes transferred, got %d", wire, transferred)
+	}
+}
+
+func TestBody_Limit(t *testing.T) {
+	text := strings.Repeat("compressible ", 100)
+	resp := encodedResponse(t, "gzip", text)
+	decodeBody(resp).SetLimit(100)
+	if got := readBody(t, resp); got != text[:100] {
+		t.Errorf("Expected first 100 bytes, got %q", got)
+	}
+	body := resp.Body.(*Body)
+	if _, decoded, complete := body.Sizes(); !body.Truncated() || complete || decoded != 100 {
+		t.Errorf("Expected truncated body, got %d bytes, complete %v", decoded, complete)
+	}
+
+	resp = encodedResponse(t, "gzip", text[:100])
+	decodeBody(resp).SetLimit(100)
+	readBody(t, resp)
+	body = resp.Body.(*Body)
+	if _, _, complete := body.Sizes(); body.Truncated() || !complete {
+		t.Errorf("Expected body of exactly the limit to be complete.")
+	}
+
+	// The length is known without reading anything
+	resp = encodedResponse(t, "", text)
+	if body := decodeBody(resp); body.Truncated() {
+		t.Errorf("Expected no truncation without a limit.")
+	} else if body.SetLimit(100); !body.Truncated() {
+		t.Errorf("Expected Content-Length over the limit to be truncated.")
+	}
+}
+
+func TestRequestURL_LimitNotCached(t *testing.T) {
+	cache, _ := NewResponseCache("", 0)
+	mockClient := makeMockHttpClient(cachedResponse(200, "first, and long"), cachedResponse(200, "second"))
+	c := &httpClient{Client: mockClient, Cache: cache, MaxBodySize: 5}
+	u := &url.URL{Scheme: "http", Host: "localhost", Path: "/"}
+	for _, want := range []string{"first", "secon"} {
+		resp, err := c.RequestURL(u)
+		if err != nil {
+			t.Fatalf("Got error: %v", err)
+		}
+		if got := readBody(t, resp); got != want {
+			t.Errorf("Expected %q, got %q", want, got)
+		}
+	}
+}
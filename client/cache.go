@@ -0,0 +1,201 @@
+// Copyright 2017 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"github.com/Matir/webborer/logging"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const (
+	// Responses with larger bodies are not cached
+	maxCachedBody = 1024 * 1024
+	// Oldest responses are dropped from memory beyond this many bytes
+	maxCacheMemory = 64 * 1024 * 1024
+)
+
+// A ResponseCache keeps responses to GET and HEAD requests so that asking for
+// the same resource again, e.g. to check a parent directory or a redirect
+// target, doesn't cost another round trip.  Responses are held in memory and,
+// if the cache has a directory, written there so later scans can use them.
+// Errors, rate limiting and responses reached through a redirect are never
+// cached, and responses older than the cache's TTL are fetched again.
+type ResponseCache struct {
+	dir     string
+	ttl     time.Duration
+	lock    sync.Mutex
+	entries map[string]cacheEntry
+	// Keys in the order they were added, for eviction
+	order []string
+	size  int64
+}
+
+type cacheEntry struct {
+	dump   []byte
+	stored time.Time
+}
+
+// Create a cache, stored on disk in dir as well as in memory if dir is set.
+// Responses are kept for ttl, or for as long as there is room if it is 0.
+func NewResponseCache(dir string, ttl time.Duration) (*ResponseCache, error) {
+	if dir != "" {
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			return nil, err
+		}
+	}
+	return &ResponseCache{dir: dir, ttl: ttl, entries: make(map[string]cacheEntry)}, nil
+}
+
+// Key for a request: the method, the URL, every header sent and the
+// credentials sent if the server asks for them, as any of them may change the
+// response.  The fragment is kept, as it carries the word when fuzzing.  The
+// key is hashed so that cookies and credentials aren't kept in it.
+func cacheKey(req *http.Request, u *url.URL, credentials string) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s %s\nHost: %s\n", req.Method, u.String(), req.Host)
+	req.Header.Write(h)
+	fmt.Fprintf(h, "\n%s", credentials)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Whether a request can be answered from the cache.  Conditional requests
+// always go to the server, as they ask whether the resource has changed.
+func cacheableRequest(req *http.Request, body string) bool {
+	if req.Header.Get("If-None-Match") != "" || req.Header.Get("If-Modified-Since") != "" {
+		return false
+	}
+	return body == "" && (req.Method == "GET" || req.Method == "HEAD")
+}
+
+// Whether an entry stored at t has expired
+func (c *ResponseCache) expired(t time.Time) bool {
+	return c.ttl > 0 && time.Since(t) > c.ttl
+}
+
+// Whether a response to req may be cached
+func cacheableResponse(req *http.Request, resp *http.Response) bool {
+	if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500 {
+		return false
+	}
+	return resp.Request == nil || resp.Request.URL.String() == req.URL.String()
+}
+
+// The cached response for key, or nil if there is none.
+func (c *ResponseCache) get(key string, req *http.Request) *http.Response {
+	c.lock.Lock()
+	entry, ok := c.entries[key]
+	c.lock.Unlock()
+	if !ok && c.dir != "" {
+		path := c.path(key)
+		fi, err := os.Stat(path)
+		if err != nil || c.expired(fi.ModTime()) {
+			return nil
+		}
+		if entry.dump, err = ioutil.ReadFile(path); err != nil {
+			return nil
+		}
+		entry.stored = fi.ModTime()
+		c.remember(key, entry)
+	} else if !ok || c.expired(entry.stored) {
+		return nil
+	}
+	resp, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(entry.dump)), req)
+	if err != nil {
+		logging.Logf(logging.LogDebug, "Unable to read cached response for %s: %s", req.URL.String(), err.Error())
+		return nil
+	}
+	logging.Logf(logging.LogDebug, "Cache hit: %s %s", req.Method, req.URL.String())
+	return resp
+}
+
+// Cache resp for key, if it is small enough.  The body of resp is replaced so
+// the caller can still read it.
+func (c *ResponseCache) put(key string, resp *http.Response) {
+	if resp.Body == nil {
+		resp.Body = http.NoBody
+	}
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxCachedBody+1))
+	// Part of a response isn't worth keeping
+	truncated := false
+	if b, ok := resp.Body.(*Body); ok {
+		truncated = b.Truncated()
+	}
+	resp.Body = replayBody(resp.Body, body)
+	if err != nil || len(body) > maxCachedBody || truncated {
+		return
+	}
+	stored := *resp
+	stored.Body = ioutil.NopCloser(bytes.NewReader(body))
+	stored.ContentLength = int64(len(body))
+	stored.TransferEncoding = nil
+	dump, err := httputil.DumpResponse(&stored, true)
+	if err != nil {
+		return
+	}
+	c.remember(key, cacheEntry{dump: dump, stored: time.Now()})
+	if c.dir != "" {
+		if err := ioutil.WriteFile(c.path(key), dump, 0600); err != nil {
+			logging.Logf(logging.LogWarning, "Unable to write to response cache: %s", err.Error())
+		}
+	}
+}
+
+// A body that returns prefix, already read from orig, followed by the rest of
+// orig.
+func replayBody(orig io.ReadCloser, prefix []byte) io.ReadCloser {
+	if b, ok := orig.(*Body); ok {
+		return b.replay(prefix)
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(bytes.NewReader(prefix), orig), orig}
+}
+
+// Keep entry in memory, dropping the oldest entries if there are too many.
+func (c *ResponseCache) remember(key string, entry cacheEntry) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if old, ok := c.entries[key]; ok {
+		c.size -= int64(len(old.dump))
+	} else {
+		c.order = append(c.order, key)
+	}
+	c.entries[key] = entry
+	c.size += int64(len(entry.dump))
+	for c.size > maxCacheMemory && len(c.order) > 0 {
+		oldest := c.order[0]
+		c.order = c.order[1:]
+		c.size -= int64(len(c.entries[oldest].dump))
+		delete(c.entries, oldest)
+	}
+}
+
+func (c *ResponseCache) path(key string) string {
+	return filepath.Join(c.dir, key)
+}
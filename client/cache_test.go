@@ -0,0 +1,179 @@
+// Copyright 2017 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func cachedResponse(code int, body string) *http.Response {
+	return &http.Response{
+		StatusCode: code,
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header:     http.Header{"Content-Type": {"text/plain"}},
+		Body:       ioutil.NopCloser(strings.NewReader(body)),
+	}
+}
+
+func readBody(t *testing.T, resp *http.Response) string {
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("Error reading body: %v", err)
+	}
+	return string(body)
+}
+
+func TestRequestURL_Cache(t *testing.T) {
+	cache, _ := NewResponseCache("", 0)
+	mockClient := makeMockHttpClient(cachedResponse(200, "first"), cachedResponse(200, "second"))
+	c := &httpClient{Client: mockClient, Cache: cache}
+	u := &url.URL{Scheme: "http", Host: "localhost", Path: "/a"}
+	for i := 0; i < 2; i++ {
+		resp, err := c.RequestURL(u)
+		if err != nil {
+			t.Fatalf("Got error: %v", err)
+		}
+		if body := readBody(t, resp); body != "first" {
+			t.Errorf("Request %d: expected cached body, got %q", i, body)
+		}
+		if resp.Header.Get("Content-Type") != "text/plain" || resp.Request.URL.Path != "/a" {
+			t.Errorf("Request %d: unexpected response %+v", i, resp)
+		}
+	}
+	if len(mockClient.resps) != 1 {
+		t.Errorf("Expected one request to be sent, %d responses left", len(mockClient.resps))
+	}
+}
+
+func TestRequestURL_CacheSkipped(t *testing.T) {
+	cache, _ := NewResponseCache("", 0)
+	u := &url.URL{Scheme: "http", Host: "localhost", Path: "/a"}
+	// Rate limiting is temporary
+	mockClient := makeMockHttpClient(cachedResponse(429, ""), cachedResponse(200, "ok"))
+	c := &httpClient{Client: mockClient, Cache: cache}
+	c.RequestURL(u)
+	if resp, _ := c.RequestURL(u); resp.StatusCode != 200 {
+		t.Errorf("Expected 429 not to be cached, got %d", resp.StatusCode)
+	}
+	// Requests with a body aren't cached
+	mockClient = makeMockHttpClient(cachedResponse(200, "one"), cachedResponse(200, "two"))
+	c = &httpClient{Client: mockClient, Cache: cache, Body: "q=FUZZ"}
+	c.RequestURL(u)
+	if resp, _ := c.RequestURL(u); readBody(t, resp) != "two" {
+		t.Error("Expected POST not to be cached.")
+	}
+}
+
+func TestRequestURL_CacheKey(t *testing.T) {
+	cache, _ := NewResponseCache("", 0)
+	u := &url.URL{Scheme: "http", Host: "localhost", Path: "/a"}
+	mockClient := makeMockHttpClient(cachedResponse(200, "one"), cachedResponse(200, "two"), cachedResponse(200, "three"))
+	c := &httpClient{Client: mockClient, Cache: cache, UserAgent: "first"}
+	readBody(t, mustRequest(t, c, u))
+	// A different User-Agent may get a different response
+	c.UserAgent = "second"
+	if body := readBody(t, mustRequest(t, c, u)); body != "two" {
+		t.Errorf("Expected request with another User-Agent to be sent, got %q", body)
+	}
+	// As may different credentials
+	c.HTTPUsername, c.HTTPPassword = "user", "pass"
+	if body := readBody(t, mustRequest(t, c, u)); body != "three" {
+		t.Errorf("Expected request with credentials to be sent, got %q", body)
+	}
+}
+
+func TestRequestURL_CacheConditional(t *testing.T) {
+	cache, _ := NewResponseCache("", 0)
+	u := &url.URL{Scheme: "http", Host: "localhost", Path: "/a"}
+	mockClient := makeMockHttpClient(cachedResponse(200, "one"), cachedResponse(304, ""))
+	c := &httpClient{Client: mockClient, Cache: cache}
+	readBody(t, mustRequest(t, c, u))
+	c.Validators = func(*url.URL) (string, string) {
+		return `"abc"`, ""
+	}
+	if resp := mustRequest(t, c, u); resp.StatusCode != 304 {
+		t.Errorf("Expected conditional request to be sent, got %d", resp.StatusCode)
+	}
+}
+
+func TestResponseCache_TTL(t *testing.T) {
+	cache, _ := NewResponseCache("", time.Minute)
+	u := &url.URL{Scheme: "http", Host: "localhost", Path: "/a"}
+	mockClient := makeMockHttpClient(cachedResponse(200, "old"), cachedResponse(200, "new"))
+	c := &httpClient{Client: mockClient, Cache: cache}
+	readBody(t, mustRequest(t, c, u))
+	for key, entry := range cache.entries {
+		entry.stored = entry.stored.Add(-2 * time.Minute)
+		cache.entries[key] = entry
+	}
+	if body := readBody(t, mustRequest(t, c, u)); body != "new" {
+		t.Errorf("Expected expired response to be fetched again, got %q", body)
+	}
+}
+
+func TestRequestURL_CacheLargeBody(t *testing.T) {
+	cache, _ := NewResponseCache("", 0)
+	large := strings.Repeat("x", maxCachedBody+10)
+	mockClient := makeMockHttpClient(cachedResponse(200, large), cachedResponse(200, "small"))
+	c := &httpClient{Client: mockClient, Cache: cache}
+	u := &url.URL{Scheme: "http", Host: "localhost", Path: "/big"}
+	resp, _ := c.RequestURL(u)
+	if body := readBody(t, resp); body != large {
+		t.Errorf("Expected whole body, got %d bytes", len(body))
+	}
+	if resp, _ := c.RequestURL(u); readBody(t, resp) != "small" {
+		t.Error("Expected large response not to be cached.")
+	}
+}
+
+func TestResponseCache_Dir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cache")
+	if err != nil {
+		t.Fatalf("Unable to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	u := &url.URL{Scheme: "http", Host: "localhost", Path: "/a"}
+	cache, err := NewResponseCache(dir, 0)
+	if err != nil {
+		t.Fatalf("Unable to create cache: %v", err)
+	}
+	c := &httpClient{Client: makeMockHttpClient(cachedResponse(404, "gone")), Cache: cache}
+	readBody(t, mustRequest(t, c, u))
+
+	// A new cache, as in a later scan, reads what was written
+	cache, _ = NewResponseCache(dir, 0)
+	c = &httpClient{Client: makeMockHttpClient(), Cache: cache}
+	resp := mustRequest(t, c, u)
+	if resp.StatusCode != 404 || readBody(t, resp) != "gone" {
+		t.Errorf("Expected response from disk, got %+v", resp)
+	}
+}
+
+func mustRequest(t *testing.T, c *httpClient, u *url.URL) *http.Response {
+	resp, err := c.RequestURL(u)
+	if err != nil || resp == nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	return resp
+}
@@ -16,21 +16,35 @@
 package client
 
 import (
+	"context"
 	"encoding/base64"
+	"encoding/json"
 	"fmt"
 	"github.com/Matir/webborer/logging"
+	"github.com/Matir/webborer/util"
+	"io"
+	"math/rand"
 	"net/http"
 	"net/url"
 	"strings"
 )
 
+// Content type of request bodies unless another is given.
+const FormContentType = "application/x-www-form-urlencoded"
+
 // Client is a thin wrapper around http.Client to make enhancements to
 // support our use case.
 type Client interface {
 	RequestURL(*url.URL) (*http.Response, error)
+	// Like RequestURL, but the request is aborted if ctx is cancelled
+	RequestURLContext(context.Context, *url.URL) (*http.Response, error)
 	SetCheckRedirect(func(*http.Request, []*http.Request) error)
 }
 
+// A ValidatorFunc returns the ETag and Last-Modified values last seen for a
+// URL, either of which may be empty.
+type ValidatorFunc func(*url.URL) (string, string)
+
 // This interface just allows us to substitute a mock in tests
 type httpClientInt interface {
 	Do(req *http.Request) (*http.Response, error)
@@ -40,20 +54,76 @@ type httpClientInt interface {
 //
 // The Client member is almost always an http.Client outside of tests.
 type httpClient struct {
-	Client       httpClientInt
-	UserAgent    string
+	Client    httpClientInt
+	UserAgent string
+	// Each request picks one of these at random instead of UserAgent, if set
+	UserAgents   []string
 	HTTPUsername string
 	HTTPPassword string
+	// Extra headers and body for each request.  The fuzz marker in either is
+	// replaced with the payload of the requested URL (see util.WithPayload).
+	Header      http.Header
+	Body        string
+	ContentType string
+	// Method to use instead of GET, or POST when there is a body
+	Method string
+	// ETag and Last-Modified values to make requests conditional on, if set
+	Validators ValidatorFunc
+	// Cache for responses, if any
+	Cache *ResponseCache
+	// Most of each body to read, after decoding, or 0 for no limit
+	MaxBodySize  int64
 	basicAuthStr string
+	// Counts connections used, if set
+	conns *connCounter
 }
 
 // Request the URL given.
 //
 // Handles HTTP Authentication & Custom Headers
 func (c *httpClient) RequestURL(u *url.URL) (*http.Response, error) {
-	// TODO: support other methods
-	method := "GET"
-	req := c.makeRequest(u, method)
+	return c.RequestURLContext(context.Background(), u)
+}
+
+func (c *httpClient) RequestURLContext(ctx context.Context, u *url.URL) (*http.Response, error) {
+	method := c.Method
+	if method == "" && c.Body != "" {
+		method = "POST"
+	} else if method == "" {
+		method = "GET"
+	}
+	if c.conns != nil {
+		ctx = c.conns.trace(ctx)
+	}
+	req, err := c.makeRequest(ctx, u, method)
+	if err != nil {
+		return nil, err
+	}
+	cache := c.Cache
+	if cache != nil && !cacheableRequest(req, c.Body) {
+		cache = nil
+	}
+	var key string
+	if cache != nil {
+		key = cacheKey(req, u, c.HTTPUsername+":"+c.HTTPPassword)
+		if resp := cache.get(key, req); resp != nil {
+			decodeBody(resp).SetLimit(c.MaxBodySize)
+			return resp, nil
+		}
+	}
+	resp, err := c.do(ctx, req, u, method)
+	if err != nil || resp == nil {
+		return resp, err
+	}
+	decodeBody(resp).SetLimit(c.MaxBodySize)
+	if cache != nil && cacheableResponse(req, resp) {
+		cache.put(key, resp)
+	}
+	return resp, nil
+}
+
+// Send req, retrying with credentials if the server asks for them.
+func (c *httpClient) do(ctx context.Context, req *http.Request, u *url.URL, method string) (*http.Response, error) {
 	resp, err := c.Client.Do(req)
 	if err != nil {
 		return resp, err
@@ -69,10 +139,16 @@ func (c *httpClient) RequestURL(u *url.URL) (*http.Response, error) {
 		if c.HTTPUsername == "" && c.HTTPPassword == "" {
 			return resp, nil
 		}
-		req = c.makeRequest(u, method)
+		agent := req.Header.Get("User-Agent")
+		if req, err = c.makeRequest(ctx, u, method); err != nil {
+			resp.Body.Close()
+			return nil, err
+		}
+		// Retry as the same browser
+		req.Header.Set("User-Agent", agent)
 		err = c.addAuthHeader(req, authHeader)
 		if err != nil {
-			logging.Logf(logging.LogInfo, err.Error())
+			logging.Logf(logging.LogInfo, "%s", err.Error())
 			return resp, nil
 		}
 		resp, err = c.Client.Do(req)
@@ -83,11 +159,75 @@ func (c *httpClient) RequestURL(u *url.URL) (*http.Response, error) {
 	return resp, nil
 }
 
-// Build a request with our preferred options
-func (c *httpClient) makeRequest(u *url.URL, method string) *http.Request {
-	req, _ := http.NewRequest(method, u.String(), nil)
-	req.Header.Set("User-Agent", c.UserAgent)
-	return req
+// Build a request with our preferred options.  When fuzzing headers or the
+// body, the word for this request is carried in the URL fragment, which is
+// never sent to the server.
+func (c *httpClient) makeRequest(ctx context.Context, u *url.URL, method string) (*http.Request, error) {
+	word := util.Payload(u)
+	target := *util.WithoutPayload(u)
+	var body io.Reader
+	ctype := c.ContentType
+	if c.Body != "" {
+		if ctype == "" {
+			ctype = FormContentType
+		}
+		body = strings.NewReader(strings.Replace(c.Body, util.FuzzMarker, escapeForBody(ctype, word), -1))
+	}
+	req, err := http.NewRequest(method, target.String(), body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", c.userAgent())
+	// Asking for an encoding stops the transport decoding gzip itself, so the
+	// size on the wire can be counted
+	req.Header.Set("Accept-Encoding", AcceptEncoding)
+	if c.Validators != nil {
+		etag, modified := c.Validators(&target)
+		if etag != "" {
+			req.Header.Set("If-None-Match", etag)
+		}
+		if modified != "" {
+			req.Header.Set("If-Modified-Since", modified)
+		}
+	}
+	if ctype != "" {
+		req.Header.Set("Content-Type", ctype)
+	}
+	for name, values := range c.Header {
+		fuzzed := make([]string, len(values))
+		for i, v := range values {
+			fuzzed[i] = strings.Replace(v, util.FuzzMarker, word, -1)
+		}
+		if name == "Host" {
+			req.Host = fuzzed[0]
+			continue
+		}
+		req.Header[name] = fuzzed
+	}
+	return req.WithContext(ctx), nil
+}
+
+// The User-Agent for the next request.
+func (c *httpClient) userAgent() string {
+	if len(c.UserAgents) > 0 {
+		return c.UserAgents[rand.Intn(len(c.UserAgents))]
+	}
+	return c.UserAgent
+}
+
+// Escape a word for substitution into a body of the given content type, so
+// that the body stays well-formed.  Types other than forms and JSON get the
+// word as-is.
+func escapeForBody(contentType, word string) string {
+	mediaType := strings.ToLower(strings.TrimSpace(strings.SplitN(contentType, ";", 2)[0]))
+	switch {
+	case mediaType == FormContentType:
+		return url.QueryEscape(word)
+	case mediaType == "application/json" || strings.HasSuffix(mediaType, "+json"):
+		quoted, _ := json.Marshal(word)
+		return string(quoted[1 : len(quoted)-1])
+	}
+	return word
 }
 
 func (c *httpClient) SetCheckRedirect(checker func(*http.Request, []*http.Request) error) {
@@ -15,7 +15,9 @@
 package client
 
 import (
+	"context"
 	"encoding/base64"
+	"io/ioutil"
 	"net/http"
 	"net/url"
 	"strings"
@@ -89,16 +91,146 @@ func (c *mockAuthHttpClient) Do(req *http.Request) (*http.Response, error) {
 	return resp, nil
 }
 
+func mustMakeRequest(t *testing.T, c *httpClient, ctx context.Context, u *url.URL, method string) *http.Request {
+	t.Helper()
+	req, err := c.makeRequest(ctx, u, method)
+	if err != nil {
+		t.Fatalf("Error making request: %v", err)
+	}
+	return req
+}
+
 // Actual tests begin here
 func TestMakeRequest_Basic(t *testing.T) {
 	c := &httpClient{}
 	u := &url.URL{Scheme: "http", Host: "localhost", Path: "/"}
-	req := c.makeRequest(u, "GET")
+	req := mustMakeRequest(t, c, context.Background(), u, "GET")
 	if req.URL.String() != u.String() {
 		t.Errorf("URL does not match requested: %s != %s", req.URL.String(), u.String())
 	}
 }
 
+func TestMakeRequest_InvalidMethod(t *testing.T) {
+	c := &httpClient{}
+	u := &url.URL{Scheme: "http", Host: "localhost", Path: "/"}
+	if _, err := c.makeRequest(context.Background(), u, "GET /"); err == nil {
+		t.Error("Expected error for invalid method.")
+	}
+	if _, err := (&httpClient{Method: "GET /"}).RequestURL(u); err == nil {
+		t.Error("Expected error requesting with invalid method.")
+	}
+}
+
+func TestMakeRequest_UserAgents(t *testing.T) {
+	u := &url.URL{Scheme: "http", Host: "localhost", Path: "/"}
+	c := &httpClient{UserAgent: "fixed"}
+	if ua := mustMakeRequest(t, c, context.Background(), u, "GET").Header.Get("User-Agent"); ua != "fixed" {
+		t.Errorf("Expected fixed User-Agent, got %q", ua)
+	}
+	c.UserAgents = []string{"one", "two"}
+	seen := make(map[string]bool)
+	for i := 0; i < 100; i++ {
+		seen[mustMakeRequest(t, c, context.Background(), u, "GET").Header.Get("User-Agent")] = true
+	}
+	if len(seen) != 2 || !seen["one"] || !seen["two"] {
+		t.Errorf("Expected requests to rotate between agents, got %v", seen)
+	}
+}
+
+func TestMakeRequest_Validators(t *testing.T) {
+	c := &httpClient{Validators: func(u *url.URL) (string, string) {
+		if u.Path == "/known" {
+			return `"abc"`, "Mon, 02 Jan 2006 15:04:05 GMT"
+		}
+		return "", ""
+	}}
+	req := mustMakeRequest(t, c, context.Background(), &url.URL{Scheme: "http", Host: "localhost", Path: "/known"}, "GET")
+	if req.Header.Get("If-None-Match") != `"abc"` || req.Header.Get("If-Modified-Since") != "Mon, 02 Jan 2006 15:04:05 GMT" {
+		t.Errorf("Expected conditional headers, got %v", req.Header)
+	}
+	req = mustMakeRequest(t, c, context.Background(), &url.URL{Scheme: "http", Host: "localhost", Path: "/other"}, "GET")
+	if _, ok := req.Header["If-None-Match"]; ok {
+		t.Errorf("Expected no conditional headers for unknown URL, got %v", req.Header)
+	}
+}
+
+func TestMakeRequest_Context(t *testing.T) {
+	c := &httpClient{}
+	u := &url.URL{Scheme: "http", Host: "localhost", Path: "/"}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	req := mustMakeRequest(t, c, ctx, u, "GET")
+	if req.Context() != ctx {
+		t.Error("Request does not use the given context.")
+	}
+}
+
+func TestMakeRequest_Fuzz(t *testing.T) {
+	c := &httpClient{
+		UserAgent: "webborer",
+		Header: http.Header{
+			"X-Api-Key":  []string{"key-FUZZ"},
+			"User-Agent": []string{"custom"},
+			"Host":       []string{"FUZZ.example.com"},
+		},
+		Body: "user=admin&id=FUZZ",
+	}
+	u := &url.URL{Scheme: "http", Host: "localhost", Path: "/api", Fragment: "a b"}
+	req := mustMakeRequest(t, c, context.Background(), u, "POST")
+	if req.URL.String() != "http://localhost/api" {
+		t.Errorf("Expected fragment to be dropped, got %s", req.URL.String())
+	}
+	if got := req.Header.Get("X-Api-Key"); got != "key-a b" {
+		t.Errorf("Expected fuzzed header, got %q", got)
+	}
+	if got := req.Header.Get("User-Agent"); got != "custom" {
+		t.Errorf("Expected header to override User-Agent, got %q", got)
+	}
+	if req.Host != "a b.example.com" {
+		t.Errorf("Expected fuzzed Host, got %q", req.Host)
+	}
+	if got := req.Header.Get("Content-Type"); got != "application/x-www-form-urlencoded" {
+		t.Errorf("Expected form content type, got %q", got)
+	}
+	body, _ := ioutil.ReadAll(req.Body)
+	if string(body) != "user=admin&id=a+b" {
+		t.Errorf("Expected fuzzed body, got %q", body)
+	}
+}
+
+func TestEscapeForBody(t *testing.T) {
+	cases := []struct {
+		ctype, word, expected string
+	}{
+		{FormContentType, "a b&c", "a+b%26c"},
+		{"application/json; charset=utf-8", `say "hi"\n`, `say \"hi\"\\n`},
+		{"application/vnd.api+json", "tab\t", `tab\t`},
+		{"text/xml", "<a&b>", "<a&b>"},
+	}
+	for _, c := range cases {
+		if got := escapeForBody(c.ctype, c.word); got != c.expected {
+			t.Errorf("escapeForBody(%s, %q): expected %q, got %q", c.ctype, c.word, c.expected, got)
+		}
+	}
+}
+
+func TestRequestURL_JSONBody(t *testing.T) {
+	mockClient := makeMockHttpClient(&http.Response{StatusCode: 200})
+	c := &httpClient{Client: mockClient, Method: "PUT", ContentType: "application/json", Body: `{"q":"FUZZ"}`}
+	resp, err := c.RequestURL(&url.URL{Scheme: "http", Host: "localhost", Path: "/api", Fragment: `a"b`})
+	if err != nil {
+		t.Fatalf("Got error: %v", err)
+	}
+	req := resp.Request
+	if req.Method != "PUT" || req.Header.Get("Content-Type") != "application/json" {
+		t.Errorf("Expected PUT of application/json, got %s of %s", req.Method, req.Header.Get("Content-Type"))
+	}
+	body, _ := ioutil.ReadAll(req.Body)
+	if string(body) != `{"q":"a\"b"}` {
+		t.Errorf("Expected escaped JSON body, got %s", body)
+	}
+}
+
 func TestSetCheckRedirect(_ *testing.T) {
 	c := &httpClient{Client: &http.Client{}}
 	c.SetCheckRedirect(func(_ *http.Request, _ []*http.Request) error { return nil })
@@ -126,6 +258,18 @@ func TestRequestURL_Basic(t *testing.T) {
 	}
 }
 
+func TestRequestURL_Body(t *testing.T) {
+	mockClient := makeMockHttpClient(&http.Response{StatusCode: 200})
+	c := &httpClient{Client: mockClient, Body: "q=FUZZ"}
+	resp, err := c.RequestURL(&url.URL{Scheme: "http", Host: "localhost", Path: "/search"})
+	if err != nil {
+		t.Fatalf("Got error: %v", err)
+	}
+	if resp.Request.Method != "POST" {
+		t.Errorf("Expected POST with a body, got %s", resp.Request.Method)
+	}
+}
+
 // Test with HTTP Basic Auth
 func TestRequestURL_BasicAuth(t *testing.T) {
 	mockClient := &mockAuthHttpClient{}
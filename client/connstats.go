@@ -0,0 +1,93 @@
+// Copyright 2017 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net/http/httptrace"
+	"sync/atomic"
+	"time"
+)
+
+// ConnStats counts how requests got their connections, to show how well
+// keep-alive connections are being reused.
+type ConnStats struct {
+	// Connections opened, and requests sent on an existing connection
+	New    int64 `json:"new"`
+	Reused int64 `json:"reused"`
+	// TLS handshakes made and the total time they took
+	TLSHandshakes int64         `json:"tls_handshakes"`
+	HandshakeTime time.Duration `json:"handshake_time"`
+}
+
+// Fraction of requests that reused a connection.
+func (s ConnStats) ReuseRate() float64 {
+	if s.New+s.Reused == 0 {
+		return 0
+	}
+	return float64(s.Reused) / float64(s.New+s.Reused)
+}
+
+func (s ConnStats) String() string {
+	desc := fmt.Sprintf("%d of %d requests reused a connection (%.0f%%), %d new connections",
+		s.Reused, s.New+s.Reused, 100*s.ReuseRate(), s.New)
+	if s.TLSHandshakes > 0 {
+		avg := s.HandshakeTime / time.Duration(s.TLSHandshakes)
+		desc += fmt.Sprintf(", %d TLS handshakes averaging %s", s.TLSHandshakes, avg.Round(time.Millisecond))
+	}
+	return desc
+}
+
+// connCounter collects ConnStats from the requests of many clients.
+type connCounter struct {
+	newConns      int64
+	reused        int64
+	handshakes    int64
+	handshakeTime int64
+}
+
+func (c *connCounter) stats() ConnStats {
+	return ConnStats{
+		New:           atomic.LoadInt64(&c.newConns),
+		Reused:        atomic.LoadInt64(&c.reused),
+		TLSHandshakes: atomic.LoadInt64(&c.handshakes),
+		HandshakeTime: time.Duration(atomic.LoadInt64(&c.handshakeTime)),
+	}
+}
+
+// Add a trace to ctx that counts the connections used by a request.
+func (c *connCounter) trace(ctx context.Context) context.Context {
+	var started time.Time
+	return httptrace.WithClientTrace(ctx, &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			if info.Reused {
+				atomic.AddInt64(&c.reused, 1)
+			} else {
+				atomic.AddInt64(&c.newConns, 1)
+			}
+		},
+		TLSHandshakeStart: func() {
+			started = time.Now()
+		},
+		TLSHandshakeDone: func(_ tls.ConnectionState, err error) {
+			if err == nil {
+				atomic.AddInt64(&c.handshakes, 1)
+				atomic.AddInt64(&c.handshakeTime, int64(time.Since(started)))
+			}
+		},
+	})
+}
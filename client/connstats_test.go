@@ -0,0 +1,86 @@
+// Copyright 2017 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func requestTwice(t *testing.T, fac *ProxyClientFactory, u *url.URL) {
+	for i := 0; i < 2; i++ {
+		resp, err := fac.Get().RequestURL(u)
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+	}
+}
+
+func TestConnStats(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+	u, _ := url.Parse(server.URL + "/")
+
+	fac, _ := NewProxyClientFactory(nil, 5*time.Second, "")
+	requestTwice(t, fac, u)
+	if stats := fac.ConnectionStats(); stats.New != 1 || stats.Reused != 1 {
+		t.Errorf("Expected clients to share a connection, got %+v", stats)
+	}
+
+	fac, _ = NewProxyClientFactory(nil, 5*time.Second, "")
+	fac.SetConnectionOptions(0, 0, true)
+	requestTwice(t, fac, u)
+	if stats := fac.ConnectionStats(); stats.New != 2 || stats.Reused != 0 {
+		t.Errorf("Expected a new connection per request without keep-alives, got %+v", stats)
+	}
+}
+
+func TestPCFGet_SharedTransport(t *testing.T) {
+	fac, _ := NewProxyClientFactory(nil, time.Second, "")
+	fac.SetConnectionOptions(4, 8, false)
+	a := fac.Get().(*httpClient).Client.(*http.Client).Transport.(*http.Transport)
+	b := fac.GetWithAgent("other").(*httpClient).Client.(*http.Client).Transport.(*http.Transport)
+	if a != b {
+		t.Error("Expected clients to share a transport.")
+	}
+	if a.MaxConnsPerHost != 4 || a.MaxIdleConnsPerHost != 8 || a.DisableKeepAlives {
+		t.Errorf("Connection options not applied: %d %d %v", a.MaxConnsPerHost, a.MaxIdleConnsPerHost, a.DisableKeepAlives)
+	}
+	fac, _ = NewProxyClientFactory([]string{"socks5://localhost", "socks4://localhost:9000"}, time.Second, "")
+	a = fac.Get().(*httpClient).Client.(*http.Client).Transport.(*http.Transport)
+	b = fac.Get().(*httpClient).Client.(*http.Client).Transport.(*http.Transport)
+	if a == b {
+		t.Error("Expected clients spread across proxies to have their own transports.")
+	}
+}
+
+func TestConnStats_String(t *testing.T) {
+	stats := ConnStats{New: 5, Reused: 15, TLSHandshakes: 5, HandshakeTime: 100 * time.Millisecond}
+	expected := "15 of 20 requests reused a connection (75%), 5 new connections, 5 TLS handshakes averaging 20ms"
+	if stats.String() != expected {
+		t.Errorf("Expected %q, got %q", expected, stats.String())
+	}
+	if (ConnStats{}).ReuseRate() != 0 {
+		t.Error("Expected no reuse without requests.")
+	}
+}
@@ -15,12 +15,16 @@
 package client
 
 import (
+	"crypto/tls"
 	"fmt"
 	"github.com/Matir/webborer/logging"
 	"h12.me/socks"
 	"math/rand"
+	"net"
 	"net/http"
 	"net/url"
+	"strings"
+	"sync"
 	"time"
 )
 
@@ -37,76 +41,334 @@ type ClientFactory interface {
 	Get() Client
 }
 
+// An AgentClientFactory can also construct clients that send a different
+// User-Agent than usual, e.g. to compare how a server treats browsers and
+// command-line tools.
+type AgentClientFactory interface {
+	ClientFactory
+	GetWithAgent(agent string) Client
+}
+
+// A CredentialClientFactory can also construct clients that answer requests
+// for HTTP authentication with particular credentials, e.g. to try a list of
+// them against an endpoint.
+type CredentialClientFactory interface {
+	ClientFactory
+	GetWithCredentials(username, password string) Client
+}
+
+// A StatsClientFactory reports how its clients' requests used connections.
+type StatsClientFactory interface {
+	ClientFactory
+	ConnectionStats() ConnStats
+}
+
 // ProxyClientFactory uses the h12.me/socks package to support SOCKS proxies
 // when transporting requests to the webserver.
 type ProxyClientFactory struct {
 	proxyURLs    []*url.URL
 	timeout      time.Duration
 	userAgent    string
+	userAgents   []string
 	httpUsername string
 	httpPassword string
+	rules        []*ProxyRule
+	resolve      map[string]string
+	sockets      map[string]string
+	dialer       DialContextFunc
+	// Connection pooling options for the transport
+	maxConnsPerHost   int
+	maxIdlePerHost    int
+	disableKeepAlives bool
+	// Transport shared by clients, created when first needed
+	transport     *http.Transport
+	transportLock sync.Mutex
+	conns         connCounter
+	header        http.Header
+	method        string
+	contentType   string
+	body          string
+	validators    ValidatorFunc
+	cache         *ResponseCache
+	requestLog    *RequestLog
+	maxBodySize   int64
 }
 
 // Create a ProxyClientFactory for the provided list of proxies.
 func NewProxyClientFactory(proxies []string, timeout time.Duration, agent string) (*ProxyClientFactory, error) {
 	factory := &ProxyClientFactory{timeout: timeout, userAgent: agent}
 	for _, proxy := range proxies {
-		u, err := url.Parse(proxy)
+		u, err := parseProxyURL(proxy)
 		if err != nil {
-			logging.Logf(logging.LogWarning, "Unable to parse proxy: %s", proxy)
 			return nil, err
 		}
-		if _, ok := proxyTypeMap[u.Scheme]; !ok {
-			logging.Logf(logging.LogWarning, "Invalid proxy protocol: %s", u.Scheme)
-			return nil, fmt.Errorf("Invalid proxy protocol: %s", u.Scheme)
-		}
-		if u.Host == "" {
-			logging.Logf(logging.LogWarning, "Missing host for proxy: %s", proxy)
-			return nil, fmt.Errorf("Missing host for proxy: %s", proxy)
-		}
 		factory.proxyURLs = append(factory.proxyURLs, u)
 	}
 	return factory, nil
 }
 
+// Parse and validate a proxy URL
+func parseProxyURL(proxy string) (*url.URL, error) {
+	u, err := url.Parse(proxy)
+	if err != nil {
+		logging.Logf(logging.LogWarning, "Unable to parse proxy: %s", proxy)
+		return nil, err
+	}
+	if _, ok := proxyTypeMap[u.Scheme]; !ok {
+		logging.Logf(logging.LogWarning, "Invalid proxy protocol: %s", u.Scheme)
+		return nil, fmt.Errorf("Invalid proxy protocol: %s", u.Scheme)
+	}
+	if u.Host == "" {
+		logging.Logf(logging.LogWarning, "Missing host for proxy: %s", proxy)
+		return nil, fmt.Errorf("Missing host for proxy: %s", proxy)
+	}
+	return u, nil
+}
+
+// Set rules routing particular hosts through particular proxies.  Rules are
+// evaluated in order for each connection; hosts that match no rule use the
+// factory's proxies (or connect directly if there are none).
+func (factory *ProxyClientFactory) SetProxyRules(rules []string) error {
+	parsed := make([]*ProxyRule, 0, len(rules))
+	for _, rule := range rules {
+		if strings.TrimSpace(rule) == "" {
+			continue
+		}
+		r, err := ParseProxyRule(rule)
+		if err != nil {
+			return err
+		}
+		parsed = append(parsed, r)
+	}
+	factory.rules = parsed
+	return nil
+}
+
+// Connect to the given IP address instead of resolving the host, for each
+// override of the form host:ip.  Requests still carry the hostname in the
+// Host header and TLS SNI, e.g. to reach an origin server behind a CDN.
+func (factory *ProxyClientFactory) SetResolveOverrides(overrides []string) error {
+	hosts, err := ParseResolveOverrides(overrides)
+	if err != nil {
+		return err
+	}
+	factory.resolve = hosts
+	return nil
+}
+
+// Send requests for the hosts in sockets over the Unix socket each maps to,
+// as for targets given as unix:///path/to.sock:/path.
+func (factory *ProxyClientFactory) SetUnixSockets(sockets map[string]string) {
+	factory.sockets = sockets
+}
+
+// Make direct connections with dial instead of a plain net.Dialer, e.g. to
+// reach targets only available through some other transport.  Connections
+// through proxies are unaffected.
+func (factory *ProxyClientFactory) SetDialer(dial DialContextFunc) {
+	factory.dialer = dial
+}
+
+// Limit each host to maxPerHost connections (0 for no limit), keep up to
+// maxIdlePerHost idle connections to each host for reuse, or turn off
+// keep-alives so each request gets a new connection.
+func (factory *ProxyClientFactory) SetConnectionOptions(maxPerHost, maxIdlePerHost int, disableKeepAlives bool) {
+	factory.maxConnsPerHost = maxPerHost
+	factory.maxIdlePerHost = maxIdlePerHost
+	factory.disableKeepAlives = disableKeepAlives
+}
+
 func (factory *ProxyClientFactory) SetUsernamePassword(username, password string) {
 	factory.httpUsername = username
 	factory.httpPassword = password
 }
 
-// Get a single client instance from the factory
-func (factory *ProxyClientFactory) Get() Client {
-	if len(factory.proxyURLs) == 0 {
-		return &httpClient{
-			Client:       &http.Client{Timeout: factory.timeout},
-			UserAgent:    factory.userAgent,
-			HTTPUsername: factory.httpUsername,
-			HTTPPassword: factory.httpPassword,
+// Set extra headers ("Name: value"), the method, and a body of the given
+// content type to send with every request.  An empty method means GET, or POST
+// if there is a body; an empty content type means a form-encoded body.
+func (factory *ProxyClientFactory) SetRequestTemplate(headers []string, method, contentType, body string) error {
+	method = strings.ToUpper(strings.TrimSpace(method))
+	if !validMethod(method) {
+		return fmt.Errorf("Invalid method: %s", method)
+	}
+	header := make(http.Header)
+	for _, h := range headers {
+		pieces := strings.SplitN(h, ":", 2)
+		name := strings.TrimSpace(pieces[0])
+		if len(pieces) != 2 || name == "" {
+			return fmt.Errorf("Invalid header (expected Name: value): %s", h)
 		}
+		header.Add(name, strings.TrimSpace(pieces[1]))
 	}
-	var cli *httpClient
-	if len(factory.proxyURLs) == 1 {
-		cli = clientForProxy(factory.proxyURLs[0], factory.timeout, factory.userAgent)
-	} else {
-		proxy := factory.proxyURLs[rand.Intn(len(factory.proxyURLs))]
-		cli = clientForProxy(proxy, factory.timeout, factory.userAgent)
+	factory.header = header
+	factory.method = method
+	factory.contentType = contentType
+	factory.body = body
+	return nil
+}
+
+// Whether method is empty or a token as defined by RFC 7230, section 3.2.6.
+func validMethod(method string) bool {
+	for _, r := range method {
+		switch {
+		case r >= 'A' && r <= 'Z', r >= 'a' && r <= 'z', r >= '0' && r <= '9':
+		case strings.ContainsRune("!#$%&'*+-.^_`|~", r):
+		default:
+			return false
+		}
 	}
-	cli.HTTPUsername = factory.httpUsername
-	cli.HTTPPassword = factory.httpPassword
-	return cli
+	return true
+}
+
+// Rotate through agents, picking one at random for each request, instead of
+// sending the factory's User-Agent.  Clients from GetWithAgent still send the
+// agent they are given.
+func (factory *ProxyClientFactory) SetUserAgents(agents []string) {
+	factory.userAgents = agents
+}
+
+// Make requests conditional on the ETag and Last-Modified values returned by
+// validators, so unchanged resources are answered with 304 Not Modified.
+func (factory *ProxyClientFactory) SetValidators(validators ValidatorFunc) {
+	factory.validators = validators
+}
+
+// Answer repeated requests from cache instead of sending them again.  Clients
+// from GetWithAgent don't use the cache, as they are meant to see how the
+// server treats a different User-Agent.
+func (factory *ProxyClientFactory) SetCache(cache *ResponseCache) {
+	factory.cache = cache
+}
+
+// Write every request made by the factory's clients, and the responses, to
+// log.  The caller closes the log once the clients are finished with.
+func (factory *ProxyClientFactory) SetRequestLog(log *RequestLog) {
+	factory.requestLog = log
 }
 
-// Build a client for a particular proxy instance
-func clientForProxy(proxy *url.URL, timeout time.Duration, agent string) *httpClient {
-	proto := proxyTypeMap[proxy.Scheme]
-	dialer := socks.DialSocksProxy(proto, proxy.Host)
-	cl := &httpClient{
+// Stop reading response bodies after n bytes, once decoded, so huge bodies
+// aren't read in full.  0 means no limit.
+func (factory *ProxyClientFactory) SetMaxBodySize(n int64) {
+	factory.maxBodySize = n
+}
+
+// Get a single client instance from the factory
+func (factory *ProxyClientFactory) Get() Client {
+	c := factory.GetWithAgent(factory.userAgent).(*httpClient)
+	c.UserAgents = factory.userAgents
+	c.Validators = factory.validators
+	c.Cache = factory.cache
+	return c
+}
+
+// Get a client that authenticates as username when asked to.  Like clients
+// from GetWithAgent, it doesn't use the cache.
+func (factory *ProxyClientFactory) GetWithCredentials(username, password string) Client {
+	c := factory.GetWithAgent(factory.userAgent).(*httpClient)
+	c.HTTPUsername = username
+	c.HTTPPassword = password
+	return c
+}
+
+// Get a client that sends agent as its User-Agent
+func (factory *ProxyClientFactory) GetWithAgent(agent string) Client {
+	return &httpClient{
 		Client: &http.Client{
-			Transport: &http.Transport{
-				Dial: dialer,
-			},
-			Timeout: timeout,
+			Transport: factory.roundTripper(),
+			Timeout:   factory.timeout,
 		},
-		UserAgent: agent}
-	return cl
+		UserAgent:    agent,
+		HTTPUsername: factory.httpUsername,
+		HTTPPassword: factory.httpPassword,
+		Header:       factory.header,
+		Method:       factory.method,
+		ContentType:  factory.contentType,
+		Body:         factory.body,
+		MaxBodySize:  factory.maxBodySize,
+		conns:        &factory.conns,
+	}
+}
+
+// Statistics on the connections used by the factory's clients so far.
+func (factory *ProxyClientFactory) ConnectionStats() ConnStats {
+	return factory.conns.stats()
+}
+
+// The transport for a new client, logging requests if there is a request log.
+func (factory *ProxyClientFactory) roundTripper() http.RoundTripper {
+	if factory.requestLog != nil {
+		return factory.requestLog.Transport(factory.getTransport())
+	}
+	return factory.getTransport()
+}
+
+// The transport for a new client.  Clients share one transport, and so its
+// pool of keep-alive connections, unless there are several proxies to spread
+// clients across.
+func (factory *ProxyClientFactory) getTransport() *http.Transport {
+	if len(factory.proxyURLs) > 1 {
+		return factory.newTransport()
+	}
+	factory.transportLock.Lock()
+	defer factory.transportLock.Unlock()
+	if factory.transport == nil {
+		factory.transport = factory.newTransport()
+	}
+	return factory.transport
+}
+
+func (factory *ProxyClientFactory) newTransport() *http.Transport {
+	var transport *http.Transport
+	if len(factory.proxyURLs) == 0 && len(factory.rules) == 0 {
+		// Keep the defaults, including proxies from the environment
+		transport = http.DefaultTransport.(*http.Transport).Clone()
+	} else {
+		transport = &http.Transport{}
+	}
+	dial := factory.dialer
+	if dial == nil {
+		dial = (&net.Dialer{}).DialContext
+	}
+	if len(factory.proxyURLs) > 0 || len(factory.rules) > 0 {
+		var proxied dialFunc
+		switch len(factory.proxyURLs) {
+		case 0:
+			proxied = (&net.Dialer{}).Dial
+		case 1:
+			proxied = dialerForProxy(factory.proxyURLs[0])
+		default:
+			proxied = dialerForProxy(factory.proxyURLs[rand.Intn(len(factory.proxyURLs))])
+		}
+		if len(factory.rules) > 0 {
+			proxied = (&ruleDialer{rules: factory.rules, resolve: factory.resolve, fallback: proxied}).Dial
+		}
+		dial = withContext(proxied)
+	}
+	// Proxy rules match the requested host, so they apply resolve overrides
+	// themselves
+	if len(factory.resolve) > 0 && len(factory.rules) == 0 {
+		dial = (&resolveDialer{hosts: factory.resolve, dial: dial}).DialContext
+	}
+	if len(factory.sockets) > 0 {
+		dial = (&unixDialer{sockets: factory.sockets, dial: dial}).DialContext
+	}
+	transport.DialContext = dial
+	if serverName := serverNameForHost(factory.header.Get("Host")); serverName != "" {
+		// A Host header names the site, so present that name in TLS too
+		transport.TLSClientConfig = &tls.Config{ServerName: serverName}
+	}
+	transport.MaxConnsPerHost = factory.maxConnsPerHost
+	if factory.maxIdlePerHost > 0 {
+		transport.MaxIdleConnsPerHost = factory.maxIdlePerHost
+		if transport.MaxIdleConns > 0 && transport.MaxIdleConns < factory.maxIdlePerHost {
+			transport.MaxIdleConns = factory.maxIdlePerHost
+		}
+	}
+	transport.DisableKeepAlives = factory.disableKeepAlives
+	return transport
+}
+
+// Build a dialer for a particular proxy instance
+func dialerForProxy(proxy *url.URL) dialFunc {
+	return socks.DialSocksProxy(proxyTypeMap[proxy.Scheme], proxy.Host)
 }
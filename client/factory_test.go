@@ -15,6 +15,8 @@
 package client
 
 import (
+	"io/ioutil"
+	"path/filepath"
 	"testing"
 	"time"
 )
@@ -95,3 +97,62 @@ func TestPCFGet_TwoProxies(t *testing.T) {
 		t.Errorf("Got nil client for two proxies.")
 	}
 }
+
+func TestPCFSetUserAgents(t *testing.T) {
+	fac, _ := NewProxyClientFactory([]string{}, time.Second, "default")
+	fac.SetUserAgents([]string{"one", "two"})
+	if c := fac.Get().(*httpClient); len(c.UserAgents) != 2 {
+		t.Errorf("Expected client to rotate agents, got %v", c.UserAgents)
+	}
+	if c := fac.GetWithAgent("other").(*httpClient); c.UserAgent != "other" || len(c.UserAgents) != 0 {
+		t.Errorf("Expected fixed agent from GetWithAgent, got %q %v", c.UserAgent, c.UserAgents)
+	}
+}
+
+func TestUserAgentList(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "agents.txt")
+	if err := ioutil.WriteFile(path, []byte("# comment\nagent one\n\n  agent two  \n"), 0644); err != nil {
+		t.Fatalf("Unable to write agents: %v", err)
+	}
+	agents, err := UserAgentList(path, false)
+	if err != nil || len(agents) != 2 || agents[0] != "agent one" || agents[1] != "agent two" {
+		t.Errorf("Unexpected agents %v: %v", agents, err)
+	}
+	agents, _ = UserAgentList(path, true)
+	if len(agents) != 2+len(BrowserAgents) {
+		t.Errorf("Expected browser agents to be added, got %d", len(agents))
+	}
+	if agents, _ := UserAgentList("", false); len(agents) != 0 {
+		t.Errorf("Expected no agents, got %v", agents)
+	}
+	if _, err := UserAgentList(filepath.Join(t.TempDir(), "missing"), false); err == nil {
+		t.Error("Expected error for missing file.")
+	}
+}
+
+func TestPCFSetRequestTemplate(t *testing.T) {
+	fac, _ := NewProxyClientFactory([]string{}, time.Second, "")
+	if err := fac.SetRequestTemplate([]string{"X-Token: FUZZ", "Accept: a, b"}, "", "", "id=FUZZ"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	c := fac.Get().(*httpClient)
+	if c.Header.Get("X-Token") != "FUZZ" || c.Header.Get("Accept") != "a, b" || c.Body != "id=FUZZ" {
+		t.Errorf("Request template not applied to client: %v %q", c.Header, c.Body)
+	}
+	for _, bad := range []string{"no colon", ": no name"} {
+		if err := fac.SetRequestTemplate([]string{bad}, "", "", ""); err == nil {
+			t.Errorf("Expected error for header %q", bad)
+		}
+	}
+	for _, bad := range []string{"GET /", "GE(T", "PUT\x00", "M\u00c9THODE"} {
+		if err := fac.SetRequestTemplate(nil, bad, "", ""); err == nil {
+			t.Errorf("Expected error for method %q", bad)
+		}
+	}
+	if err := fac.SetRequestTemplate(nil, "put", "application/json", `{"q":"FUZZ"}`); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if c := fac.Get().(*httpClient); c.Method != "PUT" || c.ContentType != "application/json" {
+		t.Errorf("Expected PUT of application/json, got %s of %s", c.Method, c.ContentType)
+	}
+}
@@ -19,6 +19,7 @@ package mock
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"github.com/Matir/webborer/client"
 	"io/ioutil"
@@ -69,6 +70,13 @@ func (c *MockClient) RequestURL(u *url.URL) (*http.Response, error) {
 	return r, nil
 }
 
+func (c *MockClient) RequestURLContext(ctx context.Context, u *url.URL) (*http.Response, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return c.RequestURL(u)
+}
+
 func (c *MockClient) SetCheckRedirect(f func(*http.Request, []*http.Request) error) {
 	c.CheckRedirect = f
 }
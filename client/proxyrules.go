@@ -0,0 +1,108 @@
+// Copyright 2017 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"fmt"
+	"h12.me/socks"
+	"net"
+	"net/url"
+	"path"
+	"strings"
+)
+
+// Dial function as used by http.Transport
+type dialFunc func(network, addr string) (net.Conn, error)
+
+// A ProxyRule routes connections to hosts matching Pattern through a proxy.
+// Pattern is either a hostname glob (e.g. "*.internal.corp") or a CIDR network
+// (e.g. "10.0.0.0/8") matched against literal IP addresses.  A nil Proxy means
+// connect directly.
+type ProxyRule struct {
+	Pattern string
+	Proxy   *url.URL
+	network *net.IPNet
+	dial    dialFunc
+}
+
+// Parse a rule of the form pattern=proxy, where proxy is a SOCKS proxy URL or
+// "direct".
+func ParseProxyRule(rule string) (*ProxyRule, error) {
+	pieces := strings.SplitN(rule, "=", 2)
+	if len(pieces) != 2 || strings.TrimSpace(pieces[0]) == "" {
+		return nil, fmt.Errorf("Invalid proxy rule, expected pattern=proxy: %s", rule)
+	}
+	r := &ProxyRule{Pattern: strings.ToLower(strings.TrimSpace(pieces[0]))}
+	if _, err := path.Match(r.Pattern, ""); err != nil {
+		return nil, fmt.Errorf("Invalid pattern in proxy rule %s: %s", rule, err.Error())
+	}
+	if _, network, err := net.ParseCIDR(r.Pattern); err == nil {
+		r.network = network
+	}
+	proxy := strings.TrimSpace(pieces[1])
+	if strings.ToLower(proxy) == "direct" {
+		r.dial = (&net.Dialer{}).Dial
+		return r, nil
+	}
+	u, err := parseProxyURL(proxy)
+	if err != nil {
+		return nil, err
+	}
+	r.Proxy = u
+	r.dial = socks.DialSocksProxy(proxyTypeMap[u.Scheme], u.Host)
+	return r, nil
+}
+
+// Check if the rule applies to host, which should not include a port.
+func (r *ProxyRule) Matches(host string) bool {
+	host = strings.ToLower(strings.Trim(host, "[]"))
+	if r.network != nil {
+		ip := net.ParseIP(host)
+		return ip != nil && r.network.Contains(ip)
+	}
+	matched, _ := path.Match(r.Pattern, host)
+	return matched
+}
+
+// A ruleDialer dials through the first matching rule, or the fallback if no
+// rule matches.  Rules are matched against the requested host, before it is
+// replaced by its override in resolve, if any.
+type ruleDialer struct {
+	rules    []*ProxyRule
+	resolve  map[string]string
+	fallback dialFunc
+}
+
+func (d *ruleDialer) ruleFor(host string) *ProxyRule {
+	for _, r := range d.rules {
+		if r.Matches(host) {
+			return r
+		}
+	}
+	return nil
+}
+
+func (d *ruleDialer) Dial(network, addr string) (net.Conn, error) {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		host = addr
+	}
+	r := d.ruleFor(host)
+	addr = resolveAddr(d.resolve, addr)
+	if r != nil {
+		return r.dial(network, addr)
+	}
+	return d.fallback(network, addr)
+}
@@ -0,0 +1,143 @@
+// Copyright 2017 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"errors"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestParseProxyRule(t *testing.T) {
+	r, err := ParseProxyRule("*.internal.corp=socks5://pivot:1080")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if r.Pattern != "*.internal.corp" || r.Proxy == nil || r.Proxy.Host != "pivot:1080" {
+		t.Errorf("Unexpected rule: %+v", r)
+	}
+	if r, err := ParseProxyRule("10.0.0.0/8=direct"); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	} else if r.Proxy != nil || r.network == nil {
+		t.Errorf("Expected direct network rule: %+v", r)
+	}
+	for _, bad := range []string{
+		"*.corp",
+		"=direct",
+		"*.corp=http://proxy:8080",
+		"*.corp=socks5://",
+		"[a-=direct",
+	} {
+		if _, err := ParseProxyRule(bad); err == nil {
+			t.Errorf("Expected error parsing %s", bad)
+		}
+	}
+}
+
+func TestProxyRule_Matches(t *testing.T) {
+	glob, _ := ParseProxyRule("*.Internal.Corp=direct")
+	cidr, _ := ParseProxyRule("10.0.0.0/8=direct")
+	v6, _ := ParseProxyRule("fd00::/8=direct")
+	cases := []struct {
+		rule    *ProxyRule
+		host    string
+		matches bool
+	}{
+		{glob, "app.internal.corp", true},
+		{glob, "APP.INTERNAL.CORP", true},
+		{glob, "a.b.internal.corp", true},
+		{glob, "internal.corp", false},
+		{glob, "www.example.com", false},
+		{cidr, "10.1.2.3", true},
+		{cidr, "192.168.1.1", false},
+		{cidr, "ten.example.com", false},
+		{v6, "[fd00::1]", true},
+		{v6, "2001:db8::1", false},
+	}
+	for _, c := range cases {
+		if got := c.rule.Matches(c.host); got != c.matches {
+			t.Errorf("%s matching %s: expected %v, got %v", c.rule.Pattern, c.host, c.matches, got)
+		}
+	}
+}
+
+func TestRuleDialer_Dial(t *testing.T) {
+	var used string
+	dialer := func(name string) dialFunc {
+		return func(network, addr string) (net.Conn, error) {
+			used = name
+			return nil, errors.New("not connecting")
+		}
+	}
+	corp, _ := ParseProxyRule("*.corp=socks5://pivot:1080")
+	corp.dial = dialer("pivot")
+	direct, _ := ParseProxyRule("*.example.corp=direct")
+	direct.dial = dialer("direct")
+	d := &ruleDialer{rules: []*ProxyRule{corp, direct}, fallback: dialer("fallback")}
+	cases := map[string]string{
+		"app.corp:80":         "pivot",
+		"www.example.corp:80": "pivot",
+		"www.example.com:443": "fallback",
+	}
+	for addr, expected := range cases {
+		used = ""
+		d.Dial("tcp", addr)
+		if used != expected {
+			t.Errorf("Dialing %s: expected %s, got %s", addr, expected, used)
+		}
+	}
+}
+
+func TestRuleDialer_Resolve(t *testing.T) {
+	var used, dialed string
+	dialer := func(name string) dialFunc {
+		return func(network, addr string) (net.Conn, error) {
+			used, dialed = name, addr
+			return nil, errors.New("not connecting")
+		}
+	}
+	corp, _ := ParseProxyRule("*.internal.corp=socks5://pivot:1080")
+	corp.dial = dialer("pivot")
+	d := &ruleDialer{
+		rules:    []*ProxyRule{corp},
+		resolve:  map[string]string{"app.internal.corp": "10.0.0.5", "www.example.com": "203.0.113.5"},
+		fallback: dialer("fallback"),
+	}
+	d.Dial("tcp", "app.internal.corp:443")
+	if used != "pivot" || dialed != "10.0.0.5:443" {
+		t.Errorf("Expected pivot to 10.0.0.5:443, got %s to %s", used, dialed)
+	}
+	d.Dial("tcp", "www.example.com:80")
+	if used != "fallback" || dialed != "203.0.113.5:80" {
+		t.Errorf("Expected fallback to 203.0.113.5:80, got %s to %s", used, dialed)
+	}
+}
+
+func TestPCFSetProxyRules(t *testing.T) {
+	fac, _ := NewProxyClientFactory([]string{}, time.Nanosecond, "")
+	if err := fac.SetProxyRules([]string{"*.corp=socks5://pivot:1080", ""}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(fac.rules) != 1 {
+		t.Errorf("Expected 1 rule, got %d", len(fac.rules))
+	}
+	if cli := fac.Get(); cli == nil {
+		t.Errorf("Got nil client with proxy rules.")
+	}
+	if err := fac.SetProxyRules([]string{"bogus"}); err == nil {
+		t.Errorf("Expected error for invalid rule.")
+	}
+}
@@ -0,0 +1,169 @@
+// Copyright 2017 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/Matir/webborer/logging"
+	"github.com/Matir/webborer/storage"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httputil"
+	"sync"
+	"time"
+)
+
+// Most of each response body to write to the request log
+const requestLogBodySize = 64 * 1024
+
+const requestLogRule = "======================================================"
+
+// A RequestLog records each request sent and the response to it in the text
+// format of Burp Suite's proxy log, so they can be pasted into Burp Repeater
+// or replayed with tools that read the format, such as sqlmap -l.  Responses
+// are logged with as much of the body as was read, up to requestLogBodySize,
+// decoded from any gzip or deflate Content-Encoding.  Bodies in other
+// encodings are logged as received, with their Content-Encoding header.
+type RequestLog struct {
+	w    io.WriteCloser
+	lock sync.Mutex
+}
+
+// Create a RequestLog writing to the file or storage URL at path.
+func NewRequestLog(path string) (*RequestLog, error) {
+	fp, err := storage.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	return &RequestLog{w: fp}, nil
+}
+
+// Wrap a transport so that its requests are logged.
+func (l *RequestLog) Transport(base http.RoundTripper) http.RoundTripper {
+	return &loggingTransport{base: base, log: l}
+}
+
+// Write one request and response.  resp is empty if there was no response.
+func (l *RequestLog) write(when time.Time, req *http.Request, reqDump, resp []byte) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	port := req.URL.Port()
+	if port == "" {
+		port = "80"
+		if req.URL.Scheme == "https" {
+			port = "443"
+		}
+	}
+	fmt.Fprintf(l.w, "%s\n%s  %s://%s:%s\n%s\n", requestLogRule, when.Format("3:04:05 PM"), req.URL.Scheme, req.URL.Hostname(), port, requestLogRule)
+	l.w.Write(reqDump)
+	fmt.Fprintf(l.w, "\n%s\n", requestLogRule)
+	if len(resp) > 0 {
+		l.w.Write(resp)
+		fmt.Fprintf(l.w, "\n%s\n", requestLogRule)
+	}
+	io.WriteString(l.w, "\n\n\n")
+}
+
+// Close the log, which for remote storage is when it is uploaded.
+func (l *RequestLog) Close() error {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	return l.w.Close()
+}
+
+type loggingTransport struct {
+	base http.RoundTripper
+	log  *RequestLog
+}
+
+func (t *loggingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	when := time.Now()
+	reqDump, err := httputil.DumpRequestOut(req, true)
+	if err != nil {
+		logging.Logf(logging.LogDebug, "Unable to log request for %s: %s", req.URL.String(), err.Error())
+		return t.base.RoundTrip(req)
+	}
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		t.log.write(when, req, reqDump, nil)
+		return resp, err
+	}
+	// The client removes the encoding headers as it decodes the body, so the
+	// headers as received are kept for the log
+	logged := *resp
+	logged.Header = resp.Header.Clone()
+	// The entry is written once the body has been read as far as it will be
+	resp.Body = &loggedBody{ReadCloser: resp.Body, done: func(body []byte) {
+		body = decodeLoggedBody(&logged, body)
+		head, err := httputil.DumpResponse(&logged, false)
+		if err != nil {
+			t.log.write(when, req, reqDump, nil)
+			return
+		}
+		t.log.write(when, req, reqDump, append(head, body...))
+	}}
+	return resp, nil
+}
+
+// Decode the start of a body in resp's Content-Encoding, if it can be,
+// removing the headers that describe the encoding from resp.  Only as much as
+// can be decoded from the start is returned.
+func decodeLoggedBody(resp *http.Response, body []byte) []byte {
+	if resp.Header.Get("Content-Encoding") == "" {
+		return body
+	}
+	fake := &http.Response{Header: resp.Header.Clone(), Body: ioutil.NopCloser(bytes.NewReader(body))}
+	b := decodeBody(fake)
+	if b.Undecoded {
+		return body
+	}
+	decoded, _ := ioutil.ReadAll(b)
+	if len(decoded) == 0 && len(body) > 0 {
+		return body
+	}
+	resp.Header = fake.Header
+	resp.ContentLength = -1
+	return decoded
+}
+
+// A response body that keeps the start of what is read from it, to be logged
+// when it is closed.
+type loggedBody struct {
+	io.ReadCloser
+	buf  bytes.Buffer
+	done func([]byte)
+	once sync.Once
+}
+
+func (b *loggedBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if room := requestLogBodySize - b.buf.Len(); room > 0 && n > 0 {
+		if n < room {
+			room = n
+		}
+		b.buf.Write(p[:room])
+	}
+	return n, err
+}
+
+func (b *loggedBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(func() {
+		b.done(b.buf.Bytes())
+	})
+	return err
+}
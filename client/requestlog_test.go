@@ -0,0 +1,109 @@
+// Copyright 2017 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"compress/gzip"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRequestLog(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Test", "yes")
+		w.Write([]byte("hello"))
+	}))
+	defer server.Close()
+	dir, err := ioutil.TempDir("", "webborer-requestlog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "requests.log")
+	log, err := NewRequestLog(path)
+	if err != nil {
+		t.Fatalf("Unable to create request log: %v", err)
+	}
+	fac, _ := NewProxyClientFactory(nil, 5*time.Second, "webborer-test")
+	fac.SetRequestLog(log)
+	u, _ := url.Parse(server.URL + "/admin?x=1")
+	resp, err := fac.Get().RequestURL(u)
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err := log.Close(); err != nil {
+		t.Fatalf("Unable to close request log: %v", err)
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	logged := string(data)
+	for _, want := range []string{
+		requestLogRule + "\n",
+		"  http://" + server.Listener.Addr().String() + "\n",
+		"GET /admin?x=1 HTTP/1.1\r\n",
+		"User-Agent: webborer-test\r\n",
+		"HTTP/1.1 200 OK\r\n",
+		"X-Test: yes\r\n",
+		"\r\nhello\n" + requestLogRule,
+	} {
+		if !strings.Contains(logged, want) {
+			t.Errorf("Expected log to contain %q, got:\n%s", want, logged)
+		}
+	}
+}
+
+func TestRequestLog_Gzip(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Encoding", "gzip")
+		zw := gzip.NewWriter(w)
+		zw.Write([]byte("compressed hello"))
+		zw.Close()
+	}))
+	defer server.Close()
+	path := filepath.Join(t.TempDir(), "requests.log")
+	log, err := NewRequestLog(path)
+	if err != nil {
+		t.Fatalf("Unable to create request log: %v", err)
+	}
+	fac, _ := NewProxyClientFactory(nil, 5*time.Second, "webborer-test")
+	fac.SetRequestLog(log)
+	u, _ := url.Parse(server.URL + "/")
+	resp, err := fac.Get().RequestURL(u)
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	log.Close()
+	data, _ := ioutil.ReadFile(path)
+	logged := string(data)
+	if !strings.Contains(logged, "\r\ncompressed hello\n") {
+		t.Errorf("Expected decoded body in log, got:\n%s", logged)
+	}
+	if strings.Contains(logged, "Content-Encoding") {
+		t.Errorf("Expected encoding headers to be removed, got:\n%s", logged)
+	}
+}
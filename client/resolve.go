@@ -0,0 +1,93 @@
+// Copyright 2017 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"context"
+	"fmt"
+	"github.com/Matir/webborer/util"
+	"net"
+	"net/url"
+	"strings"
+)
+
+// Dial function with a context, as used by http.Transport.DialContext
+type DialContextFunc func(ctx context.Context, network, addr string) (net.Conn, error)
+
+// Parse -resolve overrides of the form host:ip into a map of lowercased host
+// to IP address.  IPv6 addresses may be bracketed or not.
+func ParseResolveOverrides(overrides []string) (map[string]string, error) {
+	hosts := make(map[string]string)
+	for _, o := range overrides {
+		if strings.TrimSpace(o) == "" {
+			continue
+		}
+		pieces := strings.SplitN(o, ":", 2)
+		host := strings.ToLower(strings.TrimSpace(pieces[0]))
+		if len(pieces) != 2 || host == "" {
+			return nil, fmt.Errorf("Invalid resolve override, expected host:ip: %s", o)
+		}
+		ip := net.ParseIP(strings.Trim(strings.TrimSpace(pieces[1]), "[]"))
+		if ip == nil {
+			return nil, fmt.Errorf("Invalid IP address in resolve override: %s", o)
+		}
+		hosts[host] = ip.String()
+	}
+	return hosts, nil
+}
+
+// A resolveDialer connects to the overridden address for hosts it has one
+// for.  The request URL keeps the hostname, so the Host header and TLS SNI
+// are unchanged.
+type resolveDialer struct {
+	hosts map[string]string
+	dial  DialContextFunc
+}
+
+func (d *resolveDialer) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	return d.dial(ctx, network, resolveAddr(d.hosts, addr))
+}
+
+// The address to connect to for addr, with the host replaced by its override
+// in hosts, if any.
+func resolveAddr(hosts map[string]string, addr string) string {
+	if host, port, err := net.SplitHostPort(addr); err == nil {
+		if ip, ok := hosts[strings.ToLower(host)]; ok {
+			return net.JoinHostPort(ip, port)
+		}
+	}
+	return addr
+}
+
+// Adapt a dial function that can't be cancelled, such as a SOCKS dialer.
+func withContext(dial dialFunc) DialContextFunc {
+	return func(_ context.Context, network, addr string) (net.Conn, error) {
+		return dial(network, addr)
+	}
+}
+
+// The server name to send in TLS SNI for a Host header overriding the URL's
+// host, or empty if there is none or it varies per request.
+func serverNameForHost(host string) string {
+	if host == "" || strings.Contains(host, util.FuzzMarker) {
+		return ""
+	}
+	name := (&url.URL{Host: host}).Hostname()
+	if net.ParseIP(name) != nil {
+		// SNI is never sent for IP addresses
+		return ""
+	}
+	return name
+}
@@ -0,0 +1,152 @@
+// Copyright 2017 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseResolveOverrides(t *testing.T) {
+	hosts, err := ParseResolveOverrides([]string{"WWW.example.com:203.0.113.5", "v6.example.com:[2001:db8::1]", "raw.example.com:2001:db8::2", ""})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := map[string]string{
+		"www.example.com": "203.0.113.5",
+		"v6.example.com":  "2001:db8::1",
+		"raw.example.com": "2001:db8::2",
+	}
+	if !reflect.DeepEqual(hosts, expected) {
+		t.Errorf("Expected %v, got %v", expected, hosts)
+	}
+	for _, bad := range []string{"example.com", ":1.2.3.4", "example.com:nothere"} {
+		if _, err := ParseResolveOverrides([]string{bad}); err == nil {
+			t.Errorf("Expected error parsing %s", bad)
+		}
+	}
+}
+
+func TestResolveDialer(t *testing.T) {
+	var dialed []string
+	d := &resolveDialer{
+		hosts: map[string]string{"www.example.com": "2001:db8::1"},
+		dial: func(_ context.Context, network, addr string) (net.Conn, error) {
+			dialed = append(dialed, addr)
+			return nil, nil
+		},
+	}
+	d.DialContext(context.Background(), "tcp", "WWW.example.com:443")
+	d.DialContext(context.Background(), "tcp", "other.example.com:80")
+	expected := []string{"[2001:db8::1]:443", "other.example.com:80"}
+	if !reflect.DeepEqual(dialed, expected) {
+		t.Errorf("Expected %v, got %v", expected, dialed)
+	}
+}
+
+func TestServerNameForHost(t *testing.T) {
+	cases := map[string]string{
+		"":                    "",
+		"www.example.com":     "www.example.com",
+		"www.example.com:443": "www.example.com",
+		"203.0.113.5":         "",
+		"[2001:db8::1]:8443":  "",
+		"FUZZ.example.com":    "",
+	}
+	for host, expected := range cases {
+		if got := serverNameForHost(host); got != expected {
+			t.Errorf("%q: expected %q, got %q", host, expected, got)
+		}
+	}
+}
+
+func TestPCFGet_Resolve(t *testing.T) {
+	var host string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host = r.Host
+	}))
+	defer server.Close()
+	addr, _ := url.Parse(server.URL)
+	fac, _ := NewProxyClientFactory(nil, 5*time.Second, "")
+	if err := fac.SetResolveOverrides([]string{"www.example.invalid:" + addr.Hostname()}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	target := &url.URL{Scheme: "http", Host: "www.example.invalid:" + addr.Port(), Path: "/"}
+	resp, err := fac.Get().RequestURL(target)
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	resp.Body.Close()
+	if host != target.Host {
+		t.Errorf("Expected Host %s, got %s", target.Host, host)
+	}
+}
+
+func TestPCFGet_IPv6(t *testing.T) {
+	l, err := net.Listen("tcp", "[::1]:0")
+	if err != nil {
+		t.Skipf("IPv6 loopback unavailable: %v", err)
+	}
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	server.Listener = l
+	server.Start()
+	defer server.Close()
+	target, _ := url.Parse(server.URL + "/")
+	if target.Hostname() != "::1" {
+		t.Fatalf("Unexpected server URL %s", server.URL)
+	}
+	fac, _ := NewProxyClientFactory(nil, 5*time.Second, "")
+	resp, err := fac.Get().RequestURL(target)
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != 200 {
+		t.Errorf("Expected 200, got %d", resp.StatusCode)
+	}
+}
+
+func TestPCFGet_HostHeaderSNI(t *testing.T) {
+	sni := make(chan string, 1)
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	server.TLS = &tls.Config{GetConfigForClient: func(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+		sni <- hello.ServerName
+		return nil, nil
+	}}
+	server.StartTLS()
+	defer server.Close()
+	target, _ := url.Parse(server.URL + "/")
+	fac, _ := NewProxyClientFactory(nil, 5*time.Second, "")
+	fac.SetRequestTemplate([]string{"Host: www.example.com"}, "", "", "")
+	// The test certificate isn't trusted, so only the handshake matters
+	fac.Get().RequestURL(target)
+	select {
+	case name := <-sni:
+		if name != "www.example.com" {
+			t.Errorf("Expected SNI www.example.com, got %q", name)
+		}
+	default:
+		t.Error("No TLS handshake seen.")
+	}
+}
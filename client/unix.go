@@ -0,0 +1,39 @@
+// Copyright 2017 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"context"
+	"net"
+	"strings"
+)
+
+// A unixDialer connects to a Unix socket for hosts that stand for one, and
+// dials anything else as usual.
+type unixDialer struct {
+	sockets map[string]string
+	dial    DialContextFunc
+}
+
+func (d *unixDialer) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		host = addr
+	}
+	if socket, ok := d.sockets[strings.ToLower(host)]; ok {
+		return (&net.Dialer{}).DialContext(ctx, "unix", socket)
+	}
+	return d.dial(ctx, network, addr)
+}
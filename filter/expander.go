@@ -15,10 +15,14 @@
 package filter
 
 import (
+	"context"
+	"github.com/Matir/webborer/logging"
 	"github.com/Matir/webborer/util"
+	"github.com/Matir/webborer/wordlist"
 	"github.com/Matir/webborer/workqueue"
 	"net/url"
 	"strings"
+	"sync"
 )
 
 // An Expander is responsible for taking input URLs and expanding them to
@@ -26,14 +30,40 @@ import (
 type Expander struct {
 	// List of words to expand
 	Wordlist *[]string
+	// Words streamed from disk after those in Wordlist, if set
+	Stream *wordlist.Stream
 	// Function to count new instances
 	Adder workqueue.QueueAddCount
+	// Function to adjust the estimate of instances still to be counted, for
+	// progress reporting of streamed words
+	Estimate workqueue.QueueAddCount
+	// Substitute each word for FUZZ in the URLs instead of extending them
+	Fuzz bool
+	// Also carry each word as the payload of its task (see util.WithPayload),
+	// for FUZZ in headers or the request body
+	FuzzRequest bool
+	// URLs expanded so far, so added words can be applied to them
+	bases []*url.URL
+	// Words added while running, waiting to be picked up by Expand
+	added     [][]string
+	addedLock sync.Mutex
+	notify    chan bool
+	once      sync.Once
 }
 
 // Update the wordlist to contain directory & non-directory entries
 func (e *Expander) ProcessWordlist() {
+	if e.Fuzz {
+		// Words are values, not path entries
+		return
+	}
+	newList := processWords(*e.Wordlist)
+	e.Wordlist = &newList
+}
+
+func processWords(words []string) []string {
 	newList := make([]string, 0)
-	for _, w := range *e.Wordlist {
+	for _, w := range words {
 		newList = append(newList, w)
 		if strings.Contains(w, ".") {
 			continue
@@ -43,17 +73,83 @@ func (e *Expander) ProcessWordlist() {
 		}
 		newList = append(newList, w+"/")
 	}
-	e.Wordlist = &newList
+	return newList
+}
+
+// Add words to the wordlist of a running expansion.  The new words are used
+// for URLs already expanded as well as those still to come.
+func (E *Expander) AddWords(words ...string) {
+	words = nonEmpty(words)
+	if !E.Fuzz {
+		words = processWords(words)
+	}
+	if len(words) == 0 {
+		return
+	}
+	E.addedLock.Lock()
+	E.added = append(E.added, words)
+	E.addedLock.Unlock()
+	select {
+	case E.getNotify() <- true:
+	default:
+	}
 }
 
-func (E *Expander) Expand(in <-chan *url.URL) <-chan *url.URL {
+func (E *Expander) getNotify() chan bool {
+	E.once.Do(func() {
+		E.notify = make(chan bool, 1)
+	})
+	return E.notify
+}
+
+// Expand each URL from in into itself followed by the URL extended with each
+// word of the wordlist.  Expansions for different hosts are interleaved in
+// round-robin order, while each host's expansions are emitted in the order
+// they were received.
+func (E *Expander) Expand(ctx context.Context, in <-chan *url.URL) <-chan *url.URL {
 	out := make(chan *url.URL, cap(in))
+	notify := E.getNotify()
 	go func() {
-		for e := range in {
-			out <- e
-			E.Adder(len(*E.Wordlist))
-			for _, word := range *E.Wordlist {
-				out <- ExtendURL(e, word)
+		pending := &expansionRing{hosts: make(map[string][]*expansion), extend: ExtendURL}
+		if E.Fuzz {
+			pending.extend = E.fuzzURL
+		}
+		for in != nil || !pending.empty() {
+			if ctx.Err() != nil {
+				// Stop expanding, but let the input finish
+				if in != nil {
+					for range in {
+					}
+				}
+				break
+			}
+			if pending.empty() {
+				select {
+				case e, ok := <-in:
+					if !ok {
+						in = nil
+						continue
+					}
+					E.start(pending, e)
+				case <-notify:
+					E.startAdded(pending)
+				}
+				continue
+			}
+			select {
+			case e, ok := <-in:
+				if !ok {
+					in = nil
+					continue
+				}
+				E.start(pending, e)
+			case <-notify:
+				E.startAdded(pending)
+			default:
+				select {
+				case out <- pending.next():
+				case <-ctx.Done():
+				}
 			}
 		}
 		close(out)
@@ -62,12 +158,253 @@ func (E *Expander) Expand(in <-chan *url.URL) <-chan *url.URL {
 	return out
 }
 
+func (E *Expander) start(pending *expansionRing, u *url.URL) {
+	E.bases = append(E.bases, u)
+	if E.Stream != nil {
+		E.startStream(pending, u)
+		return
+	}
+	if E.Fuzz && len(*E.Wordlist) > 0 {
+		// The template itself takes the place of the first word
+		E.Adder(len(*E.Wordlist) - 1)
+		pending.add(&expansion{base: u, pos: 0, words: *E.Wordlist})
+		return
+	}
+	E.Adder(len(*E.Wordlist))
+	pending.add(&expansion{base: u, pos: -1, words: *E.Wordlist})
+}
+
+// Start expanding u with the wordlist followed by the stream.  Streamed words
+// are counted as they are read, one word ahead of those handed out, so the
+// work count never runs out early; until the stream is opened, one count
+// stands in for all of it.
+func (E *Expander) startStream(pending *expansionRing, u *url.URL) {
+	e := &expansion{base: u, pos: -1, words: *E.Wordlist, stream: E.Stream, count: E.Adder, estimate: E.Estimate}
+	n := len(e.words) + 1
+	if E.Fuzz {
+		// The template itself takes the place of the first word
+		e.pos = 0
+		n--
+	} else {
+		e.process = true
+	}
+	E.Adder(n)
+	if E.Estimate != nil {
+		if est := E.streamEstimate() - 1; est > 0 {
+			e.estimated = est
+			E.Estimate(est)
+		}
+	}
+	pending.add(e)
+}
+
+// Estimated number of URLs from the stream for each base
+func (E *Expander) streamEstimate() int {
+	if E.Fuzz {
+		return E.Stream.Estimate()
+	}
+	sample := E.Stream.Sample()
+	return E.Stream.Estimate() * len(processWords(sample)) / len(sample)
+}
+
+// Substitute word for FUZZ in a template URL.
+func (E *Expander) fuzzURL(template *url.URL, word string) *url.URL {
+	u := util.FuzzURL(template, word)
+	if E.FuzzRequest {
+		return util.WithPayload(u, word)
+	}
+	return u
+}
+
+// Expand the URLs seen so far with any added words, and use the added words
+// for future URLs.
+func (E *Expander) startAdded(pending *expansionRing) {
+	E.addedLock.Lock()
+	added := E.added
+	E.added = nil
+	E.addedLock.Unlock()
+	for _, words := range added {
+		wl := append(append([]string{}, *E.Wordlist...), words...)
+		E.Wordlist = &wl
+		for _, u := range E.bases {
+			E.Adder(len(words))
+			pending.add(&expansion{base: u, pos: 0, words: words})
+		}
+	}
+}
+
+// Progress of expanding a single URL with words.  A pos of -1 means the base
+// URL has not yet been emitted.
+type expansion struct {
+	base  *url.URL
+	pos   int
+	words []string
+	// Words to stream once words are used up, if any.  The stream is opened
+	// when it is reached, and the next word is read ahead.
+	stream  *wordlist.Stream
+	iter    *wordlist.Iterator
+	peek    string
+	hasPeek bool
+	// Add directory variants of streamed words
+	process bool
+	// Words read ahead but not yet used, from processing a streamed word
+	queued []string
+	// Count each streamed word after the first, and adjust the estimate of
+	// those still to come
+	count     workqueue.QueueAddCount
+	estimate  workqueue.QueueAddCount
+	estimated int
+}
+
+// The next URL, and whether the expansion is finished.
+func (e *expansion) next(extend func(*url.URL, string) *url.URL) (*url.URL, bool) {
+	var u *url.URL
+	switch {
+	case e.pos < 0:
+		// Later stages may modify the URL, so don't hand out the base itself
+		base := *e.base
+		u = &base
+		e.pos++
+	case e.pos < len(e.words):
+		u = extend(e.base, e.words[e.pos])
+		e.pos++
+	default:
+		if e.iter == nil && !e.openStream() {
+			// The count held for the stream has to be used up, and a repeat of
+			// the base is dropped by the filter
+			base := *e.base
+			return &base, true
+		}
+		u = extend(e.base, e.peek)
+		e.readAhead(true)
+	}
+	return u, e.finished()
+}
+
+func (e *expansion) finished() bool {
+	if e.pos < len(e.words) {
+		return false
+	}
+	if e.stream == nil {
+		return true
+	}
+	return e.iter != nil && !e.hasPeek
+}
+
+// Open the stream and read its first word, which was counted when the
+// expansion started.
+func (e *expansion) openStream() bool {
+	iter, err := e.stream.Iter()
+	if err != nil {
+		logging.Logf(logging.LogWarning, "Unable to read wordlist: %s", err.Error())
+		e.stream = nil
+		return false
+	}
+	e.iter = iter
+	e.readAhead(false)
+	if !e.hasPeek {
+		e.stream = nil
+		return false
+	}
+	return true
+}
+
+// Read the next streamed word into peek, counting it if count is set.
+func (e *expansion) readAhead(count bool) {
+	if len(e.queued) == 0 {
+		w, ok := e.iter.Next()
+		if !ok {
+			e.hasPeek = false
+			e.iter.Close()
+			if e.estimate != nil && e.estimated != 0 {
+				e.estimate(-e.estimated)
+				e.estimated = 0
+			}
+			return
+		}
+		if e.process {
+			e.queued = processWords([]string{w})
+		} else {
+			e.queued = []string{w}
+		}
+	}
+	e.peek, e.queued = e.queued[0], e.queued[1:]
+	e.hasPeek = true
+	if !count {
+		return
+	}
+	e.count(1)
+	if e.estimate != nil && e.estimated > 0 {
+		e.estimate(-1)
+		e.estimated--
+	}
+}
+
+// Set of in-progress expansions, grouped by host.
+type expansionRing struct {
+	hosts map[string][]*expansion
+	ring  []string
+	idx   int
+	// Build the URL for a base and word
+	extend func(*url.URL, string) *url.URL
+}
+
+func (r *expansionRing) empty() bool {
+	return len(r.ring) == 0
+}
+
+func (r *expansionRing) add(e *expansion) {
+	host := e.base.Host
+	if _, ok := r.hosts[host]; !ok {
+		r.ring = append(r.ring, host)
+	}
+	r.hosts[host] = append(r.hosts[host], e)
+}
+
+// Get the next URL from the next host's current expansion.
+func (r *expansionRing) next() *url.URL {
+	host := r.ring[r.idx]
+	e := r.hosts[host][0]
+	u, finished := e.next(r.extend)
+	if finished {
+		if len(r.hosts[host]) == 1 {
+			delete(r.hosts, host)
+			r.ring = append(r.ring[:r.idx], r.ring[r.idx+1:]...)
+			if r.idx >= len(r.ring) {
+				r.idx = 0
+			}
+			return u
+		}
+		r.hosts[host] = r.hosts[host][1:]
+	}
+	r.idx = (r.idx + 1) % len(r.ring)
+	return u
+}
+
+// Extend the path of u with tail.  A tail containing percent-encoding (such as
+// from an encoded wordlist variant) is sent as-is rather than encoded again.
 func ExtendURL(u *url.URL, tail string) *url.URL {
 	extended := *u
 	if !util.URLIsDir(u) {
-		extended.Path += "/" + tail
-	} else {
-		extended.Path += tail
+		tail = "/" + tail
+	}
+	if strings.Contains(tail, "%") {
+		if unescaped, err := url.PathUnescape(tail); err == nil {
+			extended.RawPath = u.EscapedPath() + tail
+			extended.Path += unescaped
+			return &extended
+		}
 	}
+	extended.Path += tail
 	return &extended
 }
+
+func nonEmpty(words []string) []string {
+	res := make([]string, 0, len(words))
+	for _, w := range words {
+		if w = strings.TrimSpace(w); w != "" {
+			res = append(res, w)
+		}
+	}
+	return res
+}
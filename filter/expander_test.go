@@ -15,7 +15,12 @@
 package filter
 
 import (
+	"context"
+	"github.com/Matir/webborer/wordlist"
+	"io/ioutil"
 	"net/url"
+	"os"
+	"reflect"
 	"testing"
 )
 
@@ -44,7 +49,7 @@ func TestExpand(t *testing.T) {
 		ch <- &url.URL{Path: p}
 	}
 	close(ch)
-	res := expander.Expand(ch)
+	res := expander.Expand(context.Background(), ch)
 	for _, exp := range expected {
 		if item, ok := <-res; ok {
 			if exp != item.Path {
@@ -58,3 +63,179 @@ func TestExpand(t *testing.T) {
 		t.Errorf("Expected closed channel, read an item!")
 	}
 }
+
+func TestExpand_Interleaved(t *testing.T) {
+	wl := []string{"a", "b"}
+	expander := &Expander{Wordlist: &wl, Adder: func(_ int) {}}
+	ch := make(chan *url.URL, 5)
+	ch <- &url.URL{Host: "one", Path: "/"}
+	ch <- &url.URL{Host: "two", Path: "/"}
+	close(ch)
+	expected := []string{"one/", "two/", "one/a", "two/a", "one/b", "two/b"}
+	res := expander.Expand(context.Background(), ch)
+	var got []string
+	for item := range res {
+		got = append(got, item.Host+item.Path)
+	}
+	if len(got) != len(expected) {
+		t.Fatalf("Expected %v, got %v", expected, got)
+	}
+	for i := range expected {
+		if got[i] != expected[i] {
+			t.Errorf("Expected %v, got %v", expected, got)
+			break
+		}
+	}
+}
+
+func TestExpand_Fuzz(t *testing.T) {
+	wl := []string{"1", "a b"}
+	var count int
+	expander := &Expander{Wordlist: &wl, Adder: func(n int) { count += n }, Fuzz: true}
+	expander.ProcessWordlist()
+	ch := make(chan *url.URL, 2)
+	template, _ := url.Parse("http://localhost/item?id=FUZZ")
+	ch <- template
+	close(ch)
+	expected := []string{"http://localhost/item?id=1", "http://localhost/item?id=a+b"}
+	var got []string
+	for item := range expander.Expand(context.Background(), ch) {
+		got = append(got, item.String())
+	}
+	if len(got) != len(expected) || got[0] != expected[0] || got[1] != expected[1] {
+		t.Errorf("Expected %v, got %v", expected, got)
+	}
+	// The template was counted by the queue and is replaced by the first word
+	if count != 1 {
+		t.Errorf("Expected count of 1, got %d", count)
+	}
+}
+
+func TestExpand_FuzzRequest(t *testing.T) {
+	wl := []string{"x"}
+	expander := &Expander{Wordlist: &wl, Adder: func(int) {}, Fuzz: true, FuzzRequest: true}
+	ch := make(chan *url.URL, 1)
+	ch <- &url.URL{Scheme: "http", Host: "localhost", Path: "/api"}
+	close(ch)
+	for item := range expander.Expand(context.Background(), ch) {
+		if item.String() != "http://localhost/api#x" {
+			t.Errorf("Expected word in fragment, got %s", item.String())
+		}
+	}
+}
+
+func TestExtendURL(t *testing.T) {
+	cases := []struct {
+		base, tail, expected string
+	}{
+		{"http://localhost/", "admin", "http://localhost/admin"},
+		{"http://localhost/a", "b c", "http://localhost/a/b%20c"},
+		{"http://localhost/a/", "%61%2E%62", "http://localhost/a/%61%2E%62"},
+		{"http://localhost/a%20b/", "%2e%2e", "http://localhost/a%20b/%2e%2e"},
+		{"http://localhost/", "100%", "http://localhost/100%25"},
+	}
+	for _, c := range cases {
+		base, _ := url.Parse(c.base)
+		if got := ExtendURL(base, c.tail).String(); got != c.expected {
+			t.Errorf("ExtendURL(%s, %s): expected %s, got %s", c.base, c.tail, c.expected, got)
+		}
+	}
+}
+
+func TestExpander_AddWords(t *testing.T) {
+	wl := []string{"a"}
+	var count int
+	expander := &Expander{Wordlist: &wl, Adder: func(n int) { count += n }}
+	ch := make(chan *url.URL)
+	res := expander.Expand(context.Background(), ch)
+	read := func(expected ...string) {
+		for _, exp := range expected {
+			if item := <-res; item.Path != exp {
+				t.Errorf("Expected %s, got %s.", exp, item.Path)
+			}
+		}
+	}
+	ch <- &url.URL{Path: "/x/"}
+	read("/x/", "/x/a")
+	expander.AddWords("b", " ", "c.txt")
+	read("/x/b", "/x/b/", "/x/c.txt")
+	ch <- &url.URL{Path: "/y/"}
+	read("/y/", "/y/a", "/y/b", "/y/b/", "/y/c.txt")
+	close(ch)
+	if _, ok := <-res; ok {
+		t.Error("Expected closed channel, read an item!")
+	}
+	if count != 1+3+4 {
+		t.Errorf("Expected 8 expansions counted, got %d", count)
+	}
+}
+
+func streamFile(t *testing.T, contents string) (*wordlist.Stream, func()) {
+	fp, err := ioutil.TempFile("", "expander")
+	if err != nil {
+		t.Fatalf("Unable to create wordlist: %v", err)
+	}
+	fp.WriteString(contents)
+	fp.Close()
+	stream, err := wordlist.OpenStream(fp.Name(), nil)
+	if err != nil {
+		t.Fatalf("Unable to open stream: %v", err)
+	}
+	return stream, func() { os.Remove(fp.Name()) }
+}
+
+func TestExpand_Stream(t *testing.T) {
+	stream, cleanup := streamFile(t, "b\nc.txt\n")
+	defer cleanup()
+	wl := []string{"a.php"}
+	var count, estimate int
+	expander := &Expander{
+		Wordlist: &wl,
+		Stream:   stream,
+		Adder:    func(n int) { count += n },
+		Estimate: func(n int) { estimate += n },
+	}
+	expander.ProcessWordlist()
+	ch := make(chan *url.URL, 2)
+	ch <- &url.URL{Path: "/x/"}
+	ch <- &url.URL{Path: "/y/"}
+	close(ch)
+	var got []string
+	for item := range expander.Expand(context.Background(), ch) {
+		got = append(got, item.Path)
+	}
+	expected := []string{"/x/", "/x/a.php", "/x/b", "/x/b/", "/x/c.txt", "/y/", "/y/a.php", "/y/b", "/y/b/", "/y/c.txt"}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected %v, got %v", expected, got)
+	}
+	// Base URLs are counted when they are queued
+	if count != len(expected)-2 {
+		t.Errorf("Expected %d expansions counted, got %d", len(expected)-2, count)
+	}
+	if estimate != 0 {
+		t.Errorf("Expected estimate to be used up, got %d", estimate)
+	}
+}
+
+func TestExpand_StreamFuzz(t *testing.T) {
+	stream, cleanup := streamFile(t, "1\n2\n")
+	defer cleanup()
+	wl := []string{}
+	var count int
+	expander := &Expander{Wordlist: &wl, Stream: stream, Adder: func(n int) { count += n }, Fuzz: true}
+	ch := make(chan *url.URL, 1)
+	template, _ := url.Parse("http://localhost/item?id=FUZZ")
+	ch <- template
+	close(ch)
+	var got []string
+	for item := range expander.Expand(context.Background(), ch) {
+		got = append(got, item.RawQuery)
+	}
+	if !reflect.DeepEqual(got, []string{"id=1", "id=2"}) {
+		t.Errorf("Unexpected expansions: %v", got)
+	}
+	// The template's own count covers the first word
+	if count != 1 {
+		t.Errorf("Expected 1 expansion counted, got %d", count)
+	}
+}
@@ -21,10 +21,13 @@ import (
 	"github.com/Matir/webborer/client"
 	"github.com/Matir/webborer/logging"
 	"github.com/Matir/webborer/robots"
+	"github.com/Matir/webborer/scope"
 	ss "github.com/Matir/webborer/settings"
 	"github.com/Matir/webborer/util"
 	"github.com/Matir/webborer/workqueue"
 	"net/url"
+	"sync"
+	"sync/atomic"
 )
 
 // WorkFilter is responsible for making sure that a given URL is only tested
@@ -34,21 +37,50 @@ type WorkFilter struct {
 	done     map[string]bool
 	settings *ss.ScanSettings
 	// Excluded paths
-	exclusions []*url.URL
+	exclusions []*exclusion
+	// Exclusions added with FilterURL or SetScopeRules, kept when the exclude
+	// paths change
+	added []*exclusion
+	// Protects exclusions, which may be changed while running
+	lock sync.RWMutex
 	// Count the work that has been dropped
 	counter workqueue.QueueDoneFunc
+	// Payloads carry fuzzed words (see util.WithPayload), so they
+	// distinguish tasks
+	keepPayload bool
+}
+
+// An Exclusion describes a path that was excluded from the scan.
+type Exclusion struct {
+	// URL prefix that was excluded
+	URL string `json:"url"`
+	// Why it was excluded
+	Reason string `json:"reason"`
+	// Number of URLs skipped because of this exclusion
+	Skipped int64 `json:"skipped"`
+}
+
+// Reasons for exclusions
+const (
+	ExcludedBySettings = "exclude-path"
+	ExcludedByRobots   = "robots"
+	ExcludedByFilter   = "filter"
+	ExcludedByScope    = "scope-rule"
+)
+
+type exclusion struct {
+	u *url.URL
+	// Scope rule to match instead of u
+	rule   *scope.Rule
+	reason string
+	// Accessed atomically
+	skipped int64
 }
 
 func NewWorkFilter(settings *ss.ScanSettings, counter workqueue.QueueDoneFunc) *WorkFilter {
 	wf := &WorkFilter{done: make(map[string]bool), settings: settings, counter: counter}
-	wf.exclusions = make([]*url.URL, 0, len(settings.ExcludePaths))
-	for _, path := range settings.ExcludePaths {
-		if u, err := url.Parse(path); err != nil {
-			logging.Logf(logging.LogError, "Unable to parse exclusion path: %s (%s)", path, err.Error())
-		} else {
-			wf.FilterURL(u)
-		}
-	}
+	wf.exclusions = parseExcludePaths(settings.ExcludePaths)
+	wf.keepPayload = settings.FuzzRequest()
 	return wf
 }
 
@@ -56,21 +88,21 @@ func NewWorkFilter(settings *ss.ScanSettings, counter workqueue.QueueDoneFunc) *
 func (f *WorkFilter) RunFilter(src <-chan *url.URL) <-chan *url.URL {
 	c := make(chan *url.URL, f.settings.QueueSize)
 	go func() {
-	taskLoop:
 		for task := range src {
-		  // Fragment is irrelevant for requests to server
-		  task.Fragment = ""
+			// The fragment is irrelevant for requests to server, unless it
+			// is the payload of a task
+			if !f.keepPayload {
+				task = util.WithoutPayload(task)
+			}
 			taskURL := task.String()
 			if _, ok := f.done[taskURL]; ok {
 				f.reject(task, "already done")
 				continue
 			}
 			f.done[taskURL] = true
-			for _, exclusion := range f.exclusions {
-				if util.URLIsSubpath(exclusion, task) {
-					f.reject(task, "excluded")
-					continue taskLoop
-				}
+			if f.excluded(task) {
+				f.reject(task, "excluded")
+				continue
 			}
 			c <- task
 		}
@@ -79,9 +111,90 @@ func (f *WorkFilter) RunFilter(src <-chan *url.URL) <-chan *url.URL {
 	return c
 }
 
+// Mark a URL as already done, so it won't be tried.  Must be called before
+// RunFilter.
+func (f *WorkFilter) MarkDone(u *url.URL) {
+	if !f.keepPayload {
+		u = util.WithoutPayload(u)
+	}
+	f.done[u.String()] = true
+}
+
 // Add another URL to filter
 func (f *WorkFilter) FilterURL(u *url.URL) {
-	f.exclusions = append(f.exclusions, u)
+	f.addExclusion(u, ExcludedByFilter)
+}
+
+// Exclude URLs matching the exclude rules of rules, replacing those of any
+// earlier rules.  This may be done while the filter is running.
+func (f *WorkFilter) SetScopeRules(rules *scope.Rules) {
+	var ruled []*exclusion
+	if rules != nil {
+		for _, r := range rules.Exclude {
+			ruled = append(ruled, &exclusion{rule: r, reason: ExcludedByScope})
+		}
+	}
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.exclusions = append(withoutScopeRules(f.exclusions), ruled...)
+	f.added = append(withoutScopeRules(f.added), ruled...)
+}
+
+func withoutScopeRules(exclusions []*exclusion) []*exclusion {
+	res := make([]*exclusion, 0, len(exclusions))
+	for _, e := range exclusions {
+		if e.reason != ExcludedByScope {
+			res = append(res, e)
+		}
+	}
+	return res
+}
+
+func (f *WorkFilter) addExclusion(u *url.URL, reason string) {
+	f.add(&exclusion{u: u, reason: reason})
+}
+
+func (f *WorkFilter) add(e *exclusion) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.exclusions = append(f.exclusions, e)
+	f.added = append(f.added, e)
+}
+
+// All of the current exclusions, and how many URLs each caused to be skipped.
+func (f *WorkFilter) Exclusions() []Exclusion {
+	f.lock.RLock()
+	defer f.lock.RUnlock()
+	res := make([]Exclusion, 0, len(f.exclusions))
+	for _, e := range f.exclusions {
+		res = append(res, Exclusion{
+			URL:     e.String(),
+			Reason:  e.reason,
+			Skipped: atomic.LoadInt64(&e.skipped),
+		})
+	}
+	return res
+}
+
+// Replace the exclusions from the settings with paths.  This may be done
+// while the filter is running, and applies to URLs not yet filtered.
+func (f *WorkFilter) SetExcludePaths(paths []string) {
+	exclusions := parseExcludePaths(paths)
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.exclusions = append(exclusions, f.added...)
+}
+
+func (f *WorkFilter) excluded(u *url.URL) bool {
+	f.lock.RLock()
+	defer f.lock.RUnlock()
+	for _, e := range f.exclusions {
+		if e.match(u) {
+			atomic.AddInt64(&e.skipped, 1)
+			return true
+		}
+	}
+	return false
 }
 
 // Filter data from robots.txt
@@ -96,14 +209,40 @@ func (f *WorkFilter) AddRobotsFilter(scope []*url.URL, clientFactory client.Clie
 				disallowedURL := *scopeURL
 				disallowedURL.Path = disallowed
 				logging.Logf(logging.LogDebug, "Disallowing URL by robots: %s", &disallowedURL)
-				f.FilterURL(&disallowedURL)
+				f.addExclusion(&disallowedURL, ExcludedByRobots)
 			}
 		}
 	}
 }
 
+func (e *exclusion) match(u *url.URL) bool {
+	if e.rule != nil {
+		return e.rule.Match(u)
+	}
+	return util.URLIsSubpath(e.u, u)
+}
+
+func (e *exclusion) String() string {
+	if e.rule != nil {
+		return e.rule.String()
+	}
+	return e.u.String()
+}
+
 // Task that can't be used, but should be counted as terminated.
 func (f *WorkFilter) reject(u *url.URL, reason string) {
 	logging.Logf(logging.LogDebug, "Filter rejected %s: %s.", u.String(), reason)
 	f.counter(1)
 }
+
+func parseExcludePaths(paths []string) []*exclusion {
+	exclusions := make([]*exclusion, 0, len(paths))
+	for _, path := range paths {
+		if u, err := url.Parse(path); err != nil {
+			logging.Logf(logging.LogError, "Unable to parse exclusion path: %s (%s)", path, err.Error())
+		} else {
+			exclusions = append(exclusions, &exclusion{u: u, reason: ExcludedBySettings})
+		}
+	}
+	return exclusions
+}
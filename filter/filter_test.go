@@ -16,6 +16,7 @@ package filter
 
 import (
 	"github.com/Matir/webborer/client/mock"
+	"github.com/Matir/webborer/scope"
 	"github.com/Matir/webborer/settings"
 	"net/url"
 	"testing"
@@ -105,3 +106,88 @@ func TestRobotsFilter_Fail(t *testing.T) {
 		t.Errorf("Expected no exclusions, got %d", len(wf.exclusions))
 	}
 }
+
+func TestFilterSetExcludePaths(t *testing.T) {
+	ss := &settings.ScanSettings{
+		ExcludePaths: []string{"/a"},
+	}
+	filter := NewWorkFilter(ss, func(_ int) {})
+	filter.FilterURL(&url.URL{Path: "/robots"})
+	filter.SetExcludePaths([]string{"/b"})
+	cases := map[string]bool{
+		"/a":      false,
+		"/b/c":    true,
+		"/robots": true,
+		"/d":      false,
+	}
+	for p, expected := range cases {
+		if excluded := filter.excluded(&url.URL{Path: p}); excluded != expected {
+			t.Errorf("Expected excluded(%s) = %v, got %v", p, expected, excluded)
+		}
+	}
+}
+
+func TestFilterExclusions(t *testing.T) {
+	ss := &settings.ScanSettings{
+		ExcludePaths: []string{"/a"},
+	}
+	filter := NewWorkFilter(ss, func(_ int) {})
+	filter.FilterURL(&url.URL{Path: "/b"})
+	for _, p := range []string{"/a/1", "/a/2", "/c"} {
+		filter.excluded(&url.URL{Path: p})
+	}
+	exclusions := filter.Exclusions()
+	expected := []Exclusion{
+		{URL: "/a", Reason: ExcludedBySettings, Skipped: 2},
+		{URL: "/b", Reason: ExcludedByFilter, Skipped: 0},
+	}
+	if len(exclusions) != len(expected) {
+		t.Fatalf("Expected %d exclusions, got %v", len(expected), exclusions)
+	}
+	for i, e := range expected {
+		if exclusions[i] != e {
+			t.Errorf("Expected %+v, got %+v", e, exclusions[i])
+		}
+	}
+}
+
+func TestFilterScopeRules(t *testing.T) {
+	filter := NewWorkFilter(&settings.ScanSettings{}, func(_ int) {})
+	rules, err := scope.NewRules(nil, []string{"path:/logout", "regex:delete"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	filter.SetScopeRules(rules)
+	// Rules survive reloading the exclude paths
+	filter.SetExcludePaths([]string{"/x"})
+	for p, excluded := range map[string]bool{
+		"/logout":        true,
+		"/logout.php":    true,
+		"/user/delete/1": true,
+		"/login":         false,
+	} {
+		if filter.excluded(&url.URL{Path: p}) != excluded {
+			t.Errorf("Expected %s excluded to be %v", p, excluded)
+		}
+	}
+	exclusions := filter.Exclusions()
+	if len(exclusions) != 3 || exclusions[1].URL != "path:/logout" ||
+		exclusions[1].Reason != ExcludedByScope || exclusions[1].Skipped != 2 {
+		t.Errorf("Unexpected exclusions: %+v", exclusions)
+	}
+	// New rules replace the old ones
+	rules, err = scope.NewRules(nil, []string{"path:/login"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	filter.SetScopeRules(rules)
+	if filter.excluded(&url.URL{Path: "/logout"}) {
+		t.Error("Expected /logout no longer excluded.")
+	}
+	if !filter.excluded(&url.URL{Path: "/login"}) {
+		t.Error("Expected /login excluded.")
+	}
+	if exclusions := filter.Exclusions(); len(exclusions) != 2 {
+		t.Errorf("Unexpected exclusions: %+v", exclusions)
+	}
+}
@@ -0,0 +1,299 @@
+// Copyright 2017 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package fingerprint identifies the software a web server runs, so a scan
+// can try the extensions and paths that stack uses instead of guessing.
+package fingerprint
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"github.com/Matir/webborer/client"
+	"github.com/Matir/webborer/logging"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// Only the start of each probe response is examined
+const maxProbeSize = 256 * 1024
+
+// A Technology is a server-side stack that can be recognized, along with the
+// extensions and built-in wordlist that suit it.
+type Technology struct {
+	Name string
+	// Extensions to mangle with when the stack is found
+	Extensions []string
+	// Built-in wordlist of paths common to the stack, if there is one
+	Wordlist string
+}
+
+// Recognized technologies, by name
+var Technologies = map[string]*Technology{
+	"php":       {Name: "php", Extensions: []string{"php"}, Wordlist: "php"},
+	"wordpress": {Name: "wordpress", Extensions: []string{"php"}, Wordlist: "wordpress"},
+	"aspnet":    {Name: "aspnet", Extensions: []string{"aspx", "asp", "ashx", "asmx"}, Wordlist: "aspnet"},
+	"java":      {Name: "java", Extensions: []string{"jsp", "do", "action"}, Wordlist: "java"},
+	"python":    {Name: "python", Wordlist: "python"},
+	"node":      {Name: "node", Wordlist: "node"},
+	"rails":     {Name: "rails", Wordlist: "rails"},
+}
+
+// A headerSignature recognizes a technology by a substring of a header
+type headerSignature struct {
+	header string
+	value  string
+	tech   string
+}
+
+var headerSignatures = []headerSignature{
+	{"X-Powered-By", "php", "php"},
+	{"X-Powered-By", "asp.net", "aspnet"},
+	{"X-AspNet-Version", "", "aspnet"},
+	{"X-AspNetMvc-Version", "", "aspnet"},
+	{"X-Powered-By", "servlet", "java"},
+	{"X-Powered-By", "jsp", "java"},
+	{"Server", "apache-coyote", "java"},
+	{"Server", "tomcat", "java"},
+	{"Server", "jetty", "java"},
+	{"Server", "microsoft-iis", "aspnet"},
+	{"Server", "gunicorn", "python"},
+	{"Server", "werkzeug", "python"},
+	{"Server", "uvicorn", "python"},
+	{"X-Powered-By", "express", "node"},
+	{"X-Powered-By", "next.js", "node"},
+	{"Server", "phusion passenger", "rails"},
+	{"X-Runtime", "", "rails"},
+	{"X-Pingback", "xmlrpc.php", "wordpress"},
+}
+
+// Session cookies set by each stack's default configuration
+var cookieSignatures = map[string]string{
+	"phpsessid":             "php",
+	"laravel_session":       "php",
+	"asp.net_sessionid":     "aspnet",
+	".aspxauth":             "aspnet",
+	"aspsessionid":          "aspnet",
+	"jsessionid":            "java",
+	"csrftoken":             "python",
+	"connect.sid":           "node",
+	"_rails_session":        "rails",
+	"wordpress_test_cookie": "wordpress",
+}
+
+// MD5 hashes of default favicons
+var faviconSignatures = map[string]string{
+	"4644f2d45601037b8423d45e13194c93": "java", // Apache Tomcat
+	"0488faca4c19046b94d07c3ee83cf9d6": "java", // Spring Boot
+}
+
+// Strings in the home page left by a stack
+var bodySignatures = map[string]string{
+	"/wp-content/":        "wordpress",
+	"/wp-includes/":       "wordpress",
+	"__viewstate":         "aspnet",
+	"csrfmiddlewaretoken": "python",
+	"csrf-param":          "rails",
+}
+
+// Paths that only exist on a stack, checked against a made-up path with the
+// same extension so that servers answering everything with 200 don't match
+var pathSignatures = []struct {
+	path string
+	tech string
+}{
+	{"/wp-login.php", "wordpress"},
+	{"/index.php", "php"},
+	{"/default.aspx", "aspnet"},
+	{"/index.jsp", "java"},
+}
+
+// A Fingerprint lists the technologies found on a target, and how each was
+// recognized.
+type Fingerprint struct {
+	Target       *url.URL
+	Technologies []string
+	// Evidence for each technology, e.g. "cookie PHPSESSID"
+	Evidence map[string][]string
+}
+
+func newFingerprint(target *url.URL) *Fingerprint {
+	return &Fingerprint{Target: target, Evidence: make(map[string][]string)}
+}
+
+func (f *Fingerprint) add(tech, evidence string) {
+	if _, ok := f.Evidence[tech]; !ok {
+		f.Technologies = append(f.Technologies, tech)
+	}
+	f.Evidence[tech] = append(f.Evidence[tech], evidence)
+}
+
+// Extensions used by the technologies found, without duplicates.
+func (f *Fingerprint) Extensions() []string {
+	return Extensions(f.Technologies)
+}
+
+func (f *Fingerprint) String() string {
+	pieces := make([]string, 0, len(f.Technologies))
+	for _, t := range f.Technologies {
+		pieces = append(pieces, fmt.Sprintf("%s (%s)", t, strings.Join(f.Evidence[t], ", ")))
+	}
+	return strings.Join(pieces, "; ")
+}
+
+// Extensions used by the named technologies, without duplicates.
+func Extensions(techs []string) []string {
+	seen := make(map[string]bool)
+	exts := make([]string, 0)
+	for _, name := range techs {
+		t, ok := Technologies[name]
+		if !ok {
+			continue
+		}
+		for _, ext := range t.Extensions {
+			if !seen[ext] {
+				seen[ext] = true
+				exts = append(exts, ext)
+			}
+		}
+	}
+	return exts
+}
+
+// Built-in wordlists for the named technologies.
+func Wordlists(techs []string) []string {
+	lists := make([]string, 0)
+	for _, name := range techs {
+		if t, ok := Technologies[name]; ok && t.Wordlist != "" {
+			lists = append(lists, t.Wordlist)
+		}
+	}
+	sort.Strings(lists)
+	return lists
+}
+
+// Probe target to see what it runs: the headers, cookies and body of its home
+// page, its favicon, and a few paths specific to each stack.  Requests that
+// fail are skipped, so the result may be empty but is never nil.
+func Probe(target *url.URL, factory client.ClientFactory) *Fingerprint {
+	c := factory.Get()
+	f := newFingerprint(target)
+	resolve := func(path string) *url.URL {
+		ref, _ := url.Parse(path)
+		return target.ResolveReference(ref)
+	}
+
+	if resp, body, err := fetch(c, target); err == nil {
+		checkHeaders(f, resp.Header)
+		checkCookies(f, resp.Cookies())
+		checkBody(f, body)
+	} else {
+		logging.Logf(logging.LogInfo, "Unable to fingerprint %s: %s", target.String(), err.Error())
+		return f
+	}
+
+	if resp, body, err := fetch(c, resolve("/favicon.ico")); err == nil && resp.StatusCode == http.StatusOK {
+		sum := md5.Sum(body)
+		hash := hex.EncodeToString(sum[:])
+		logging.Logf(logging.LogDebug, "Favicon hash for %s: %s", target.String(), hash)
+		if tech, ok := faviconSignatures[hash]; ok {
+			f.add(tech, "favicon "+hash)
+		}
+	}
+
+	// Status of a path that shouldn't exist, for each extension
+	controls := make(map[string]int)
+	for _, sig := range pathSignatures {
+		ext := sig.path[strings.LastIndex(sig.path, "."):]
+		if _, ok := controls[ext]; !ok {
+			controls[ext] = status(c, resolve(fmt.Sprintf("/%x%s", rand.Int63(), ext)))
+		}
+		if controls[ext] == http.StatusOK {
+			continue
+		}
+		if status(c, resolve(sig.path)) == http.StatusOK {
+			f.add(sig.tech, "path "+sig.path)
+		}
+	}
+	// WordPress is written in PHP
+	if _, ok := f.Evidence["wordpress"]; ok {
+		if _, ok := f.Evidence["php"]; !ok {
+			f.add("php", "wordpress")
+		}
+	}
+	return f
+}
+
+func fetch(c client.Client, u *url.URL) (*http.Response, []byte, error) {
+	resp, err := c.RequestURL(u)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxProbeSize))
+	if err != nil {
+		return nil, nil, err
+	}
+	return resp, body, nil
+}
+
+// Status code for u, or 0 if the request fails
+func status(c client.Client, u *url.URL) int {
+	resp, _, err := fetch(c, u)
+	if err != nil {
+		return 0
+	}
+	return resp.StatusCode
+}
+
+func checkHeaders(f *Fingerprint, h http.Header) {
+	for _, sig := range headerSignatures {
+		v := h.Get(sig.header)
+		if v == "" || !strings.Contains(strings.ToLower(v), sig.value) {
+			continue
+		}
+		f.add(sig.tech, fmt.Sprintf("header %s: %s", sig.header, v))
+	}
+}
+
+func checkCookies(f *Fingerprint, cookies []*http.Cookie) {
+	for _, c := range cookies {
+		name := strings.ToLower(c.Name)
+		for prefix, tech := range cookieSignatures {
+			// Classic ASP appends a random suffix to the cookie name
+			if name == prefix || (prefix == "aspsessionid" && strings.HasPrefix(name, prefix)) {
+				f.add(tech, "cookie "+c.Name)
+			}
+		}
+	}
+}
+
+func checkBody(f *Fingerprint, body []byte) {
+	lower := strings.ToLower(string(body))
+	keys := make([]string, 0, len(bodySignatures))
+	for k := range bodySignatures {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		if strings.Contains(lower, k) {
+			f.add(bodySignatures[k], "page contains "+k)
+		}
+	}
+}
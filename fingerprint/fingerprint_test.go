@@ -0,0 +1,87 @@
+// Copyright 2017 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fingerprint
+
+import (
+	"github.com/Matir/webborer/scantest"
+	"net/http"
+	"net/url"
+	"reflect"
+	"testing"
+)
+
+func probeTarget(t *testing.T, target *scantest.Target) *Fingerprint {
+	u, _ := url.Parse("http://target.test/")
+	return Probe(u, scantest.NewClientFactory(target))
+}
+
+func TestProbe_Headers(t *testing.T) {
+	target := scantest.NewTarget().
+		Handle("/", scantest.Route{Body: "hi", Header: http.Header{
+			"X-Powered-By": {"ASP.NET"},
+			"Set-Cookie":   {"ASP.NET_SessionId=abc; path=/"},
+		}})
+	fp := probeTarget(t, target)
+	if !reflect.DeepEqual(fp.Technologies, []string{"aspnet"}) {
+		t.Fatalf("Expected aspnet, got %v", fp.Technologies)
+	}
+	expected := []string{"header X-Powered-By: ASP.NET", "cookie ASP.NET_SessionId"}
+	if !reflect.DeepEqual(fp.Evidence["aspnet"], expected) {
+		t.Errorf("Expected evidence %v, got %v", expected, fp.Evidence["aspnet"])
+	}
+	if !reflect.DeepEqual(fp.Extensions(), []string{"aspx", "asp", "ashx", "asmx"}) {
+		t.Errorf("Unexpected extensions: %v", fp.Extensions())
+	}
+}
+
+func TestProbe_Paths(t *testing.T) {
+	target := scantest.NewTarget().
+		Handle("/", scantest.Route{Body: `<link href="/wp-content/themes/x.css">`}).
+		Handle("/wp-login.php", scantest.Route{Body: "login"})
+	fp := probeTarget(t, target)
+	if !reflect.DeepEqual(fp.Technologies, []string{"wordpress", "php"}) {
+		t.Errorf("Expected wordpress and php, got %v", fp.Technologies)
+	}
+	if !reflect.DeepEqual(fp.Evidence["wordpress"], []string{"page contains /wp-content/", "path /wp-login.php"}) {
+		t.Errorf("Unexpected evidence: %v", fp.Evidence["wordpress"])
+	}
+	if !reflect.DeepEqual(Wordlists(fp.Technologies), []string{"php", "wordpress"}) {
+		t.Errorf("Unexpected wordlists: %v", Wordlists(fp.Technologies))
+	}
+}
+
+func TestProbe_SoftNotFound(t *testing.T) {
+	target := scantest.NewTarget()
+	target.SoftNotFound = true
+	fp := probeTarget(t, target)
+	if len(fp.Technologies) != 0 {
+		t.Errorf("Expected nothing recognized on a catch-all server, got %v", fp)
+	}
+}
+
+func TestProbe_Favicon(t *testing.T) {
+	target := scantest.NewTarget().
+		Handle("/", scantest.Route{Body: "hi"}).
+		Handle("/favicon.ico", scantest.Route{Body: "not a known icon", ContentType: "image/x-icon"})
+	if fp := probeTarget(t, target); len(fp.Technologies) != 0 {
+		t.Errorf("Expected unknown favicon not to match, got %v", fp)
+	}
+	faviconSignatures["dbc8d591d59d41d8f150fa6eabd24fcf"] = "java"
+	defer delete(faviconSignatures, "dbc8d591d59d41d8f150fa6eabd24fcf")
+	fp := probeTarget(t, target)
+	if !reflect.DeepEqual(fp.Evidence["java"], []string{"favicon dbc8d591d59d41d8f150fa6eabd24fcf"}) {
+		t.Errorf("Expected favicon to match, got %v", fp)
+	}
+}
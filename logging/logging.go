@@ -42,10 +42,14 @@ var LogLevelStrings = [...]string{
 var logLevel = LogWarning
 var defaultLogger = log.New(os.Stderr, "", log.Ldate|log.Ltime|log.Lshortfile)
 
+// Whether defaultLogger is writing to stderr (as opposed to a logfile)
+var loggingToStderr = true
+
 func ResetLog(logfilePath, logLevel string) {
 	if len(logfilePath) > 0 {
 		if fp, err := os.Create(logfilePath); err == nil {
 			defaultLogger = log.New(fp, "", log.Ldate|log.Ltime|log.Lshortfile)
+			loggingToStderr = false
 		} else {
 			Logf(LogError, "Unable to open logfile %s.", logfilePath)
 		}
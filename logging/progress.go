@@ -0,0 +1,219 @@
+// Copyright 2017 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logging
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	progressRefresh = 250 * time.Millisecond
+	// Weight given to the most recent sample when smoothing rates
+	progressSmoothing = 0.2
+)
+
+// Progress renders a single status line showing the amount of work completed,
+// the current request rate, and an estimate of the time remaining.  It is
+// intended to be written to stderr while results go to stdout, so anything
+// else writing to the console should go through ConsoleWriter so the status
+// line can be cleared first.
+type Progress struct {
+	out  io.Writer
+	lock sync.Mutex
+	// Work counts, as reported by the work counter
+	done  int64
+	total int64
+	// Source for the number of requests made
+	requests func() int64
+	// State for rate computations
+	lastTick time.Time
+	lastReqs int64
+	lastDone int64
+	reqRate  float64
+	doneRate float64
+	// Length of the line currently displayed
+	lineLen int
+	stop    chan bool
+	stopped chan bool
+}
+
+var activeProgress *Progress
+var activeProgressLock sync.Mutex
+
+// Start displaying progress on out.  requests may be nil, in which case the
+// rate of completed work is displayed instead of the request rate.
+func StartProgress(out io.Writer, requests func() int64) *Progress {
+	p := &Progress{
+		out:      out,
+		requests: requests,
+		lastTick: time.Now(),
+		stop:     make(chan bool),
+		stopped:  make(chan bool),
+	}
+	activeProgressLock.Lock()
+	activeProgress = p
+	activeProgressLock.Unlock()
+	if loggingToStderr {
+		defaultLogger.SetOutput(ConsoleWriter(os.Stderr))
+	}
+	go p.run()
+	return p
+}
+
+// Update the work counts.  Suitable for use as a WorkCounter status callback.
+func (p *Progress) Update(done, total int64) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.done = done
+	p.total = total
+}
+
+// Stop the display, leaving the final status line in place.
+func (p *Progress) Stop() {
+	p.stop <- true
+	<-p.stopped
+	activeProgressLock.Lock()
+	if activeProgress == p {
+		activeProgress = nil
+	}
+	activeProgressLock.Unlock()
+	if loggingToStderr {
+		defaultLogger.SetOutput(os.Stderr)
+	}
+}
+
+func (p *Progress) run() {
+	defer close(p.stopped)
+	ticker := time.NewTicker(progressRefresh)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-p.stop:
+			p.lock.Lock()
+			p.tick(time.Now())
+			p.draw()
+			fmt.Fprint(p.out, "\n")
+			p.lineLen = 0
+			p.lock.Unlock()
+			return
+		case now := <-ticker.C:
+			p.lock.Lock()
+			p.tick(now)
+			p.draw()
+			p.lock.Unlock()
+		}
+	}
+}
+
+// Update the smoothed rates.  Must be called with the lock held.
+func (p *Progress) tick(now time.Time) {
+	elapsed := now.Sub(p.lastTick).Seconds()
+	if elapsed <= 0 {
+		return
+	}
+	var reqs int64
+	if p.requests != nil {
+		reqs = p.requests()
+	}
+	p.reqRate = smoothRate(p.reqRate, float64(reqs-p.lastReqs)/elapsed)
+	p.doneRate = smoothRate(p.doneRate, float64(p.done-p.lastDone)/elapsed)
+	p.lastReqs = reqs
+	p.lastDone = p.done
+	p.lastTick = now
+}
+
+func smoothRate(old, sample float64) float64 {
+	if old == 0 {
+		return sample
+	}
+	return old*(1-progressSmoothing) + sample*progressSmoothing
+}
+
+// Draw the status line.  Must be called with the lock held.
+func (p *Progress) draw() {
+	line := p.String()
+	pad := ""
+	if len(line) < p.lineLen {
+		pad = strings.Repeat(" ", p.lineLen-len(line))
+	}
+	fmt.Fprintf(p.out, "\r%s%s", line, pad)
+	p.lineLen = len(line)
+}
+
+// Clear the status line.  Must be called with the lock held.
+func (p *Progress) clear() {
+	if p.lineLen == 0 {
+		return
+	}
+	fmt.Fprintf(p.out, "\r%s\r", strings.Repeat(" ", p.lineLen))
+	p.lineLen = 0
+}
+
+// Status line as it would be displayed.
+func (p *Progress) String() string {
+	var pct float64
+	if p.total > 0 {
+		pct = float64(p.done) * 100 / float64(p.total)
+	}
+	var rate string
+	if p.requests != nil {
+		rate = fmt.Sprintf("%.1f req/s", p.reqRate)
+	} else {
+		rate = fmt.Sprintf("%.1f tasks/s", p.doneRate)
+	}
+	return fmt.Sprintf("%d/%d (%.1f%%) %s ETA %s", p.done, p.total, pct, rate, p.eta())
+}
+
+// Estimated time remaining, based on the rate of completed work.
+func (p *Progress) eta() string {
+	remaining := p.total - p.done
+	if remaining <= 0 {
+		return "0s"
+	}
+	if p.doneRate <= 0 {
+		return "--"
+	}
+	eta := time.Duration(float64(remaining) / p.doneRate * float64(time.Second))
+	return eta.Round(time.Second).String()
+}
+
+type consoleWriter struct {
+	w io.Writer
+}
+
+// ConsoleWriter wraps a writer to the console so that any active progress
+// display is cleared before each write.  The status line is redrawn on the
+// next refresh.
+func ConsoleWriter(w io.Writer) io.Writer {
+	return &consoleWriter{w: w}
+}
+
+func (c *consoleWriter) Write(b []byte) (int, error) {
+	activeProgressLock.Lock()
+	p := activeProgress
+	activeProgressLock.Unlock()
+	if p == nil {
+		return c.w.Write(b)
+	}
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.clear()
+	return c.w.Write(b)
+}
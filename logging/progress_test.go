@@ -0,0 +1,85 @@
+// Copyright 2017 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logging
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestProgress_String(t *testing.T) {
+	p := &Progress{done: 50, total: 200, doneRate: 10}
+	s := p.String()
+	if !strings.HasPrefix(s, "50/200 (25.0%)") {
+		t.Errorf("Unexpected progress prefix: %s", s)
+	}
+	if !strings.HasSuffix(s, "ETA 15s") {
+		t.Errorf("Unexpected ETA: %s", s)
+	}
+	p = &Progress{done: 5, total: 10}
+	if !strings.HasSuffix(p.String(), "ETA --") {
+		t.Errorf("Expected unknown ETA with no rate: %s", p.String())
+	}
+}
+
+func TestProgress_Tick(t *testing.T) {
+	var reqs int64
+	start := time.Now()
+	p := &Progress{requests: func() int64 { return reqs }, lastTick: start}
+	reqs = 20
+	p.done = 4
+	p.tick(start.Add(2 * time.Second))
+	if p.reqRate != 10 {
+		t.Errorf("Expected 10 req/s, got %f", p.reqRate)
+	}
+	if p.doneRate != 2 {
+		t.Errorf("Expected 2 tasks/s, got %f", p.doneRate)
+	}
+}
+
+func TestProgress_StartStop(t *testing.T) {
+	nullLog()
+	buf := &bytes.Buffer{}
+	p := StartProgress(buf, nil)
+	p.Update(1, 2)
+	p.Stop()
+	if !strings.Contains(buf.String(), "1/2 (50.0%)") {
+		t.Errorf("Expected final status line, got %q", buf.String())
+	}
+	if activeProgress != nil {
+		t.Errorf("Expected no active progress after Stop.")
+	}
+}
+
+func TestConsoleWriter(t *testing.T) {
+	progBuf := &bytes.Buffer{}
+	outBuf := &bytes.Buffer{}
+	p := &Progress{out: progBuf, lineLen: 5}
+	activeProgress = p
+	defer func() { activeProgress = nil }()
+	w := ConsoleWriter(outBuf)
+	w.Write([]byte("result\n"))
+	if outBuf.String() != "result\n" {
+		t.Errorf("Expected write to pass through, got %q", outBuf.String())
+	}
+	if progBuf.String() != "\r     \r" {
+		t.Errorf("Expected status line to be cleared, got %q", progBuf.String())
+	}
+	if p.lineLen != 0 {
+		t.Errorf("Expected lineLen to be reset, got %d", p.lineLen)
+	}
+}
@@ -16,15 +16,18 @@
 package main
 
 import (
+	"context"
 	"github.com/Matir/webborer/client"
-	"github.com/Matir/webborer/filter"
 	"github.com/Matir/webborer/logging"
+	"github.com/Matir/webborer/plugins"
+	"github.com/Matir/webborer/remote"
 	"github.com/Matir/webborer/results"
+	"github.com/Matir/webborer/scanner"
 	ss "github.com/Matir/webborer/settings"
 	"github.com/Matir/webborer/util"
-	"github.com/Matir/webborer/wordlist"
 	"github.com/Matir/webborer/worker"
-	"github.com/Matir/webborer/workqueue"
+	"os"
+	"os/signal"
 	"runtime"
 )
 
@@ -33,7 +36,7 @@ func loadSettings() (*ss.ScanSettings, error) {
 	// Load scan settings
 	settings, err := ss.GetScanSettings()
 	if err != nil {
-		logging.Logf(logging.LogFatal, err.Error())
+		logging.Logf(logging.LogFatal, "%s", err.Error())
 		return nil, err
 	}
 	logging.ResetLog(settings.LogfilePath, settings.LogLevel)
@@ -41,14 +44,26 @@ func loadSettings() (*ss.ScanSettings, error) {
 	return settings, nil
 }
 
-// This is the main runner for webborer.
-// TODO: separate the actual scanning from all of the setup steps
+// Exit statuses, for running webborer as a CI gate.
+const (
+	exitOK = 0
+	// Setup failed, or the scan failed or was interrupted before finishing
+	exitError = 1
+	// There were findings with one of the -fail-on codes
+	exitFailOn = 3
+)
+
 func main() {
+	os.Exit(run())
+}
+
+// This is the main runner for webborer.  Returns the exit status.
+func run() int {
 	util.EnableStackTraces()
 
 	settings, err := loadSettings()
 	if err != nil {
-		return
+		return exitError
 	}
 
 	// Enable CPU profiling
@@ -61,85 +76,71 @@ func main() {
 	logging.Logf(logging.LogDebug, "Setting GOMAXPROCS to %d.", settings.Threads)
 	runtime.GOMAXPROCS(settings.Threads)
 
-	// Load wordlist
-	var words []string
-	words, err = wordlist.LoadWordlist(settings.WordlistPath)
+	loaded, err := plugins.LoadAll(settings.Plugins)
 	if err != nil {
-		logging.Logf(logging.LogFatal, "Unable to load wordlist: %s", err.Error())
-		return
+		logging.Logf(logging.LogFatal, "%s", err.Error())
+		return exitError
 	}
 
-	// Build an HTTP Client Factory
-	logging.Logf(logging.LogDebug, "Creating Client Factory...")
-	clientFactory, err := client.NewProxyClientFactory(settings.Proxies, settings.Timeout, settings.UserAgent)
-	if err != nil {
-		logging.Logf(logging.LogFatal, "Unable to build client factory: %s", err.Error())
-		return
+	if settings.Mode == ss.AgentMode {
+		if !runAgent(settings, loaded) {
+			return exitError
+		}
+		return exitOK
 	}
-	clientFactory.SetUsernamePassword(settings.HTTPUsername, settings.HTTPPassword)
 
-	// Starting point
-	scope, err := settings.GetScopes()
+	scan, err := scanner.New(settings)
 	if err != nil {
-		logging.Logf(logging.LogFatal, err.Error())
-		return
+		logging.Logf(logging.LogFatal, "Unable to setup scan: %s", err.Error())
+		return exitError
 	}
-
-	// Setup the main workqueue
-	logging.Logf(logging.LogDebug, "Starting work queue...")
-	queue := workqueue.NewWorkQueue(settings.QueueSize, scope, settings.AllowHTTPSUpgrade)
-	queue.RunInBackground()
-
-	logging.Logf(logging.LogDebug, "Creating expander and filter...")
-	expander := filter.Expander{Wordlist: &words, Adder: queue.GetAddCount()}
-	expander.ProcessWordlist()
-	filter := filter.NewWorkFilter(settings, queue.GetDoneFunc())
-
-	// Check robots mode
-	if settings.RobotsMode == ss.ObeyRobots {
-		filter.AddRobotsFilter(scope, clientFactory)
+	for _, p := range loaded {
+		scan.AddPlugin(p)
 	}
 
-	// filter paths after expansion
-	logging.Debugf("Starting expansion and filtering...")
-	work := filter.RunFilter(expander.Expand(queue.GetWorkChan()))
-
 	logging.Logf(logging.LogDebug, "Creating results manager...")
-	rchan := make(chan results.Result, settings.QueueSize)
 	resultsManager, err := results.GetResultsManager(settings)
 	if err != nil {
 		logging.Logf(logging.LogFatal, "Unable to start results manager: %s", err.Error())
-		return
+		return exitError
 	}
-
-	logging.Logf(logging.LogDebug, "Starting %d workers...", settings.Workers)
-	worker.StartWorkers(settings, clientFactory, work, queue.GetAddFunc(), queue.GetDoneFunc(), rchan)
-
+	summary := results.NewSummaryManager(settings)
+	resultsManager = results.NewTeeResultsManager(resultsManager, summary)
 	logging.Logf(logging.LogDebug, "Starting results manager...")
-	resultsManager.Run(rchan)
-
-	// Kick things off with the seed URL
-	logging.Logf(logging.LogDebug, "Adding starting URLs: %v", scope)
-	queue.AddURLs(scope...)
+	resultsManager.Run(scan.Results())
 
 	// Add a progress bar?
+	var progressStop func()
 	if settings.ProgressBar {
-		initProgressBar(queue.GetCounter())
+		progressStop = initProgressBar(scan)
 	}
 
-	// Potentially seed from robots
-	if settings.RobotsMode == ss.SeedRobots {
-		queue.SeedFromRobots(scope, clientFactory)
+	// Long-running coordinators can pick up changes to the config file
+	if settings.Mode == ss.ServeMode {
+		reloadStop := reloadOnSignal(scan)
+		defer reloadStop()
 	}
 
-	// Wait for work to be done
-	logging.Logf(logging.LogDebug, "Main goroutine waiting for work...")
-	queue.WaitPipe()
-	logging.Logf(logging.LogDebug, "Work done.")
+	// Words and targets can be fed to the scan while it runs
+	if settings.ControlStdin {
+		go scan.ReadControl(os.Stdin)
+	}
 
-	// Cleanup
-	queue.InputFinished()
-	close(rchan)
+	ctx, stop := interruptContext()
+	defer stop()
+	err = scan.Run(ctx)
+	if progressStop != nil {
+		progressStop()
+	}
+	if err == context.Canceled {
+		done, total := scan.Counter().Counts()
+		logging.Logf(logging.LogWarning, "Scan interrupted after %d requests with %d of %d tasks done.", scan.RequestCount(), done, total)
+		if settings.CheckpointPath != "" {
+			logging.Logf(logging.LogWarning, "Resume with -resume %s", settings.CheckpointPath)
+		}
+	} else if err != nil {
+		logging.Logf(logging.LogError, "Scan failed: %s", err.Error())
+	}
 
 	logging.Debugf("Waiting for results manager.")
 	resultsManager.Wait()
@@ -147,4 +148,75 @@ func main() {
 		cpuProfStop()
 	}
 	logging.Logf(logging.LogDebug, "Done!")
+	if summary.Summary().Failed() {
+		logging.Logf(logging.LogWarning, "Failing: %d findings with -fail-on codes %s.", len(summary.Summary().Failures), settings.FailOn.String())
+		return exitFailOn
+	}
+	if err != nil {
+		return exitError
+	}
+	return exitOK
+}
+
+// Perform work for a coordinator until the scan is finished.  Returns whether
+// it was successful.
+func runAgent(settings *ss.ScanSettings, loaded []worker.Plugin) bool {
+	logging.Logf(logging.LogDebug, "Connecting to coordinator at %s...", settings.CoordinatorURL)
+	agent, err := remote.NewAgent(settings)
+	if err != nil {
+		logging.Logf(logging.LogFatal, "Unable to start agent: %s", err.Error())
+		return false
+	}
+	for _, p := range loaded {
+		agent.AddPlugin(p)
+	}
+	var requestLog *client.RequestLog
+	if settings.RequestLogPath != "" {
+		requestLog, err = client.NewRequestLog(settings.RequestLogPath)
+		if err != nil {
+			logging.Logf(logging.LogFatal, "Unable to open request log: %s", err.Error())
+			return false
+		}
+		defer requestLog.Close()
+	}
+	// Rebuilt when the coordinator's settings change
+	newFactory := func(settings *ss.ScanSettings) (client.ClientFactory, error) {
+		factory, err := scanner.NewClientFactory(settings)
+		if err != nil {
+			return nil, err
+		}
+		if requestLog != nil {
+			factory.SetRequestLog(requestLog)
+		}
+		return factory, nil
+	}
+	ctx, stop := interruptContext()
+	defer stop()
+	if err := agent.Run(ctx, newFactory); err != nil && err != context.Canceled {
+		logging.Logf(logging.LogFatal, "Agent failed: %s", err.Error())
+		return false
+	}
+	logging.Logf(logging.LogDebug, "Done!")
+	return true
+}
+
+// Get a context that is cancelled on the first interrupt.  A second interrupt
+// kills the process as usual.
+func interruptContext() (context.Context, func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt)
+	go func() {
+		select {
+		case <-sigs:
+			logging.Logf(logging.LogWarning, "Interrupted, finishing up.  Interrupt again to quit immediately.")
+			signal.Stop(sigs)
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return ctx, func() {
+		signal.Stop(sigs)
+		cancel()
+	}
 }
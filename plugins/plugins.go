@@ -0,0 +1,66 @@
+// Copyright 2017 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package plugins loads webborer plugins from Go plugin files.  It is kept out
+// of the worker package so that only programs that load plugin files depend
+// on the plugin package.
+package plugins
+
+import (
+	"fmt"
+	"github.com/Matir/webborer/logging"
+	"github.com/Matir/webborer/worker"
+	"plugin"
+)
+
+// Load a Go plugin (built with -buildmode=plugin).  It must export a symbol
+// named Plugin, either a variable holding a worker.Plugin or a
+// func() worker.Plugin.
+func Load(path string) (worker.Plugin, error) {
+	lib, err := plugin.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	sym, err := lib.Lookup("Plugin")
+	if err != nil {
+		return nil, err
+	}
+	var p worker.Plugin
+	switch v := sym.(type) {
+	case *worker.Plugin:
+		p = *v
+	case func() worker.Plugin:
+		p = v()
+	case worker.Plugin:
+		p = v
+	}
+	if p == nil {
+		return nil, fmt.Errorf("Symbol Plugin in %s is a %T, not a worker.Plugin.", path, sym)
+	}
+	logging.Logf(logging.LogInfo, "Loaded plugin %s from %s.", p.Name(), path)
+	return p, nil
+}
+
+// Load each of the plugins at paths.
+func LoadAll(paths []string) ([]worker.Plugin, error) {
+	var loaded []worker.Plugin
+	for _, path := range paths {
+		p, err := Load(path)
+		if err != nil {
+			return nil, fmt.Errorf("Unable to load plugin %s: %s", path, err.Error())
+		}
+		loaded = append(loaded, p)
+	}
+	return loaded, nil
+}
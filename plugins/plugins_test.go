@@ -0,0 +1,34 @@
+// Copyright 2017 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package plugins
+
+import (
+	"testing"
+)
+
+func TestLoad_Missing(t *testing.T) {
+	if _, err := Load("/nonexistent/plugin.so"); err == nil {
+		t.Errorf("Expected error loading missing plugin.")
+	}
+}
+
+func TestLoadAll(t *testing.T) {
+	if loaded, err := LoadAll(nil); err != nil || len(loaded) != 0 {
+		t.Errorf("Expected no plugins, got %v, %v", loaded, err)
+	}
+	if _, err := LoadAll([]string{"/nonexistent/plugin.so"}); err == nil {
+		t.Errorf("Expected error loading missing plugin.")
+	}
+}
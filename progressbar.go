@@ -16,19 +16,19 @@
 package main
 
 import (
-	"github.com/Matir/webborer/workqueue"
-	"gopkg.in/cheggaaa/pb.v1"
+	"github.com/Matir/webborer/logging"
+	"github.com/Matir/webborer/scanner"
+	"os"
 )
 
-func initProgressBar(wc *workqueue.WorkCounter) {
-	bar := pb.New(1)
-	bar.ManualUpdate = true
-	bar.ShowTimeLeft = false
-	var callback = func(done, total int64) {
-		bar.Total = total
-		bar.Set64(done)
-		bar.Update()
+// Display the progress of scan on stderr, returning a function to stop the
+// display.
+func initProgressBar(scan *scanner.Scanner) func() {
+	wc := scan.Counter()
+	bar := logging.StartProgress(os.Stderr, scan.RequestCount)
+	wc.SetStatusCallback(bar.Update)
+	return func() {
+		wc.SetStatusCallback(nil)
+		bar.Stop()
 	}
-	wc.SetStatusCallback(callback)
-	bar.Start()
 }
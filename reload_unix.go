@@ -0,0 +1,45 @@
+// Copyright 2017 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Build constraints copied from go's src/os/dir_unix.go
+//go:build darwin || dragonfly || freebsd || linux || nacl || netbsd || openbsd || solaris
+// +build darwin dragonfly freebsd linux nacl netbsd openbsd solaris
+
+package main
+
+import (
+	"github.com/Matir/webborer/logging"
+	"github.com/Matir/webborer/scanner"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// Reload settings whenever SIGHUP is received, returning a function to stop.
+func reloadOnSignal(scan *scanner.Scanner) func() {
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGHUP)
+	go func() {
+		for range sigs {
+			logging.Logf(logging.LogInfo, "Received SIGHUP, reloading settings.")
+			if err := scan.Reload(); err != nil {
+				logging.Logf(logging.LogError, "Unable to reload settings: %s", err.Error())
+			}
+		}
+	}()
+	return func() {
+		signal.Stop(sigs)
+		close(sigs)
+	}
+}
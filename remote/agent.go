@@ -0,0 +1,375 @@
+// Copyright 2017 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package remote
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/Matir/webborer/client"
+	"github.com/Matir/webborer/logging"
+	"github.com/Matir/webborer/results"
+	"github.com/Matir/webborer/scope"
+	ss "github.com/Matir/webborer/settings"
+	"github.com/Matir/webborer/util"
+	"github.com/Matir/webborer/worker"
+	"github.com/Matir/webborer/workqueue"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// Reports are sent when this many tasks are complete...
+	reportBatchSize = 50
+	// ...or this much time has passed.
+	reportInterval = 500 * time.Millisecond
+	// Give up after this many consecutive errors talking to the coordinator
+	maxAgentErrors = 10
+	// Time to wait between retries
+	agentRetryDelay = 2 * time.Second
+)
+
+// A FactoryFunc builds the client factory for an agent's settings.  Most
+// settings are fixed once the factory is built, so it is called again whenever
+// the coordinator's settings change.
+type FactoryFunc func(*ss.ScanSettings) (client.ClientFactory, error)
+
+// Agent pulls tasks from a Coordinator, performs them with local workers, and
+// reports the results back.
+type Agent struct {
+	settings *ss.ScanSettings
+	base     *url.URL
+	http     *http.Client
+	// Completed tasks waiting to be reported
+	reports chan *taskReport
+	// Version of the coordinator's settings in use
+	version int
+	// Clients for the settings in use, and how to build them
+	factory      client.ClientFactory
+	newFactory   FactoryFunc
+	settingsLock sync.Mutex
+	// Plugins whose request and response hooks are added to each worker.
+	// Result hooks are run by the coordinator.
+	plugins []worker.Plugin
+}
+
+// Construct an Agent for the coordinator in settings.  The coordinator's scan
+// settings are fetched and applied to settings, so this should be done before
+// any clients are built.
+func NewAgent(settings *ss.ScanSettings) (*Agent, error) {
+	base, err := url.Parse(settings.CoordinatorURL)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to parse coordinator URL: %s", err.Error())
+	}
+	a := &Agent{
+		settings: settings,
+		base:     base,
+		http:     &http.Client{Timeout: 2*pollTimeout + settings.Timeout},
+		reports:  make(chan *taskReport, reportBatchSize),
+	}
+	var remote agentSettings
+	if err := a.call("GET", settingsPath, nil, &remote); err != nil {
+		return nil, err
+	}
+	remote.apply(settings)
+	a.version = remote.Version
+	return a, nil
+}
+
+// Add a plugin to the workers.  Plugins must be added before Run.
+func (a *Agent) AddPlugin(p worker.Plugin) {
+	a.plugins = append(a.plugins, p)
+}
+
+// Settings for new tasks.
+func (a *Agent) currentSettings() *ss.ScanSettings {
+	settings, _ := a.current()
+	return settings
+}
+
+// Settings and client factory for new tasks.
+func (a *Agent) current() (*ss.ScanSettings, client.ClientFactory) {
+	a.settingsLock.Lock()
+	defer a.settingsLock.Unlock()
+	return a.settings, a.factory
+}
+
+// Fetch the coordinator's settings after they have been reloaded, and build a
+// client factory for them.  Workers switch to the new settings at their next
+// task.  If the factory can't be built, the previous settings are kept until
+// the coordinator's settings change again.
+func (a *Agent) refreshSettings() error {
+	var remote agentSettings
+	if err := a.call("GET", settingsPath, nil, &remote); err != nil {
+		return err
+	}
+	a.settingsLock.Lock()
+	settings := *a.settings
+	newFactory := a.newFactory
+	a.settingsLock.Unlock()
+	remote.apply(&settings)
+	var factory client.ClientFactory
+	if newFactory != nil {
+		var err error
+		if factory, err = newFactory(&settings); err != nil {
+			a.settingsLock.Lock()
+			a.version = remote.Version
+			a.settingsLock.Unlock()
+			return fmt.Errorf("Unable to use settings version %d: %s", remote.Version, err.Error())
+		}
+	}
+	a.settingsLock.Lock()
+	defer a.settingsLock.Unlock()
+	a.settings = &settings
+	a.factory = factory
+	a.version = remote.Version
+	logging.Logf(logging.LogInfo, "Loaded settings version %d from coordinator.", remote.Version)
+	return nil
+}
+
+// Run until the coordinator reports the scan is finished or ctx is cancelled.
+// Requests are made with clients from newFactory.  Tasks interrupted by
+// cancellation are not reported, so the coordinator will hand them out again
+// once their lease expires.
+func (a *Agent) Run(ctx context.Context, newFactory FactoryFunc) error {
+	settings := a.currentSettings()
+	factory, err := newFactory(settings)
+	if err != nil {
+		return err
+	}
+	a.settingsLock.Lock()
+	a.factory, a.newFactory = factory, newFactory
+	a.settingsLock.Unlock()
+	workers := settings.Workers
+	tasks := make(chan wireTask, workers)
+	wg := &sync.WaitGroup{}
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go a.runWorker(ctx, tasks, wg)
+	}
+	reporterDone := make(chan bool)
+	go a.runReporter(reporterDone)
+
+	err = a.fetchTasks(ctx, tasks)
+	close(tasks)
+	wg.Wait()
+	close(a.reports)
+	<-reporterDone
+	return err
+}
+
+// Keep the local task channel full until the scan is finished.
+func (a *Agent) fetchTasks(ctx context.Context, tasks chan<- wireTask) error {
+	errors := 0
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		free := cap(tasks) - len(tasks)
+		if free == 0 {
+			time.Sleep(reportInterval)
+			continue
+		}
+		var resp tasksResponse
+		path := tasksPath + "?max=" + strconv.Itoa(free)
+		if err := a.call("GET", path, nil, &resp); err != nil {
+			errors++
+			if errors >= maxAgentErrors {
+				return err
+			}
+			logging.Logf(logging.LogWarning, "Error fetching tasks: %s", err.Error())
+			time.Sleep(agentRetryDelay)
+			continue
+		}
+		errors = 0
+		a.settingsLock.Lock()
+		stale := resp.SettingsVersion != a.version
+		a.settingsLock.Unlock()
+		if stale {
+			if err := a.refreshSettings(); err != nil {
+				logging.Logf(logging.LogWarning, "Error refreshing settings: %s", err.Error())
+			}
+		}
+		for _, t := range resp.Tasks {
+			tasks <- t
+		}
+		if resp.Finished {
+			logging.Logf(logging.LogInfo, "Coordinator reports scan finished.")
+			return nil
+		}
+	}
+}
+
+func (a *Agent) runWorker(ctx context.Context, tasks <-chan wireTask, wg *sync.WaitGroup) {
+	defer wg.Done()
+	var report *taskReport
+	adder := func(urls ...*url.URL) {
+		for _, u := range urls {
+			report.Found = append(report.Found, u.String())
+		}
+	}
+	rchan := make(chan results.Result)
+	var settings *ss.ScanSettings
+	var w *worker.Worker
+	for t := range tasks {
+		if current, factory := a.current(); current != settings {
+			settings = current
+			w = worker.NewConfiguredWorker(settings, factory, nil, adder, func(int) {}, nil, rchan)
+			w.SetContext(ctx)
+			if settings.DirListings {
+				w.AddDirListings(worker.NewDirListings(adder, rchan))
+			}
+			for _, p := range a.plugins {
+				w.AddPlugin(p)
+			}
+			// Redirects are followed only within the coordinator's scope
+			if inScope, err := scopeFunc(settings); err != nil {
+				logging.Logf(logging.LogWarning, "Unable to use scope from coordinator: %s", err)
+			} else {
+				w.SetScopeFunc(inScope)
+			}
+		}
+		if ctx.Err() != nil {
+			continue
+		}
+		report = &taskReport{ID: t.ID}
+		u, err := url.Parse(t.URL)
+		if err != nil {
+			logging.Logf(logging.LogWarning, "Unable to parse task URL %s: %s", t.URL, err.Error())
+			a.reports <- report
+			continue
+		}
+		if t.Payload != "" {
+			u = util.WithPayload(u, t.Payload)
+		}
+		finished := make(chan bool)
+		go func() {
+			w.HandleURL(u)
+			close(finished)
+		}()
+	collect:
+		for {
+			select {
+			case r := <-rchan:
+				report.Results = append(report.Results, r)
+			case <-finished:
+				break collect
+			}
+		}
+		if ctx.Err() != nil {
+			continue
+		}
+		a.reports <- report
+	}
+}
+
+// Send completed tasks to the coordinator in batches.
+func (a *Agent) runReporter(done chan<- bool) {
+	defer close(done)
+	ticker := time.NewTicker(reportInterval)
+	defer ticker.Stop()
+	batch := make([]*taskReport, 0, reportBatchSize)
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		for attempt := 1; ; attempt++ {
+			err := a.call("POST", reportPath, &reportRequest{Tasks: batch}, nil)
+			if err == nil {
+				break
+			}
+			if attempt == maxAgentErrors {
+				logging.Logf(logging.LogError, "Giving up on reporting %d tasks: %s", len(batch), err.Error())
+				break
+			}
+			logging.Logf(logging.LogWarning, "Error reporting results: %s", err.Error())
+			time.Sleep(agentRetryDelay)
+		}
+		batch = batch[:0]
+	}
+	for {
+		select {
+		case r, ok := <-a.reports:
+			if !ok {
+				flush()
+				return
+			}
+			batch = append(batch, r)
+			if len(batch) >= reportBatchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		}
+	}
+}
+
+// Make a request to the coordinator, encoding body and decoding the response
+// into out, if they are non-nil.
+func (a *Agent) call(method, path string, body, out interface{}) error {
+	ref, err := url.Parse(path)
+	if err != nil {
+		return err
+	}
+	var rdr io.Reader
+	if body != nil {
+		buf, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		rdr = bytes.NewReader(buf)
+	}
+	req, err := http.NewRequest(method, a.base.ResolveReference(ref).String(), rdr)
+	if err != nil {
+		return err
+	}
+	if token := a.currentSettings().APIToken; token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := a.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("Coordinator returned %s", resp.Status)
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// Check URLs against the scope sent by the coordinator, as its work queue
+// does.
+func scopeFunc(settings *ss.ScanSettings) (workqueue.QueueScopeFunc, error) {
+	bases, err := settings.GetScopes()
+	if err != nil {
+		return nil, err
+	}
+	rules, err := scope.NewRules(settings.ScopeInclude, settings.ScopeExclude)
+	if err != nil {
+		return nil, err
+	}
+	return workqueue.NewScopeFunc(bases, settings.AllowHTTPSUpgrade, rules), nil
+}
@@ -0,0 +1,106 @@
+// Copyright 2017 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package remote
+
+import (
+	"context"
+	"github.com/Matir/webborer/client"
+	"github.com/Matir/webborer/client/mock"
+	"github.com/Matir/webborer/results"
+	ss "github.com/Matir/webborer/settings"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestAgent_Run(t *testing.T) {
+	src := make(chan *url.URL, 1)
+	rchan := make(chan results.Result, 10)
+	var c *Coordinator
+	done := func(int) { c.Finish() }
+	c = NewCoordinator(&ss.ScanSettings{
+		LeaseTime:   time.Minute,
+		UserAgent:   "coordinator",
+		SpiderCodes: []int{200},
+	}, src, func(...*url.URL) {}, done, nil, rchan)
+	server := httptest.NewServer(c.Handler())
+	defer server.Close()
+
+	settings := &ss.ScanSettings{
+		CoordinatorURL: server.URL,
+		Workers:        1,
+		UserAgent:      "agent",
+	}
+	agent, err := NewAgent(settings)
+	if err != nil {
+		t.Fatalf("Error creating agent: %v", err)
+	}
+	if settings.UserAgent != "coordinator" {
+		t.Errorf("Coordinator settings not applied, UserAgent: %s", settings.UserAgent)
+	}
+
+	u, _ := url.Parse("http://localhost/a")
+	src <- u
+	resp := mock.ResponseFromString("")
+	resp.StatusCode = 200
+	factory := &mock.MockClientFactory{
+		ForeverClient: &mock.MockClient{ForeverResponse: resp},
+	}
+	newFactory := func(*ss.ScanSettings) (client.ClientFactory, error) {
+		return factory, nil
+	}
+	if err := agent.Run(context.Background(), newFactory); err != nil {
+		t.Fatalf("Error running agent: %v", err)
+	}
+	select {
+	case r := <-rchan:
+		if r.URL.String() != u.String() || r.Code != 200 {
+			t.Errorf("Unexpected result: %+v", r)
+		}
+	default:
+		t.Error("Expected a result from the agent.")
+	}
+}
+
+func TestAgent_RefreshSettings(t *testing.T) {
+	src := make(chan *url.URL)
+	rchan := make(chan results.Result)
+	c := NewCoordinator(&ss.ScanSettings{LeaseTime: time.Minute, UserAgent: "before"},
+		src, func(...*url.URL) {}, func(int) {}, nil, rchan)
+	server := httptest.NewServer(c.Handler())
+	defer server.Close()
+
+	agent, err := NewAgent(&ss.ScanSettings{CoordinatorURL: server.URL, Workers: 1})
+	if err != nil {
+		t.Fatalf("Error creating agent: %v", err)
+	}
+	c.UpdateSettings(&ss.ScanSettings{UserAgent: "after"})
+	c.Finish()
+	var built []string
+	newFactory := func(settings *ss.ScanSettings) (client.ClientFactory, error) {
+		built = append(built, settings.UserAgent)
+		return &mock.MockClientFactory{}, nil
+	}
+	if err := agent.Run(context.Background(), newFactory); err != nil {
+		t.Fatalf("Error running agent: %v", err)
+	}
+	if ua := agent.currentSettings().UserAgent; ua != "after" {
+		t.Errorf("Expected reloaded settings, got UserAgent %s", ua)
+	}
+	if len(built) != 2 || built[1] != "after" {
+		t.Errorf("Expected a client factory for the reloaded settings, built %v", built)
+	}
+}
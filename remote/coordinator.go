@@ -0,0 +1,509 @@
+// Copyright 2017 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package remote
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/Matir/webborer/logging"
+	"github.com/Matir/webborer/results"
+	ss "github.com/Matir/webborer/settings"
+	"github.com/Matir/webborer/util"
+	"github.com/Matir/webborer/worker"
+	"github.com/Matir/webborer/workqueue"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// How long a request for tasks waits for work to become available
+	pollTimeout = time.Second
+	// Most tasks handed out in a single request
+	maxTasksPerRequest = 100
+	// Time allowed for agents to notice the scan is finished
+	finishGrace = 2 * pollTimeout
+	// Largest request body accepted for adding words or targets
+	maxControlBody = 16 * 1024 * 1024
+)
+
+// Coordinator serves the work from a scan's work channel to agents over HTTP
+// and feeds their results and discovered URLs back into the scan.  It takes
+// the place of the local workers.
+type Coordinator struct {
+	settings *ss.ScanSettings
+	// Channel of URLs to hand out
+	src <-chan *url.URL
+	// Functions to feed back into the work queue
+	adder   workqueue.QueueAddFunc
+	done    workqueue.QueueDoneFunc
+	release workqueue.QueueReleaseFunc
+	// Function to pause hosts serving challenge pages, if any
+	pause workqueue.QueuePauseFunc
+	// Channel for scan results
+	rchan chan<- results.Result
+	// Tasks handed out, by ID
+	leases map[uint64]*lease
+	// Leases that expired and need to be handed out again
+	expired  []*lease
+	nextID   uint64
+	finished bool
+	// Settings sent to agents
+	agentSettings *agentSettings
+	// Targets added to the scope since the scan started
+	addedScope []string
+	// Called to reload settings on request
+	reload func() error
+	// Called to add words or targets to the scan on request
+	addWords   func([]string)
+	addTargets func([]string) error
+	lock       sync.Mutex
+	listener   net.Listener
+	server     *http.Server
+	stop       chan bool
+}
+
+type lease struct {
+	id        uint64
+	url       *url.URL
+	expires   time.Time
+	completed bool
+	// Waiting in the expired queue
+	requeued bool
+}
+
+func NewCoordinator(settings *ss.ScanSettings,
+	src <-chan *url.URL,
+	adder workqueue.QueueAddFunc,
+	done workqueue.QueueDoneFunc,
+	release workqueue.QueueReleaseFunc,
+	rchan chan<- results.Result) *Coordinator {
+	return &Coordinator{
+		settings:      settings,
+		src:           src,
+		adder:         adder,
+		done:          done,
+		release:       release,
+		rchan:         rchan,
+		leases:        make(map[uint64]*lease),
+		agentSettings: agentSettingsFrom(settings),
+		stop:          make(chan bool),
+	}
+}
+
+// Start listening for agents.  Without an API token anyone who can reach the
+// coordinator could read its settings and inject results, so only loopback
+// addresses are allowed then.
+func (c *Coordinator) Start() error {
+	if c.settings.APIToken == "" && !isLoopback(c.settings.ListenAddr) {
+		return fmt.Errorf("Refusing to listen on %s without -api-token", c.settings.ListenAddr)
+	}
+	if c.settings.APIToken == "" && c.settings.HTTPUsername != "" {
+		logging.Logf(logging.LogWarning, "HTTP credentials are only sent to agents when -api-token is set.")
+	}
+	listener, err := net.Listen("tcp", c.settings.ListenAddr)
+	if err != nil {
+		return err
+	}
+	c.listener = listener
+	c.server = &http.Server{Handler: c.Handler()}
+	go c.server.Serve(listener)
+	go c.expireLeases()
+	logging.Logf(logging.LogInfo, "Coordinator listening on %s", listener.Addr().String())
+	return nil
+}
+
+// Whether addr, as host:port, only listens on a loopback interface.
+func isLoopback(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return false
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// Address the coordinator is listening on.
+func (c *Coordinator) Addr() string {
+	if c.listener == nil {
+		return ""
+	}
+	return c.listener.Addr().String()
+}
+
+// HTTP handler for the coordinator API.
+func (c *Coordinator) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc(settingsPath, requireToken(c.settings.APIToken, c.handleSettings))
+	mux.HandleFunc(tasksPath, requireToken(c.settings.APIToken, c.handleTasks))
+	mux.HandleFunc(reportPath, requireToken(c.settings.APIToken, c.handleReport))
+	mux.HandleFunc(reloadPath, requireToken(c.settings.APIToken, c.handleReload))
+	mux.HandleFunc(wordsPath, requireToken(c.settings.APIToken, c.handleWords))
+	mux.HandleFunc(targetsPath, requireToken(c.settings.APIToken, c.handleTargets))
+	return mux
+}
+
+// Set the function used to reload settings when requested through the API.
+func (c *Coordinator) SetReloadFunc(reload func() error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.reload = reload
+}
+
+// Set the function used to add words to the scan when requested through the
+// API.
+func (c *Coordinator) SetAddWordsFunc(addWords func([]string)) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.addWords = addWords
+}
+
+// Set the function used to add targets to the scan when requested through the
+// API.
+func (c *Coordinator) SetAddTargetsFunc(addTargets func([]string) error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.addTargets = addTargets
+}
+
+// Set the function used to pause hosts when agents report challenge pages.
+func (c *Coordinator) SetPauseFunc(pause workqueue.QueuePauseFunc) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.pause = pause
+}
+
+// Change the settings sent to agents.  Agents pick up the new settings the
+// next time they ask for tasks.
+func (c *Coordinator) UpdateSettings(settings *ss.ScanSettings) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	as := agentSettingsFrom(settings)
+	as.BaseURLs = append(append([]string{}, as.BaseURLs...), c.addedScope...)
+	as.Version = c.agentSettings.Version + 1
+	c.agentSettings = as
+}
+
+// Add targets to the scope sent to agents.
+func (c *Coordinator) AddScope(urls ...*url.URL) {
+	if len(urls) == 0 {
+		return
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	as := *c.agentSettings
+	as.BaseURLs = append([]string{}, as.BaseURLs...)
+	for _, u := range urls {
+		c.addedScope = append(c.addedScope, u.String())
+		as.BaseURLs = append(as.BaseURLs, u.String())
+	}
+	as.Version++
+	c.agentSettings = &as
+}
+
+// Mark the scan as finished so agents know to exit.
+func (c *Coordinator) Finish() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.finished = true
+}
+
+// Stop serving, after giving agents a chance to notice the scan is finished.
+// No results are written after Stop returns.
+func (c *Coordinator) Stop() {
+	if c.server == nil {
+		return
+	}
+	time.Sleep(finishGrace)
+	close(c.stop)
+	c.server.Shutdown(context.Background())
+}
+
+func (c *Coordinator) handleSettings(w http.ResponseWriter, r *http.Request) {
+	c.lock.Lock()
+	as := *c.agentSettings
+	c.lock.Unlock()
+	if c.settings.APIToken == "" {
+		// Credentials are only given to agents that authenticated
+		as.HTTPUsername, as.HTTPPassword = "", ""
+	}
+	writeJSON(w, &as)
+}
+
+func (c *Coordinator) handleReload(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	c.lock.Lock()
+	reload := c.reload
+	c.lock.Unlock()
+	if reload == nil {
+		http.Error(w, "Reloading not supported", http.StatusNotImplemented)
+		return
+	}
+	if err := reload(); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Add words, one per line in the request body.
+func (c *Coordinator) handleWords(w http.ResponseWriter, r *http.Request) {
+	c.lock.Lock()
+	addWords := c.addWords
+	c.lock.Unlock()
+	if !c.controlAllowed(w) {
+		return
+	}
+	lines, ok := readLines(w, r, addWords != nil)
+	if !ok {
+		return
+	}
+	addWords(lines)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Add targets, one URL per line in the request body.
+func (c *Coordinator) handleTargets(w http.ResponseWriter, r *http.Request) {
+	c.lock.Lock()
+	addTargets := c.addTargets
+	c.lock.Unlock()
+	if !c.controlAllowed(w) {
+		return
+	}
+	lines, ok := readLines(w, r, addTargets != nil)
+	if !ok {
+		return
+	}
+	if err := addTargets(lines); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Whether words and targets may be added, writing an error response if not.
+// Without a token anyone who can reach the coordinator could add hosts to the
+// scan, so it must be set.
+func (c *Coordinator) controlAllowed(w http.ResponseWriter) bool {
+	if c.settings.APIToken == "" {
+		http.Error(w, "Adding words or targets requires -api-token", http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
+// Read the non-empty lines of a POST body, writing an error response if that
+// isn't possible.
+func readLines(w http.ResponseWriter, r *http.Request, supported bool) ([]string, bool) {
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return nil, false
+	}
+	if !supported {
+		http.Error(w, "Not supported", http.StatusNotImplemented)
+		return nil, false
+	}
+	body, err := ioutil.ReadAll(io.LimitReader(r.Body, maxControlBody))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return nil, false
+	}
+	lines := make([]string, 0)
+	for _, line := range strings.Split(string(body), "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines, true
+}
+
+func (c *Coordinator) handleTasks(w http.ResponseWriter, r *http.Request) {
+	max, err := strconv.Atoi(r.URL.Query().Get("max"))
+	if err != nil || max < 1 {
+		max = 1
+	} else if max > maxTasksPerRequest {
+		max = maxTasksPerRequest
+	}
+	tasks := c.take(max)
+	if len(tasks) == 0 {
+		// Long poll for a single task
+		select {
+		case u, ok := <-c.src:
+			if ok {
+				tasks = append(tasks, c.newLease(u))
+			}
+		case <-time.After(pollTimeout):
+		}
+	}
+	resp := tasksResponse{Tasks: make([]wireTask, 0, len(tasks))}
+	for _, l := range tasks {
+		resp.Tasks = append(resp.Tasks, wireTask{
+			ID:      l.id,
+			URL:     util.WithoutPayload(l.url).String(),
+			Payload: util.Payload(l.url),
+		})
+	}
+	c.lock.Lock()
+	resp.SettingsVersion = c.agentSettings.Version
+	if len(tasks) == 0 {
+		resp.Finished = c.finished
+	}
+	c.lock.Unlock()
+	writeJSON(w, resp)
+}
+
+func (c *Coordinator) handleReport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var req reportRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	for _, report := range req.Tasks {
+		c.lock.Lock()
+		l, ok := c.leases[report.ID]
+		if ok {
+			delete(c.leases, report.ID)
+			l.completed = true
+		}
+		c.lock.Unlock()
+		if !ok {
+			logging.Logf(logging.LogInfo, "Ignoring report for unknown task %d.", report.ID)
+			continue
+		}
+		c.complete(l, report)
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Feed a completed task back into the scan.  Discovered URLs must be added
+// before the task is marked done so the work count never reaches zero early.
+func (c *Coordinator) complete(l *lease, report *taskReport) {
+	found := make([]*url.URL, 0, len(report.Found))
+	for _, s := range report.Found {
+		if u, err := url.Parse(s); err == nil {
+			found = append(found, u)
+		}
+	}
+	if len(found) > 0 {
+		c.adder(found...)
+	}
+	c.lock.Lock()
+	settings, pause := c.settings, c.pause
+	c.lock.Unlock()
+	for _, res := range report.Results {
+		worker.HandleChallenge(settings, &res, pause)
+		c.rchan <- res
+	}
+	c.done(1)
+	if c.release != nil {
+		c.release(l.url)
+	}
+}
+
+// Take up to max tasks without blocking, preferring expired leases.
+func (c *Coordinator) take(max int) []*lease {
+	tasks := make([]*lease, 0, max)
+	c.lock.Lock()
+	for len(tasks) < max && len(c.expired) > 0 {
+		l := c.expired[0]
+		c.expired = c.expired[1:]
+		l.requeued = false
+		if l.completed {
+			continue
+		}
+		l.expires = time.Now().Add(c.settings.LeaseTime)
+		tasks = append(tasks, l)
+	}
+	c.lock.Unlock()
+	for len(tasks) < max {
+		select {
+		case u, ok := <-c.src:
+			if !ok {
+				return tasks
+			}
+			tasks = append(tasks, c.newLease(u))
+		default:
+			return tasks
+		}
+	}
+	return tasks
+}
+
+func (c *Coordinator) newLease(u *url.URL) *lease {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.nextID++
+	l := &lease{
+		id:      c.nextID,
+		url:     u,
+		expires: time.Now().Add(c.settings.LeaseTime),
+	}
+	c.leases[l.id] = l
+	return l
+}
+
+// Periodically find leases that have expired so they can be handed out again.
+func (c *Coordinator) expireLeases() {
+	interval := c.settings.LeaseTime / 4
+	if interval < time.Second {
+		interval = time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.stop:
+			return
+		case now := <-ticker.C:
+			c.requeueExpired(now)
+		}
+	}
+}
+
+func (c *Coordinator) requeueExpired(now time.Time) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	for _, l := range c.leases {
+		if !l.completed && !l.requeued && now.After(l.expires) {
+			logging.Logf(logging.LogInfo, "Lease on %s expired, requeueing.", l.url.String())
+			l.requeued = true
+			c.expired = append(c.expired, l)
+		}
+	}
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		logging.Logf(logging.LogWarning, "Error writing response: %s", err.Error())
+	}
+}
@@ -0,0 +1,404 @@
+// Copyright 2017 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package remote
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"github.com/Matir/webborer/results"
+	ss "github.com/Matir/webborer/settings"
+	"github.com/Matir/webborer/util"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+type testScan struct {
+	src      chan *url.URL
+	added    []*url.URL
+	done     int
+	released []*url.URL
+	rchan    chan results.Result
+}
+
+func newTestCoordinator(settings *ss.ScanSettings) (*Coordinator, *testScan) {
+	scan := &testScan{
+		src:   make(chan *url.URL, 10),
+		rchan: make(chan results.Result, 10),
+	}
+	adder := func(urls ...*url.URL) { scan.added = append(scan.added, urls...) }
+	done := func(n int) { scan.done += n }
+	release := func(u *url.URL) { scan.released = append(scan.released, u) }
+	c := NewCoordinator(settings, scan.src, adder, done, release, scan.rchan)
+	return c, scan
+}
+
+func getTasks(t *testing.T, h http.Handler, max string) tasksResponse {
+	req := httptest.NewRequest("GET", tasksPath+"?max="+max, nil)
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Unexpected status for tasks: %d", rec.Code)
+	}
+	var resp tasksResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatalf("Error decoding tasks: %v", err)
+	}
+	return resp
+}
+
+func postReport(t *testing.T, h http.Handler, reports ...*taskReport) {
+	buf, _ := json.Marshal(&reportRequest{Tasks: reports})
+	req := httptest.NewRequest("POST", reportPath, bytes.NewReader(buf))
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("Unexpected status for report: %d", rec.Code)
+	}
+}
+
+func TestCoordinator_TasksAndReport(t *testing.T) {
+	c, scan := newTestCoordinator(&ss.ScanSettings{LeaseTime: time.Minute})
+	h := c.Handler()
+	u1, _ := url.Parse("http://localhost/a")
+	u2, _ := url.Parse("http://localhost/b")
+	scan.src <- u1
+	scan.src <- u2
+
+	resp := getTasks(t, h, "5")
+	if len(resp.Tasks) != 2 {
+		t.Fatalf("Expected 2 tasks, got %d.", len(resp.Tasks))
+	}
+	if resp.Finished {
+		t.Error("Scan should not be finished.")
+	}
+	if resp.Tasks[0].URL != u1.String() || resp.Tasks[1].URL != u2.String() {
+		t.Errorf("Unexpected tasks: %v", resp.Tasks)
+	}
+
+	postReport(t, h, &taskReport{
+		ID:      resp.Tasks[0].ID,
+		Results: []results.Result{results.Result{URL: u1, Code: 200}},
+		Found:   []string{"http://localhost/a/c"},
+	})
+	if scan.done != 1 {
+		t.Errorf("Expected 1 task done, got %d.", scan.done)
+	}
+	if len(scan.added) != 1 || scan.added[0].Path != "/a/c" {
+		t.Errorf("Unexpected found URLs: %v", scan.added)
+	}
+	if len(scan.released) != 1 || scan.released[0] != u1 {
+		t.Errorf("Unexpected released URLs: %v", scan.released)
+	}
+	select {
+	case r := <-scan.rchan:
+		if r.Code != 200 || r.URL.String() != u1.String() {
+			t.Errorf("Unexpected result: %+v", r)
+		}
+	default:
+		t.Error("Expected a result.")
+	}
+
+	// Duplicate reports are ignored
+	postReport(t, h, &taskReport{ID: resp.Tasks[0].ID})
+	if scan.done != 1 {
+		t.Errorf("Duplicate report was processed.")
+	}
+}
+
+func TestCoordinator_Finished(t *testing.T) {
+	c, _ := newTestCoordinator(&ss.ScanSettings{LeaseTime: time.Minute})
+	c.Finish()
+	resp := getTasks(t, c.Handler(), "1")
+	if len(resp.Tasks) != 0 {
+		t.Errorf("Expected no tasks, got %d.", len(resp.Tasks))
+	}
+	if !resp.Finished {
+		t.Error("Expected scan to be finished.")
+	}
+}
+
+func TestCoordinator_LeaseExpiry(t *testing.T) {
+	c, scan := newTestCoordinator(&ss.ScanSettings{LeaseTime: time.Minute})
+	h := c.Handler()
+	u, _ := url.Parse("http://localhost/a")
+	scan.src <- u
+	first := getTasks(t, h, "1")
+	if len(first.Tasks) != 1 {
+		t.Fatalf("Expected 1 task, got %d.", len(first.Tasks))
+	}
+	c.requeueExpired(time.Now().Add(2 * time.Minute))
+	second := getTasks(t, h, "1")
+	if len(second.Tasks) != 1 || second.Tasks[0].ID != first.Tasks[0].ID {
+		t.Fatalf("Expected expired task to be handed out again, got %v", second.Tasks)
+	}
+	// Either agent may report; only the first report counts.
+	postReport(t, h, &taskReport{ID: first.Tasks[0].ID})
+	postReport(t, h, &taskReport{ID: second.Tasks[0].ID})
+	if scan.done != 1 {
+		t.Errorf("Expected 1 task done, got %d.", scan.done)
+	}
+}
+
+func TestRequireToken(t *testing.T) {
+	h := requireToken("secret", func(w http.ResponseWriter, r *http.Request) {})
+	for _, tc := range []struct {
+		auth string
+		code int
+	}{
+		{"", http.StatusUnauthorized},
+		{"Bearer wrong", http.StatusUnauthorized},
+		{"Bearer secret", http.StatusOK},
+	} {
+		req := httptest.NewRequest("GET", settingsPath, nil)
+		if tc.auth != "" {
+			req.Header.Set("Authorization", tc.auth)
+		}
+		rec := httptest.NewRecorder()
+		h(rec, req)
+		if rec.Code != tc.code {
+			t.Errorf("Auth %q: expected %d, got %d", tc.auth, tc.code, rec.Code)
+		}
+	}
+}
+
+func TestCoordinator_TaskPayload(t *testing.T) {
+	c, scan := newTestCoordinator(&ss.ScanSettings{LeaseTime: time.Minute})
+	h := c.Handler()
+	u, _ := url.Parse("http://localhost/login")
+	scan.src <- util.WithPayload(u, "admin#1")
+
+	resp := getTasks(t, h, "1")
+	if len(resp.Tasks) != 1 {
+		t.Fatalf("Expected 1 task, got %d.", len(resp.Tasks))
+	}
+	if resp.Tasks[0].URL != u.String() || resp.Tasks[0].Payload != "admin#1" {
+		t.Errorf("Expected payload apart from the URL, got %+v", resp.Tasks[0])
+	}
+}
+
+func TestAgentSettings_Apply(t *testing.T) {
+	src := &ss.ScanSettings{
+		Extensions:      []string{"php"},
+		Mangle:          true,
+		SpiderCodes:     []int{200},
+		SleepTime:       time.Second,
+		UserAgent:       "test",
+		ArchivePeek:     true,
+		ArchivePeekSize: 10,
+		NegativeCodes:   ss.MustParseCodeRanges("404,500-599"),
+		Headers:         []string{"X-Token: FUZZ"},
+		RequestData:     "user=FUZZ",
+		RequestMethod:   "PUT",
+		MaxBodySize:     1024,
+	}
+	buf, err := json.Marshal(agentSettingsFrom(src))
+	if err != nil {
+		t.Fatalf("Error marshaling settings: %v", err)
+	}
+	var as agentSettings
+	if err := json.Unmarshal(buf, &as); err != nil {
+		t.Fatalf("Error unmarshaling settings: %v", err)
+	}
+	dst := &ss.ScanSettings{UserAgent: "other", Workers: 3}
+	as.apply(dst)
+	if dst.UserAgent != "test" || !dst.Mangle || dst.SleepTime != time.Second ||
+		len(dst.Extensions) != 1 || !dst.ArchivePeek || dst.ArchivePeekSize != 10 ||
+		dst.NegativeCodes.String() != "404,500-599" || len(dst.Headers) != 1 ||
+		dst.RequestData != "user=FUZZ" || dst.RequestMethod != "PUT" ||
+		dst.MaxBodySize != 1024 {
+		t.Errorf("Settings not applied: %+v", dst)
+	}
+	if dst.Workers != 3 {
+		t.Error("Local settings should not be overwritten.")
+	}
+}
+
+func TestCoordinator_AddScope(t *testing.T) {
+	settings := &ss.ScanSettings{
+		LeaseTime:    time.Minute,
+		BaseURLs:     []string{"http://one/"},
+		ScopeInclude: []string{"host:*.one"},
+		ScopeExclude: []string{"path:/logout"},
+	}
+	c, _ := newTestCoordinator(settings)
+	u, _ := url.Parse("http://two/")
+	c.AddScope(u)
+	// Added targets survive a reload
+	c.UpdateSettings(settings)
+	as := c.agentSettings
+	if as.Version != 2 || strings.Join(as.BaseURLs, " ") != "http://one/ http://two/" {
+		t.Errorf("Expected added target in settings, got version %d, %v", as.Version, as.BaseURLs)
+	}
+	dst := &ss.ScanSettings{}
+	as.apply(dst)
+	inScope, err := scopeFunc(dst)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	for target, expected := range map[string]bool{
+		"http://two/a":      true,
+		"http://api.one/a":  true,
+		"http://one/logout": false,
+		"http://three/":     false,
+	} {
+		u, _ := url.Parse(target)
+		if inScope(u) != expected {
+			t.Errorf("Expected agent scope check for %s to be %v", target, expected)
+		}
+	}
+}
+
+func TestCoordinator_Reload(t *testing.T) {
+	c, _ := newTestCoordinator(&ss.ScanSettings{LeaseTime: time.Minute, UserAgent: "before"})
+	h := c.Handler()
+	reloaded := false
+	c.SetReloadFunc(func() error {
+		reloaded = true
+		c.UpdateSettings(&ss.ScanSettings{UserAgent: "after"})
+		return nil
+	})
+
+	req := httptest.NewRequest("GET", reloadPath, nil)
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected GET to be rejected, got %d", rec.Code)
+	}
+
+	req = httptest.NewRequest("POST", reloadPath, nil)
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusNoContent || !reloaded {
+		t.Fatalf("Reload failed: %d", rec.Code)
+	}
+
+	c.Finish()
+	if resp := getTasks(t, h, "1"); resp.SettingsVersion != 1 {
+		t.Errorf("Expected settings version 1, got %d", resp.SettingsVersion)
+	}
+	req = httptest.NewRequest("GET", settingsPath, nil)
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	var as agentSettings
+	if err := json.NewDecoder(rec.Body).Decode(&as); err != nil {
+		t.Fatalf("Error decoding settings: %v", err)
+	}
+	if as.UserAgent != "after" || as.Version != 1 {
+		t.Errorf("Expected reloaded settings, got %+v", as)
+	}
+}
+
+func TestCoordinator_AddWordsAndTargets(t *testing.T) {
+	c, _ := newTestCoordinator(&ss.ScanSettings{LeaseTime: time.Minute, APIToken: "secret"})
+	h := c.Handler()
+	post := func(path, body string) int {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", path, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer secret")
+		h.ServeHTTP(rec, req)
+		return rec.Code
+	}
+	if code := post(wordsPath, "a\n"); code != http.StatusNotImplemented {
+		t.Errorf("Expected words to be unsupported without a function, got %d", code)
+	}
+
+	var words, targets []string
+	c.SetAddWordsFunc(func(w []string) { words = append(words, w...) })
+	c.SetAddTargetsFunc(func(u []string) error {
+		if u[0] == "bad" {
+			return errors.New("bad target")
+		}
+		targets = append(targets, u...)
+		return nil
+	})
+	if code := post(wordsPath, "admin\n\n backup \n"); code != http.StatusNoContent {
+		t.Errorf("Adding words failed: %d", code)
+	}
+	if len(words) != 2 || words[0] != "admin" || words[1] != "backup" {
+		t.Errorf("Unexpected words: %v", words)
+	}
+	if code := post(targetsPath, "http://other/\n"); code != http.StatusNoContent {
+		t.Errorf("Adding targets failed: %d", code)
+	}
+	if len(targets) != 1 || targets[0] != "http://other/" {
+		t.Errorf("Unexpected targets: %v", targets)
+	}
+	if code := post(targetsPath, "bad"); code != http.StatusBadRequest {
+		t.Errorf("Expected bad target to be rejected, got %d", code)
+	}
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", wordsPath, nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected GET to be rejected, got %d", rec.Code)
+	}
+
+	// Without a token nothing can be added
+	c, _ = newTestCoordinator(&ss.ScanSettings{LeaseTime: time.Minute})
+	c.SetAddTargetsFunc(func(u []string) error {
+		targets = append(targets, u...)
+		return nil
+	})
+	rec = httptest.NewRecorder()
+	c.Handler().ServeHTTP(rec, httptest.NewRequest("POST", targetsPath, strings.NewReader("http://evil/\n")))
+	if rec.Code != http.StatusForbidden || len(targets) != 1 {
+		t.Errorf("Expected targets to be refused without a token, got %d, %v", rec.Code, targets)
+	}
+}
+
+func TestCoordinator_StartRequiresToken(t *testing.T) {
+	c, _ := newTestCoordinator(&ss.ScanSettings{LeaseTime: time.Minute, ListenAddr: ":0"})
+	if err := c.Start(); err == nil {
+		c.Stop()
+		t.Fatal("Expected listening on all interfaces without a token to fail")
+	}
+	c, _ = newTestCoordinator(&ss.ScanSettings{LeaseTime: time.Minute, ListenAddr: ":0", APIToken: "secret"})
+	if err := c.Start(); err != nil {
+		t.Fatalf("Expected listening with a token to work: %v", err)
+	}
+	c.server.Close()
+	c, _ = newTestCoordinator(&ss.ScanSettings{LeaseTime: time.Minute, ListenAddr: "127.0.0.1:0"})
+	if err := c.Start(); err != nil {
+		t.Fatalf("Expected listening on loopback to work: %v", err)
+	}
+	c.server.Close()
+}
+
+func TestCoordinator_SettingsCredentials(t *testing.T) {
+	get := func(token string) agentSettings {
+		c, _ := newTestCoordinator(&ss.ScanSettings{LeaseTime: time.Minute, APIToken: token, HTTPUsername: "user", HTTPPassword: "pass"})
+		req := httptest.NewRequest("GET", settingsPath, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		rec := httptest.NewRecorder()
+		c.Handler().ServeHTTP(rec, req)
+		var as agentSettings
+		if err := json.NewDecoder(rec.Body).Decode(&as); err != nil {
+			t.Fatalf("Error decoding settings: %v", err)
+		}
+		return as
+	}
+	if as := get(""); as.HTTPUsername != "" || as.HTTPPassword != "" {
+		t.Errorf("Expected no credentials without a token, got %s:%s", as.HTTPUsername, as.HTTPPassword)
+	}
+	if as := get("secret"); as.HTTPUsername != "user" || as.HTTPPassword != "pass" {
+		t.Errorf("Expected credentials with a token, got %s:%s", as.HTTPUsername, as.HTTPPassword)
+	}
+}
@@ -0,0 +1,193 @@
+// Copyright 2017 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package remote allows a single scan to be spread across several machines.
+// A Coordinator runs the work queue and serves tasks over HTTP, and Agents
+// pull tasks, perform them, and push the results back.
+package remote
+
+import (
+	"crypto/subtle"
+	"github.com/Matir/webborer/results"
+	ss "github.com/Matir/webborer/settings"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	settingsPath = "/v1/settings"
+	tasksPath    = "/v1/tasks"
+	reportPath   = "/v1/report"
+	reloadPath   = "/v1/reload"
+	wordsPath    = "/v1/words"
+	targetsPath  = "/v1/targets"
+)
+
+// A single URL to be handled by an agent.
+type wireTask struct {
+	ID  uint64 `json:"id"`
+	URL string `json:"url"`
+	// Word for FUZZ in the headers or body, if any
+	Payload string `json:"payload,omitempty"`
+}
+
+type tasksResponse struct {
+	Tasks []wireTask `json:"tasks"`
+	// Set when the scan is complete and no more tasks will be handed out
+	Finished bool `json:"finished"`
+	// Changes when the settings are reloaded
+	SettingsVersion int `json:"settings_version"`
+}
+
+// Everything produced while handling a single task.
+type taskReport struct {
+	ID      uint64           `json:"id"`
+	Results []results.Result `json:"results"`
+	// URLs discovered while handling the task
+	Found []string `json:"found"`
+}
+
+type reportRequest struct {
+	Tasks []*taskReport `json:"tasks"`
+}
+
+// Settings that the coordinator sends to agents so that all work is done the
+// same way, regardless of the flags each agent was started with.
+type agentSettings struct {
+	Version       int
+	Extensions    []string
+	Mangle        bool
+	SpiderCodes   []int
+	PositiveCodes ss.CodeRanges
+	NegativeCodes ss.CodeRanges
+	ParseHTML     bool
+	ParseJS       bool
+	DirListings   bool
+	SleepTime     time.Duration
+	Jitter        time.Duration
+	UserAgent     string
+	RandomAgent   bool
+	Cache         bool
+	CacheTTL      time.Duration
+	HTTPUsername  string
+	HTTPPassword  string
+	// Request template, which may contain FUZZ
+	Headers         []string
+	RequestData     string
+	ContentType     string
+	RequestMethod   string
+	MaxBodySize     int64
+	ArchivePeek     bool
+	ArchivePeekSize int64
+	LeakDetect      bool
+	HeaderChecks    bool
+	ChallengeDetect bool
+	FollowRedirects int
+	CompareAgent    string
+	ComparePaths    []string
+	// Scope of the scan, including targets added while it runs
+	BaseURLs          []string
+	AllowHTTPSUpgrade bool
+	ScopeInclude      []string
+	ScopeExclude      []string
+}
+
+func agentSettingsFrom(settings *ss.ScanSettings) *agentSettings {
+	return &agentSettings{
+		Extensions:        settings.Extensions,
+		Mangle:            settings.Mangle,
+		SpiderCodes:       settings.SpiderCodes,
+		PositiveCodes:     settings.PositiveCodes,
+		NegativeCodes:     settings.NegativeCodes,
+		ParseHTML:         settings.ParseHTML,
+		ParseJS:           settings.ParseJS,
+		DirListings:       settings.DirListings,
+		SleepTime:         settings.SleepTime,
+		Jitter:            settings.Jitter,
+		UserAgent:         settings.UserAgent,
+		RandomAgent:       settings.RandomAgent,
+		Cache:             settings.Cache || settings.CacheDir != "",
+		CacheTTL:          settings.CacheTTL,
+		HTTPUsername:      settings.HTTPUsername,
+		HTTPPassword:      settings.HTTPPassword,
+		Headers:           settings.Headers,
+		RequestData:       settings.RequestData,
+		ContentType:       settings.ContentType,
+		RequestMethod:     settings.RequestMethod,
+		MaxBodySize:       settings.MaxBodySize,
+		ArchivePeek:       settings.ArchivePeek,
+		ArchivePeekSize:   settings.ArchivePeekSize,
+		LeakDetect:        settings.LeakDetect,
+		HeaderChecks:      settings.HeaderChecks,
+		ChallengeDetect:   settings.ChallengeDetect,
+		FollowRedirects:   settings.FollowRedirects,
+		CompareAgent:      settings.CompareAgent,
+		ComparePaths:      settings.ComparePaths,
+		BaseURLs:          settings.BaseURLs,
+		AllowHTTPSUpgrade: settings.AllowHTTPSUpgrade,
+		ScopeInclude:      settings.ScopeInclude,
+		ScopeExclude:      settings.ScopeExclude,
+	}
+}
+
+func (as *agentSettings) apply(settings *ss.ScanSettings) {
+	settings.Extensions = as.Extensions
+	settings.Mangle = as.Mangle
+	settings.SpiderCodes = as.SpiderCodes
+	settings.PositiveCodes = as.PositiveCodes
+	settings.NegativeCodes = as.NegativeCodes
+	settings.ParseHTML = as.ParseHTML
+	settings.ParseJS = as.ParseJS
+	settings.DirListings = as.DirListings
+	settings.SleepTime = as.SleepTime
+	settings.Jitter = as.Jitter
+	settings.UserAgent = as.UserAgent
+	settings.RandomAgent = as.RandomAgent
+	settings.Cache = as.Cache
+	settings.CacheTTL = as.CacheTTL
+	settings.HTTPUsername = as.HTTPUsername
+	settings.HTTPPassword = as.HTTPPassword
+	settings.Headers = as.Headers
+	settings.RequestData = as.RequestData
+	settings.ContentType = as.ContentType
+	settings.RequestMethod = as.RequestMethod
+	settings.MaxBodySize = as.MaxBodySize
+	settings.ArchivePeek = as.ArchivePeek
+	settings.ArchivePeekSize = as.ArchivePeekSize
+	settings.LeakDetect = as.LeakDetect
+	settings.HeaderChecks = as.HeaderChecks
+	settings.ChallengeDetect = as.ChallengeDetect
+	settings.FollowRedirects = as.FollowRedirects
+	settings.CompareAgent = as.CompareAgent
+	settings.ComparePaths = as.ComparePaths
+	settings.BaseURLs = as.BaseURLs
+	settings.AllowHTTPSUpgrade = as.AllowHTTPSUpgrade
+	settings.ScopeInclude = as.ScopeInclude
+	settings.ScopeExclude = as.ScopeExclude
+}
+
+// Wrap a handler to require the API token, if one is configured.
+func requireToken(token string, h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if token != "" {
+			auth := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if subtle.ConstantTimeCompare([]byte(auth), []byte(token)) != 1 {
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+		}
+		h(w, r)
+	}
+}
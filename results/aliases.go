@@ -0,0 +1,124 @@
+// Copyright 2017 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package results
+
+import (
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// AliasDetector marks results that are another name for an earlier finding,
+// so they are reported once with their aliases listed, instead of as
+// separate findings.  Aliases are redirects to the same path with a trailing
+// slash or in another case (/admin to /admin/), and, on hosts whose paths
+// turn out not to be case-sensitive, the same path in another case or with
+// a trailing slash (/Admin and /admin) with the same status and length.
+type AliasDetector struct {
+	hosts map[string]*aliasHost
+	lock  sync.Mutex
+}
+
+type aliasHost struct {
+	// Two spellings of a path differing only in case got different status
+	// codes
+	caseSensitive bool
+	// First result for each path, by aliasKey
+	seen map[string]aliasEntry
+}
+
+type aliasEntry struct {
+	url    string
+	path   string
+	code   int
+	length int64
+}
+
+func NewAliasDetector() *AliasDetector {
+	return &AliasDetector{hosts: make(map[string]*aliasHost)}
+}
+
+// Set res.AliasOf if it is an alias of an earlier result.
+func (d *AliasDetector) Observe(res *Result) {
+	if res.URL == nil || res.Error != nil || res.Challenge != "" || res.AliasOf != "" {
+		return
+	}
+	if res.Redir != nil {
+		if aliasKey(res.URL) == aliasKey(res.Redir) && res.URL.Host == res.Redir.Host {
+			res.AliasOf = res.Redir.String()
+		}
+		return
+	}
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	host, ok := d.hosts[res.URL.Scheme+"://"+res.URL.Host]
+	if !ok {
+		host = &aliasHost{seen: make(map[string]aliasEntry)}
+		d.hosts[res.URL.Scheme+"://"+res.URL.Host] = host
+	}
+	key := aliasKey(res.URL)
+	prev, ok := host.seen[key]
+	if !ok {
+		host.seen[key] = aliasEntry{url: res.URL.String(), path: res.URL.Path, code: res.Code, length: res.Length}
+		return
+	}
+	if prev.url == res.URL.String() {
+		return
+	}
+	otherCase := strings.TrimSuffix(prev.path, "/") != strings.TrimSuffix(res.URL.Path, "/")
+	if prev.code != res.Code {
+		if otherCase {
+			host.caseSensitive = true
+		}
+		return
+	}
+	if prev.length != res.Length || (otherCase && host.caseSensitive) {
+		return
+	}
+	res.AliasOf = prev.url
+}
+
+// Paths that may name the same resource have the same key: the lowercased
+// path without a trailing slash, and the query.
+func aliasKey(u *url.URL) string {
+	p := strings.TrimSuffix(strings.ToLower(u.EscapedPath()), "/")
+	return p + "?" + u.RawQuery
+}
+
+// Aliases of one finding, as listed in reports.
+type AliasGroup struct {
+	URL     string
+	Aliases []string
+}
+
+// Aliases seen, grouped by the URL they are an alias of, in order of first
+// appearance
+type aliasStats struct {
+	groups []*AliasGroup
+	byURL  map[string]*AliasGroup
+}
+
+func (a *aliasStats) add(res Result) {
+	if a.byURL == nil {
+		a.byURL = make(map[string]*AliasGroup)
+	}
+	g, ok := a.byURL[res.AliasOf]
+	if !ok {
+		g = &AliasGroup{URL: res.AliasOf}
+		a.byURL[res.AliasOf] = g
+		a.groups = append(a.groups, g)
+	}
+	g.Aliases = append(g.Aliases, res.URL.String())
+}
@@ -0,0 +1,79 @@
+// Copyright 2017 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package results
+
+import (
+	"net/url"
+	"testing"
+)
+
+func TestAliasDetector(t *testing.T) {
+	mk := func(path string, code int, length int64) *Result {
+		return &Result{URL: &url.URL{Scheme: "http", Host: "iis", Path: path}, Code: code, Length: length}
+	}
+	d := NewAliasDetector()
+	steps := []struct {
+		res     *Result
+		aliasOf string
+	}{
+		{mk("/admin/", 200, 100), ""},
+		{mk("/Admin/", 200, 100), "http://iis/admin/"},
+		{mk("/ADMIN", 200, 100), "http://iis/admin/"},
+		// Same path again isn't an alias of itself
+		{mk("/admin/", 200, 100), ""},
+		// Different content
+		{mk("/Admin/", 200, 50), ""},
+		{mk("/login", 200, 10), ""},
+	}
+	for i, s := range steps {
+		d.Observe(s.res)
+		if s.res.AliasOf != s.aliasOf {
+			t.Errorf("Step %d (%s): expected alias of %q, got %q", i, s.res.URL, s.aliasOf, s.res.AliasOf)
+		}
+	}
+
+	redirect := mk("/images", 301, 0)
+	redirect.Redir = &url.URL{Scheme: "http", Host: "iis", Path: "/images/"}
+	d.Observe(redirect)
+	if redirect.AliasOf != "http://iis/images/" {
+		t.Errorf("Expected redirect to add a slash to be an alias, got %q", redirect.AliasOf)
+	}
+	elsewhere := mk("/old", 302, 0)
+	elsewhere.Redir = &url.URL{Scheme: "http", Host: "iis", Path: "/new/"}
+	d.Observe(elsewhere)
+	if elsewhere.AliasOf != "" {
+		t.Errorf("Expected redirect elsewhere not to be an alias, got %q", elsewhere.AliasOf)
+	}
+}
+
+func TestAliasDetector_CaseSensitive(t *testing.T) {
+	mk := func(path string, code int) *Result {
+		return &Result{URL: &url.URL{Scheme: "http", Host: "nginx", Path: path}, Code: code, Length: 100}
+	}
+	d := NewAliasDetector()
+	for _, r := range []*Result{mk("/admin", 200), mk("/Admin", 404), mk("/docs", 200)} {
+		d.Observe(r)
+	}
+	docs := mk("/DOCS", 200)
+	d.Observe(docs)
+	if docs.AliasOf != "" {
+		t.Errorf("Expected no case aliases on a case-sensitive host, got %q", docs.AliasOf)
+	}
+	slash := mk("/docs/", 200)
+	d.Observe(slash)
+	if slash.AliasOf != "http://nginx/docs" {
+		t.Errorf("Expected trailing slash alias, got %q", slash.AliasOf)
+	}
+}
@@ -0,0 +1,118 @@
+// Copyright 2017 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package results
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/Matir/webborer/storage"
+	"io"
+	"net/url"
+	"sort"
+)
+
+// Baseline is the set of results from an earlier scan, written with -format
+// json, that a new scan is compared against to find what has changed.
+type Baseline struct {
+	results map[string]Result
+}
+
+// Load a baseline from a file of JSON results.
+func LoadBaseline(path string) (*Baseline, error) {
+	fp, err := storage.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer fp.Close()
+	return ReadBaseline(fp)
+}
+
+// Read a baseline of JSON results, one per line.
+func ReadBaseline(rdr io.Reader) (*Baseline, error) {
+	b := &Baseline{results: make(map[string]Result)}
+	dec := json.NewDecoder(rdr)
+	for {
+		var res Result
+		if err := dec.Decode(&res); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("Unable to read baseline: %s", err.Error())
+		}
+		if res.URL != nil {
+			b.results[res.URL.String()] = res
+		}
+	}
+	return b, nil
+}
+
+// The URLs in the baseline, in order, so that each is checked again.
+func (b *Baseline) URLs() []*url.URL {
+	keys := make([]string, 0, len(b.results))
+	for k := range b.results {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	urls := make([]*url.URL, len(keys))
+	for i, k := range keys {
+		urls[i] = b.results[k].URL
+	}
+	return urls
+}
+
+// The ETag and Last-Modified values to request u with, so an unchanged
+// resource can be answered with 304 Not Modified.
+func (b *Baseline) Validators(u *url.URL) (string, string) {
+	prev := b.results[u.String()]
+	return prev.ETag, prev.LastModified
+}
+
+// Set the Change of res by comparing it with the baseline.  found is whether
+// res would be reported as a finding.  Results that say nothing about the
+// resource, such as errors and challenge pages, are left alone.
+func (b *Baseline) Compare(res *Result, found bool) {
+	if res.URL == nil || res.Error != nil || res.Challenge != "" {
+		return
+	}
+	prev, known := b.results[res.URL.String()]
+	switch {
+	case !known && found:
+		res.Change = ChangeNew
+	case !known:
+		return
+	case res.Code == 304:
+		res.Change = ChangeUnchanged
+	case !found:
+		res.Change = ChangeRemoved
+	case differs(prev, *res):
+		res.Change = ChangeChanged
+	default:
+		res.Change = ChangeUnchanged
+	}
+}
+
+// Whether a resource looks different from how it was before.  Validators are
+// compared when both responses have them; otherwise the length is.
+func differs(prev, cur Result) bool {
+	if prev.Code != cur.Code || maybeStringURL(prev.Redir) != maybeStringURL(cur.Redir) {
+		return true
+	}
+	if prev.ETag != "" && cur.ETag != "" {
+		return prev.ETag != cur.ETag
+	}
+	if prev.LastModified != "" && cur.LastModified != "" && prev.LastModified != cur.LastModified {
+		return true
+	}
+	return prev.Length >= 0 && cur.Length >= 0 && prev.Length != cur.Length
+}
@@ -0,0 +1,71 @@
+// Copyright 2017 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package results
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+)
+
+const testBaseline = `{"URL":"http://localhost/same","Code":200,"Length":10,"ETag":"\"a\""}
+{"URL":"http://localhost/edited","Code":200,"Length":10,"ETag":"\"a\""}
+{"URL":"http://localhost/grown","Code":200,"Length":10}
+{"URL":"http://localhost/gone","Code":200,"Length":10,"LastModified":"Mon, 02 Jan 2006 15:04:05 GMT"}
+`
+
+func TestBaseline(t *testing.T) {
+	b, err := ReadBaseline(strings.NewReader(testBaseline))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if urls := b.URLs(); len(urls) != 4 || urls[0].Path != "/edited" {
+		t.Errorf("Expected 4 sorted URLs, got %v", urls)
+	}
+	etag, modified := b.Validators(&url.URL{Scheme: "http", Host: "localhost", Path: "/same"})
+	if etag != `"a"` || modified != "" {
+		t.Errorf("Unexpected validators %q %q", etag, modified)
+	}
+	etag, modified = b.Validators(&url.URL{Scheme: "http", Host: "localhost", Path: "/gone"})
+	if etag != "" || modified != "Mon, 02 Jan 2006 15:04:05 GMT" {
+		t.Errorf("Unexpected validators %q %q", etag, modified)
+	}
+
+	cases := []struct {
+		res      Result
+		found    bool
+		expected string
+	}{
+		{Result{Code: 304}, false, ChangeUnchanged},
+		{Result{Code: 200, Length: 10, ETag: `"a"`}, true, ChangeUnchanged},
+		{Result{Code: 200, Length: 10, ETag: `"b"`}, true, ChangeChanged},
+		{Result{Code: 200, Length: 12}, true, ChangeChanged},
+		{Result{Code: 404, Length: 0}, false, ChangeRemoved},
+		{Result{Code: 200, Length: 5}, true, ChangeNew},
+		{Result{Code: 404, Length: 5}, false, ""},
+	}
+	paths := []string{"/same", "/same", "/edited", "/grown", "/gone", "/new", "/missing"}
+	for i, c := range cases {
+		c.res.URL = &url.URL{Scheme: "http", Host: "localhost", Path: paths[i]}
+		b.Compare(&c.res, c.found)
+		if c.res.Change != c.expected {
+			t.Errorf("Expected %s with code %d to be %q, got %q", paths[i], c.res.Code, c.expected, c.res.Change)
+		}
+	}
+
+	if _, err := ReadBaseline(strings.NewReader("not json")); err == nil {
+		t.Error("Expected error for invalid baseline.")
+	}
+}
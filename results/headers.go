@@ -0,0 +1,80 @@
+// Copyright 2017 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package results
+
+import (
+	"fmt"
+	"sort"
+)
+
+// A HeaderObservation is a header issue seen on responses from one host.
+// Headers are usually set for a whole site, so the same issue is reported
+// once per host rather than once per response.
+type HeaderObservation struct {
+	Host  string
+	Issue string
+	// Number of responses with the issue, and the first of them
+	Count   int64
+	Example string
+}
+
+func (o *HeaderObservation) String() string {
+	return fmt.Sprintf("%s (%d responses, e.g. %s)", o.Issue, o.Count, o.Example)
+}
+
+// Header observations for each host and issue seen
+type headerStats struct {
+	seen map[string]map[string]*HeaderObservation
+}
+
+func (h *headerStats) add(res Result) {
+	if len(res.HeaderIssues) == 0 || res.URL == nil {
+		return
+	}
+	if h.seen == nil {
+		h.seen = make(map[string]map[string]*HeaderObservation)
+	}
+	host := res.URL.Host
+	issues, ok := h.seen[host]
+	if !ok {
+		issues = make(map[string]*HeaderObservation)
+		h.seen[host] = issues
+	}
+	for _, issue := range res.HeaderIssues {
+		o, ok := issues[issue]
+		if !ok {
+			o = &HeaderObservation{Host: host, Issue: issue, Example: res.URL.String()}
+			issues[issue] = o
+		}
+		o.Count++
+	}
+}
+
+// All observations, ordered by host and then issue.
+func (h *headerStats) observations() []*HeaderObservation {
+	obs := make([]*HeaderObservation, 0)
+	for _, issues := range h.seen {
+		for _, o := range issues {
+			obs = append(obs, o)
+		}
+	}
+	sort.Slice(obs, func(i, j int) bool {
+		if obs[i].Host != obs[j].Host {
+			return obs[i].Host < obs[j].Host
+		}
+		return obs[i].Issue < obs[j].Issue
+	})
+	return obs
+}
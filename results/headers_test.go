@@ -0,0 +1,64 @@
+// Copyright 2017 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package results
+
+import (
+	"bytes"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestHeaderStats(t *testing.T) {
+	mkResult := func(u string, issues ...string) Result {
+		pu, _ := url.Parse(u)
+		return Result{URL: pu, Code: 200, HeaderIssues: issues}
+	}
+	stats := headerStats{}
+	stats.add(mkResult("http://b.example/a", "CORS allows any origin"))
+	stats.add(mkResult("http://a.example/x", "missing Content-Security-Policy", "verbose Server: nginx/1.2"))
+	stats.add(mkResult("http://a.example/y", "missing Content-Security-Policy"))
+	stats.add(mkResult("http://a.example/z"))
+	obs := stats.observations()
+	if len(obs) != 3 {
+		t.Fatalf("Expected 3 observations, got %d", len(obs))
+	}
+	if obs[0].Host != "a.example" || obs[0].Issue != "missing Content-Security-Policy" || obs[0].Count != 2 {
+		t.Errorf("Unexpected first observation: %+v", obs[0])
+	}
+	if obs[0].Example != "http://a.example/x" {
+		t.Errorf("Expected first response as example, got %s", obs[0].Example)
+	}
+	if obs[2].Host != "b.example" {
+		t.Errorf("Expected b.example last, got %+v", obs[2])
+	}
+}
+
+func TestPlainResultsManager_Headers(t *testing.T) {
+	buf := bytes.Buffer{}
+	mgr := &PlainResultsManager{writer: &buf}
+	rchan := make(chan Result)
+	mgr.Run(rchan)
+	for _, r := range makeTestResults() {
+		r.HeaderIssues = []string{"CORS allows any origin"}
+		rchan <- r
+	}
+	close(rchan)
+	mgr.Wait()
+	out := buf.String()
+	if !strings.Contains(out, "Header observations:\nlocalhost\n    CORS allows any origin (3 responses, e.g. http://localhost/") {
+		t.Errorf("Expected header observations in output: %s", out)
+	}
+}
@@ -0,0 +1,251 @@
+// Copyright 2017 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package results
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Upper bounds of the latency histogram buckets.  A final bucket holds all
+// responses slower than the last bound.
+var LatencyBuckets = []time.Duration{
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	250 * time.Millisecond,
+	500 * time.Millisecond,
+	time.Second,
+	2500 * time.Millisecond,
+	5 * time.Second,
+}
+
+// A LatencyHistogram counts the responses within a directory by how long they
+// took.  Consistently slow directories often do heavier processing on the
+// server and are worth a closer look.
+type LatencyHistogram struct {
+	// Directory URL, including the trailing slash
+	Directory string
+	// Counts for each bucket in LatencyBuckets, plus one for slower responses
+	Counts []int64
+	// Number of responses and their total and maximum time
+	Count int64
+	Total time.Duration
+	Max   time.Duration
+	// Uniform sample of the response times, for percentiles
+	samples []time.Duration
+}
+
+// Response times kept per directory for percentiles.  Larger directories are
+// sampled, so their percentiles are estimates.
+const latencySampleSize = 1000
+
+// A LatencyBucket is a labelled histogram bucket for display.
+type LatencyBucket struct {
+	Label string
+	Count int64
+}
+
+func newLatencyHistogram(dir string) *LatencyHistogram {
+	return &LatencyHistogram{
+		Directory: dir,
+		Counts:    make([]int64, len(LatencyBuckets)+1),
+	}
+}
+
+func (h *LatencyHistogram) add(d time.Duration) {
+	i := sort.Search(len(LatencyBuckets), func(i int) bool {
+		return d < LatencyBuckets[i]
+	})
+	h.Counts[i]++
+	h.Count++
+	h.Total += d
+	if d > h.Max {
+		h.Max = d
+	}
+	if len(h.samples) < latencySampleSize {
+		h.samples = append(h.samples, d)
+	} else if i := rand.Int63n(h.Count); i < latencySampleSize {
+		h.samples[i] = d
+	}
+}
+
+// Response time that p percent of responses were at least as fast as.
+func (h *LatencyHistogram) Percentile(p float64) time.Duration {
+	if len(h.samples) == 0 {
+		return 0
+	}
+	sorted := make([]time.Duration, len(h.samples))
+	copy(sorted, h.samples)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	rank := int(math.Ceil(p/100*float64(len(sorted)))) - 1
+	if rank < 0 {
+		rank = 0
+	}
+	return sorted[rank]
+}
+
+// Mean response time
+func (h *LatencyHistogram) Mean() time.Duration {
+	if h.Count == 0 {
+		return 0
+	}
+	return h.Total / time.Duration(h.Count)
+}
+
+// Non-empty buckets, labelled with their upper bound.
+func (h *LatencyHistogram) Buckets() []LatencyBucket {
+	buckets := make([]LatencyBucket, 0, len(h.Counts))
+	for i, c := range h.Counts {
+		if c == 0 {
+			continue
+		}
+		var label string
+		if i < len(LatencyBuckets) {
+			label = "<" + LatencyBuckets[i].String()
+		} else {
+			label = ">=" + LatencyBuckets[len(LatencyBuckets)-1].String()
+		}
+		buckets = append(buckets, LatencyBucket{Label: label, Count: c})
+	}
+	return buckets
+}
+
+func (h *LatencyHistogram) String() string {
+	pieces := make([]string, 0, len(h.Counts))
+	for _, b := range h.Buckets() {
+		pieces = append(pieces, fmt.Sprintf("%s %d", b.Label, b.Count))
+	}
+	return fmt.Sprintf("%s (%d requests, mean %s, p50 %s, p90 %s, p99 %s, max %s): %s",
+		h.Directory, h.Count, roundLatency(h.Mean()), roundLatency(h.Percentile(50)),
+		roundLatency(h.Percentile(90)), roundLatency(h.Percentile(99)),
+		roundLatency(h.Max), strings.Join(pieces, ", "))
+}
+
+func roundLatency(d time.Duration) time.Duration {
+	return d.Round(time.Millisecond)
+}
+
+// Latency histograms for each directory seen
+type latencyStats struct {
+	dirs map[string]*LatencyHistogram
+}
+
+func (l *latencyStats) add(res Result) {
+	if res.Error != nil || res.Duration <= 0 || res.URL == nil {
+		return
+	}
+	if l.dirs == nil {
+		l.dirs = make(map[string]*LatencyHistogram)
+	}
+	dir := resultDirectory(res.URL)
+	h, ok := l.dirs[dir]
+	if !ok {
+		h = newLatencyHistogram(dir)
+		l.dirs[dir] = h
+	}
+	h.add(res.Duration)
+}
+
+// All histograms, slowest directory first.
+func (l *latencyStats) histograms() []*LatencyHistogram {
+	hists := make([]*LatencyHistogram, 0, len(l.dirs))
+	for _, h := range l.dirs {
+		hists = append(hists, h)
+	}
+	sort.Slice(hists, func(i, j int) bool {
+		if hists[i].Mean() != hists[j].Mean() {
+			return hists[i].Mean() > hists[j].Mean()
+		}
+		return hists[i].Directory < hists[j].Directory
+	})
+	return hists
+}
+
+// Thresholds for flagging a response as slow: the directory needs enough
+// responses to compare with, and the response must be well outside their
+// spread, as well as noticeably slower in absolute terms.
+const (
+	latencyMinSamples = 10
+	latencyMaxSigma   = 4
+	latencyMinExcess  = 250 * time.Millisecond
+)
+
+// LatencyDetector flags responses that took far longer than others in the
+// same directory.  These are often heavy endpoints, debug handlers, or
+// parameters reaching something like a database sleep, and are worth a
+// closer look whatever their status.
+type LatencyDetector struct {
+	dirs map[string]*latencyBaseline
+	lock sync.Mutex
+}
+
+// Running mean and variance (Welford's method) of response times, in
+// nanoseconds.  Flagged responses are included, so a host that slows down
+// overall soon stops being flagged.
+type latencyBaseline struct {
+	count int64
+	mean  float64
+	m2    float64
+}
+
+func NewLatencyDetector() *LatencyDetector {
+	return &LatencyDetector{dirs: make(map[string]*latencyBaseline)}
+}
+
+// Set res.LatencyOutlier if it took far longer than earlier responses from
+// its directory.
+func (d *LatencyDetector) Observe(res *Result) {
+	if res.Error != nil || res.Duration <= 0 || res.URL == nil || res.Challenge != "" {
+		return
+	}
+	dir := resultDirectory(res.URL)
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	b, ok := d.dirs[dir]
+	if !ok {
+		b = &latencyBaseline{}
+		d.dirs[dir] = b
+	}
+	t := float64(res.Duration)
+	if b.count >= latencyMinSamples {
+		stddev := math.Sqrt(b.m2 / float64(b.count-1))
+		if t > b.mean+latencyMaxSigma*stddev && t-b.mean >= float64(latencyMinExcess) && t >= 2*b.mean {
+			res.LatencyOutlier = fmt.Sprintf("%s vs %s typical", roundLatency(res.Duration), roundLatency(time.Duration(b.mean)))
+		}
+	}
+	b.count++
+	delta := t - b.mean
+	b.mean += delta / float64(b.count)
+	b.m2 += delta * (t - b.mean)
+}
+
+// The directory containing a resource, or the resource itself if it is a
+// directory.
+func resultDirectory(u *url.URL) string {
+	p := u.Path
+	if i := strings.LastIndex(p, "/"); i != -1 {
+		p = p[:i+1]
+	} else {
+		p = "/"
+	}
+	d := url.URL{Scheme: u.Scheme, Host: u.Host, Path: p}
+	return d.String()
+}
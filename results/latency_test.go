@@ -0,0 +1,181 @@
+// Copyright 2017 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package results
+
+import (
+	"bytes"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestResultDirectory(t *testing.T) {
+	cases := map[string]string{
+		"http://localhost/":            "http://localhost/",
+		"http://localhost/a/b.php":     "http://localhost/a/",
+		"http://localhost/a/b/":        "http://localhost/a/b/",
+		"https://localhost:8443/a?x=1": "https://localhost:8443/",
+		"http://localhost":             "http://localhost/",
+	}
+	for in, expected := range cases {
+		u, _ := url.Parse(in)
+		if got := resultDirectory(u); got != expected {
+			t.Errorf("resultDirectory(%s): expected %s, got %s", in, expected, got)
+		}
+	}
+}
+
+func TestLatencyHistogram(t *testing.T) {
+	h := newLatencyHistogram("http://localhost/")
+	for _, d := range []time.Duration{10 * time.Millisecond, 60 * time.Millisecond, 70 * time.Millisecond, 10 * time.Second} {
+		h.add(d)
+	}
+	if h.Count != 4 || h.Max != 10*time.Second {
+		t.Errorf("Unexpected histogram: %+v", h)
+	}
+	if h.Mean() != (10140*time.Millisecond)/4 {
+		t.Errorf("Unexpected mean: %s", h.Mean())
+	}
+	buckets := h.Buckets()
+	expected := []LatencyBucket{{"<50ms", 1}, {"<100ms", 2}, {">=5s", 1}}
+	if len(buckets) != len(expected) {
+		t.Fatalf("Expected %d buckets, got %v", len(expected), buckets)
+	}
+	for i, b := range expected {
+		if buckets[i] != b {
+			t.Errorf("Bucket %d: expected %v, got %v", i, b, buckets[i])
+		}
+	}
+}
+
+func TestLatencyStats(t *testing.T) {
+	mkResult := func(u string, d time.Duration) Result {
+		pu, _ := url.Parse(u)
+		return Result{URL: pu, Code: 200, Duration: d}
+	}
+	stats := latencyStats{}
+	stats.add(mkResult("http://localhost/fast/a", 10*time.Millisecond))
+	stats.add(mkResult("http://localhost/slow/a", time.Second))
+	stats.add(mkResult("http://localhost/slow/b", 3*time.Second))
+	stats.add(mkResult("http://localhost/none/a", 0))
+	hists := stats.histograms()
+	if len(hists) != 2 {
+		t.Fatalf("Expected 2 directories, got %d", len(hists))
+	}
+	if hists[0].Directory != "http://localhost/slow/" || hists[0].Count != 2 {
+		t.Errorf("Expected slow directory first, got %+v", hists[0])
+	}
+}
+
+func TestPlainResultsManager_Latency(t *testing.T) {
+	buf := bytes.Buffer{}
+	mgr := &PlainResultsManager{writer: &buf}
+	rchan := make(chan Result)
+	mgr.Run(rchan)
+	for _, r := range makeTestResults() {
+		r.Duration = 200 * time.Millisecond
+		rchan <- r
+	}
+	close(rchan)
+	mgr.Wait()
+	out := buf.String()
+	if !strings.Contains(out, "Response times by directory:\nhttp://localhost/ (3 requests, mean 200ms, p50 200ms, p90 200ms, p99 200ms, max 200ms): <250ms 3\n") {
+		t.Errorf("Expected latency histogram in output: %s", out)
+	}
+}
+
+func TestHTMLResultsManager_Latency(t *testing.T) {
+	buf := bytes.Buffer{}
+	mgr := &HTMLResultsManager{writer: &buf}
+	rchan := make(chan Result)
+	mgr.Run(rchan)
+	for _, r := range makeTestResults() {
+		r.Duration = 1500 * time.Millisecond
+		rchan <- r
+	}
+	close(rchan)
+	mgr.Wait()
+	if !strings.Contains(buf.String(), "<td>http://localhost/</td><td>3</td><td>1.5s</td>") {
+		t.Errorf("Expected latency table in output: %s", buf.String())
+	}
+}
+
+func TestLatencyHistogram_Percentile(t *testing.T) {
+	h := newLatencyHistogram("http://localhost/")
+	if h.Percentile(50) != 0 {
+		t.Errorf("Expected 0 for empty histogram, got %s", h.Percentile(50))
+	}
+	for i := 100; i >= 1; i-- {
+		h.add(time.Duration(i) * time.Millisecond)
+	}
+	for p, expected := range map[float64]time.Duration{50: 50 * time.Millisecond, 90: 90 * time.Millisecond, 99: 99 * time.Millisecond, 100: 100 * time.Millisecond} {
+		if got := h.Percentile(p); got != expected {
+			t.Errorf("p%v: expected %s, got %s", p, expected, got)
+		}
+	}
+	for i := 0; i < 2*latencySampleSize; i++ {
+		h.add(time.Millisecond)
+	}
+	if len(h.samples) != latencySampleSize {
+		t.Errorf("Expected sample to be capped at %d, got %d", latencySampleSize, len(h.samples))
+	}
+}
+
+func TestLatencyDetector(t *testing.T) {
+	mkResult := func(path string, d time.Duration) *Result {
+		return &Result{URL: &url.URL{Scheme: "http", Host: "localhost", Path: path}, Code: 404, Duration: d}
+	}
+	d := NewLatencyDetector()
+	early := mkResult("/app/early", 3*time.Second)
+	d.Observe(early)
+	if early.LatencyOutlier != "" {
+		t.Errorf("Expected no flag without a baseline, got %q", early.LatencyOutlier)
+	}
+	for i := 0; i < 20; i++ {
+		d.Observe(mkResult("/app/x", time.Duration(100+i%5)*time.Millisecond))
+		d.Observe(mkResult("/other/x", time.Duration(100+i%5)*time.Millisecond))
+	}
+	slow := mkResult("/app/debug", 4*time.Second)
+	d.Observe(slow)
+	if !strings.HasPrefix(slow.LatencyOutlier, "4s vs ") {
+		t.Errorf("Expected slow response to be flagged, got %q", slow.LatencyOutlier)
+	}
+	// Slower, but not by enough to matter
+	jitter := mkResult("/other/y", 300*time.Millisecond)
+	d.Observe(jitter)
+	if jitter.LatencyOutlier != "" {
+		t.Errorf("Expected small excess not to be flagged, got %q", jitter.LatencyOutlier)
+	}
+}
+
+func TestPlainResultsManager_Slow(t *testing.T) {
+	buf := bytes.Buffer{}
+	mgr := &PlainResultsManager{writer: &buf}
+	rchan := make(chan Result)
+	mgr.Run(rchan)
+	rchan <- Result{
+		URL:            &url.URL{Scheme: "http", Host: "localhost", Path: "/search"},
+		Code:           500,
+		Length:         -1,
+		LatencyOutlier: "5s vs 100ms typical",
+	}
+	close(rchan)
+	mgr.Wait()
+	expected := "Slow responses (compared with their directory):\n500 http://localhost/search: 5s vs 100ms typical\n"
+	if !strings.Contains(buf.String(), expected) {
+		t.Errorf("Expected slow section %q, got %q", expected, buf.String())
+	}
+}
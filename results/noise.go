@@ -0,0 +1,167 @@
+// Copyright 2017 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package results
+
+import (
+	"net/url"
+	"path"
+	"strings"
+	"sync"
+)
+
+const (
+	// Responses in a cluster before it can be treated as noise
+	noiseMinCluster = 8
+	// Lengths within this many bytes, or 5%, are alike, as pages often echo
+	// the path requested
+	noiseLengthSlack = 32
+)
+
+// NoiseDetector learns what the responses in each directory usually look
+// like, as results come in, so that repeats of the dominant response can be
+// suppressed.  Responses are clustered by status, content type, redirect and
+// approximate length; once a cluster has at least noiseMinCluster responses
+// and makes up most of its directory, later members are marked as noise,
+// with the first of them still reported.  Results that are interesting in
+// themselves, e.g. with leaks or a severity, are never noise.
+type NoiseDetector struct {
+	dirs map[string]*noiseDir
+	lock sync.Mutex
+}
+
+type noiseDir struct {
+	clusters []*noiseCluster
+	total    int
+}
+
+type noiseCluster struct {
+	code        int
+	contentType string
+	redirect    string
+	length      int64
+	count       int
+	// URL of the first response in the cluster
+	first string
+}
+
+func NewNoiseDetector() *NoiseDetector {
+	return &NoiseDetector{dirs: make(map[string]*noiseDir)}
+}
+
+// Set res.NoiseOf if it repeats the dominant response in its directory.
+func (d *NoiseDetector) Observe(res *Result) {
+	if res.URL == nil || res.Error != nil || res.Challenge != "" || res.AliasOf != "" || res.ListedIn != "" || standsOut(res) {
+		return
+	}
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	key := noiseDirKey(res.URL)
+	dir, ok := d.dirs[key]
+	if !ok {
+		dir = &noiseDir{}
+		d.dirs[key] = dir
+	}
+	dir.total++
+	redirect := noiseRedirect(res)
+	for _, c := range dir.clusters {
+		if c.matches(res, redirect) {
+			c.count++
+			if c.count >= noiseMinCluster && c.count*2 > dir.total {
+				res.NoiseOf = c.first
+			}
+			return
+		}
+	}
+	dir.clusters = append(dir.clusters, &noiseCluster{
+		code:        res.Code,
+		contentType: res.ContentType,
+		redirect:    redirect,
+		length:      res.Length,
+		count:       1,
+		first:       res.URL.String(),
+	})
+}
+
+func (c *noiseCluster) matches(res *Result, redirect string) bool {
+	if c.code != res.Code || c.contentType != res.ContentType || c.redirect != redirect {
+		return false
+	}
+	if redirect != "" || c.length == res.Length {
+		return true
+	}
+	if c.length < 0 || res.Length < 0 {
+		return false
+	}
+	diff := c.length - res.Length
+	if diff < 0 {
+		diff = -diff
+	}
+	return diff <= noiseLengthSlack || diff*20 <= c.length
+}
+
+// Whether a result has something to say beyond its status, so it should be
+// reported whatever the responses around it look like.
+func standsOut(res *Result) bool {
+	return res.Severity != "" || len(res.Leaks) > 0 || len(res.Notes) > 0 ||
+		len(res.ArchiveListing) > 0 || res.DirListing > 0 || res.Credentials != "" ||
+		res.AgentDiff != "" || res.OffScopeRedirect || res.LatencyOutlier != "" ||
+		(res.Change != "" && res.Change != ChangeUnchanged)
+}
+
+// The directory a result is in, with its scheme and host.
+func noiseDirKey(u *url.URL) string {
+	dir := path.Dir(strings.TrimSuffix(u.Path, "/"))
+	return u.Scheme + "://" + u.Host + dir
+}
+
+// Describe where a result redirects to, so that redirects adding a slash
+// (/x to /x/) are alike whatever the path.
+func noiseRedirect(res *Result) string {
+	if res.Redir == nil {
+		return ""
+	}
+	if res.Redir.Host == res.URL.Host && res.Redir.Path == res.URL.Path+"/" {
+		return "+/"
+	}
+	return res.Redir.String()
+}
+
+// Responses suppressed as repeats of one that was reported, as listed in
+// reports.
+type NoiseGroup struct {
+	URL   string
+	Code  int
+	Count int
+}
+
+// Suppressed responses, grouped by the URL they repeat, in order of first
+// appearance
+type noiseStats struct {
+	groups []*NoiseGroup
+	byURL  map[string]*NoiseGroup
+}
+
+func (n *noiseStats) add(res Result) {
+	if n.byURL == nil {
+		n.byURL = make(map[string]*NoiseGroup)
+	}
+	g, ok := n.byURL[res.NoiseOf]
+	if !ok {
+		g = &NoiseGroup{URL: res.NoiseOf, Code: res.Code}
+		n.byURL[res.NoiseOf] = g
+		n.groups = append(n.groups, g)
+	}
+	g.Count++
+}
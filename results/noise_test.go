@@ -0,0 +1,94 @@
+// Copyright 2017 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package results
+
+import (
+	"fmt"
+	"net/url"
+	"testing"
+)
+
+func TestNoiseDetector(t *testing.T) {
+	mk := func(path string, code int, length int64) *Result {
+		return &Result{URL: &url.URL{Scheme: "http", Host: "app", Path: path}, Code: code, Length: length, ContentType: "text/html"}
+	}
+	d := NewNoiseDetector()
+	noisy := 0
+	for i := 0; i < 20; i++ {
+		// Catch-all page echoing the path, so lengths vary a little
+		r := mk(fmt.Sprintf("/app/word%d", i), 200, 1000+int64(i))
+		d.Observe(r)
+		if i < noiseMinCluster-1 && r.NoiseOf != "" {
+			t.Errorf("Expected %s not to be noise before the cluster is learned", r.URL)
+		}
+		if r.NoiseOf != "" {
+			noisy++
+			if r.NoiseOf != "http://app/app/word0" {
+				t.Errorf("Expected noise of the first response, got %q", r.NoiseOf)
+			}
+		}
+	}
+	if expected := 20 - noiseMinCluster + 1; noisy != expected {
+		t.Errorf("Expected %d noisy responses, got %d", expected, noisy)
+	}
+
+	different := mk("/app/login", 200, 5000)
+	d.Observe(different)
+	if different.NoiseOf != "" {
+		t.Errorf("Expected different response not to be noise, got %q", different.NoiseOf)
+	}
+	severe := mk("/app/.env", 200, 1003)
+	severe.Severity = SeverityCritical
+	d.Observe(severe)
+	if severe.NoiseOf != "" {
+		t.Errorf("Expected result with a severity not to be noise, got %q", severe.NoiseOf)
+	}
+	other := mk("/other/word1", 200, 1001)
+	d.Observe(other)
+	if other.NoiseOf != "" {
+		t.Errorf("Expected response in another directory not to be noise, got %q", other.NoiseOf)
+	}
+}
+
+func TestNoiseDetector_NotDominant(t *testing.T) {
+	d := NewNoiseDetector()
+	for i := 0; i < 30; i++ {
+		// Alike responses are only a third of the directory
+		length := int64(100)
+		if i%3 != 0 {
+			length = int64(10000 * i)
+		}
+		r := &Result{URL: &url.URL{Scheme: "http", Host: "app", Path: fmt.Sprintf("/x%d", i)}, Code: 200, Length: length}
+		d.Observe(r)
+		if r.NoiseOf != "" {
+			t.Fatalf("Expected no noise without a dominant cluster, got %s", r.URL)
+		}
+	}
+}
+
+func TestNoiseDetector_Redirects(t *testing.T) {
+	d := NewNoiseDetector()
+	var last *Result
+	for i := 0; i < noiseMinCluster; i++ {
+		u := &url.URL{Scheme: "http", Host: "app", Path: fmt.Sprintf("/d%d", i)}
+		redir := *u
+		redir.Path += "/"
+		last = &Result{URL: u, Code: 301, Redir: &redir, Length: int64(100 + 50*i)}
+		d.Observe(last)
+	}
+	if last.NoiseOf != "http://app/d0" {
+		t.Errorf("Expected redirects adding a slash to be alike, got %q", last.NoiseOf)
+	}
+}
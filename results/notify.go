@@ -0,0 +1,146 @@
+// Copyright 2017 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package results
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/Matir/webborer/logging"
+	ss "github.com/Matir/webborer/settings"
+	"net/http"
+	"time"
+)
+
+// Payload formats for webhook notifications
+const (
+	// The result as JSON, as in -format json
+	NotifyJSON = "json"
+	// A Slack incoming webhook message
+	NotifySlack = "slack"
+)
+
+// Notifications waiting to be sent before more are dropped, so that a slow
+// webhook never holds up the scan.
+const notifyQueueSize = 256
+
+// WebhookNotifier POSTs each high-interest result to a webhook as it arrives,
+// so that a long scan can raise an alert without waiting for the report.
+type WebhookNotifier struct {
+	settings *ss.ScanSettings
+	url      string
+	format   string
+	client   *http.Client
+	queue    chan Result
+	finished chan bool
+}
+
+func NewWebhookNotifier(settings *ss.ScanSettings) (*WebhookNotifier, error) {
+	format := settings.NotifyFormat
+	if format == "" {
+		format = NotifyJSON
+	}
+	if format != NotifyJSON && format != NotifySlack {
+		return nil, fmt.Errorf("Invalid notification format: %s", format)
+	}
+	return &WebhookNotifier{
+		settings: settings,
+		url:      settings.NotifyWebhook,
+		format:   format,
+		client:   &http.Client{Timeout: 10 * time.Second},
+		queue:    make(chan Result, notifyQueueSize),
+		finished: make(chan bool),
+	}, nil
+}
+
+func (n *WebhookNotifier) Run(res <-chan Result) {
+	go func() {
+		for r := range n.queue {
+			if err := n.send(r); err != nil {
+				logging.Logf(logging.LogWarning, "Unable to send notification for %s: %s", r.URL.String(), err.Error())
+			}
+		}
+		n.finished <- true
+	}()
+	go func() {
+		defer close(n.queue)
+		for r := range res {
+			if !n.interesting(r) {
+				continue
+			}
+			select {
+			case n.queue <- r:
+			default:
+				logging.Logf(logging.LogWarning, "Notification queue full, dropping %s.", r.URL.String())
+			}
+		}
+	}()
+}
+
+func (n *WebhookNotifier) Wait() {
+	<-n.finished
+}
+
+// Whether a result is worth a notification: a response with one of the
+// notify codes that is a finding, or a difference when comparing with a
+// baseline.
+func (n *WebhookNotifier) interesting(r Result) bool {
+	if r.URL == nil || r.Error != nil || r.Challenge != "" || r.AliasOf != "" || r.NoiseOf != "" || !n.settings.NotifyCodes.Contains(r.Code) {
+		return false
+	}
+	if n.settings.DiffPath != "" {
+		return r.Change != "" && r.Change != ChangeUnchanged
+	}
+	return n.settings.IsPositiveCode(r.Code)
+}
+
+func (n *WebhookNotifier) send(r Result) error {
+	body, err := n.payload(r)
+	if err != nil {
+		return err
+	}
+	resp, err := n.client.Post(n.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("Webhook returned %s", resp.Status)
+	}
+	return nil
+}
+
+func (n *WebhookNotifier) payload(r Result) ([]byte, error) {
+	if n.format == NotifySlack {
+		return json.Marshal(struct {
+			Text string `json:"text"`
+		}{Text: "webborer found " + summarize(r)})
+	}
+	return json.Marshal(r)
+}
+
+// Describe a result in one line, e.g. "200 http://host/admin (512 bytes)".
+func summarize(r Result) string {
+	s := fmt.Sprintf("%d %s", r.Code, r.URL.String())
+	if r.Redir != nil {
+		s += " -> " + r.Redir.String()
+	} else if r.Length >= 0 {
+		s += " (" + r.Size() + ")"
+	}
+	if r.Change != "" {
+		s += " [" + r.Change + "]"
+	}
+	return s
+}
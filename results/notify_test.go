@@ -0,0 +1,99 @@
+// Copyright 2017 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package results
+
+import (
+	"encoding/json"
+	ss "github.com/Matir/webborer/settings"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+)
+
+func webhookServer() (*httptest.Server, func() []string) {
+	var lock sync.Mutex
+	var bodies []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		lock.Lock()
+		bodies = append(bodies, string(body))
+		lock.Unlock()
+	}))
+	return server, func() []string {
+		lock.Lock()
+		defer lock.Unlock()
+		return append([]string(nil), bodies...)
+	}
+}
+
+func TestWebhookNotifier(t *testing.T) {
+	server, bodies := webhookServer()
+	defer server.Close()
+	s := &ss.ScanSettings{
+		NotifyWebhook: server.URL,
+		NotifyCodes:   ss.MustParseCodeRanges("200,403"),
+	}
+	n, err := NewWebhookNotifier(s)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	rchan := make(chan Result)
+	n.Run(rchan)
+	for _, r := range makeTestResults() {
+		rchan <- r
+	}
+	rchan <- Result{URL: &url.URL{Scheme: "http", Host: "localhost", Path: "/cf"}, Code: 403, Challenge: "cloudflare js-challenge"}
+	close(rchan)
+	n.Wait()
+	got := bodies()
+	if len(got) != 1 {
+		t.Fatalf("Expected one notification, got %v", got)
+	}
+	var r Result
+	if err := json.Unmarshal([]byte(got[0]), &r); err != nil || r.URL.Path != "/" || r.Code != 200 {
+		t.Errorf("Expected JSON of the result for /, got %s (%v)", got[0], err)
+	}
+}
+
+func TestWebhookNotifier_Slack(t *testing.T) {
+	server, bodies := webhookServer()
+	defer server.Close()
+	s := &ss.ScanSettings{
+		NotifyWebhook: server.URL,
+		NotifyFormat:  NotifySlack,
+		NotifyCodes:   ss.MustParseCodeRanges("200"),
+	}
+	n, err := NewWebhookNotifier(s)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	rchan := make(chan Result)
+	n.Run(rchan)
+	rchan <- Result{URL: &url.URL{Scheme: "http", Host: "localhost", Path: "/admin"}, Code: 200, Length: 512}
+	close(rchan)
+	n.Wait()
+	expected := `{"text":"webborer found 200 http://localhost/admin (512 bytes)"}`
+	if got := bodies(); len(got) != 1 || got[0] != expected {
+		t.Errorf("Expected %s, got %v", expected, got)
+	}
+
+	s.NotifyFormat = "carrier-pigeon"
+	if _, err := NewWebhookNotifier(s); err == nil {
+		t.Error("Expected error for invalid format.")
+	}
+}
@@ -18,11 +18,14 @@ package results
 import (
 	"encoding/csv"
 	"fmt"
+	"github.com/Matir/webborer/logging"
 	ss "github.com/Matir/webborer/settings"
+	"github.com/Matir/webborer/storage"
 	"io"
-	"net/http"
 	"net/url"
 	"os"
+	"strings"
+	"time"
 )
 
 // This is the result emitted by the worker for each URL tested.
@@ -33,12 +36,144 @@ type Result struct {
 	Code int
 	// Error if one occurred
 	Error error
-	// Redirect URL
+	// Redirect URL, if the redirect was not followed
 	Redir *url.URL
-	// Content length
+	// Each URL requested, starting with URL, and its status code, if there
+	// were any redirects
+	Redirects []RedirectHop
+	// Whether Redir is outside the scope of the scan
+	OffScopeRedirect bool
+	// Content length, after decoding any Content-Encoding
 	Length int64
-	// Content-type header
+	// Bytes received for the body, before decoding, and the encoding they
+	// were in, if it was compressed
+	TransferLength int64
+	Encoding       string
+	// Content-type header, or the sniffed type if the header was missing or
+	// generic
 	ContentType string
+	// Whether ContentType was determined by sniffing the body
+	Sniffed bool
+	// Whether the body was larger than -max-body-size, so only the start of
+	// it was examined
+	Truncated bool
+	// Validators from the response, for conditional requests in later scans
+	ETag         string
+	LastModified string
+	// How the resource differs from the -diff baseline, if there is one: one
+	// of the Change* values
+	Change string
+	// Contents of the resource, if it is an archive
+	ArchiveListing []string
+	// Internal hostnames and addresses disclosed by the response
+	Leaks []string
+	// Time until the response headers were received
+	Duration time.Duration
+	// Kind of challenge or CAPTCHA page served instead of the resource, if
+	// any, e.g. "cloudflare js-challenge"
+	Challenge string
+	// How the response differed when requested with the -compare-agent
+	// User-Agent, if it did
+	AgentDiff string
+	// Why a WAF or rate limiter was found to be blocking the scan, if this
+	// result is where it was noticed
+	Blocked string
+	// Whether the host was blocking the scan when this result was received,
+	// so it may not reflect what is really there
+	Suspect bool
+	// Whether the host was found to have stopped blocking the scan with this
+	// result, so the results after it can be trusted again
+	Unblocked bool
+	// WWW-Authenticate challenge of a 401 response
+	Authenticate string
+	// Username and password, as user:pass, that were accepted where the
+	// server asked for authentication
+	Credentials string
+	// How much longer the response took than others in its directory, if it
+	// was an outlier, e.g. "2.1s vs 120ms typical"
+	LatencyOutlier string
+	// URL of the earlier finding this is another name for, if it is one,
+	// e.g. http://host/admin/ for /Admin on a case-insensitive server
+	AliasOf string
+	// Security-relevant observations about the response headers, e.g.
+	// "missing Content-Security-Policy"
+	HeaderIssues []string
+	// Observations added by plugins, e.g. "aws-key in line 12"
+	Notes []string
+	// Number of entries, if the response is a directory listing
+	DirListing int
+	// URL of the directory listing this was found in, if it was reported
+	// from the listing instead of being requested
+	ListedIn string
+	// URL of the first response in its directory this is a repeat of, if it
+	// is one of many alike and so reported only as a count
+	NoiseOf string
+	// How interesting the resource is, one of the Severity* values, and why,
+	// if it matched a signature
+	Severity       string
+	SeverityReason string
+}
+
+// How a resource changed since the baseline scan.
+const (
+	ChangeNew       = "new"
+	ChangeChanged   = "changed"
+	ChangeRemoved   = "removed"
+	ChangeUnchanged = "unchanged"
+)
+
+// One request in a chain of redirects.
+type RedirectHop struct {
+	URL  string
+	Code int
+}
+
+// Describe the size of the body, e.g. "512 bytes" or "512 bytes, 180 gzip",
+// or "" if it isn't known.
+func (r Result) Size() string {
+	if r.Length < 0 {
+		return ""
+	}
+	s := fmt.Sprintf("%d bytes", r.Length)
+	if t := r.TransferSize(); t != "" {
+		s += ", " + t
+	}
+	return s
+}
+
+// Describe the size of a compressed body as received, e.g. "180 gzip", or ""
+// if it wasn't compressed.
+func (r Result) TransferSize() string {
+	if r.Encoding == "" || r.TransferLength < 0 {
+		return ""
+	}
+	return fmt.Sprintf("%d %s", r.TransferLength, r.Encoding)
+}
+
+// Describe the severity of a result and why, e.g. "high (database dump)".
+func (r Result) DescribeSeverity() string {
+	if r.SeverityReason == "" {
+		return r.Severity
+	}
+	return fmt.Sprintf("%s (%s)", r.Severity, r.SeverityReason)
+}
+
+// Describe the blocking event at a result: why blocking was detected, or that
+// it stopped.
+func (r Result) BlockEvent() string {
+	if r.Unblocked {
+		return "blocking stopped"
+	}
+	return r.Blocked
+}
+
+// Describe the redirects for a result, e.g. "301 http://a/ -> 200 http://b/".
+func (r Result) RedirectChain() string {
+	hops := make([]string, len(r.Redirects))
+	for i, h := range r.Redirects {
+		hops[i] = fmt.Sprintf("%d %s", h.Code, h.URL)
+	}
+	return strings.Join(hops, " -> ")
 }
 
 // ResultsManager provides an interface for reading results from a channel and
@@ -54,59 +189,163 @@ type ResultsManager interface {
 
 type baseResultsManager struct {
 	finished chan bool
+	settings *ss.ScanSettings
+	latency  latencyStats
+	headers  headerStats
+	// Challenge pages, reported separately from findings
+	challenges []Result
+	// Results where blocking was detected
+	blocks []Result
+	// Aliases of findings, listed with them instead of on their own
+	aliases aliasStats
+	// Responses much slower than others in their directory
+	slow []Result
+	// Repeats of common responses, counted instead of reported
+	noise noiseStats
 }
 
 // Available output formats as strings.
-var OutputFormats = []string{"text", "csv", "html"}
+var OutputFormats = []string{"text", "csv", "html", "json"}
 
 func init() {
 	ss.SetOutputFormats(OutputFormats)
 }
 
-// Returns true if this is a "useful" result
+// Returns true if this is a "useful" result with the default status codes.
 func FoundSomething(code int) bool {
-	return (code != 0 &&
-		code != http.StatusNotFound &&
-		code != http.StatusGone &&
-		code != http.StatusBadGateway &&
-		code != http.StatusServiceUnavailable &&
-		code != http.StatusGatewayTimeout)
+	return ss.IsPositiveCode(code, nil, defaultNegativeCodes)
 }
 
-// Returns true if this result should be included in reports
+var defaultNegativeCodes = ss.MustParseCodeRanges(ss.DefaultNegativeCodes)
+
+// Returns true if this result should be included in reports with the default
+// status codes.  Challenge pages say nothing about the resource requested, so
+// they are never findings.
 func ReportResult(res Result) bool {
-	return res.Error == nil && FoundSomething(res.Code)
+	return res.Error == nil && res.Challenge == "" && FoundSomething(res.Code)
 }
 
 // Construct a ResultsManager for the given settings in the ss.ScanSettings.
 // Returns an object satisfying the ResultsManager interface or an error.
 func GetResultsManager(settings *ss.ScanSettings) (ResultsManager, error) {
 	var writer io.Writer
-	var fp *os.File
+	var fp io.WriteCloser
 	var err error
 
-	format := settings.OutputFormat
 	if settings.OutputPath == "" {
-		writer = os.Stdout
+		writer = logging.ConsoleWriter(os.Stdout)
 	} else {
-		if fp, err = os.Create(settings.OutputPath); err != nil {
+		if fp, err = storage.Create(settings.OutputPath); err != nil {
 			return nil, err
 		} else {
 			writer = fp
 		}
 	}
+	rm, err := newResultsManager(settings, writer, fp)
+	if err != nil {
+		closeOutput(fp)
+		return nil, err
+	}
+	if settings.PerHostDir != "" {
+		rm = newPartitionedResultsManager(settings, rm)
+	}
+	if settings.SortSeverity && (settings.OutputPath != "" || settings.PerHostDir != "") {
+		// Reports on the console are written as results arrive
+		rm = newSortedResultsManager(rm)
+	}
+	if settings.NotifyWebhook != "" {
+		notifier, err := NewWebhookNotifier(settings)
+		if err != nil {
+			closeOutput(fp)
+			return nil, err
+		}
+		rm = NewTeeResultsManager(rm, notifier)
+	}
+	return rm, nil
+}
+
+// Construct the ResultsManager for the output format, writing to writer and
+// closing fp, if any, when done.
+func newResultsManager(settings *ss.ScanSettings, writer io.Writer, fp io.WriteCloser) (ResultsManager, error) {
+	format := settings.OutputFormat
+	base := baseResultsManager{settings: settings}
 	switch {
 	case format == "text":
-		return &PlainResultsManager{writer: writer, fp: fp, redirs: settings.IncludeRedirects}, nil
+		rm := &PlainResultsManager{baseResultsManager: base, writer: writer, fp: fp, redirs: settings.IncludeRedirects}
+		if settings.OutputTree {
+			rm.tree = newResultTree()
+		}
+		return rm, nil
 	case format == "csv":
-		return &CSVResultsManager{writer: csv.NewWriter(writer), fp: fp}, nil
+		return &CSVResultsManager{baseResultsManager: base, writer: csv.NewWriter(writer), fp: fp}, nil
 	case format == "html":
 		// TODO: do more than the first
-		return &HTMLResultsManager{writer: writer, fp: fp, BaseURL: settings.BaseURLs[0]}, nil
+		return &HTMLResultsManager{baseResultsManager: base, writer: writer, fp: fp, BaseURL: settings.BaseURLs[0]}, nil
+	case format == "json":
+		return &JSONResultsManager{baseResultsManager: base, writer: writer, fp: fp}, nil
 	}
 	return nil, fmt.Errorf("Invalid output type: %s", format)
 }
 
+// Close the output, if any.  For remote storage this is when the report is
+// uploaded, so failures are worth reporting.
+func closeOutput(fp io.WriteCloser) {
+	if fp == nil {
+		return
+	}
+	if err := fp.Close(); err != nil {
+		logging.Logf(logging.LogError, "Error writing results: %s", err.Error())
+	}
+}
+
+// Check if a result should be reported, using the configured status codes if
+// available.  Challenge pages are set aside to be listed on their own, and
+// blocking events, slow responses, aliases and repeats of common responses
+// are kept to be listed as well.
+func (b *baseResultsManager) report(res Result) bool {
+	if res.Blocked != "" || res.Unblocked {
+		b.blocks = append(b.blocks, res)
+	}
+	if res.LatencyOutlier != "" {
+		b.slow = append(b.slow, res)
+	}
+	if res.Error == nil && res.Challenge != "" {
+		b.challenges = append(b.challenges, res)
+		return false
+	}
+	if res.AliasOf != "" {
+		// Redirects only count as aliases where redirects are reported
+		if res.Redir == nil || (b.settings != nil && b.settings.IncludeRedirects) {
+			b.aliases.add(res)
+		}
+		return false
+	}
+	if b.diffing() {
+		// Only differences from the baseline are of interest
+		return res.Change != "" && res.Change != ChangeUnchanged
+	}
+	if res.Error == nil && (res.AgentDiff != "" || res.OffScopeRedirect || res.Credentials != "") {
+		// Worth a look whatever the status code
+		return true
+	}
+	var found bool
+	if b.settings == nil {
+		found = ReportResult(res)
+	} else {
+		found = res.Error == nil && b.settings.IsPositiveCode(res.Code)
+	}
+	if found && res.NoiseOf != "" {
+		b.noise.add(res)
+		return false
+	}
+	return found
+}
+
+// Whether results are being compared with a baseline.
+func (b *baseResultsManager) diffing() bool {
+	return b.settings != nil && b.settings.DiffPath != ""
+}
+
 func (b *baseResultsManager) start() {
 	b.finished = make(chan bool)
 }
@@ -17,15 +17,15 @@ package results
 import (
 	"encoding/csv"
 	"fmt"
+	"io"
 	"net/url"
-	"os"
 )
 
 // CSVResultsManager writes a CSV containing all of the results.
 type CSVResultsManager struct {
 	baseResultsManager
 	writer *csv.Writer
-	fp     *os.File
+	fp     io.WriteCloser
 }
 
 func (rm *CSVResultsManager) Run(res <-chan Result) {
@@ -33,14 +33,16 @@ func (rm *CSVResultsManager) Run(res <-chan Result) {
 		rm.start()
 		defer func() {
 			rm.writer.Flush()
-			if rm.fp != nil {
-				rm.fp.Close()
-			}
+			closeOutput(rm.fp)
 			rm.done()
 		}()
 
 		// Header line
-		rm.writer.Write([]string{"code", "url", "content_length", "redirect_url"})
+		header := []string{"code", "url", "content_length", "redirect_url"}
+		if rm.diffing() {
+			header = append(header, "change")
+		}
+		rm.writer.Write(header)
 
 		for r := range res {
 			rm.runOne(r)
@@ -49,7 +51,7 @@ func (rm *CSVResultsManager) Run(res <-chan Result) {
 }
 
 func (rm *CSVResultsManager) runOne(res Result) {
-	if !ReportResult(res) {
+	if !rm.report(res) {
 		return
 	}
 	var clen string
@@ -62,6 +64,9 @@ func (rm *CSVResultsManager) runOne(res Result) {
 		clen,
 		maybeStringURL(res.Redir),
 	}
+	if rm.diffing() {
+		record = append(record, res.Change)
+	}
 	rm.writer.Write(record)
 }
 
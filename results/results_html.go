@@ -18,14 +18,13 @@ import (
 	"github.com/Matir/webborer/logging"
 	"html/template"
 	"io"
-	"os"
 )
 
 // HTMLResultsManager writes an HTML file containing the results.
 type HTMLResultsManager struct {
 	baseResultsManager
 	writer  io.Writer
-	fp      *os.File
+	fp      io.WriteCloser
 	BaseURL string
 }
 
@@ -36,14 +35,14 @@ func (rm *HTMLResultsManager) Run(res <-chan Result) {
 
 		defer func() {
 			rm.writeFooter()
-			if rm.fp != nil {
-				rm.fp.Close()
-			}
+			closeOutput(rm.fp)
 			rm.done()
 		}()
 
 		for r := range res {
-			if !ReportResult(r) {
+			rm.latency.add(r)
+			rm.headers.add(r)
+			if !rm.report(r) {
 				continue
 			}
 			if r.Redir != nil {
@@ -72,12 +71,30 @@ func (rm *HTMLResultsManager) writeHeader() {
 }
 
 func (rm *HTMLResultsManager) writeFooter() {
-	footer := `{{define "FOOTER"}}</table></html>{{end}}`
-	t, err := template.New("htmlResultsManager").Parse(footer)
+	footer := `{{define "FOOTER"}}</table>{{if .Challenges}}<h3>Challenge pages</h3><table><tr><th>Code</th><th>URL</th><th>Challenge</th></tr>{{range .Challenges}}<tr><td>{{.Code}}</td><td><a href="{{.URL.String}}">{{.URL.String}}</a></td><td>{{.Challenge}}</td></tr>{{end}}</table>{{end}}{{if .Blocks}}<h3>Blocking detected</h3><p>Results from these hosts until it stopped are suspect.</p><table><tr><th>Host</th><th>URL</th><th>Reason</th></tr>{{range .Blocks}}<tr><td>{{.URL.Host}}</td><td><a href="{{.URL.String}}">{{.URL.String}}</a></td><td>{{.BlockEvent}}</td></tr>{{end}}</table>{{end}}{{if .Aliases}}<h3>Aliases</h3><p>Reported once, under the first URL.</p><table><tr><th>URL</th><th>Also at</th></tr>{{range .Aliases}}<tr><td><a href="{{.URL}}">{{.URL}}</a></td><td>{{range $i, $a := .Aliases}}{{if $i}}, {{end}}<a href="{{$a}}">{{$a}}</a>{{end}}</td></tr>{{end}}</table>{{end}}{{if .Noise}}<h3>Suppressed repeats</h3><p>Alike responses in the same directory, reported once.</p><table><tr><th>Code</th><th>URL</th><th>More like it</th></tr>{{range .Noise}}<tr><td>{{.Code}}</td><td><a href="{{.URL}}">{{.URL}}</a></td><td>{{.Count}}</td></tr>{{end}}</table>{{end}}{{if .Slow}}<h3>Slow responses</h3><p>Compared with others in the same directory.</p><table><tr><th>Code</th><th>URL</th><th>Time</th></tr>{{range .Slow}}<tr><td>{{.Code}}</td><td><a href="{{.URL.String}}">{{.URL.String}}</a></td><td>{{.LatencyOutlier}}</td></tr>{{end}}</table>{{end}}{{if .Headers}}<h3>Header observations</h3><table><tr><th>Host</th><th>Observation</th><th>Responses</th><th>Example</th></tr>{{range .Headers}}<tr><td>{{.Host}}</td><td>{{.Issue}}</td><td>{{.Count}}</td><td><a href="{{.Example}}">{{.Example}}</a></td></tr>{{end}}</table>{{end}}{{if .Latency}}<h3>Response times by directory</h3><table><tr><th>Directory</th><th>Requests</th><th>Mean</th><th>p50</th><th>p90</th><th>p99</th><th>Max</th><th>Histogram</th></tr>{{range .Latency}}<tr><td>{{.Directory}}</td><td>{{.Count}}</td><td>{{round .Mean}}</td><td>{{round (.Percentile 50)}}</td><td>{{round (.Percentile 90)}}</td><td>{{round (.Percentile 99)}}</td><td>{{round .Max}}</td><td>{{range $i, $b := .Buckets}}{{if $i}}, {{end}}{{$b.Label}}: {{$b.Count}}{{end}}</td></tr>{{end}}</table>{{end}}</html>{{end}}`
+	funcs := template.FuncMap{"round": roundLatency}
+	t, err := template.New("htmlResultsManager").Funcs(funcs).Parse(footer)
 	if err != nil {
 		logging.Logf(logging.LogWarning, "Error parsing a template: %s", err.Error())
 	}
-	err = t.ExecuteTemplate(rm.writer, "FOOTER", nil)
+	data := struct {
+		Challenges []Result
+		Blocks     []Result
+		Aliases    []*AliasGroup
+		Noise      []*NoiseGroup
+		Slow       []Result
+		Headers    []*HeaderObservation
+		Latency    []*LatencyHistogram
+	}{
+		Challenges: rm.challenges,
+		Blocks:     rm.blocks,
+		Aliases:    rm.aliases.groups,
+		Noise:      rm.noise.groups,
+		Slow:       rm.slow,
+		Headers:    rm.headers.observations(),
+		Latency:    rm.latency.histograms(),
+	}
+	err = t.ExecuteTemplate(rm.writer, "FOOTER", data)
 	if err != nil {
 		logging.Logf(logging.LogWarning, "Error writing template output: %s", err.Error())
 	}
@@ -85,7 +102,7 @@ func (rm *HTMLResultsManager) writeFooter() {
 
 func (rm *HTMLResultsManager) writeResult(res *Result) {
 	// TODO: don't rebuild the template with each row
-	tmpl := `{{define "ROW"}}<tr><td>{{.Code}}</td><td><a href="{{.URL.String}}">{{.URL.String}}</a></td><td>{{if ge .Length 0}}{{.Length}}{{end}}</td><td>{{.ContentType}}</td></tr>{{end}}`
+	tmpl := `{{define "ROW"}}<tr><td>{{.Code}}</td><td><a href="{{.URL.String}}">{{.URL.String}}</a>{{if .Change}} ({{.Change}}){{end}}</td><td>{{if ge .Length 0}}{{.Length}}{{with .TransferSize}} ({{.}}){{end}}{{end}}</td><td>{{.ContentType}}{{if .Sniffed}} (sniffed){{end}}</td></tr>{{if .ArchiveListing}}<tr><td></td><td colspan="3"><ul>{{range .ArchiveListing}}<li>{{.}}</li>{{end}}</ul></td></tr>{{end}}{{if .Severity}}<tr><td></td><td colspan="3">Severity: {{.DescribeSeverity}}</td></tr>{{end}}{{if .DirListing}}<tr><td></td><td colspan="3">Directory listing ({{.DirListing}} entries)</td></tr>{{end}}{{with .ListedIn}}<tr><td></td><td colspan="3">Listed in <a href="{{.}}">{{.}}</a></td></tr>{{end}}{{if .Leaks}}<tr><td></td><td colspan="3">Leaks: {{range $i, $l := .Leaks}}{{if $i}}, {{end}}{{$l}}{{end}}</td></tr>{{end}}{{if .Truncated}}<tr><td></td><td colspan="3">Truncated: larger than -max-body-size</td></tr>{{end}}{{range .Notes}}<tr><td></td><td colspan="3">Note: {{.}}</td></tr>{{end}}{{if .AgentDiff}}<tr><td></td><td colspan="3">Differs {{.AgentDiff}}</td></tr>{{end}}{{if .LatencyOutlier}}<tr><td></td><td colspan="3">Slow: {{.LatencyOutlier}}</td></tr>{{end}}{{if .Credentials}}<tr><td></td><td colspan="3">Credentials: {{.Credentials}}</td></tr>{{end}}{{if .Redirects}}<tr><td></td><td colspan="3">Redirects: {{.RedirectChain}}</td></tr>{{end}}{{if .Suspect}}<tr><td></td><td colspan="3">Suspect: host was blocking requests</td></tr>{{end}}{{end}}`
 	t, err := template.New("htmlResultsManager").Parse(tmpl)
 	if err != nil {
 		logging.Logf(logging.LogWarning, "Error parsing a template: %s", err.Error())
@@ -0,0 +1,68 @@
+// Copyright 2017 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package results
+
+import (
+	"encoding/json"
+	"errors"
+	"net/url"
+)
+
+// Aliased so that encoding doesn't recurse into MarshalJSON.
+type plainResult Result
+
+// JSON representation of a Result, with URLs and errors as strings.
+type jsonResult struct {
+	*plainResult
+	URL   string `json:",omitempty"`
+	Error string `json:",omitempty"`
+	Redir string `json:",omitempty"`
+}
+
+func (r Result) MarshalJSON() ([]byte, error) {
+	jr := jsonResult{
+		plainResult: (*plainResult)(&r),
+		URL:         maybeStringURL(r.URL),
+		Redir:       maybeStringURL(r.Redir),
+	}
+	if r.Error != nil {
+		jr.Error = r.Error.Error()
+	}
+	return json.Marshal(jr)
+}
+
+func (r *Result) UnmarshalJSON(data []byte) error {
+	jr := jsonResult{plainResult: (*plainResult)(r)}
+	if err := json.Unmarshal(data, &jr); err != nil {
+		return err
+	}
+	var err error
+	r.URL, r.Redir = nil, nil
+	if jr.URL != "" {
+		if r.URL, err = url.Parse(jr.URL); err != nil {
+			return err
+		}
+	}
+	if jr.Redir != "" {
+		if r.Redir, err = url.Parse(jr.Redir); err != nil {
+			return err
+		}
+	}
+	r.Error = nil
+	if jr.Error != "" {
+		r.Error = errors.New(jr.Error)
+	}
+	return nil
+}
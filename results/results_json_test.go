@@ -0,0 +1,72 @@
+// Copyright 2017 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package results
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestResultJSON_RoundTrip(t *testing.T) {
+	rs := makeTestResults()
+	rs[0].Sniffed = true
+	rs[0].ArchiveListing = []string{"a.txt (3 bytes)"}
+	rs[1].Error = errors.New("Connection refused")
+	buf, err := json.Marshal(rs)
+	if err != nil {
+		t.Fatalf("Error marshaling results: %v", err)
+	}
+	var decoded []Result
+	if err := json.Unmarshal(buf, &decoded); err != nil {
+		t.Fatalf("Error unmarshaling results: %v", err)
+	}
+	if len(decoded) != len(rs) {
+		t.Fatalf("Expected %d results, got %d.", len(rs), len(decoded))
+	}
+	for i := range rs {
+		if decoded[i].Error != nil || rs[i].Error != nil {
+			if decoded[i].Error == nil || rs[i].Error == nil || decoded[i].Error.Error() != rs[i].Error.Error() {
+				t.Errorf("Error mismatch: %v != %v", decoded[i].Error, rs[i].Error)
+			}
+			decoded[i].Error, rs[i].Error = nil, nil
+		}
+		if !reflect.DeepEqual(decoded[i], rs[i]) {
+			t.Errorf("Round trip mismatch: %+v != %+v", decoded[i], rs[i])
+		}
+	}
+}
+
+func TestJSONResultsManager(t *testing.T) {
+	buf := bytes.Buffer{}
+	mgr := &JSONResultsManager{writer: &buf}
+	rchan := make(chan Result)
+	mgr.Run(rchan)
+	for _, r := range makeTestResults() {
+		rchan <- r
+	}
+	close(rchan)
+	mgr.Wait()
+	baseline, err := ReadBaseline(&buf)
+	if err != nil {
+		t.Fatalf("Unable to read results back: %v", err)
+	}
+	urls := baseline.URLs()
+	if len(urls) != 2 || urls[0].Path != "/" || urls[1].Path != "/.git" {
+		t.Errorf("Expected only the findings to be written, got %v", urls)
+	}
+}
@@ -0,0 +1,49 @@
+// Copyright 2017 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package results
+
+import (
+	"encoding/json"
+	"github.com/Matir/webborer/logging"
+	"io"
+)
+
+// JSONResultsManager writes each reported result as a line of JSON, for other
+// tools to consume and for later scans to compare against with -diff.
+type JSONResultsManager struct {
+	baseResultsManager
+	writer io.Writer
+	fp     io.WriteCloser
+}
+
+func (rm *JSONResultsManager) Run(res <-chan Result) {
+	go func() {
+		rm.start()
+		defer func() {
+			closeOutput(rm.fp)
+			rm.done()
+		}()
+
+		enc := json.NewEncoder(rm.writer)
+		for r := range res {
+			if !rm.report(r) {
+				continue
+			}
+			if err := enc.Encode(r); err != nil {
+				logging.Logf(logging.LogWarning, "Error writing result: %s", err.Error())
+			}
+		}
+	}()
+}
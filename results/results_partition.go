@@ -0,0 +1,128 @@
+// Copyright 2017 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package results
+
+import (
+	"github.com/Matir/webborer/logging"
+	ss "github.com/Matir/webborer/settings"
+	"github.com/Matir/webborer/storage"
+	"strings"
+)
+
+// File extension of the report for each output format.
+var formatExtensions = map[string]string{
+	"text": "txt",
+	"csv":  "csv",
+	"html": "html",
+	"json": "json",
+}
+
+// partitionedResultsManager passes every result to the combined output, and
+// also writes a separate report for each host under a directory, so that the
+// results for each host can be handed to its owner.
+type partitionedResultsManager struct {
+	settings *ss.ScanSettings
+	combined ResultsManager
+	// Input channel of the report for each host, by host
+	hosts    map[string]chan Result
+	managers []ResultsManager
+	finished chan bool
+}
+
+func newPartitionedResultsManager(settings *ss.ScanSettings, combined ResultsManager) *partitionedResultsManager {
+	return &partitionedResultsManager{
+		settings: settings,
+		combined: combined,
+		hosts:    make(map[string]chan Result),
+		finished: make(chan bool),
+	}
+}
+
+func (rm *partitionedResultsManager) Run(res <-chan Result) {
+	all := make(chan Result)
+	rm.combined.Run(all)
+	go func() {
+		defer func() {
+			close(all)
+			for _, c := range rm.hosts {
+				if c != nil {
+					close(c)
+				}
+			}
+			rm.finished <- true
+		}()
+		for r := range res {
+			all <- r
+			if c := rm.hostChan(r); c != nil {
+				c <- r
+			}
+		}
+	}()
+}
+
+// Get the input channel for the report for the host of r, starting the report
+// if this is the first result for the host.  Returns nil if the report could
+// not be created.
+func (rm *partitionedResultsManager) hostChan(r Result) chan Result {
+	if r.URL == nil {
+		return nil
+	}
+	host := strings.ToLower(r.URL.Host)
+	if c, ok := rm.hosts[host]; ok {
+		return c
+	}
+	// Remember failures too, so they are only reported once
+	rm.hosts[host] = nil
+	path := storage.Join(rm.settings.PerHostDir, hostDirName(host), "results."+formatExtensions[rm.settings.OutputFormat])
+	fp, err := storage.CreateAll(path)
+	if err != nil {
+		logging.Logf(logging.LogError, "Unable to create report for %s: %s", host, err.Error())
+		return nil
+	}
+	hs := *rm.settings
+	hs.OutputPath = path
+	hs.BaseURLs = []string{r.URL.Scheme + "://" + r.URL.Host + "/"}
+	mgr, err := newResultsManager(&hs, fp, fp)
+	if err != nil {
+		closeOutput(fp)
+		logging.Logf(logging.LogError, "Unable to create report for %s: %s", host, err.Error())
+		return nil
+	}
+	c := make(chan Result)
+	mgr.Run(c)
+	rm.hosts[host] = c
+	rm.managers = append(rm.managers, mgr)
+	return c
+}
+
+func (rm *partitionedResultsManager) Wait() {
+	<-rm.finished
+	rm.combined.Wait()
+	for _, mgr := range rm.managers {
+		mgr.Wait()
+	}
+}
+
+// Name of the directory for a host's report.  Ports are kept, but with a
+// character that is allowed in file names everywhere.
+func hostDirName(host string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9', r == '.', r == '-':
+			return r
+		}
+		return '_'
+	}, host)
+}
@@ -0,0 +1,71 @@
+// Copyright 2017 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package results
+
+import (
+	"github.com/Matir/webborer/settings"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPartitionedResultsManager(t *testing.T) {
+	dir, err := ioutil.TempDir("", "partition")
+	if err != nil {
+		t.Fatalf("Unable to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	s := &settings.ScanSettings{
+		OutputFormat: "text",
+		OutputPath:   filepath.Join(dir, "all.txt"),
+		PerHostDir:   filepath.Join(dir, "hosts"),
+		BaseURLs:     []string{"http://a.example/"},
+	}
+	mgr, err := GetResultsManager(s)
+	if err != nil {
+		t.Fatalf("Unable to construct results manager: %v", err)
+	}
+	rchan := make(chan Result)
+	mgr.Run(rchan)
+	for _, u := range []string{"http://a.example/x", "https://B.example:8443/y", "http://a.example/z"} {
+		parsed, _ := url.Parse(u)
+		rchan <- Result{URL: parsed, Code: 200, Length: -1}
+	}
+	close(rchan)
+	mgr.Wait()
+
+	read := func(path string) string {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Fatalf("Unable to read %s: %v", path, err)
+		}
+		return string(data)
+	}
+	if all := read(s.OutputPath); strings.Count(all, "\n") != 3 {
+		t.Errorf("Expected all 3 results in combined output, got %q", all)
+	}
+	expected := map[string]string{
+		"a.example":      "200 http://a.example/x\n200 http://a.example/z\n",
+		"b.example_8443": "200 https://B.example:8443/y\n",
+	}
+	for host, exp := range expected {
+		if got := read(filepath.Join(s.PerHostDir, host, "results.txt")); got != exp {
+			t.Errorf("Expected %q for %s, got %q", exp, host, got)
+		}
+	}
+}
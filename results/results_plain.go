@@ -17,7 +17,6 @@ package results
 import (
 	"fmt"
 	"io"
-	"os"
 )
 
 // PlainResultsManager is designed to output a very basic output that is good
@@ -26,33 +25,184 @@ import (
 type PlainResultsManager struct {
 	baseResultsManager
 	writer io.Writer
-	fp     *os.File
+	fp     io.WriteCloser
 	redirs bool
+	// Results to print as a tree at the end, instead of as they arrive
+	tree *resultTree
 }
 
 func (rm *PlainResultsManager) Run(res <-chan Result) {
 	go func() {
 		rm.start()
 		defer func() {
-			if rm.fp != nil {
-				rm.fp.Close()
-			}
+			closeOutput(rm.fp)
 			rm.done()
 		}()
 
 		for r := range res {
-			if !ReportResult(r) {
+			rm.latency.add(r)
+			rm.headers.add(r)
+			if !rm.report(r) {
 				continue
 			}
+			if rm.tree != nil {
+				if r.Redir == nil || rm.redirs || r.AgentDiff != "" || r.OffScopeRedirect || r.Change != "" {
+					rm.tree.add(r)
+				}
+				continue
+			}
+			change := ""
+			if r.Change != "" {
+				change = " [" + r.Change + "]"
+			}
 			if r.Redir == nil {
 				if r.Length >= 0 {
-					fmt.Fprintf(rm.writer, "%d %s (%d bytes)\n", r.Code, r.URL.String(), r.Length)
+					fmt.Fprintf(rm.writer, "%d %s (%s)%s\n", r.Code, r.URL.String(), r.Size(), change)
+				} else {
+					fmt.Fprintf(rm.writer, "%d %s%s\n", r.Code, r.URL.String(), change)
+				}
+				for _, entry := range r.ArchiveListing {
+					fmt.Fprintf(rm.writer, "    %s\n", entry)
+				}
+				if r.Severity != "" {
+					fmt.Fprintf(rm.writer, "    severity: %s\n", r.DescribeSeverity())
+				}
+				if r.DirListing > 0 {
+					fmt.Fprintf(rm.writer, "    directory listing (%d entries)\n", r.DirListing)
+				}
+				if r.ListedIn != "" {
+					fmt.Fprintf(rm.writer, "    listed in %s\n", r.ListedIn)
+				}
+				for _, leak := range r.Leaks {
+					fmt.Fprintf(rm.writer, "    leaks %s\n", leak)
+				}
+				if r.Truncated {
+					fmt.Fprintf(rm.writer, "    truncated: larger than -max-body-size\n")
+				}
+				for _, note := range r.Notes {
+					fmt.Fprintf(rm.writer, "    note: %s\n", note)
+				}
+				if r.AgentDiff != "" {
+					fmt.Fprintf(rm.writer, "    differs %s\n", r.AgentDiff)
+				}
+				if r.LatencyOutlier != "" {
+					fmt.Fprintf(rm.writer, "    slow: %s\n", r.LatencyOutlier)
+				}
+				if r.Credentials != "" {
+					fmt.Fprintf(rm.writer, "    credentials %s\n", r.Credentials)
+				}
+				if len(r.Redirects) > 0 {
+					fmt.Fprintf(rm.writer, "    via %s\n", r.RedirectChain())
+				}
+				if r.Suspect {
+					fmt.Fprintf(rm.writer, "    suspect: host was blocking requests\n")
+				}
+			} else if rm.redirs || r.AgentDiff != "" || r.OffScopeRedirect || r.Change != "" {
+				if r.OffScopeRedirect {
+					fmt.Fprintf(rm.writer, "%d %s -> %s (off scope)%s\n", r.Code, r.URL.String(), r.Redir.String(), change)
 				} else {
-					fmt.Fprintf(rm.writer, "%d %s\n", r.Code, r.URL.String())
+					fmt.Fprintf(rm.writer, "%d %s -> %s%s\n", r.Code, r.URL.String(), r.Redir.String(), change)
+				}
+				if len(r.Redirects) > 1 {
+					fmt.Fprintf(rm.writer, "    via %s\n", r.RedirectChain())
+				}
+				if r.AgentDiff != "" {
+					fmt.Fprintf(rm.writer, "    differs %s\n", r.AgentDiff)
+				}
+				if r.Suspect {
+					fmt.Fprintf(rm.writer, "    suspect: host was blocking requests\n")
 				}
-			} else if rm.redirs {
-				fmt.Fprintf(rm.writer, "%d %s -> %s\n", r.Code, r.URL.String(), r.Redir.String())
 			}
 		}
+		if rm.tree != nil {
+			rm.tree.write(rm.writer)
+		}
+		rm.writeChallenges()
+		rm.writeBlocks()
+		rm.writeAliases()
+		rm.writeNoise()
+		rm.writeSlow()
+		rm.writeHeaders()
+		rm.writeLatency()
 	}()
 }
+
+func (rm *PlainResultsManager) writeChallenges() {
+	if len(rm.challenges) == 0 {
+		return
+	}
+	fmt.Fprintf(rm.writer, "\nChallenge pages (not findings):\n")
+	for _, r := range rm.challenges {
+		fmt.Fprintf(rm.writer, "%d %s (%s)\n", r.Code, r.URL.String(), r.Challenge)
+	}
+}
+
+func (rm *PlainResultsManager) writeBlocks() {
+	if len(rm.blocks) == 0 {
+		return
+	}
+	fmt.Fprintf(rm.writer, "\nBlocking detected (results from these hosts until it stopped are suspect):\n")
+	for _, r := range rm.blocks {
+		fmt.Fprintf(rm.writer, "%s at %s: %s\n", r.URL.Host, r.URL.String(), r.BlockEvent())
+	}
+}
+
+func (rm *PlainResultsManager) writeAliases() {
+	if len(rm.aliases.groups) == 0 {
+		return
+	}
+	fmt.Fprintf(rm.writer, "\nAliases (reported once):\n")
+	for _, g := range rm.aliases.groups {
+		fmt.Fprintf(rm.writer, "%s\n", g.URL)
+		for _, alias := range g.Aliases {
+			fmt.Fprintf(rm.writer, "    also %s\n", alias)
+		}
+	}
+}
+
+func (rm *PlainResultsManager) writeNoise() {
+	if len(rm.noise.groups) == 0 {
+		return
+	}
+	fmt.Fprintf(rm.writer, "\nSuppressed repeats (alike responses in the same directory):\n")
+	for _, g := range rm.noise.groups {
+		fmt.Fprintf(rm.writer, "%d %s and %d more like it\n", g.Code, g.URL, g.Count)
+	}
+}
+
+func (rm *PlainResultsManager) writeSlow() {
+	if len(rm.slow) == 0 {
+		return
+	}
+	fmt.Fprintf(rm.writer, "\nSlow responses (compared with their directory):\n")
+	for _, r := range rm.slow {
+		fmt.Fprintf(rm.writer, "%d %s: %s\n", r.Code, r.URL.String(), r.LatencyOutlier)
+	}
+}
+
+func (rm *PlainResultsManager) writeHeaders() {
+	obs := rm.headers.observations()
+	if len(obs) == 0 {
+		return
+	}
+	fmt.Fprintf(rm.writer, "\nHeader observations:\n")
+	host := ""
+	for _, o := range obs {
+		if o.Host != host {
+			host = o.Host
+			fmt.Fprintf(rm.writer, "%s\n", host)
+		}
+		fmt.Fprintf(rm.writer, "    %s\n", o.String())
+	}
+}
+
+func (rm *PlainResultsManager) writeLatency() {
+	hists := rm.latency.histograms()
+	if len(hists) == 0 {
+		return
+	}
+	fmt.Fprintf(rm.writer, "\nResponse times by directory:\n")
+	for _, h := range hists {
+		fmt.Fprintf(rm.writer, "%s\n", h.String())
+	}
+}
@@ -16,6 +16,8 @@ package results
 
 import (
 	"bytes"
+	"github.com/Matir/webborer/settings"
+	"net/url"
 	"strings"
 	"testing"
 )
@@ -39,3 +41,194 @@ func TestPlainResultsManager_Basic(t *testing.T) {
 		t.Fatalf("Expected 3 lines of output, got %d", len(lines))
 	}
 }
+
+func TestPlainResultsManager_Codes(t *testing.T) {
+	buf := bytes.Buffer{}
+	mgr := &PlainResultsManager{
+		baseResultsManager: baseResultsManager{
+			settings: &settings.ScanSettings{
+				PositiveCodes: settings.MustParseCodeRanges("200-299,404"),
+			},
+		},
+		writer: &buf,
+		redirs: true,
+	}
+	rchan := make(chan Result)
+	mgr.Run(rchan)
+	for _, r := range makeTestResults() {
+		rchan <- r
+	}
+	close(rchan)
+	mgr.Wait()
+	out := buf.String()
+	if !strings.Contains(out, "404 http://localhost/x") {
+		t.Errorf("Expected 404 to be reported: %s", out)
+	}
+	if strings.Contains(out, "301") {
+		t.Errorf("Expected 301 not to be reported: %s", out)
+	}
+}
+
+func TestPlainResultsManager_Challenges(t *testing.T) {
+	buf := bytes.Buffer{}
+	mgr := &PlainResultsManager{writer: &buf}
+	rchan := make(chan Result)
+	mgr.Run(rchan)
+	rchan <- Result{
+		URL:       &url.URL{Scheme: "http", Host: "localhost", Path: "/admin"},
+		Code:      403,
+		Challenge: "cloudflare js-challenge",
+	}
+	close(rchan)
+	mgr.Wait()
+	out := buf.String()
+	if strings.HasPrefix(out, "403") {
+		t.Errorf("Expected challenge page not to be reported as a finding: %s", out)
+	}
+	expected := "Challenge pages (not findings):\n403 http://localhost/admin (cloudflare js-challenge)\n"
+	if !strings.Contains(out, expected) {
+		t.Errorf("Expected challenge section %q, got %q", expected, out)
+	}
+}
+
+func TestPlainResultsManager_Blocked(t *testing.T) {
+	buf := bytes.Buffer{}
+	mgr := &PlainResultsManager{writer: &buf}
+	rchan := make(chan Result)
+	mgr.Run(rchan)
+	rchan <- Result{
+		URL:     &url.URL{Scheme: "http", Host: "localhost", Path: "/x"},
+		Code:    429,
+		Blocked: "9 of the last 10 responses rate limited (429)",
+	}
+	rchan <- Result{
+		URL:     &url.URL{Scheme: "http", Host: "localhost", Path: "/admin"},
+		Code:    200,
+		Length:  -1,
+		Suspect: true,
+	}
+	rchan <- Result{
+		URL:       &url.URL{Scheme: "http", Host: "localhost", Path: "/y"},
+		Code:      404,
+		Suspect:   true,
+		Unblocked: true,
+	}
+	close(rchan)
+	mgr.Wait()
+	out := buf.String()
+	if !strings.Contains(out, "200 http://localhost/admin\n    suspect: host was blocking requests\n") {
+		t.Errorf("Expected finding to be marked suspect: %q", out)
+	}
+	expected := "Blocking detected (results from these hosts until it stopped are suspect):\n" +
+		"localhost at http://localhost/x: 9 of the last 10 responses rate limited (429)\n" +
+		"localhost at http://localhost/y: blocking stopped\n"
+	if !strings.Contains(out, expected) {
+		t.Errorf("Expected blocking section %q, got %q", expected, out)
+	}
+}
+
+func TestPlainResultsManager_Aliases(t *testing.T) {
+	buf := bytes.Buffer{}
+	mgr := &PlainResultsManager{writer: &buf}
+	rchan := make(chan Result)
+	mgr.Run(rchan)
+	rchan <- Result{URL: &url.URL{Scheme: "http", Host: "localhost", Path: "/admin/"}, Code: 200, Length: -1}
+	rchan <- Result{
+		URL:     &url.URL{Scheme: "http", Host: "localhost", Path: "/Admin/"},
+		Code:    200,
+		Length:  -1,
+		AliasOf: "http://localhost/admin/",
+	}
+	rchan <- Result{
+		URL:     &url.URL{Scheme: "http", Host: "localhost", Path: "/admin"},
+		Code:    301,
+		Redir:   &url.URL{Scheme: "http", Host: "localhost", Path: "/admin/"},
+		AliasOf: "http://localhost/admin/",
+	}
+	close(rchan)
+	mgr.Wait()
+	out := buf.String()
+	if strings.Contains(out, "200 http://localhost/Admin/") {
+		t.Errorf("Expected alias not to be reported as a finding: %q", out)
+	}
+	expected := "Aliases (reported once):\nhttp://localhost/admin/\n    also http://localhost/Admin/\n"
+	if !strings.HasSuffix(out, expected) {
+		t.Errorf("Expected aliases section %q, got %q", expected, out)
+	}
+}
+
+func TestPlainResultsManager_Noise(t *testing.T) {
+	buf := bytes.Buffer{}
+	mgr := &PlainResultsManager{writer: &buf}
+	rchan := make(chan Result)
+	mgr.Run(rchan)
+	rchan <- Result{URL: &url.URL{Scheme: "http", Host: "localhost", Path: "/a"}, Code: 200, Length: -1}
+	for _, p := range []string{"/b", "/c"} {
+		rchan <- Result{
+			URL:     &url.URL{Scheme: "http", Host: "localhost", Path: p},
+			Code:    200,
+			Length:  -1,
+			NoiseOf: "http://localhost/a",
+		}
+	}
+	// Not a finding, so not counted either
+	rchan <- Result{URL: &url.URL{Scheme: "http", Host: "localhost", Path: "/d"}, Code: 404, NoiseOf: "http://localhost/x"}
+	close(rchan)
+	mgr.Wait()
+	out := buf.String()
+	if strings.Contains(out, "200 http://localhost/b") {
+		t.Errorf("Expected noise not to be reported as a finding: %q", out)
+	}
+	expected := "200 http://localhost/a\n\nSuppressed repeats (alike responses in the same directory):\n200 http://localhost/a and 2 more like it\n"
+	if out != expected {
+		t.Errorf("Expected %q, got %q", expected, out)
+	}
+}
+
+func TestPlainResultsManager_AgentDiff(t *testing.T) {
+	buf := bytes.Buffer{}
+	mgr := &PlainResultsManager{writer: &buf}
+	rchan := make(chan Result)
+	mgr.Run(rchan)
+	rchan <- Result{
+		URL:       &url.URL{Scheme: "http", Host: "localhost", Path: "/admin"},
+		Code:      404,
+		Length:    -1,
+		AgentDiff: `with User-Agent "curl/8.0": status 200 vs 404`,
+	}
+	close(rchan)
+	mgr.Wait()
+	expected := "404 http://localhost/admin\n    differs with User-Agent \"curl/8.0\": status 200 vs 404\n"
+	if buf.String() != expected {
+		t.Errorf("Expected %q, got %q", expected, buf.String())
+	}
+}
+
+func TestPlainResultsManager_Redirects(t *testing.T) {
+	buf := bytes.Buffer{}
+	mgr := &PlainResultsManager{writer: &buf}
+	rchan := make(chan Result)
+	mgr.Run(rchan)
+	rchan <- Result{
+		URL:    &url.URL{Scheme: "http", Host: "localhost", Path: "/a"},
+		Code:   200,
+		Length: -1,
+		Redirects: []RedirectHop{
+			{URL: "http://localhost/a", Code: 301},
+			{URL: "http://localhost/b", Code: 200},
+		},
+	}
+	rchan <- Result{
+		URL:              &url.URL{Scheme: "http", Host: "localhost", Path: "/away"},
+		Code:             302,
+		Redir:            &url.URL{Scheme: "http", Host: "elsewhere", Path: "/"},
+		OffScopeRedirect: true,
+	}
+	close(rchan)
+	mgr.Wait()
+	expected := "200 http://localhost/a\n    via 301 http://localhost/a -> 200 http://localhost/b\n" +
+		"302 http://localhost/away -> http://elsewhere/ (off scope)\n"
+	if buf.String() != expected {
+		t.Errorf("Expected %q, got %q", expected, buf.String())
+	}
+}
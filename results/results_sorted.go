@@ -0,0 +1,62 @@
+// Copyright 2017 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package results
+
+import (
+	"sort"
+)
+
+// sortedResultsManager holds every result until the scan is over, then passes
+// them on most severe first, so a report starts with what matters most.
+type sortedResultsManager struct {
+	inner    ResultsManager
+	finished chan bool
+}
+
+func newSortedResultsManager(inner ResultsManager) *sortedResultsManager {
+	return &sortedResultsManager{inner: inner, finished: make(chan bool)}
+}
+
+func (rm *sortedResultsManager) Run(res <-chan Result) {
+	out := make(chan Result)
+	rm.inner.Run(out)
+	go func() {
+		defer func() {
+			close(out)
+			rm.finished <- true
+		}()
+		held := make([]Result, 0)
+		for r := range res {
+			held = append(held, r)
+		}
+		SortBySeverity(held)
+		for _, r := range held {
+			out <- r
+		}
+	}()
+}
+
+func (rm *sortedResultsManager) Wait() {
+	<-rm.finished
+	rm.inner.Wait()
+}
+
+// Sort results most severe first, keeping results of the same severity in
+// order.
+func SortBySeverity(res []Result) {
+	sort.SliceStable(res, func(i, j int) bool {
+		return SeverityRank(res[i].Severity) > SeverityRank(res[j].Severity)
+	})
+}
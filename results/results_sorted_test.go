@@ -0,0 +1,81 @@
+// Copyright 2017 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package results
+
+import (
+	"net/url"
+	"reflect"
+	"testing"
+)
+
+func TestSortBySeverity(t *testing.T) {
+	res := []Result{
+		{Code: 200, Severity: ""},
+		{Code: 201, Severity: SeverityLow},
+		{Code: 202, Severity: SeverityCritical},
+		{Code: 203, Severity: ""},
+		{Code: 204, Severity: SeverityLow},
+	}
+	SortBySeverity(res)
+	got := make([]int, len(res))
+	for i, r := range res {
+		got[i] = r.Code
+	}
+	if expected := []int{202, 201, 204, 200, 203}; !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected order %v, got %v", expected, got)
+	}
+}
+
+func TestSortedResultsManager(t *testing.T) {
+	inner := &collectingResultsManager{finished: make(chan bool)}
+	rm := newSortedResultsManager(inner)
+	rchan := make(chan Result)
+	rm.Run(rchan)
+	for _, p := range []string{"/a", "/.env", "/b"} {
+		u, _ := url.Parse("http://localhost" + p)
+		r := Result{URL: u, Code: 200}
+		if p == "/.env" {
+			r.Severity = SeverityCritical
+		}
+		rchan <- r
+	}
+	close(rchan)
+	rm.Wait()
+	got := make([]string, len(inner.results))
+	for i, r := range inner.results {
+		got[i] = r.URL.Path
+	}
+	if expected := []string{"/.env", "/a", "/b"}; !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected order %v, got %v", expected, got)
+	}
+}
+
+type collectingResultsManager struct {
+	results  []Result
+	finished chan bool
+}
+
+func (rm *collectingResultsManager) Run(res <-chan Result) {
+	go func() {
+		for r := range res {
+			rm.results = append(rm.results, r)
+		}
+		rm.finished <- true
+	}()
+}
+
+func (rm *collectingResultsManager) Wait() {
+	<-rm.finished
+}
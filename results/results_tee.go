@@ -0,0 +1,56 @@
+// Copyright 2017 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package results
+
+// teeResultsManager passes every result to each of several ResultsManagers,
+// e.g. a report and a notifier.
+type teeResultsManager struct {
+	managers []ResultsManager
+	finished chan bool
+}
+
+// Combine ResultsManagers so that each receives every result.  This is how
+// extra handlers, such as notifications, are added alongside the report.
+func NewTeeResultsManager(managers ...ResultsManager) ResultsManager {
+	return &teeResultsManager{managers: managers, finished: make(chan bool)}
+}
+
+func (rm *teeResultsManager) Run(res <-chan Result) {
+	chans := make([]chan Result, len(rm.managers))
+	for i, mgr := range rm.managers {
+		chans[i] = make(chan Result)
+		mgr.Run(chans[i])
+	}
+	go func() {
+		defer func() {
+			for _, c := range chans {
+				close(c)
+			}
+			rm.finished <- true
+		}()
+		for r := range res {
+			for _, c := range chans {
+				c <- r
+			}
+		}
+	}()
+}
+
+func (rm *teeResultsManager) Wait() {
+	<-rm.finished
+	for _, mgr := range rm.managers {
+		mgr.Wait()
+	}
+}
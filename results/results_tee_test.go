@@ -0,0 +1,37 @@
+// Copyright 2017 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package results
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestTeeResultsManager(t *testing.T) {
+	one, two := &JSONResultsManager{}, &JSONResultsManager{}
+	var bufOne, bufTwo bytes.Buffer
+	one.writer, two.writer = &bufOne, &bufTwo
+	tee := NewTeeResultsManager(one, two)
+	rchan := make(chan Result)
+	tee.Run(rchan)
+	for _, r := range makeTestResults() {
+		rchan <- r
+	}
+	close(rchan)
+	tee.Wait()
+	if bufOne.String() == "" || bufOne.String() != bufTwo.String() {
+		t.Errorf("Expected both managers to get the results: %q %q", bufOne.String(), bufTwo.String())
+	}
+}
@@ -80,3 +80,20 @@ func TestBaseFunctions(_ *testing.T) {
 	go brm.done()
 	brm.Wait()
 }
+
+func TestResultSize(t *testing.T) {
+	cases := []struct {
+		res      Result
+		expected string
+	}{
+		{Result{Length: -1}, ""},
+		{Result{Length: 512, TransferLength: 512}, "512 bytes"},
+		{Result{Length: 512, TransferLength: 180, Encoding: "gzip"}, "512 bytes, 180 gzip"},
+		{Result{Length: 512, TransferLength: -1, Encoding: "gzip"}, "512 bytes"},
+	}
+	for _, c := range cases {
+		if got := c.res.Size(); got != c.expected {
+			t.Errorf("Expected %q, got %q", c.expected, got)
+		}
+	}
+}
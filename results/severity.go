@@ -0,0 +1,213 @@
+// Copyright 2017 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package results
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/Matir/webborer/storage"
+	"io"
+	"regexp"
+	"strings"
+)
+
+// Severities of results, from most to least severe.
+const (
+	SeverityCritical = "critical"
+	SeverityHigh     = "high"
+	SeverityMedium   = "medium"
+	SeverityLow      = "low"
+	SeverityInfo     = "info"
+)
+
+var severityRanks = map[string]int{
+	SeverityCritical: 5,
+	SeverityHigh:     4,
+	SeverityMedium:   3,
+	SeverityLow:      2,
+	SeverityInfo:     1,
+}
+
+// Rank a severity for sorting, higher being more severe.  Results without a
+// severity rank lowest.
+func SeverityRank(severity string) int {
+	return severityRanks[severity]
+}
+
+// Signature marks paths matching a pattern as being of some severity.
+// Patterns are matched against the end of the path, starting at a directory:
+// "backup.sql" matches /backup.sql and /old/backup.sql, and "*" matches any
+// part of a name, as in "*.sql".  A pattern ending in "/" matches the
+// directory and everything in it, and one starting with "/" only matches from
+// the root.
+type Signature struct {
+	Pattern     string
+	Severity    string
+	Description string
+	re          *regexp.Regexp
+}
+
+func NewSignature(pattern, severity, description string) (*Signature, error) {
+	if _, ok := severityRanks[severity]; !ok {
+		return nil, fmt.Errorf("Invalid severity %q for %s", severity, pattern)
+	}
+	expr := "(?i)(?:^|/)"
+	if strings.HasPrefix(pattern, "/") {
+		expr = "(?i)^/"
+	}
+	glob := strings.TrimPrefix(pattern, "/")
+	dir := strings.HasSuffix(glob, "/")
+	glob = strings.TrimSuffix(glob, "/")
+	if glob == "" {
+		return nil, fmt.Errorf("Invalid signature pattern %q", pattern)
+	}
+	parts := strings.Split(glob, "*")
+	for i, p := range parts {
+		parts[i] = regexp.QuoteMeta(p)
+	}
+	expr += strings.Join(parts, "[^/]*")
+	if dir {
+		expr += "(?:/|$)"
+	} else {
+		expr += "$"
+	}
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, err
+	}
+	return &Signature{Pattern: pattern, Severity: severity, Description: description, re: re}, nil
+}
+
+func mustSignature(pattern, severity, description string) *Signature {
+	sig, err := NewSignature(pattern, severity, description)
+	if err != nil {
+		panic(err)
+	}
+	return sig
+}
+
+func (s *Signature) Match(path string) bool {
+	return s.re.MatchString(path)
+}
+
+// Knowledge base of paths that are worth a look when they're found.
+var builtinSignatures = []*Signature{
+	mustSignature(".env", SeverityCritical, "environment file, often holding secrets"),
+	mustSignature(".env.*", SeverityCritical, "environment file, often holding secrets"),
+	mustSignature(".git/", SeverityCritical, "exposed git repository"),
+	mustSignature(".svn/", SeverityHigh, "exposed subversion checkout"),
+	mustSignature(".hg/", SeverityHigh, "exposed mercurial repository"),
+	mustSignature(".aws/credentials", SeverityCritical, "cloud credentials"),
+	mustSignature(".ssh/", SeverityCritical, "SSH keys"),
+	mustSignature("id_rsa", SeverityCritical, "SSH private key"),
+	mustSignature(".htpasswd", SeverityHigh, "password hashes"),
+	mustSignature("wp-config.php.*", SeverityCritical, "copy of WordPress config with database credentials"),
+	mustSignature("wp-config.php~", SeverityCritical, "copy of WordPress config with database credentials"),
+	mustSignature("config.php.*", SeverityHigh, "copy of PHP config"),
+	mustSignature("web.config.*", SeverityHigh, "copy of IIS config"),
+	mustSignature("*.sql", SeverityHigh, "database dump"),
+	mustSignature("*.sql.gz", SeverityHigh, "database dump"),
+	mustSignature("*.bak", SeverityMedium, "backup file"),
+	mustSignature("*.old", SeverityMedium, "backup file"),
+	mustSignature("*.swp", SeverityMedium, "editor swap file"),
+	mustSignature("*~", SeverityMedium, "editor backup file"),
+	mustSignature("backup.zip", SeverityHigh, "backup archive"),
+	mustSignature("backup.tar.gz", SeverityHigh, "backup archive"),
+	mustSignature("actuator/env", SeverityCritical, "Spring Boot environment, often holding secrets"),
+	mustSignature("actuator/heapdump", SeverityCritical, "Spring Boot heap dump"),
+	mustSignature("actuator/", SeverityMedium, "Spring Boot actuator endpoint"),
+	mustSignature("server-status", SeverityMedium, "Apache server status"),
+	mustSignature("phpinfo.php", SeverityMedium, "PHP configuration details"),
+	mustSignature("elmah.axd", SeverityHigh, "ASP.NET error log"),
+	mustSignature("trace.axd", SeverityHigh, "ASP.NET request trace"),
+	mustSignature(".DS_Store", SeverityLow, "macOS directory metadata"),
+	mustSignature("swagger.json", SeverityLow, "API description"),
+	mustSignature("openapi.json", SeverityLow, "API description"),
+	mustSignature("phpmyadmin/", SeverityMedium, "database admin interface"),
+	mustSignature("admin/", SeverityLow, "admin interface"),
+}
+
+// Scorer tags results with a severity from a knowledge base of high-value
+// paths, e.g. .git/ or backup.sql, and any signature files given to it.
+type Scorer struct {
+	signatures []*Signature
+}
+
+// Construct a Scorer with the built-in signatures and those in each of
+// paths.
+func NewScorer(paths []string) (*Scorer, error) {
+	s := &Scorer{signatures: append([]*Signature{}, builtinSignatures...)}
+	for _, path := range paths {
+		if err := s.load(path); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+func (s *Scorer) load(path string) error {
+	fp, err := storage.Open(path)
+	if err != nil {
+		return err
+	}
+	defer fp.Close()
+	sigs, err := ReadSignatures(fp)
+	if err != nil {
+		return fmt.Errorf("Error in signature file %s: %s", path, err.Error())
+	}
+	s.signatures = append(s.signatures, sigs...)
+	return nil
+}
+
+// Read signatures, one per line as the severity, pattern and an optional
+// description, e.g. "high /debug/pprof/ Go profiler".  Blank lines and lines
+// starting with # are ignored.
+func ReadSignatures(rdr io.Reader) ([]*Signature, error) {
+	sigs := make([]*Signature, 0)
+	scanner := bufio.NewScanner(rdr)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			return nil, fmt.Errorf("Line %d: expected severity and pattern", n)
+		}
+		sig, err := NewSignature(fields[1], strings.ToLower(fields[0]), strings.Join(fields[2:], " "))
+		if err != nil {
+			return nil, fmt.Errorf("Line %d: %s", n, err.Error())
+		}
+		sigs = append(sigs, sig)
+	}
+	return sigs, scanner.Err()
+}
+
+// Set the severity of a result from the most severe signature matching it.
+// Only resources that were found are scored.
+func (s *Scorer) Score(r *Result) {
+	if r.URL == nil || r.Error != nil || r.Code < 200 || r.Code >= 300 {
+		return
+	}
+	var best *Signature
+	for _, sig := range s.signatures {
+		if sig.Match(r.URL.Path) && (best == nil || SeverityRank(sig.Severity) > SeverityRank(best.Severity)) {
+			best = sig
+		}
+	}
+	if best != nil {
+		r.Severity, r.SeverityReason = best.Severity, best.Description
+	}
+}
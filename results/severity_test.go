@@ -0,0 +1,110 @@
+// Copyright 2017 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package results
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestSignature_Match(t *testing.T) {
+	cases := []struct {
+		pattern string
+		path    string
+		match   bool
+	}{
+		{".env", "/.env", true},
+		{".env", "/app/.env", true},
+		{".env", "/.environment", false},
+		{".git/", "/.git/", true},
+		{".git/", "/.git/HEAD", true},
+		{".git/", "/a.git/HEAD", false},
+		{"*.sql", "/dump/backup.sql", true},
+		{"*.sql", "/backup.sql.txt", false},
+		{"/admin/", "/admin/", true},
+		{"/admin/", "/app/admin/", false},
+		{"actuator/env", "/api/actuator/env", true},
+		{"wp-config.php.*", "/WP-CONFIG.PHP.BAK", true},
+	}
+	for _, c := range cases {
+		sig, err := NewSignature(c.pattern, SeverityHigh, "")
+		if err != nil {
+			t.Fatalf("Error creating signature %s: %v", c.pattern, err)
+		}
+		if got := sig.Match(c.path); got != c.match {
+			t.Errorf("%s matching %s: expected %v, got %v", c.pattern, c.path, c.match, got)
+		}
+	}
+}
+
+func TestNewSignature_Invalid(t *testing.T) {
+	if _, err := NewSignature(".env", "urgent", ""); err == nil {
+		t.Error("Expected error for unknown severity")
+	}
+	if _, err := NewSignature("/", SeverityLow, ""); err == nil {
+		t.Error("Expected error for empty pattern")
+	}
+}
+
+func TestReadSignatures(t *testing.T) {
+	sigs, err := ReadSignatures(strings.NewReader("# comment\n\nHigh /debug/pprof/ Go profiler\nlow robots.txt\n"))
+	if err != nil {
+		t.Fatalf("Error reading signatures: %v", err)
+	}
+	if len(sigs) != 2 {
+		t.Fatalf("Expected 2 signatures, got %d", len(sigs))
+	}
+	if sigs[0].Severity != SeverityHigh || sigs[0].Pattern != "/debug/pprof/" || sigs[0].Description != "Go profiler" {
+		t.Errorf("Unexpected signature: %+v", sigs[0])
+	}
+	if _, err := ReadSignatures(strings.NewReader("high\n")); err == nil {
+		t.Error("Expected error for line without a pattern")
+	}
+}
+
+func TestScorer_Score(t *testing.T) {
+	scorer, err := NewScorer(nil)
+	if err != nil {
+		t.Fatalf("Error creating scorer: %v", err)
+	}
+	cases := []struct {
+		path     string
+		code     int
+		severity string
+	}{
+		{"/.env", 200, SeverityCritical},
+		{"/.git/config", 200, SeverityCritical},
+		{"/backup.sql", 200, SeverityHigh},
+		{"/actuator/env", 200, SeverityCritical},
+		{"/actuator/health", 200, SeverityMedium},
+		{"/index.html", 200, ""},
+		{"/.env", 404, ""},
+	}
+	for _, c := range cases {
+		u, _ := url.Parse("http://localhost" + c.path)
+		r := Result{URL: u, Code: c.code}
+		scorer.Score(&r)
+		if r.Severity != c.severity {
+			t.Errorf("%d %s: expected severity %q, got %q", c.code, c.path, c.severity, r.Severity)
+		}
+	}
+}
+
+func TestScorer_SignatureFile(t *testing.T) {
+	if _, err := NewScorer([]string{"/nonexistent/signatures.txt"}); err == nil {
+		t.Error("Expected error for missing signature file")
+	}
+}
@@ -0,0 +1,164 @@
+// Copyright 2017 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package results
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/Matir/webborer/logging"
+	ss "github.com/Matir/webborer/settings"
+	"github.com/Matir/webborer/storage"
+	"sort"
+	"strings"
+)
+
+// A Summary is a machine-readable account of what a scan found, for CI jobs
+// and other tooling that acts on the outcome rather than reading the report.
+type Summary struct {
+	// Responses received, by status class, e.g. "2xx"
+	Responses map[string]int `json:"responses"`
+	// Requests that got no response
+	Errors int `json:"errors"`
+	// Results included in the report
+	Findings int `json:"findings"`
+	// Findings that were not in the -diff baseline, have changed since or
+	// have gone, if there was a baseline
+	New     int `json:"new"`
+	Changed int `json:"changed"`
+	Removed int `json:"removed"`
+	// Findings with one of the -fail-on status codes, e.g.
+	// "200 http://host/.git/config (512 bytes)"
+	Failures []string `json:"failures"`
+}
+
+// Whether anything was found that should fail the build.
+func (s *Summary) Failed() bool {
+	return len(s.Failures) > 0
+}
+
+// Describe the summary in one line, e.g. "1200 responses (3 2xx, 1197 4xx),
+// 3 findings, 1 matching -fail-on".
+func (s *Summary) String() string {
+	keys := make([]string, 0, len(s.Responses))
+	total := 0
+	for class, n := range s.Responses {
+		keys = append(keys, class)
+		total += n
+	}
+	sort.Strings(keys)
+	classes := make([]string, 0, len(keys))
+	for _, class := range keys {
+		classes = append(classes, fmt.Sprintf("%d %s", s.Responses[class], class))
+	}
+	str := fmt.Sprintf("%d responses", total)
+	if len(classes) > 0 {
+		str += " (" + strings.Join(classes, ", ") + ")"
+	}
+	if s.Errors > 0 {
+		str += fmt.Sprintf(", %d errors", s.Errors)
+	}
+	str += fmt.Sprintf(", %d findings", s.Findings)
+	if s.New+s.Changed+s.Removed > 0 {
+		str += fmt.Sprintf(" (%d new, %d changed, %d removed)", s.New, s.Changed, s.Removed)
+	}
+	if len(s.Failures) > 0 {
+		str += fmt.Sprintf(", %d matching -fail-on", len(s.Failures))
+	}
+	return str
+}
+
+// Status class of a code, e.g. "4xx" for 404.
+func statusClass(code int) string {
+	return fmt.Sprintf("%dxx", code/100)
+}
+
+// SummaryManager counts results into a Summary, writing it to the -summary
+// file, if any, at the end of the scan.  It runs alongside the report.
+type SummaryManager struct {
+	baseResultsManager
+	summary *Summary
+}
+
+func NewSummaryManager(settings *ss.ScanSettings) *SummaryManager {
+	return &SummaryManager{
+		baseResultsManager: baseResultsManager{settings: settings},
+		summary: &Summary{
+			Responses: make(map[string]int),
+			Failures:  make([]string, 0),
+		},
+	}
+}
+
+func (rm *SummaryManager) Run(res <-chan Result) {
+	rm.start()
+	go func() {
+		defer rm.done()
+		for r := range res {
+			rm.add(r)
+		}
+		logging.Logf(logging.LogInfo, "Summary: %s", rm.summary.String())
+		if rm.settings.SummaryPath != "" {
+			if err := rm.write(rm.settings.SummaryPath); err != nil {
+				logging.Logf(logging.LogError, "Unable to write summary: %s", err.Error())
+			}
+		}
+	}()
+}
+
+// The summary of the scan, complete once Wait returns.
+func (rm *SummaryManager) Summary() *Summary {
+	return rm.summary
+}
+
+func (rm *SummaryManager) add(r Result) {
+	s := rm.summary
+	if r.Error != nil {
+		s.Errors++
+	} else if r.Code > 0 && r.ListedIn == "" {
+		// Entries of directory listings weren't requested
+		s.Responses[statusClass(r.Code)]++
+	}
+	if !rm.report(r) {
+		return
+	}
+	s.Findings++
+	switch r.Change {
+	case ChangeNew:
+		s.New++
+	case ChangeChanged:
+		s.Changed++
+	case ChangeRemoved:
+		// Gone resources can't fail the build
+		s.Removed++
+		return
+	}
+	if r.URL != nil && rm.settings.FailOn.Contains(r.Code) {
+		s.Failures = append(s.Failures, summarize(r))
+	}
+}
+
+func (rm *SummaryManager) write(path string) error {
+	fp, err := storage.Create(path)
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(fp)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(rm.summary); err != nil {
+		fp.Close()
+		return err
+	}
+	return fp.Close()
+}
@@ -0,0 +1,115 @@
+// Copyright 2017 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package results
+
+import (
+	"encoding/json"
+	"errors"
+	ss "github.com/Matir/webborer/settings"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func runSummary(s *ss.ScanSettings, res []Result) *Summary {
+	rm := NewSummaryManager(s)
+	rchan := make(chan Result)
+	rm.Run(rchan)
+	for _, r := range res {
+		rchan <- r
+	}
+	close(rchan)
+	rm.Wait()
+	return rm.Summary()
+}
+
+func TestSummaryManager(t *testing.T) {
+	dir, err := ioutil.TempDir("", "webborer-summary")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "summary.json")
+	s := &ss.ScanSettings{
+		NegativeCodes: ss.MustParseCodeRanges(ss.DefaultNegativeCodes),
+		FailOn:        ss.MustParseCodeRanges("200,500"),
+		SummaryPath:   path,
+	}
+	res := append(makeTestResults(),
+		Result{URL: &url.URL{Scheme: "http", Host: "localhost", Path: "/down"}, Error: errors.New("reset")},
+		Result{URL: &url.URL{Scheme: "http", Host: "localhost", Path: "/cf"}, Code: 403, Challenge: "cloudflare js-challenge"})
+	summary := runSummary(s, res)
+	want := map[string]int{"2xx": 1, "3xx": 1, "4xx": 2}
+	for class, n := range want {
+		if summary.Responses[class] != n {
+			t.Errorf("Expected %d %s responses, got %v", n, class, summary.Responses)
+		}
+	}
+	if summary.Errors != 1 {
+		t.Errorf("Expected 1 error, got %d", summary.Errors)
+	}
+	// The 200 and the redirect, but not the 404 or the challenge page
+	if summary.Findings != 2 {
+		t.Errorf("Expected 2 findings, got %d", summary.Findings)
+	}
+	if !summary.Failed() || len(summary.Failures) != 1 || summary.Failures[0] != "200 http://localhost/ (0 bytes)" {
+		t.Errorf("Expected the 200 to fail the scan, got %v", summary.Failures)
+	}
+	var written Summary
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Summary not written: %v", err)
+	}
+	if err := json.Unmarshal(data, &written); err != nil || written.Findings != 2 || len(written.Failures) != 1 {
+		t.Errorf("Unexpected summary file %s (%v)", data, err)
+	}
+}
+
+func TestSummaryManager_Diff(t *testing.T) {
+	s := &ss.ScanSettings{
+		DiffPath: "baseline.json",
+		FailOn:   ss.MustParseCodeRanges("200-299"),
+	}
+	u := func(path string) *url.URL {
+		return &url.URL{Scheme: "http", Host: "localhost", Path: path}
+	}
+	summary := runSummary(s, []Result{
+		{URL: u("/"), Code: 200, Change: ChangeUnchanged},
+		{URL: u("/new"), Code: 200, Change: ChangeNew},
+		{URL: u("/changed"), Code: 500, Change: ChangeChanged},
+		{URL: u("/gone"), Code: 200, Change: ChangeRemoved},
+	})
+	if summary.Findings != 3 || summary.New != 1 || summary.Changed != 1 || summary.Removed != 1 {
+		t.Errorf("Unexpected counts: %+v", summary)
+	}
+	if len(summary.Failures) != 1 || summary.Failures[0] != "200 http://localhost/new (0 bytes) [new]" {
+		t.Errorf("Expected only the new 200 to fail the scan, got %v", summary.Failures)
+	}
+}
+
+func TestSummary_String(t *testing.T) {
+	s := &Summary{
+		Responses: map[string]int{"4xx": 10, "2xx": 2},
+		Errors:    1,
+		Findings:  2,
+		Failures:  []string{"200 http://localhost/"},
+	}
+	want := "12 responses (2 2xx, 10 4xx), 1 errors, 2 findings, 1 matching -fail-on"
+	if got := s.String(); got != want {
+		t.Errorf("Expected %q, got %q", want, got)
+	}
+}
@@ -0,0 +1,170 @@
+// Copyright 2017 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package results
+
+import (
+	"fmt"
+	"io"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// resultTree arranges results by host and path, for printing as an indented
+// directory tree.
+type resultTree struct {
+	hosts map[string]*treeNode
+}
+
+type treeNode struct {
+	name     string
+	children map[string]*treeNode
+	// Result for this path, if it was found itself rather than only having
+	// things found beneath it
+	result *Result
+}
+
+func newResultTree() *resultTree {
+	return &resultTree{hosts: make(map[string]*treeNode)}
+}
+
+func newTreeNode(name string) *treeNode {
+	return &treeNode{name: name, children: make(map[string]*treeNode)}
+}
+
+// Add a result at the position of its path.  Directories along the way are
+// added as needed.
+func (t *resultTree) add(r Result) {
+	root := (&url.URL{Scheme: r.URL.Scheme, Host: r.URL.Host, Path: "/"}).String()
+	node, ok := t.hosts[root]
+	if !ok {
+		node = newTreeNode(root)
+		t.hosts[root] = node
+	}
+	parts := strings.Split(strings.TrimPrefix(r.URL.EscapedPath(), "/"), "/")
+	for i, part := range parts {
+		if part == "" {
+			// Trailing slash: the result is for the directory itself
+			break
+		}
+		name := part
+		if i < len(parts)-1 {
+			name += "/"
+		} else {
+			name += queryAndFragment(r.URL)
+		}
+		child, ok := node.children[name]
+		if !ok {
+			child = newTreeNode(name)
+			node.children[name] = child
+		}
+		node = child
+	}
+	node.result = &r
+}
+
+func queryAndFragment(u *url.URL) string {
+	s := ""
+	if u.RawQuery != "" {
+		s += "?" + u.RawQuery
+	}
+	if u.Fragment != "" {
+		s += "#" + u.Fragment
+	}
+	return s
+}
+
+// Write the tree for each host, hosts and entries in name order.
+func (t *resultTree) write(w io.Writer) {
+	roots := make([]string, 0, len(t.hosts))
+	for root := range t.hosts {
+		roots = append(roots, root)
+	}
+	sort.Strings(roots)
+	for _, root := range roots {
+		t.hosts[root].write(w, 0)
+	}
+}
+
+func (n *treeNode) write(w io.Writer, depth int) {
+	indent := strings.Repeat("  ", depth)
+	fmt.Fprintf(w, "%s%s%s\n", indent, n.name, n.describe())
+	if r := n.result; r != nil {
+		for _, entry := range r.ArchiveListing {
+			fmt.Fprintf(w, "%s    %s\n", indent, entry)
+		}
+		if r.Severity != "" {
+			fmt.Fprintf(w, "%s    severity: %s\n", indent, r.DescribeSeverity())
+		}
+		if r.DirListing > 0 {
+			fmt.Fprintf(w, "%s    directory listing (%d entries)\n", indent, r.DirListing)
+		}
+		if r.ListedIn != "" {
+			fmt.Fprintf(w, "%s    listed in %s\n", indent, r.ListedIn)
+		}
+		for _, leak := range r.Leaks {
+			fmt.Fprintf(w, "%s    leaks %s\n", indent, leak)
+		}
+		if r.Truncated {
+			fmt.Fprintf(w, "%s    truncated: larger than -max-body-size\n", indent)
+		}
+		for _, note := range r.Notes {
+			fmt.Fprintf(w, "%s    note: %s\n", indent, note)
+		}
+		if r.AgentDiff != "" {
+			fmt.Fprintf(w, "%s    differs %s\n", indent, r.AgentDiff)
+		}
+		if r.LatencyOutlier != "" {
+			fmt.Fprintf(w, "%s    slow: %s\n", indent, r.LatencyOutlier)
+		}
+		if r.Credentials != "" {
+			fmt.Fprintf(w, "%s    credentials %s\n", indent, r.Credentials)
+		}
+		if r.Suspect {
+			fmt.Fprintf(w, "%s    suspect: host was blocking requests\n", indent)
+		}
+	}
+	names := make([]string, 0, len(n.children))
+	for name := range n.children {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		n.children[name].write(w, depth+1)
+	}
+}
+
+// Summarize the node's result, e.g. " (200, 512 bytes)" or
+// " (301 -> https://host/new)".
+func (n *treeNode) describe() string {
+	r := n.result
+	if r == nil {
+		return ""
+	}
+	info := []string{fmt.Sprintf("%d", r.Code)}
+	if r.Redir != nil {
+		info[0] += " -> " + r.Redir.String()
+		if r.OffScopeRedirect {
+			info = append(info, "off scope")
+		}
+	} else if r.Length >= 0 {
+		info = append(info, r.Size())
+	}
+	s := " (" + strings.Join(info, ", ") + ")"
+	if r.Change != "" {
+		s += " [" + r.Change + "]"
+	}
+	return s
+}
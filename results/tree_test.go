@@ -0,0 +1,53 @@
+// Copyright 2017 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package results
+
+import (
+	"bytes"
+	"net/url"
+	"testing"
+)
+
+func TestPlainResultsManager_Tree(t *testing.T) {
+	buf := bytes.Buffer{}
+	mgr := &PlainResultsManager{writer: &buf, tree: newResultTree()}
+	rchan := make(chan Result)
+	mgr.Run(rchan)
+	for _, r := range []Result{
+		{URL: &url.URL{Scheme: "http", Host: "b.example", Path: "/"}, Code: 200, Length: 5},
+		{URL: &url.URL{Scheme: "http", Host: "a.example", Path: "/admin/login.php"}, Code: 200, Length: 1234},
+		{URL: &url.URL{Scheme: "http", Host: "a.example", Path: "/admin/"}, Code: 403, Length: -1},
+		{URL: &url.URL{Scheme: "http", Host: "a.example", Path: "/api/v1/users", RawQuery: "id=1"}, Code: 200, Length: 2, Change: ChangeNew},
+		{URL: &url.URL{Scheme: "http", Host: "a.example", Path: "/robots.txt"}, Code: 200, Length: 30, Leaks: []string{"db.internal"}},
+		{URL: &url.URL{Scheme: "http", Host: "a.example", Path: "/x"}, Code: 404},
+	} {
+		rchan <- r
+	}
+	close(rchan)
+	mgr.Wait()
+	expected := `http://a.example/
+  admin/ (403)
+    login.php (200, 1234 bytes)
+  api/
+    v1/
+      users?id=1 (200, 2 bytes) [new]
+  robots.txt (200, 30 bytes)
+      leaks db.internal
+http://b.example/ (200, 5 bytes)
+`
+	if out := buf.String(); out != expected {
+		t.Errorf("Expected tree:\n%s\ngot:\n%s", expected, out)
+	}
+}
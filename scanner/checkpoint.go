@@ -0,0 +1,119 @@
+// Copyright 2017 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scanner
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/Matir/webborer/storage"
+	"net/url"
+	"sync"
+)
+
+// A checkpoint records the progress of a scan so that an interrupted scan can
+// be resumed.  Resuming re-expands the starting URLs and everything discovered
+// during the scan, skipping tasks that were already completed.
+type checkpoint struct {
+	// URLs discovered during the scan (by spidering, redirects, etc.)
+	Seeds []string `json:"seeds"`
+	// Tasks that were completed
+	Completed []string `json:"completed"`
+	// Targets and words added to the running scan
+	Targets []string `json:"targets,omitempty"`
+	Words   []string `json:"words,omitempty"`
+	seen    map[string]bool
+	lock    sync.Mutex
+}
+
+func newCheckpoint() *checkpoint {
+	return &checkpoint{
+		Seeds:     make([]string, 0),
+		Completed: make([]string, 0),
+		seen:      make(map[string]bool),
+	}
+}
+
+func loadCheckpoint(path string) (*checkpoint, error) {
+	fp, err := storage.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to open checkpoint: %s", err.Error())
+	}
+	defer fp.Close()
+	c := newCheckpoint()
+	if err := json.NewDecoder(fp).Decode(c); err != nil {
+		return nil, fmt.Errorf("Unable to read checkpoint: %s", err.Error())
+	}
+	for _, s := range c.Seeds {
+		c.seen[s] = true
+	}
+	return c, nil
+}
+
+func (c *checkpoint) addSeeds(urls ...*url.URL) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	for _, u := range urls {
+		s := u.String()
+		if !c.seen[s] {
+			c.seen[s] = true
+			c.Seeds = append(c.Seeds, s)
+		}
+	}
+}
+
+func (c *checkpoint) addTargets(urls ...*url.URL) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	for _, u := range urls {
+		c.Targets = append(c.Targets, u.String())
+	}
+}
+
+func (c *checkpoint) addWords(words ...string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.Words = append(c.Words, words...)
+}
+
+func (c *checkpoint) complete(u *url.URL) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.Completed = append(c.Completed, u.String())
+}
+
+// Parse a list of URLs from the checkpoint, skipping any that are invalid.
+func parseURLs(strs []string) []*url.URL {
+	urls := make([]*url.URL, 0, len(strs))
+	for _, s := range strs {
+		if u, err := url.Parse(s); err == nil {
+			urls = append(urls, u)
+		}
+	}
+	return urls
+}
+
+func (c *checkpoint) write(path string) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	fp, err := storage.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := json.NewEncoder(fp).Encode(c); err != nil {
+		fp.Close()
+		return err
+	}
+	return fp.Close()
+}
@@ -0,0 +1,59 @@
+// Copyright 2017 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scanner
+
+import (
+	"bufio"
+	"github.com/Matir/webborer/logging"
+	"io"
+	"strings"
+)
+
+// Read commands to control the scan from r, one per line, until EOF.  Commands
+// are read once the scan has started.  Supported commands are:
+//
+//	word <word>...     add words to the wordlist
+//	target <url>...    add targets to the scan
+//	reload             reload settings from the config file
+func (s *Scanner) ReadControl(r io.Reader) {
+	<-s.started
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		if err := s.control(fields[0], fields[1:]); err != nil {
+			logging.Logf(logging.LogWarning, "Control command %s failed: %s", fields[0], err.Error())
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		logging.Logf(logging.LogWarning, "Error reading control commands: %s", err.Error())
+	}
+}
+
+func (s *Scanner) control(cmd string, args []string) error {
+	switch strings.ToLower(cmd) {
+	case "word", "words":
+		s.AddWords(args)
+	case "target", "targets":
+		return s.AddTargets(args)
+	case "reload":
+		return s.Reload()
+	default:
+		logging.Logf(logging.LogWarning, "Unknown control command: %s", cmd)
+	}
+	return nil
+}
@@ -0,0 +1,84 @@
+// Copyright 2017 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scanner
+
+import (
+	"github.com/Matir/webborer/fingerprint"
+	"github.com/Matir/webborer/logging"
+	"github.com/Matir/webborer/wordlist"
+	"net/url"
+	"strings"
+)
+
+// Probe each target host before the scan starts and tailor the scan to what
+// they run: the built-in wordlists for the stacks found are added to the
+// words, and the extensions for those stacks are returned to replace the
+// default ones.  Extensions given with -extensions are kept, so nil is
+// returned then, as it is if no stack is recognized.
+func (s *Scanner) applyFingerprints() []string {
+	seen := make(map[string]bool)
+	techs := make([]string, 0)
+	found := make(map[string]bool)
+	for _, target := range s.scope {
+		root := &url.URL{Scheme: target.Scheme, Host: target.Host, Path: "/"}
+		if seen[root.String()] {
+			continue
+		}
+		seen[root.String()] = true
+		fp := fingerprint.Probe(root, s.factory)
+		if len(fp.Technologies) == 0 {
+			logging.Logf(logging.LogInfo, "No technologies recognized on %s.", root.String())
+			continue
+		}
+		logging.Logf(logging.LogInfo, "Fingerprinted %s: %s", root.String(), fp.String())
+		for _, t := range fp.Technologies {
+			if !found[t] {
+				found[t] = true
+				techs = append(techs, t)
+			}
+		}
+	}
+	exts := fingerprint.Extensions(techs)
+	if len(exts) > 0 && s.settings.IsSet("extensions") {
+		logging.Logf(logging.LogInfo, "Keeping -extensions instead of those for %s.", strings.Join(techs, ", "))
+		exts = nil
+	} else if len(exts) > 0 {
+		logging.Logf(logging.LogInfo, "Using extensions for %s: %s", strings.Join(techs, ", "), strings.Join(exts, ", "))
+	}
+	have := make(map[string]bool, len(s.words))
+	for _, w := range s.words {
+		have[w] = true
+	}
+	for _, name := range fingerprint.Wordlists(techs) {
+		words, err := wordlist.LoadBuiltinWordlist(name)
+		if err != nil {
+			logging.Logf(logging.LogWarning, "Unable to load wordlist for %s: %s", name, err.Error())
+			continue
+		}
+		added := 0
+		for _, w := range words {
+			if !have[w] {
+				have[w] = true
+				s.words = append(s.words, w)
+				added++
+			}
+		}
+		logging.Logf(logging.LogInfo, "Added %d words for %s.", added, name)
+	}
+	if len(exts) == 0 {
+		return nil
+	}
+	return exts
+}
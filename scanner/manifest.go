@@ -0,0 +1,95 @@
+// Copyright 2017 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scanner
+
+import (
+	"encoding/json"
+	"github.com/Matir/webborer/client"
+	"github.com/Matir/webborer/filter"
+	ss "github.com/Matir/webborer/settings"
+	"github.com/Matir/webborer/storage"
+	"github.com/Matir/webborer/workqueue"
+	"net/url"
+	"time"
+)
+
+// A Manifest documents the boundaries of a scan: what was in scope, what was
+// excluded and why, and how much was skipped as a result.
+type Manifest struct {
+	Started  time.Time `json:"started"`
+	Finished time.Time `json:"finished"`
+	// Whether the scan was interrupted before finishing
+	Interrupted bool `json:"interrupted"`
+	// Starting URLs
+	Targets []string `json:"targets"`
+	// URL prefixes that were allowed to be scanned
+	Scope []string `json:"scope"`
+	// How robots.txt was handled
+	RobotsMode string `json:"robots_mode"`
+	// Paths that were not scanned
+	Exclusions []filter.Exclusion `json:"exclusions"`
+	// Number of URLs found during the scan that were outside the scope
+	OutOfScope int64 `json:"out_of_scope"`
+	// Checks of each target host before the scan, if they were made
+	Preflight []*TargetCheck `json:"preflight,omitempty"`
+	// How connections were reused, if known
+	Connections *client.ConnStats `json:"connections,omitempty"`
+	// Other hostnames on the targets' TLS certificates
+	SuggestedTargets []string `json:"suggested_targets,omitempty"`
+
+	upgradeHTTP bool
+}
+
+func newManifest(settings *ss.ScanSettings) *Manifest {
+	m := &Manifest{
+		Started:     time.Now(),
+		RobotsMode:  ss.RobotsModeName(settings.RobotsMode),
+		Exclusions:  make([]filter.Exclusion, 0),
+		upgradeHTTP: settings.AllowHTTPSUpgrade,
+	}
+	return m
+}
+
+// Record the final state of the scan, including targets added while running.
+func (m *Manifest) finish(scope []*url.URL, f *filter.WorkFilter, q *workqueue.WorkQueue, interrupted bool) {
+	m.Finished = time.Now()
+	m.Targets = urlStrings(scope)
+	m.Scope = urlStrings(workqueue.ScopeURLs(scope, m.upgradeHTTP))
+	m.Interrupted = interrupted
+	m.Exclusions = f.Exclusions()
+	m.OutOfScope = q.OutOfScopeCount()
+}
+
+func (m *Manifest) write(path string) error {
+	fp, err := storage.Create(path)
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(fp)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(m); err != nil {
+		fp.Close()
+		return err
+	}
+	return fp.Close()
+}
+
+func urlStrings(urls []*url.URL) []string {
+	strs := make([]string, 0, len(urls))
+	for _, u := range urls {
+		strs = append(strs, u.String())
+	}
+	return strs
+}
@@ -0,0 +1,187 @@
+// Copyright 2017 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scanner
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"github.com/Matir/webborer/client"
+	"github.com/Matir/webborer/logging"
+	"net"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Certificates expiring within this long are warned about.
+const certExpiryWarning = 30 * 24 * time.Hour
+
+// A TargetCheck is the result of checking a target host before the scan.
+type TargetCheck struct {
+	Target string `json:"target"`
+	// Addresses the host resolved to, if it was looked up
+	Addresses []string `json:"addresses,omitempty"`
+	// Status of the request for /, or why it failed
+	Status int    `json:"status,omitempty"`
+	Error  string `json:"error,omitempty"`
+	// TLS certificate chain presented, leaf first
+	Certificates []CertificateInfo `json:"certificates,omitempty"`
+}
+
+// The parts of a TLS certificate of interest for recon.
+type CertificateInfo struct {
+	CommonName string    `json:"common_name"`
+	SANs       []string  `json:"sans,omitempty"`
+	Issuer     string    `json:"issuer"`
+	NotAfter   time.Time `json:"not_after"`
+}
+
+// Check that each target host resolves and responds before scanning it, and
+// record its TLS certificates.  Targets on hosts that fail are dropped from
+// the scan, and an error is returned if none are left.  Hostnames named by
+// the certificates that aren't being scanned are returned as suggestions.
+func (s *Scanner) preflight(ctx context.Context) ([]*TargetCheck, []string, error) {
+	sockets, _ := s.settings.UnixSockets()
+	checks := make([]*TargetCheck, 0)
+	dead := make(map[string]bool)
+	for _, target := range s.scope {
+		root := &url.URL{Scheme: target.Scheme, Host: target.Host, Path: "/"}
+		if _, ok := dead[root.String()]; ok {
+			continue
+		}
+		check := &TargetCheck{Target: root.String()}
+		checks = append(checks, check)
+		// Leave resolution to the proxy or the socket if there is one
+		if len(s.settings.Proxies) == 0 && sockets[root.Host] == "" && !s.resolveOverridden(root.Hostname()) {
+			check.resolve(ctx, root.Hostname())
+		}
+		if check.Error == "" {
+			check.request(ctx, s.factory.Get(), root)
+		}
+		dead[root.String()] = check.Error != ""
+		if check.Error != "" {
+			logging.Logf(logging.LogWarning, "Skipping %s: %s", root.String(), check.Error)
+			continue
+		}
+		for _, cert := range check.Certificates {
+			logging.Logf(logging.LogInfo, "%s certificate: %s", root.Host, cert.String())
+			if remaining := cert.NotAfter.Sub(time.Now()); remaining < 0 {
+				logging.Logf(logging.LogWarning, "Certificate for %s expired %s.", cert.CommonName, cert.NotAfter.Format("2006-01-02"))
+			} else if remaining < certExpiryWarning {
+				logging.Logf(logging.LogWarning, "Certificate for %s expires %s.", cert.CommonName, cert.NotAfter.Format("2006-01-02"))
+			}
+		}
+	}
+	live := s.scope[:0]
+	for _, target := range s.scope {
+		if !dead[(&url.URL{Scheme: target.Scheme, Host: target.Host, Path: "/"}).String()] {
+			live = append(live, target)
+		}
+	}
+	s.scope = live
+	if len(live) == 0 {
+		return checks, nil, fmt.Errorf("None of the targets responded.")
+	}
+	suggested := suggestTargets(checks, live)
+	if len(suggested) > 0 {
+		logging.Logf(logging.LogInfo, "Certificates also name: %s", strings.Join(suggested, ", "))
+	}
+	return checks, suggested, nil
+}
+
+// Whether -resolve gives the address for host.
+func (s *Scanner) resolveOverridden(host string) bool {
+	for _, o := range s.settings.Resolve {
+		if strings.EqualFold(strings.SplitN(o, ":", 2)[0], host) {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *TargetCheck) resolve(ctx context.Context, host string) {
+	if net.ParseIP(host) != nil {
+		return
+	}
+	addrs, err := net.DefaultResolver.LookupHost(ctx, host)
+	if err != nil {
+		c.Error = fmt.Sprintf("Unable to resolve %s: %s", host, err.Error())
+		return
+	}
+	c.Addresses = addrs
+}
+
+func (c *TargetCheck) request(ctx context.Context, cli client.Client, u *url.URL) {
+	resp, err := cli.RequestURLContext(ctx, u)
+	if err != nil {
+		c.Error = err.Error()
+		return
+	}
+	resp.Body.Close()
+	c.Status = resp.StatusCode
+	if resp.TLS != nil {
+		c.Certificates = certificateChain(resp.TLS)
+	}
+}
+
+func certificateChain(state *tls.ConnectionState) []CertificateInfo {
+	chain := make([]CertificateInfo, 0, len(state.PeerCertificates))
+	for _, cert := range state.PeerCertificates {
+		chain = append(chain, CertificateInfo{
+			CommonName: cert.Subject.CommonName,
+			SANs:       cert.DNSNames,
+			Issuer:     cert.Issuer.CommonName,
+			NotAfter:   cert.NotAfter,
+		})
+	}
+	return chain
+}
+
+func (c CertificateInfo) String() string {
+	desc := fmt.Sprintf("CN=%s, issuer %s, expires %s", c.CommonName, c.Issuer, c.NotAfter.Format("2006-01-02"))
+	if len(c.SANs) > 0 {
+		desc += ", SANs " + strings.Join(c.SANs, " ")
+	}
+	return desc
+}
+
+// Hostnames in the leaf certificates of live targets that aren't targets
+// themselves, sorted.  Wildcard names are left out, as they don't name a
+// host to scan.
+func suggestTargets(checks []*TargetCheck, targets []*url.URL) []string {
+	scanned := make(map[string]bool)
+	for _, t := range targets {
+		scanned[strings.ToLower(t.Hostname())] = true
+	}
+	seen := make(map[string]bool)
+	suggested := make([]string, 0)
+	for _, c := range checks {
+		if c.Error != "" || len(c.Certificates) == 0 {
+			continue
+		}
+		for _, name := range c.Certificates[0].SANs {
+			name = strings.ToLower(name)
+			if strings.Contains(name, "*") || scanned[name] || seen[name] {
+				continue
+			}
+			seen[name] = true
+			suggested = append(suggested, name)
+		}
+	}
+	sort.Strings(suggested)
+	return suggested
+}
@@ -0,0 +1,122 @@
+// Copyright 2017 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scanner
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"github.com/Matir/webborer/scantest"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestCertificateChain(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+	u, _ := url.Parse(server.URL)
+	conn, err := tls.Dial("tcp", u.Host, &tls.Config{InsecureSkipVerify: true})
+	if err != nil {
+		t.Fatalf("Unable to connect: %v", err)
+	}
+	state := conn.ConnectionState()
+	conn.Close()
+	chain := certificateChain(&state)
+	if len(chain) == 0 || len(chain[0].SANs) == 0 || chain[0].SANs[0] != "example.com" {
+		t.Fatalf("Unexpected chain: %+v", chain)
+	}
+	if !chain[0].NotAfter.Equal(server.Certificate().NotAfter) {
+		t.Errorf("Expected expiry %s, got %s", server.Certificate().NotAfter, chain[0].NotAfter)
+	}
+
+	checks := []*TargetCheck{
+		{Target: server.URL + "/", Certificates: chain},
+		{Target: "https://other.example/", Certificates: []CertificateInfo{{SANs: []string{"*.example.com", "www.example.com", "Example.com"}}}},
+	}
+	targets := []*url.URL{u, {Scheme: "https", Host: "other.example", Path: "/"}}
+	suggested := suggestTargets(checks, targets)
+	if expected := []string{"example.com", "www.example.com"}; !reflect.DeepEqual(suggested, expected) {
+		t.Errorf("Expected suggestions %v, got %v", expected, suggested)
+	}
+}
+
+// A URL on a port nothing is listening on
+func deadURL(t *testing.T) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Unable to listen: %v", err)
+	}
+	l.Close()
+	return "http://" + l.Addr().String() + "/"
+}
+
+func TestScanner_Preflight(t *testing.T) {
+	target := scantest.NewTarget().Handle("/admin", scantest.Route{Body: "ok"})
+	baseURL := target.Start()
+	defer target.Close()
+	dead := deadURL(t)
+	settings := scantest.Settings(t, baseURL, "admin")
+	settings.BaseURLs = append(settings.BaseURLs, dead)
+	settings.Preflight = true
+	settings.ManifestPath = filepath.Join(filepath.Dir(settings.WordlistPath), "manifest.json")
+
+	scan, err := New(settings)
+	if err != nil {
+		t.Fatalf("Error creating scanner: %v", err)
+	}
+	codes := collect(scan.Results())
+	if err := scan.Run(context.Background()); err != nil {
+		t.Fatalf("Error running scan: %v", err)
+	}
+	if found := <-codes; found["/admin"] != 200 {
+		t.Errorf("Expected live target to be scanned, got %v", found)
+	}
+	buf, err := ioutil.ReadFile(settings.ManifestPath)
+	if err != nil {
+		t.Fatalf("Manifest not written: %v", err)
+	}
+	var m Manifest
+	if err := json.Unmarshal(buf, &m); err != nil {
+		t.Fatalf("Unable to parse manifest: %v", err)
+	}
+	if len(m.Targets) != 1 {
+		t.Errorf("Expected dead target to be dropped, got %v", m.Targets)
+	}
+	if len(m.Preflight) != 2 || m.Preflight[0].Status == 0 || m.Preflight[1].Error == "" {
+		t.Errorf("Unexpected preflight checks: %+v", m.Preflight)
+	}
+}
+
+func TestScanner_PreflightAllDead(t *testing.T) {
+	settings := scantest.Settings(t, deadURL(t), "admin")
+	settings.Preflight = true
+	scan, err := New(settings)
+	if err != nil {
+		t.Fatalf("Error creating scanner: %v", err)
+	}
+	codes := collect(scan.Results())
+	if err := scan.Run(context.Background()); err == nil {
+		t.Error("Expected error when no targets respond.")
+	}
+	if found := <-codes; len(found) != 0 {
+		t.Errorf("Expected no results, got %v", found)
+	}
+}
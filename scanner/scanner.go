@@ -0,0 +1,647 @@
+// Copyright 2017 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package scanner runs a complete webborer scan, from loading the wordlist to
+// producing results.  It can be used to embed webborer in other tools:
+//
+//	scan, err := scanner.New(settings)
+//	if err != nil {
+//		return err
+//	}
+//	go func() {
+//		for r := range scan.Results() {
+//			// handle r
+//		}
+//	}()
+//	err = scan.Run(ctx)
+package scanner
+
+import (
+	"context"
+	"fmt"
+	"github.com/Matir/webborer/client"
+	"github.com/Matir/webborer/filter"
+	"github.com/Matir/webborer/logging"
+	"github.com/Matir/webborer/remote"
+	"github.com/Matir/webborer/results"
+	"github.com/Matir/webborer/scope"
+	ss "github.com/Matir/webborer/settings"
+	"github.com/Matir/webborer/util"
+	"github.com/Matir/webborer/wordlist"
+	"github.com/Matir/webborer/worker"
+	"github.com/Matir/webborer/workqueue"
+	"net/url"
+	"sync"
+)
+
+// Scanner holds all of the components of a single scan.  A Scanner can only
+// be run once.
+type Scanner struct {
+	settings *ss.ScanSettings
+	factory  client.ClientFactory
+	words    []string
+	// Words read from disk as they are used, after words, if the wordlist is
+	// too large to load
+	stream *wordlist.Stream
+	scope  []*url.URL
+	rules  *scope.Rules
+	// Results of an earlier scan to compare with, if any
+	baseline *results.Baseline
+	// Credentials to try where Basic authentication is asked for
+	credentials []worker.Credential
+	// Tags results with their severity
+	scorer *results.Scorer
+	// Produces the variants of each word
+	transformer *wordlist.Transformer
+	// Plugins added with AddPlugin
+	plugins []worker.Plugin
+	// Log of requests and responses, closed when the scan finishes
+	requestLog *client.RequestLog
+	// Requests made by the workers
+	requests *worker.RequestCounter
+	queue    *workqueue.WorkQueue
+	// Channel for scan results
+	rchan chan results.Result
+	// Running components that can be reloaded or added to
+	filter      *filter.WorkFilter
+	expander    *filter.Expander
+	adder       workqueue.QueueAddFunc
+	ckpt        *checkpoint
+	coordinator *remote.Coordinator
+	lock        sync.Mutex
+	// Closed once words and targets can be added
+	started chan bool
+}
+
+// Build the HTTP client factory for the given settings, as used by New.
+// Agents use this too, so that they make requests in the same way.
+func NewClientFactory(settings *ss.ScanSettings) (*client.ProxyClientFactory, error) {
+	logging.Logf(logging.LogDebug, "Creating Client Factory...")
+	factory, err := client.NewProxyClientFactory(settings.Proxies, settings.Timeout, settings.UserAgent)
+	if err != nil {
+		return nil, err
+	}
+	factory.SetUsernamePassword(settings.HTTPUsername, settings.HTTPPassword)
+	if err := factory.SetProxyRules(settings.ProxyRules); err != nil {
+		return nil, err
+	}
+	if err := factory.SetResolveOverrides(settings.Resolve); err != nil {
+		return nil, err
+	}
+	sockets, err := settings.UnixSockets()
+	if err != nil {
+		return nil, err
+	}
+	factory.SetUnixSockets(sockets)
+	factory.SetConnectionOptions(settings.MaxConnsPerHost, settings.IdleConnsPerHost(), settings.NoKeepAlive)
+	factory.SetMaxBodySize(settings.MaxBodySize)
+	if err := factory.SetRequestTemplate(settings.Headers, settings.RequestMethod, settings.ContentType, settings.RequestData); err != nil {
+		return nil, err
+	}
+	agents, err := client.UserAgentList(settings.UserAgentFile, settings.RandomAgent)
+	if err != nil {
+		return nil, err
+	}
+	factory.SetUserAgents(agents)
+	if settings.Cache || settings.CacheDir != "" {
+		cache, err := client.NewResponseCache(settings.CacheDir, settings.CacheTTL)
+		if err != nil {
+			return nil, err
+		}
+		factory.SetCache(cache)
+	}
+	return factory, nil
+}
+
+// Construct a Scanner for the given settings, loading the wordlist and
+// building an HTTP client factory.
+func New(settings *ss.ScanSettings) (*Scanner, error) {
+	factory, err := NewClientFactory(settings)
+	if err != nil {
+		return nil, err
+	}
+	var requestLog *client.RequestLog
+	if settings.RequestLogPath != "" {
+		if requestLog, err = client.NewRequestLog(settings.RequestLogPath); err != nil {
+			return nil, err
+		}
+		factory.SetRequestLog(requestLog)
+	}
+	scan, err := NewWithClientFactory(settings, factory)
+	if err != nil {
+		if requestLog != nil {
+			requestLog.Close()
+		}
+		return nil, err
+	}
+	if scan.baseline != nil {
+		factory.SetValidators(scan.baseline.Validators)
+	}
+	scan.requestLog = requestLog
+	return scan, nil
+}
+
+// Construct a Scanner that makes its requests with clients from factory.
+func NewWithClientFactory(settings *ss.ScanSettings, factory client.ClientFactory) (*Scanner, error) {
+	transformer, err := wordlist.NewTransformer(settings.WordCases,
+		settings.WordPrefixes, settings.WordSuffixes, settings.WordEncode)
+	if err != nil {
+		return nil, err
+	}
+	var words []string
+	var stream *wordlist.Stream
+	if wordlist.ShouldStream(settings.WordlistPath, settings.StreamWordlist) {
+		if stream, err = wordlist.OpenStream(settings.WordlistPath, transformer); err != nil {
+			return nil, err
+		}
+		if settings.Shuffle {
+			logging.Logf(logging.LogWarning, "Streamed wordlists can't be shuffled, using wordlist order.")
+		}
+		if settings.WordDedup {
+			logging.Logf(logging.LogWarning, "Duplicate words aren't removed from streamed wordlists.")
+		}
+	} else {
+		if words, err = wordlist.LoadWordlist(settings.WordlistPath); err != nil {
+			return nil, err
+		}
+		if settings.WordDedup {
+			words = util.DedupeStrings(words)
+		}
+		if settings.Shuffle {
+			wordlist.Shuffle(words)
+		}
+		if !transformer.Identity() {
+			// Variants are produced as each word is reached
+			if stream, err = wordlist.NewListStream(words, transformer); err != nil {
+				return nil, err
+			}
+			words = nil
+		}
+	}
+	rules, err := scope.NewRules(settings.ScopeInclude, settings.ScopeExclude)
+	if err != nil {
+		return nil, err
+	}
+	bases, err := settings.GetScopes()
+	if err != nil {
+		return nil, err
+	}
+	var baseline *results.Baseline
+	if settings.DiffPath != "" {
+		if baseline, err = results.LoadBaseline(settings.DiffPath); err != nil {
+			return nil, err
+		}
+	}
+	var credentials []worker.Credential
+	if settings.AuthWordlist != "" {
+		if credentials, err = worker.ReadCredentialFile(settings.AuthWordlist); err != nil {
+			return nil, err
+		}
+	}
+	scorer, err := results.NewScorer(settings.SignatureFiles)
+	if err != nil {
+		return nil, err
+	}
+	queue := workqueue.NewWorkQueue(settings.QueueSize, bases, settings.AllowHTTPSUpgrade)
+	queue.SetRules(rules)
+	return &Scanner{
+		settings:    settings,
+		factory:     factory,
+		words:       words,
+		stream:      stream,
+		scope:       bases,
+		rules:       rules,
+		baseline:    baseline,
+		credentials: credentials,
+		scorer:      scorer,
+		transformer: transformer,
+		queue:       queue,
+		requests:    &worker.RequestCounter{},
+		rchan:       make(chan results.Result, settings.QueueSize),
+		started:     make(chan bool),
+	}, nil
+}
+
+// Add a plugin to the scan.  Its request and response hooks are added to each
+// worker, and its result hook sees every result, including working
+// credentials, files from directory listings and results from agents.
+// Plugins must be added before Run.
+func (s *Scanner) AddPlugin(p worker.Plugin) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.plugins = append(s.plugins, p)
+}
+
+// Channel of results.  The channel is closed when Run returns, and must be
+// read from for the scan to make progress.
+func (s *Scanner) Results() <-chan results.Result {
+	return s.rchan
+}
+
+// Counter tracking the work done and remaining, for progress displays.
+func (s *Scanner) Counter() *workqueue.WorkCounter {
+	return s.queue.GetCounter()
+}
+
+// Number of requests made so far, for progress displays.
+func (s *Scanner) RequestCount() int64 {
+	return s.requests.Count()
+}
+
+// Run the scan until all work is done or ctx is cancelled.  When cancelled,
+// requests in progress are aborted, the results channel is closed once the
+// workers have stopped, and a checkpoint is written if one was requested.
+func (s *Scanner) Run(ctx context.Context) error {
+	settings := s.settings
+	if s.requestLog != nil {
+		defer func() {
+			if err := s.requestLog.Close(); err != nil {
+				logging.Logf(logging.LogError, "Unable to write request log: %s", err.Error())
+			}
+		}()
+	}
+	queue := s.queue
+	runCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	if s.stream != nil {
+		defer s.stream.Close()
+	}
+
+	manifest := newManifest(settings)
+	ckpt := newCheckpoint()
+	// Targets added to the scan before it was interrupted
+	var resumedTargets []*url.URL
+	if settings.ResumePath != "" {
+		var err error
+		if ckpt, err = loadCheckpoint(settings.ResumePath); err != nil {
+			close(s.rchan)
+			return err
+		}
+		logging.Logf(logging.LogInfo, "Resuming with %d completed tasks.", len(ckpt.Completed))
+		if resumedTargets = parseURLs(ckpt.Targets); len(resumedTargets) > 0 {
+			s.scope = append(s.scope, resumedTargets...)
+			queue.AddScope(resumedTargets...)
+		}
+		// Words were transformed when added
+		s.words = append(s.words, ckpt.Words...)
+	}
+	resumeSeeds := parseURLs(ckpt.Seeds)
+	adder := func(urls ...*url.URL) {
+		ckpt.addSeeds(urls...)
+		queue.AddURLs(urls...)
+	}
+
+	if settings.Preflight {
+		logging.Logf(logging.LogInfo, "Checking targets...")
+		var err error
+		if manifest.Preflight, manifest.SuggestedTargets, err = s.preflight(runCtx); err != nil {
+			close(s.rchan)
+			return err
+		}
+	}
+
+	if settings.Fingerprint && !settings.Fuzzing() {
+		logging.Logf(logging.LogInfo, "Fingerprinting targets...")
+		if exts := s.applyFingerprints(); exts != nil {
+			// The caller's settings are left as they were
+			copied := *settings
+			copied.Extensions = exts
+			settings = &copied
+			s.lock.Lock()
+			s.settings = settings
+			s.lock.Unlock()
+		}
+	}
+
+	// Setup the main workqueue
+	logging.Logf(logging.LogDebug, "Starting work queue...")
+	queue.RunInBackground(runCtx)
+
+	logging.Logf(logging.LogDebug, "Creating expander and filter...")
+	expander := filter.Expander{
+		Wordlist:    &s.words,
+		Stream:      s.stream,
+		Adder:       queue.GetAddCount(),
+		Estimate:    queue.GetEstimateFunc(),
+		Fuzz:        settings.Fuzzing(),
+		FuzzRequest: settings.FuzzRequest(),
+	}
+	expander.ProcessWordlist()
+	filter := filter.NewWorkFilter(settings, queue.GetDoneFunc())
+	for _, u := range parseURLs(ckpt.Completed) {
+		filter.MarkDone(u)
+	}
+	s.lock.Lock()
+	filter.SetScopeRules(s.rules)
+	s.filter = filter
+	s.expander = &expander
+	s.adder = adder
+	s.ckpt = ckpt
+	s.lock.Unlock()
+
+	// Check robots mode
+	if settings.RobotsMode == ss.ObeyRobots {
+		filter.AddRobotsFilter(s.scope, s.factory)
+	}
+
+	// filter paths after expansion
+	logging.Debugf("Starting expansion and filtering...")
+	work := filter.RunFilter(expander.Expand(runCtx, queue.GetWorkChan()))
+
+	// Interleave hosts and limit per-host concurrency
+	scheduler := workqueue.NewHostScheduler(work, settings.HostConcurrency, settings.QueueSize*len(s.scope))
+	scheduler.RunInBackground(runCtx)
+	schedulerRelease := scheduler.GetReleaseFunc()
+	release := func(u *url.URL) {
+		ckpt.complete(u)
+		schedulerRelease(u)
+	}
+
+	// Results pass through here so blocking can be detected across workers
+	// or agents
+	wchan, forwarded := s.watchResults(runCtx, scheduler)
+
+	var coordinator *remote.Coordinator
+	var workers []*worker.Worker
+	if settings.Mode == ss.ServeMode {
+		logging.Logf(logging.LogDebug, "Starting coordinator...")
+		coordinator = remote.NewCoordinator(settings, scheduler.GetWorkChan(), adder, queue.GetDoneFunc(), release, wchan)
+		coordinator.SetReloadFunc(s.Reload)
+		coordinator.SetAddWordsFunc(s.AddWords)
+		coordinator.SetAddTargetsFunc(s.AddTargets)
+		coordinator.SetPauseFunc(scheduler.GetPauseFunc())
+		coordinator.AddScope(resumedTargets...)
+		s.lock.Lock()
+		s.coordinator = coordinator
+		s.lock.Unlock()
+		if err := coordinator.Start(); err != nil {
+			cancel()
+			queue.InputFinished()
+			close(wchan)
+			<-forwarded
+			return err
+		}
+	} else {
+		logging.Logf(logging.LogDebug, "Starting %d workers...", settings.Workers)
+		workers = worker.StartWorkers(runCtx, settings, s.factory, scheduler.GetWorkChan(), adder, queue.GetDoneFunc(), release, scheduler.GetPauseFunc(), queue.GetScopeFunc(), s.requests, wchan, s.plugins)
+	}
+
+	// Kick things off with the seed URL
+	logging.Logf(logging.LogDebug, "Adding starting URLs: %v", s.scope)
+	queue.AddURLs(s.scope...)
+	if s.baseline != nil {
+		// Check everything found last time, whether or not it is linked
+		queue.AddURLs(s.baseline.URLs()...)
+	}
+	if len(resumeSeeds) > 0 {
+		logging.Logf(logging.LogDebug, "Adding %d URLs from checkpoint.", len(resumeSeeds))
+		queue.AddURLs(resumeSeeds...)
+	}
+
+	// Potentially seed from robots
+	if settings.RobotsMode == ss.SeedRobots {
+		queue.SeedFromRobots(s.scope, s.factory)
+	}
+	close(s.started)
+
+	// Wait for work to be done, or for the queue to be cancelled
+	logging.Logf(logging.LogDebug, "Waiting for work...")
+	queue.WaitPipe()
+	err := ctx.Err()
+	// No more work may be added from outside the scan
+	s.lock.Lock()
+	s.adder = nil
+	s.expander = nil
+	s.lock.Unlock()
+	if err == nil {
+		logging.Logf(logging.LogDebug, "Work done.")
+	} else {
+		logging.Logf(logging.LogInfo, "Scan cancelled, stopping workers.")
+	}
+
+	// Cleanup
+	if coordinator != nil {
+		coordinator.Finish()
+		coordinator.Stop()
+	}
+	if err == nil {
+		// Workers stop once their input is finished
+		queue.InputFinished()
+		for _, w := range workers {
+			w.Wait()
+		}
+	} else {
+		// Workers may still be adding work until they stop
+		for _, w := range workers {
+			w.Wait()
+		}
+		queue.InputFinished()
+		if settings.CheckpointPath != "" {
+			if werr := ckpt.write(settings.CheckpointPath); werr != nil {
+				logging.Logf(logging.LogError, "Unable to write checkpoint: %s", werr.Error())
+			} else {
+				logging.Logf(logging.LogInfo, "Checkpoint written to %s", settings.CheckpointPath)
+			}
+		}
+	}
+	if sf, ok := s.factory.(client.StatsClientFactory); ok {
+		if stats := sf.ConnectionStats(); stats.New+stats.Reused > 0 {
+			logging.Logf(logging.LogInfo, "Connections: %s", stats.String())
+			manifest.Connections = &stats
+		}
+	}
+	if settings.ManifestPath != "" {
+		s.lock.Lock()
+		manifest.finish(s.scope, filter, queue, err != nil)
+		s.lock.Unlock()
+		if werr := manifest.write(settings.ManifestPath); werr != nil {
+			logging.Logf(logging.LogError, "Unable to write manifest: %s", werr.Error())
+		}
+	}
+	close(wchan)
+	<-forwarded
+	return err
+}
+
+// Pass results from the workers or agents on to the results channel after
+// annotating them: hosts that start blocking the scan are slowed down, and
+// results are checked for aliases, latency outliers, changes from the
+// baseline, credentials to try, severity and noise.  The results channel is
+// closed once the returned channel is closed and everything has been passed
+// on.
+func (s *Scanner) watchResults(ctx context.Context, scheduler *workqueue.HostScheduler) (chan<- results.Result, <-chan bool) {
+	var detector *worker.BlockDetector
+	if worker.BlockDetectionEnabled(s.settings) {
+		detector = worker.NewBlockDetector(s.settings, scheduler.GetPauseFunc(), scheduler.GetThrottleFunc())
+	}
+	var aliases *results.AliasDetector
+	if s.settings.CollapseAliases {
+		aliases = results.NewAliasDetector()
+	}
+	var latency *results.LatencyDetector
+	if s.settings.LatencyOutliers {
+		latency = results.NewLatencyDetector()
+	}
+	var noise *results.NoiseDetector
+	if s.settings.Denoise {
+		noise = results.NewNoiseDetector()
+	}
+	report := func(r results.Result) {
+		worker.RunResultHooks(s.plugins, &r)
+		s.rchan <- r
+	}
+	var tester *worker.CredentialTester
+	// Working credentials, passed on by their own goroutine as the tester
+	// may be waiting to test another endpoint
+	tested := make(chan results.Result)
+	testedDone := make(chan bool)
+	go func() {
+		defer close(testedDone)
+		for r := range tested {
+			report(r)
+		}
+	}()
+	if len(s.credentials) > 0 {
+		if tester = worker.NewCredentialTester(s.factory, s.credentials, s.settings.AuthDelay, tested); tester != nil {
+			tester.Run(ctx)
+		}
+	}
+	wchan := make(chan results.Result, s.settings.QueueSize)
+	forwarded := make(chan bool)
+	go func() {
+		defer close(forwarded)
+		defer close(s.rchan)
+		for r := range wchan {
+			if detector != nil {
+				detector.Observe(&r)
+			}
+			if aliases != nil {
+				aliases.Observe(&r)
+			}
+			if latency != nil {
+				latency.Observe(&r)
+			}
+			if s.baseline != nil {
+				s.baseline.Compare(&r, s.settings.IsPositiveCode(r.Code))
+			}
+			if tester != nil {
+				tester.Observe(&r)
+			}
+			s.scorer.Score(&r)
+			if noise != nil {
+				// After scoring, as results with a severity are never noise
+				noise.Observe(&r)
+			}
+			report(r)
+		}
+		if tester != nil {
+			tester.Finish()
+		}
+		close(tested)
+		<-testedDone
+	}()
+	return wchan, forwarded
+}
+
+// Reload settings from the config file and apply them to the running scan.
+// The exclude paths and scope rules take effect for URLs not yet filtered.
+// In serve mode, agents are also sent the settings they make requests with,
+// such as the extensions, status codes, delays and request template.  Other
+// settings, like the wordlist and number of workers, keep their values from
+// startup.
+func (s *Scanner) Reload() error {
+	s.lock.Lock()
+	settings := s.settings
+	s.lock.Unlock()
+	fresh, err := settings.Reload()
+	if err != nil {
+		return err
+	}
+	rules, err := scope.NewRules(fresh.ScopeInclude, fresh.ScopeExclude)
+	if err != nil {
+		return err
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.rules = rules
+	s.queue.SetRules(rules)
+	if s.filter != nil {
+		s.filter.SetExcludePaths(fresh.ExcludePaths)
+		s.filter.SetScopeRules(rules)
+	}
+	if s.coordinator != nil {
+		s.coordinator.UpdateSettings(fresh)
+	}
+	logging.Logf(logging.LogInfo, "Settings reloaded.")
+	return nil
+}
+
+// Add words to the wordlist of a running scan, with the same transformations
+// as the wordlist.  They are tried in every directory found so far, as well as
+// those found later.
+func (s *Scanner) AddWords(words []string) {
+	s.lock.Lock()
+	expander, ckpt, settings := s.expander, s.ckpt, s.settings
+	s.lock.Unlock()
+	if expander == nil {
+		logging.Logf(logging.LogWarning, "Scan not running, unable to add words.")
+		return
+	}
+	transformed := make([]string, 0, len(words))
+	for _, w := range words {
+		s.transformer.Transform(w, func(v string) {
+			transformed = append(transformed, v)
+		})
+	}
+	words = transformed
+	if settings.Shuffle {
+		wordlist.Shuffle(words)
+	}
+	ckpt.addWords(words...)
+	expander.AddWords(words...)
+	logging.Logf(logging.LogInfo, "Added %d words to the scan.", len(words))
+}
+
+// Add targets to a running scan.  Each target is added to the scope and
+// scanned like the starting URLs.
+func (s *Scanner) AddTargets(targets []string) error {
+	urls := make([]*url.URL, 0, len(targets))
+	for _, t := range targets {
+		u, err := url.Parse(t)
+		if err != nil {
+			return fmt.Errorf("Unable to parse target (%s): %s", t, err.Error())
+		}
+		if u.Scheme == "" || u.Host == "" {
+			return fmt.Errorf("Target must be an absolute URL: %s", t)
+		}
+		if u.Path == "" {
+			u.Path = "/"
+		}
+		urls = append(urls, u)
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.adder == nil {
+		return fmt.Errorf("Scan is not running.")
+	}
+	s.scope = append(s.scope, urls...)
+	s.queue.AddScope(urls...)
+	s.ckpt.addTargets(urls...)
+	if s.coordinator != nil {
+		s.coordinator.AddScope(urls...)
+	}
+	s.adder(urls...)
+	logging.Logf(logging.LogInfo, "Added %d targets to the scan.", len(urls))
+	return nil
+}
@@ -0,0 +1,827 @@
+// Copyright 2017 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scanner
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/Matir/webborer/results"
+	"github.com/Matir/webborer/scantest"
+	ss "github.com/Matir/webborer/settings"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func testSettings(t *testing.T, baseURL string) *ss.ScanSettings {
+	dir, err := ioutil.TempDir("", "scanner")
+	if err != nil {
+		t.Fatalf("Unable to create temp dir: %v", err)
+	}
+	wordlist := filepath.Join(dir, "words.txt")
+	if err := ioutil.WriteFile(wordlist, []byte("admin\nmissing\n"), 0644); err != nil {
+		t.Fatalf("Unable to write wordlist: %v", err)
+	}
+	return &ss.ScanSettings{
+		BaseURLs:     []string{baseURL},
+		WordlistPath: wordlist,
+		QueueSize:    16,
+		Workers:      2,
+		Timeout:      5 * time.Second,
+		SpiderCodes:  []int{200},
+		Mode:         ss.ScanMode,
+	}
+}
+
+func collect(ch <-chan results.Result) <-chan map[string]int {
+	out := make(chan map[string]int, 1)
+	go func() {
+		codes := make(map[string]int)
+		for r := range ch {
+			codes[r.URL.Path] = r.Code
+		}
+		out <- codes
+	}()
+	return out
+}
+
+func TestScanner_Run(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/" || r.URL.Path == "/admin" {
+			w.Write([]byte("ok"))
+			return
+		}
+		http.NotFound(w, r)
+	}))
+	defer server.Close()
+	settings := testSettings(t, server.URL)
+	defer os.RemoveAll(filepath.Dir(settings.WordlistPath))
+
+	scan, err := New(settings)
+	if err != nil {
+		t.Fatalf("Error creating scanner: %v", err)
+	}
+	codes := collect(scan.Results())
+	if err := scan.Run(context.Background()); err != nil {
+		t.Fatalf("Error running scan: %v", err)
+	}
+	found := <-codes
+	if found["/admin"] != 200 {
+		t.Errorf("Expected /admin to be found, got %v", found)
+	}
+	if code, ok := found["/missing"]; ok && code != 404 {
+		t.Errorf("Unexpected code for /missing: %d", code)
+	}
+}
+
+func TestScanner_RequestCount(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/" {
+			w.Write([]byte("ok"))
+			return
+		}
+		http.NotFound(w, r)
+	}))
+	defer server.Close()
+	settings := testSettings(t, server.URL)
+	defer os.RemoveAll(filepath.Dir(settings.WordlistPath))
+
+	first, err := New(settings)
+	if err != nil {
+		t.Fatalf("Error creating scanner: %v", err)
+	}
+	second, err := New(settings)
+	if err != nil {
+		t.Fatalf("Error creating scanner: %v", err)
+	}
+	codes := collect(first.Results())
+	if err := first.Run(context.Background()); err != nil {
+		t.Fatalf("Error running scan: %v", err)
+	}
+	<-codes
+	if first.RequestCount() == 0 {
+		t.Error("Expected requests to be counted.")
+	}
+	if n := second.RequestCount(); n != 0 {
+		t.Errorf("Requests of one scan counted for another: %d", n)
+	}
+}
+
+func TestScanner_Fuzz(t *testing.T) {
+	var lock sync.Mutex
+	var requests []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		requests = append(requests, r.Method+" "+r.URL.RequestURI()+" "+r.Header.Get("X-Token"))
+		lock.Unlock()
+		if r.URL.Query().Get("id") == "admin" && r.Header.Get("X-Token") == "admin" {
+			w.Write([]byte("ok"))
+			return
+		}
+		http.NotFound(w, r)
+	}))
+	defer server.Close()
+	settings := testSettings(t, server.URL+"/item?id=FUZZ")
+	defer os.RemoveAll(filepath.Dir(settings.WordlistPath))
+	settings.Headers = []string{"X-Token: FUZZ"}
+	settings.Extensions = []string{"php"}
+	settings.Mangle = true
+
+	scan, err := New(settings)
+	if err != nil {
+		t.Fatalf("Error creating scanner: %v", err)
+	}
+	found := make(chan []string, 1)
+	go func() {
+		var urls []string
+		for r := range scan.Results() {
+			if r.Code == 200 {
+				urls = append(urls, r.URL.String())
+			}
+		}
+		found <- urls
+	}()
+	if err := scan.Run(context.Background()); err != nil {
+		t.Fatalf("Error running scan: %v", err)
+	}
+	expected := server.URL + "/item?id=admin#admin"
+	if urls := <-found; len(urls) != 1 || urls[0] != expected {
+		t.Errorf("Expected only %s to be found, got %v", expected, urls)
+	}
+	// One request per word: no directories, extensions or mangling
+	if len(requests) != 2 {
+		t.Errorf("Expected 2 requests, got %v", requests)
+	}
+}
+
+func TestScanner_Cancel(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+	settings := testSettings(t, server.URL)
+	defer os.RemoveAll(filepath.Dir(settings.WordlistPath))
+
+	scan, err := New(settings)
+	if err != nil {
+		t.Fatalf("Error creating scanner: %v", err)
+	}
+	codes := collect(scan.Results())
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	settings.CheckpointPath = filepath.Join(filepath.Dir(settings.WordlistPath), "checkpoint.json")
+	if err := scan.Run(ctx); err != context.Canceled {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+	// Results channel must be closed
+	<-codes
+	if _, err := loadCheckpoint(settings.CheckpointPath); err != nil {
+		t.Errorf("Expected checkpoint to be written: %v", err)
+	}
+}
+
+func TestScanner_Resume(t *testing.T) {
+	var lock sync.Mutex
+	requested := make(map[string]bool)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		requested[r.URL.Path] = true
+		lock.Unlock()
+		if r.URL.Path == "/" || r.URL.Path == "/admin/" || r.URL.Path == "/admin/missing" {
+			w.Write([]byte("ok"))
+			return
+		}
+		http.NotFound(w, r)
+	}))
+	defer server.Close()
+	settings := testSettings(t, server.URL)
+	defer os.RemoveAll(filepath.Dir(settings.WordlistPath))
+
+	ckpt := newCheckpoint()
+	ckpt.Seeds = []string{server.URL + "/admin/"}
+	ckpt.Completed = []string{server.URL + "/", server.URL + "/admin"}
+	ckpt.Words = []string{"added"}
+	settings.ResumePath = filepath.Join(filepath.Dir(settings.WordlistPath), "checkpoint.json")
+	if err := ckpt.write(settings.ResumePath); err != nil {
+		t.Fatalf("Unable to write checkpoint: %v", err)
+	}
+
+	scan, err := New(settings)
+	if err != nil {
+		t.Fatalf("Error creating scanner: %v", err)
+	}
+	codes := collect(scan.Results())
+	if err := scan.Run(context.Background()); err != nil {
+		t.Fatalf("Error running scan: %v", err)
+	}
+	found := <-codes
+	if requested["/admin"] {
+		t.Error("Completed task was requested again.")
+	}
+	if found["/admin/missing"] != 200 {
+		t.Errorf("Expected seed from checkpoint to be expanded, got %v", found)
+	}
+	if !requested["/admin/added"] {
+		t.Error("Expected word added to the checkpointed scan to be tried.")
+	}
+}
+
+func TestScanner_Manifest(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(`<a href="/admin/secret/x">x</a><a href="http://elsewhere.invalid/">y</a>`))
+	}))
+	defer server.Close()
+	settings := testSettings(t, server.URL)
+	defer os.RemoveAll(filepath.Dir(settings.WordlistPath))
+	settings.ParseHTML = true
+	settings.ExcludePaths = []string{server.URL + "/admin/secret"}
+	settings.ManifestPath = filepath.Join(filepath.Dir(settings.WordlistPath), "manifest.json")
+
+	scan, err := New(settings)
+	if err != nil {
+		t.Fatalf("Error creating scanner: %v", err)
+	}
+	codes := collect(scan.Results())
+	if err := scan.Run(context.Background()); err != nil {
+		t.Fatalf("Error running scan: %v", err)
+	}
+	<-codes
+	buf, err := ioutil.ReadFile(settings.ManifestPath)
+	if err != nil {
+		t.Fatalf("Manifest not written: %v", err)
+	}
+	var m Manifest
+	if err := json.Unmarshal(buf, &m); err != nil {
+		t.Fatalf("Unable to parse manifest: %v", err)
+	}
+	if len(m.Targets) != 1 || m.Targets[0] != server.URL+"/" || m.Interrupted {
+		t.Errorf("Unexpected manifest: %+v", m)
+	}
+	if len(m.Exclusions) != 1 || m.Exclusions[0].Skipped == 0 {
+		t.Errorf("Expected exclusion to have skipped URLs: %+v", m.Exclusions)
+	}
+	if m.OutOfScope == 0 {
+		t.Error("Expected out of scope URLs to be counted.")
+	}
+}
+
+func TestScanner_ReadControl(t *testing.T) {
+	release := make(chan bool)
+	var lock sync.Mutex
+	requested := make(map[string]bool)
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		requested[r.Host+r.URL.Path] = true
+		lock.Unlock()
+		// Keep the scan running until the control commands are read
+		if r.URL.Path == "/missing" {
+			<-release
+		}
+		http.NotFound(w, r)
+	}
+	server := httptest.NewServer(http.HandlerFunc(handler))
+	defer server.Close()
+	other := httptest.NewServer(http.HandlerFunc(handler))
+	defer other.Close()
+	settings := testSettings(t, server.URL)
+	defer os.RemoveAll(filepath.Dir(settings.WordlistPath))
+	settings.WordSuffixes = []string{".bak"}
+
+	scan, err := New(settings)
+	if err != nil {
+		t.Fatalf("Error creating scanner: %v", err)
+	}
+	codes := collect(scan.Results())
+	done := make(chan error)
+	go func() {
+		done <- scan.Run(context.Background())
+	}()
+	scan.ReadControl(strings.NewReader("word extra\n# comment\nbogus\ntarget " + other.URL + "\n"))
+	close(release)
+	if err := <-done; err != nil {
+		t.Fatalf("Error running scan: %v", err)
+	}
+	<-codes
+	serverHost := strings.TrimPrefix(server.URL, "http://")
+	otherHost := strings.TrimPrefix(other.URL, "http://")
+	for _, p := range []string{serverHost + "/extra", serverHost + "/extra.bak", otherHost + "/", otherHost + "/admin", otherHost + "/extra"} {
+		if !requested[p] {
+			t.Errorf("Expected %s to be requested.", p)
+		}
+	}
+	if ckpt := scan.ckpt; strings.Join(ckpt.Words, ",") != "extra,extra.bak" || len(ckpt.Targets) != 1 || ckpt.Targets[0] != other.URL+"/" {
+		t.Errorf("Expected additions in checkpoint, got words %v, targets %v", ckpt.Words, ckpt.Targets)
+	}
+	if err := scan.AddTargets([]string{other.URL}); err == nil {
+		t.Error("Expected error adding targets after the scan finished.")
+	}
+}
+
+func TestScanner_ScopeRules(t *testing.T) {
+	target := scantest.NewTarget().
+		Handle("/", scantest.Route{Body: `<a href="/delete/1">x</a>`}).
+		Handle("/admin", scantest.Route{Body: "ok"}).
+		Handle("/logout", scantest.Route{Body: "bye"}).
+		Handle("/go", scantest.Route{Redirect: "/logout"})
+	baseURL := target.Start()
+	defer target.Close()
+	settings := scantest.Settings(t, baseURL, "admin", "logout", "go")
+	settings.ParseHTML = true
+	settings.FollowRedirects = 2
+	settings.ScopeExclude = []string{"path:/logout", "path:/delete"}
+
+	scan, err := New(settings)
+	if err != nil {
+		t.Fatalf("Error creating scanner: %v", err)
+	}
+	codes := collect(scan.Results())
+	if err := scan.Run(context.Background()); err != nil {
+		t.Fatalf("Error running scan: %v", err)
+	}
+	<-codes
+	for _, p := range []string{"/admin", "/go"} {
+		if !target.Requested(p) {
+			t.Errorf("Expected %s to be requested, got %v", p, target.Requests())
+		}
+	}
+	for _, p := range []string{"/logout", "/delete/1"} {
+		if target.Requested(p) {
+			t.Errorf("Expected excluded %s not to be requested, got %v", p, target.Requests())
+		}
+	}
+}
+
+// Settings loaded from a config file are bound to the command line flags,
+// which may only be defined once.
+var configSettings = ss.NewScanSettings()
+
+func TestScanner_ReloadScopeRules(t *testing.T) {
+	target := scantest.NewTarget().
+		Handle("/", scantest.Route{Body: "ok"}).
+		Handle("/admin", scantest.Route{Body: "ok"}).
+		Handle("/logout", scantest.Route{Body: "bye"})
+	baseURL := target.Start()
+	defer target.Close()
+	conf := filepath.Join(t.TempDir(), "webborer.conf")
+	if err := ioutil.WriteFile(conf, []byte("# No rules yet\n"), 0644); err != nil {
+		t.Fatalf("Unable to write config: %v", err)
+	}
+	// Loading a config file sets every flag to its default, so the test
+	// settings are applied afterwards.
+	configSettings.LoadFromConfigFile(conf)
+	settings := *configSettings
+	test := scantest.Settings(t, baseURL, "admin", "logout")
+	settings.BaseURLs = test.BaseURLs
+	settings.WordlistPath = test.WordlistPath
+	settings.QueueSize = test.QueueSize
+	settings.Workers = test.Workers
+	settings.Timeout = test.Timeout
+	settings.Extensions = nil
+
+	scan, err := New(&settings)
+	if err != nil {
+		t.Fatalf("Error creating scanner: %v", err)
+	}
+	if err := ioutil.WriteFile(conf, []byte("scope-exclude = path:/logout\n"), 0644); err != nil {
+		t.Fatalf("Unable to write config: %v", err)
+	}
+	if err := scan.Reload(); err != nil {
+		t.Fatalf("Error reloading: %v", err)
+	}
+	logout, _ := url.Parse(baseURL + "logout")
+	if scan.queue.InScope(logout) {
+		t.Error("Expected reloaded rule to exclude /logout from the queue.")
+	}
+	codes := collect(scan.Results())
+	if err := scan.Run(context.Background()); err != nil {
+		t.Fatalf("Error running scan: %v", err)
+	}
+	<-codes
+	if !target.Requested("/admin") {
+		t.Errorf("Expected /admin to be requested, got %v", target.Requests())
+	}
+	if target.Requested("/logout") {
+		t.Errorf("Expected excluded /logout not to be requested, got %v", target.Requests())
+	}
+}
+
+func TestScanner_ParseJS(t *testing.T) {
+	target := scantest.NewTarget().
+		Handle("/app.js", scantest.Route{Body: `fetch("/api/v1/users"); location = "/internal/admin";`, ContentType: "application/javascript"}).
+		Handle("/api/v1/users", scantest.Route{Body: "[]"}).
+		Handle("/internal/admin", scantest.Route{Body: "ok"})
+	baseURL := target.Start()
+	defer target.Close()
+	settings := scantest.Settings(t, baseURL, "app.js")
+	settings.ParseJS = true
+
+	scan, err := New(settings)
+	if err != nil {
+		t.Fatalf("Error creating scanner: %v", err)
+	}
+	codes := collect(scan.Results())
+	if err := scan.Run(context.Background()); err != nil {
+		t.Fatalf("Error running scan: %v", err)
+	}
+	found := <-codes
+	for _, p := range []string{"/api/v1/users", "/internal/admin"} {
+		if found[p] != 200 {
+			t.Errorf("Expected %s from app.js to be found, got %v", p, found)
+		}
+	}
+}
+
+func TestScanner_DirListings(t *testing.T) {
+	target := scantest.NewTarget().
+		Handle("/files/", scantest.Route{Body: `<html><title>Index of /files</title><a href="/">Parent Directory</a><a href="secret.txt">secret.txt</a><a href="sub/">sub/</a></html>`}).
+		Handle("/files/sub/", scantest.Route{Body: `<html><title>Index of /files/sub</title><a href="deep.bak">deep.bak</a></html>`}).
+		Handle("/files/secret.txt", scantest.Route{Body: "secret"})
+	baseURL := target.Start()
+	defer target.Close()
+	settings := scantest.Settings(t, baseURL, "files", "secret.txt")
+	settings.DirListings = true
+
+	scan, err := New(settings)
+	if err != nil {
+		t.Fatalf("Error creating scanner: %v", err)
+	}
+	codes := collect(scan.Results())
+	if err := scan.Run(context.Background()); err != nil {
+		t.Fatalf("Error running scan: %v", err)
+	}
+	found := <-codes
+	for _, p := range []string{"/files/secret.txt", "/files/sub/", "/files/sub/deep.bak"} {
+		if found[p] != 200 {
+			t.Errorf("Expected %s from listing to be found, got %v", p, found)
+		}
+	}
+	for _, p := range []string{"/files/secret.txt", "/files/sub/deep.bak"} {
+		if target.Requested(p) {
+			t.Errorf("Expected listed %s not to be requested, got %v", p, target.Requests())
+		}
+	}
+}
+
+// A plugin that notes each result it sees
+type notePlugin struct{}
+
+func (notePlugin) Name() string {
+	return "note"
+}
+
+func (notePlugin) OnResult(result *results.Result) {
+	result.Notes = append(result.Notes, "seen")
+}
+
+func TestScanner_AddPlugin(t *testing.T) {
+	target := scantest.NewTarget().
+		Handle("/files/", scantest.Route{Body: `<html><title>Index of /files</title><a href="secret.txt">secret.txt</a></html>`})
+	baseURL := target.Start()
+	defer target.Close()
+	settings := scantest.Settings(t, baseURL, "files")
+	settings.DirListings = true
+
+	scan, err := New(settings)
+	if err != nil {
+		t.Fatalf("Error creating scanner: %v", err)
+	}
+	scan.AddPlugin(notePlugin{})
+	notes := make(chan map[string]int, 1)
+	go func() {
+		seen := make(map[string]int)
+		for r := range scan.Results() {
+			seen[r.URL.Path] = len(r.Notes)
+		}
+		notes <- seen
+	}()
+	if err := scan.Run(context.Background()); err != nil {
+		t.Fatalf("Error running scan: %v", err)
+	}
+	seen := <-notes
+	// Including the file from the listing, which no worker requested
+	for _, p := range []string{"/files/", "/files/secret.txt"} {
+		if seen[p] != 1 {
+			t.Errorf("Expected result hook to see %s once, got %v", p, seen)
+		}
+	}
+}
+
+func TestScanner_Denoise(t *testing.T) {
+	target := scantest.NewTarget()
+	words := make([]string, 0)
+	for i := 0; i < 20; i++ {
+		// Every path gets the same page
+		p := fmt.Sprintf("page%d", i)
+		words = append(words, p)
+		target.Handle("/"+p, scantest.Route{Body: "welcome"})
+	}
+	baseURL := target.Start()
+	defer target.Close()
+	settings := scantest.Settings(t, baseURL, words...)
+	settings.Workers = 1
+	settings.Denoise = true
+
+	scan, err := New(settings)
+	if err != nil {
+		t.Fatalf("Error creating scanner: %v", err)
+	}
+	noise := make(chan int, 1)
+	go func() {
+		count := 0
+		for r := range scan.Results() {
+			if r.NoiseOf != "" {
+				count++
+			}
+		}
+		noise <- count
+	}()
+	if err := scan.Run(context.Background()); err != nil {
+		t.Fatalf("Error running scan: %v", err)
+	}
+	if count := <-noise; count < 10 {
+		t.Errorf("Expected repeats of the same page to be noise, got %d", count)
+	}
+}
+
+func TestScanner_StreamWordlist(t *testing.T) {
+	target := scantest.NewTarget().
+		Handle("/", scantest.Route{Body: "home"}).
+		Handle("/admin/", scantest.Route{Body: "ok"}).
+		Handle("/admin/backup", scantest.Route{Body: "ok"})
+	baseURL := target.Start()
+	defer target.Close()
+	settings := scantest.Settings(t, baseURL, "admin", "backup")
+	settings.StreamWordlist = true
+
+	scan, err := New(settings)
+	if err != nil {
+		t.Fatalf("Error creating scanner: %v", err)
+	}
+	if len(scan.words) != 0 || scan.stream == nil {
+		t.Fatalf("Expected wordlist to be streamed, loaded %v", scan.words)
+	}
+	codes := collect(scan.Results())
+	if err := scan.Run(context.Background()); err != nil {
+		t.Fatalf("Error running scan: %v", err)
+	}
+	found := <-codes
+	for _, p := range []string{"/admin/", "/admin/backup"} {
+		if found[p] != 200 {
+			t.Errorf("Expected %s to be found, got %v", p, found)
+		}
+	}
+	if done, total := scan.Counter().Counts(); done != total {
+		t.Errorf("Expected all work done, got %d/%d", done, total)
+	}
+}
+
+func TestScanner_Fingerprint(t *testing.T) {
+	target := scantest.NewTarget().
+		Handle("/", scantest.Route{Body: "home", Header: http.Header{"X-Powered-By": {"PHP/8.1.2"}}}).
+		Handle("/admin.php", scantest.Route{Body: "ok"})
+	baseURL := target.Start()
+	defer target.Close()
+	settings := scantest.Settings(t, baseURL, "admin")
+	settings.Extensions = []string{"aspx"}
+	settings.Fingerprint = true
+
+	scan, err := New(settings)
+	if err != nil {
+		t.Fatalf("Error creating scanner: %v", err)
+	}
+	codes := collect(scan.Results())
+	if err := scan.Run(context.Background()); err != nil {
+		t.Fatalf("Error running scan: %v", err)
+	}
+	found := <-codes
+	if found["/admin.php"] != 200 {
+		t.Errorf("Expected /admin.php to be found, got %v", found)
+	}
+	if target.Requested("/admin.aspx") {
+		t.Errorf("Expected default extension to be replaced, got %v", target.Requests())
+	}
+	if len(settings.Extensions) != 1 || settings.Extensions[0] != "aspx" {
+		t.Errorf("Expected caller's settings to be unchanged, got %v", settings.Extensions)
+	}
+	if !target.Requested("/phpinfo.php") {
+		t.Errorf("Expected words from builtin:php to be requested, got %v", target.Requests())
+	}
+}
+
+func TestScanner_AuthWordlist(t *testing.T) {
+	// Credentials only count where they get a real page, so both paths exist
+	target := scantest.NewTarget().
+		Handle("/", scantest.Route{Body: "home"}).
+		Handle("/admin", scantest.Route{Body: "admin"})
+	target.Username, target.Password = "admin", "hunter2"
+	baseURL := target.Start()
+	defer target.Close()
+	settings := scantest.Settings(t, baseURL, "admin")
+	creds := filepath.Join(filepath.Dir(settings.WordlistPath), "creds.txt")
+	if err := ioutil.WriteFile(creds, []byte("admin:admin\nadmin:hunter2\n"), 0644); err != nil {
+		t.Fatalf("Unable to write credentials: %v", err)
+	}
+	settings.AuthWordlist = creds
+
+	scan, err := New(settings)
+	if err != nil {
+		t.Fatalf("Error creating scanner: %v", err)
+	}
+	found := make(chan []string, 1)
+	go func() {
+		var working []string
+		for r := range scan.Results() {
+			if r.Credentials != "" {
+				working = append(working, r.URL.Path+" "+r.Credentials)
+			}
+		}
+		found <- working
+	}()
+	if err := scan.Run(context.Background()); err != nil {
+		t.Fatalf("Error running scan: %v", err)
+	}
+	// Whichever 401 was seen first is tried, and the realm only once
+	if working := <-found; len(working) != 1 || !strings.HasSuffix(working[0], " admin:hunter2") {
+		t.Errorf("Expected admin:hunter2 to work once, got %v", working)
+	}
+}
+
+func TestScanner_UnixSocket(t *testing.T) {
+	dir, err := ioutil.TempDir("", "scanner")
+	if err != nil {
+		t.Fatalf("Unable to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	socket := filepath.Join(dir, "app.sock")
+	l, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Skipf("Unix sockets unavailable: %v", err)
+	}
+	target := scantest.NewTarget().Handle("/api/admin", scantest.Route{Body: "ok"})
+	server := &http.Server{Handler: target}
+	go server.Serve(l)
+	defer server.Close()
+	settings := scantest.Settings(t, "unix://"+socket+":/api/", "admin")
+
+	scan, err := New(settings)
+	if err != nil {
+		t.Fatalf("Error creating scanner: %v", err)
+	}
+	codes := collect(scan.Results())
+	if err := scan.Run(context.Background()); err != nil {
+		t.Fatalf("Error running scan: %v", err)
+	}
+	if found := <-codes; found["/api/admin"] != 200 {
+		t.Errorf("Expected /api/admin to be found over the socket, got %v", found)
+	}
+}
+
+func TestScanner_BlockDetection(t *testing.T) {
+	var lock sync.Mutex
+	served := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		served++
+		n := served
+		lock.Unlock()
+		if n > 8 {
+			http.Error(w, "Slow down", http.StatusTooManyRequests)
+			return
+		}
+		http.NotFound(w, r)
+	}))
+	defer server.Close()
+	words := make([]string, 30)
+	for i := range words {
+		words[i] = fmt.Sprintf("word%d", i)
+	}
+	settings := scantest.Settings(t, server.URL, words...)
+	settings.BlockAction = ss.BlockWarn
+
+	scan, err := New(settings)
+	if err != nil {
+		t.Fatalf("Error creating scanner: %v", err)
+	}
+	blocked, suspect := 0, 0
+	done := make(chan bool)
+	go func() {
+		for r := range scan.Results() {
+			if r.Blocked != "" {
+				blocked++
+			}
+			if r.Suspect {
+				suspect++
+			}
+		}
+		close(done)
+	}()
+	if err := scan.Run(context.Background()); err != nil {
+		t.Fatalf("Error running scan: %v", err)
+	}
+	<-done
+	if blocked != 1 || suspect == 0 {
+		t.Errorf("Expected one blocking event and suspect results, got %d and %d", blocked, suspect)
+	}
+}
+
+func TestScanner_Diff(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/same":
+			w.Header().Set("ETag", `"a"`)
+			if r.Header.Get("If-None-Match") == `"a"` {
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+			w.Write([]byte("same"))
+		case "/edited":
+			w.Header().Set("ETag", `"b"`)
+			w.Write([]byte("edited"))
+		case "/", "/admin":
+			w.Write([]byte("ok"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+	settings := scantest.Settings(t, server.URL, "admin")
+	settings.DiffPath = filepath.Join(t.TempDir(), "baseline.json")
+	baseline := ""
+	for _, p := range []string{"/", "/same", "/edited", "/gone"} {
+		baseline += fmt.Sprintf(`{"URL":"%s%s","Code":200,"Length":-1,"ETag":"\"a\""}`+"\n", server.URL, p)
+	}
+	if err := ioutil.WriteFile(settings.DiffPath, []byte(baseline), 0644); err != nil {
+		t.Fatalf("Unable to write baseline: %v", err)
+	}
+
+	scan, err := New(settings)
+	if err != nil {
+		t.Fatalf("Error creating scanner: %v", err)
+	}
+	changes := make(chan map[string]string, 1)
+	go func() {
+		found := make(map[string]string)
+		for r := range scan.Results() {
+			found[r.URL.Path] = r.Change
+		}
+		changes <- found
+	}()
+	if err := scan.Run(context.Background()); err != nil {
+		t.Fatalf("Error running scan: %v", err)
+	}
+	expected := map[string]string{
+		"/same":   results.ChangeUnchanged,
+		"/edited": results.ChangeChanged,
+		"/gone":   results.ChangeRemoved,
+		"/admin":  results.ChangeNew,
+	}
+	found := <-changes
+	for p, change := range expected {
+		if found[p] != change {
+			t.Errorf("Expected %s to be %q, got %q", p, change, found[p])
+		}
+	}
+}
+
+func TestNew_BadScopeRule(t *testing.T) {
+	settings := testSettings(t, "http://localhost/")
+	defer os.RemoveAll(filepath.Dir(settings.WordlistPath))
+	settings.ScopeExclude = []string{"bogus"}
+	if _, err := New(settings); err == nil {
+		t.Error("Expected error for invalid scope rule.")
+	}
+}
+
+func TestNew_BadWordlist(t *testing.T) {
+	settings := testSettings(t, "http://localhost/")
+	os.RemoveAll(filepath.Dir(settings.WordlistPath))
+	if _, err := New(settings); err == nil {
+		t.Error("Expected error for missing wordlist.")
+	}
+}
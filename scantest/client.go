@@ -0,0 +1,111 @@
+// Copyright 2017 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scantest
+
+import (
+	"context"
+	"github.com/Matir/webborer/client"
+	"github.com/Matir/webborer/util"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+)
+
+// Transport is an http.RoundTripper that answers requests by calling Handler
+// directly, without a network.
+type Transport struct {
+	Handler http.Handler
+}
+
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if err := req.Context().Err(); err != nil {
+		return nil, err
+	}
+	rec := httptest.NewRecorder()
+	t.Handler.ServeHTTP(rec, req)
+	if err := req.Context().Err(); err != nil {
+		return nil, err
+	}
+	resp := rec.Result()
+	resp.Request = req
+	return resp, nil
+}
+
+// Client is a client.Client that sends every request to a handler through a
+// Transport, and records the URLs requested.
+type Client struct {
+	// User-Agent sent with each request
+	UserAgent string
+	http      *http.Client
+	lock      sync.Mutex
+	requests  []*url.URL
+}
+
+// Construct a Client that sends requests to h.
+func NewClient(h http.Handler) *Client {
+	return &Client{http: &http.Client{Transport: &Transport{Handler: h}}}
+}
+
+func (c *Client) RequestURL(u *url.URL) (*http.Response, error) {
+	return c.RequestURLContext(context.Background(), u)
+}
+
+func (c *Client) RequestURLContext(ctx context.Context, u *url.URL) (*http.Response, error) {
+	c.lock.Lock()
+	c.requests = append(c.requests, u)
+	c.lock.Unlock()
+	req, err := http.NewRequest("GET", util.WithoutPayload(u).String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	if c.UserAgent != "" {
+		req.Header.Set("User-Agent", c.UserAgent)
+	}
+	return c.http.Do(req.WithContext(ctx))
+}
+
+func (c *Client) SetCheckRedirect(f func(*http.Request, []*http.Request) error) {
+	c.http.CheckRedirect = f
+}
+
+// URLs requested through this client so far.
+func (c *Client) Requests() []*url.URL {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return append([]*url.URL(nil), c.requests...)
+}
+
+// ClientFactory makes Clients that all send requests to the same handler.
+// It also supports clients with a different User-Agent, for -compare-agent.
+type ClientFactory struct {
+	Handler   http.Handler
+	UserAgent string
+}
+
+// Construct a ClientFactory whose clients send requests to h.
+func NewClientFactory(h http.Handler) *ClientFactory {
+	return &ClientFactory{Handler: h}
+}
+
+func (f *ClientFactory) Get() client.Client {
+	return f.GetWithAgent(f.UserAgent)
+}
+
+func (f *ClientFactory) GetWithAgent(agent string) client.Client {
+	c := NewClient(f.Handler)
+	c.UserAgent = agent
+	return c
+}
@@ -0,0 +1,147 @@
+// Copyright 2017 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scantest_test
+
+import (
+	"context"
+	"fmt"
+	"github.com/Matir/webborer/results"
+	"github.com/Matir/webborer/scanner"
+	"github.com/Matir/webborer/scantest"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"testing"
+	"time"
+)
+
+// Run a scan to completion and return the status code of each path.
+func runScan(t *testing.T, scan *scanner.Scanner) map[string]int {
+	codes := make(chan map[string]int, 1)
+	go func() {
+		found := make(map[string]int)
+		for r := range scan.Results() {
+			found[r.URL.Path] = r.Code
+		}
+		codes <- found
+	}()
+	if err := scan.Run(context.Background()); err != nil {
+		t.Fatalf("Error running scan: %v", err)
+	}
+	return <-codes
+}
+
+func TestTarget_Routes(t *testing.T) {
+	target := scantest.NewTarget().
+		Handle("/", scantest.Route{Body: `<a href="/linked">x</a>`, ContentType: "text/html"}).
+		Handle("/admin", scantest.Route{Status: http.StatusForbidden}).
+		Handle("/linked", scantest.Route{Body: "found"}).
+		Handle("/old", scantest.Route{Redirect: "/linked"})
+	settings := scantest.Settings(t, "http://target.test/", "admin", "old", "missing")
+	settings.ParseHTML = true
+	scan, err := scanner.NewWithClientFactory(settings, scantest.NewClientFactory(target))
+	if err != nil {
+		t.Fatalf("Error creating scanner: %v", err)
+	}
+	codes := runScan(t, scan)
+	expected := map[string]int{"/admin": 403, "/linked": 200, "/old": 302, "/missing": 404}
+	for path, code := range expected {
+		if codes[path] != code {
+			t.Errorf("Expected %d for %s, got %d", code, path, codes[path])
+		}
+	}
+	if !target.Requested("/linked") {
+		t.Errorf("Expected link to be followed, requests: %v", target.Requests())
+	}
+}
+
+func TestTarget_SoftNotFoundAndAuth(t *testing.T) {
+	target := scantest.NewTarget()
+	target.SoftNotFound = true
+	target.Username, target.Password = "user", "pass"
+	client := scantest.NewClient(target)
+	u, _ := url.Parse("http://target.test/anything")
+	resp, err := client.RequestURL(u)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if resp.StatusCode != 401 || resp.Header.Get("WWW-Authenticate") == "" {
+		t.Errorf("Expected 401 with a challenge, got %d", resp.StatusCode)
+	}
+	target.Username = ""
+	resp, _ = client.RequestURL(u)
+	body, _ := ioutil.ReadAll(resp.Body)
+	if resp.StatusCode != 200 || string(body) != scantest.SoftNotFoundBody {
+		t.Errorf("Expected soft 404 page, got %d %q", resp.StatusCode, body)
+	}
+	if len(client.Requests()) != 2 {
+		t.Errorf("Expected 2 requests recorded, got %v", client.Requests())
+	}
+}
+
+func TestTarget_Delay(t *testing.T) {
+	target := scantest.NewTarget().Handle("/slow", scantest.Route{Delay: time.Hour})
+	client := scantest.NewClient(target)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	u, _ := url.Parse("http://target.test/slow")
+	if _, err := client.RequestURLContext(ctx, u); err == nil {
+		t.Error("Expected delayed request to be cancelled.")
+	}
+}
+
+func TestTarget_Start(t *testing.T) {
+	target := scantest.NewTarget().Handle("/admin", scantest.Route{Body: "ok"})
+	base := target.Start()
+	defer target.Close()
+	resp, err := http.Get(base + "admin")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != 200 {
+		t.Errorf("Expected 200, got %d", resp.StatusCode)
+	}
+}
+
+func TestTarget_Findings(t *testing.T) {
+	target := scantest.NewTarget().
+		Handle("/admin", scantest.Route{Body: "welcome"}).
+		Handle("/backup.zip", scantest.Route{Status: http.StatusForbidden})
+	settings := scantest.Settings(t, "http://target.test/", "admin", "backup.zip", "missing")
+	scan, err := scanner.NewWithClientFactory(settings, scantest.NewClientFactory(target))
+	if err != nil {
+		t.Fatalf("Error creating scanner: %v", err)
+	}
+	found := make(chan []string, 1)
+	go func() {
+		var paths []string
+		for r := range scan.Results() {
+			if results.ReportResult(r) {
+				paths = append(paths, fmt.Sprintf("%d %s", r.Code, r.URL.Path))
+			}
+		}
+		sort.Strings(paths)
+		found <- paths
+	}()
+	if err := scan.Run(context.Background()); err != nil {
+		t.Fatalf("Error running scan: %v", err)
+	}
+	expected := "[200 /admin 403 /backup.zip]"
+	if got := fmt.Sprint(<-found); got != expected {
+		t.Errorf("Expected %s, got %s", expected, got)
+	}
+}
@@ -0,0 +1,45 @@
+// Copyright 2017 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scantest
+
+import (
+	ss "github.com/Matir/webborer/settings"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Build settings suited to tests for a scan of baseURL with the given words.
+// The wordlist is written to a temporary directory that is removed when the
+// test finishes.  Settings can be changed before the scan is created.
+func Settings(tb testing.TB, baseURL string, words ...string) *ss.ScanSettings {
+	tb.Helper()
+	wordlist := filepath.Join(tb.TempDir(), "words.txt")
+	if err := ioutil.WriteFile(wordlist, []byte(strings.Join(words, "\n")+"\n"), 0644); err != nil {
+		tb.Fatalf("Unable to write wordlist: %v", err)
+	}
+	return &ss.ScanSettings{
+		BaseURLs:      []string{baseURL},
+		WordlistPath:  wordlist,
+		QueueSize:     16,
+		Workers:       2,
+		Timeout:       5 * time.Second,
+		SpiderCodes:   []int{200},
+		NegativeCodes: ss.MustParseCodeRanges(ss.DefaultNegativeCodes),
+		Mode:          ss.ScanMode,
+	}
+}
@@ -0,0 +1,195 @@
+// Copyright 2017 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package scantest provides a fake target and clients for testing programs
+// that embed webborer.  A Target serves configurable routes, optionally with
+// delays, HTTP authentication and "soft 404" pages, and a ClientFactory
+// connects scans to it in-process so tests are fast and deterministic:
+//
+//	target := scantest.NewTarget()
+//	target.Handle("/admin", scantest.Route{Body: "welcome"})
+//	settings := scantest.Settings(t, "http://target.test/", "admin", "backup")
+//	scan, err := scanner.NewWithClientFactory(settings, scantest.NewClientFactory(target))
+package scantest
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Page returned for unknown paths by a target with SoftNotFound.
+const SoftNotFoundBody = "<html><body><h1>Page not found</h1></body></html>"
+
+// A Route is the response a Target gives for a path.
+type Route struct {
+	// Status code, 200 if zero
+	Status int
+	// Body of the response
+	Body string
+	// Content-Type header, sniffed from Body if empty
+	ContentType string
+	// Additional headers
+	Header http.Header
+	// Location to redirect to; Status defaults to 302 if set
+	Redirect string
+	// Time to wait before responding, in addition to the target's Delay
+	Delay time.Duration
+}
+
+// A Target is a fake web server with a fixed set of routes.  It can be used
+// as an http.Handler, served over the network with Start, or reached without
+// a network through NewClientFactory.
+type Target struct {
+	// Time to wait before every response
+	Delay time.Duration
+	// Credentials required for every path, using HTTP Basic authentication,
+	// if Username is set
+	Username, Password string
+	// Answer unknown paths with 200 and SoftNotFoundBody instead of 404, like
+	// servers with a catch-all error page
+	SoftNotFound bool
+
+	lock     sync.Mutex
+	routes   map[string]Route
+	requests []string
+	server   *httptest.Server
+}
+
+func NewTarget() *Target {
+	return &Target{routes: make(map[string]Route)}
+}
+
+// Set the response for path, replacing any previous route.  Returns the target
+// so calls can be chained.
+func (t *Target) Handle(path string, r Route) *Target {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.routes[path] = r
+	return t
+}
+
+// Paths requested so far, in order, including unknown paths.
+func (t *Target) Requests() []string {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	return append([]string(nil), t.requests...)
+}
+
+// Whether path has been requested.
+func (t *Target) Requested(path string) bool {
+	for _, p := range t.Requests() {
+		if p == path {
+			return true
+		}
+	}
+	return false
+}
+
+// Paths with routes, sorted.
+func (t *Target) Paths() []string {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	paths := make([]string, 0, len(t.routes))
+	for p := range t.routes {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+func (t *Target) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	t.lock.Lock()
+	t.requests = append(t.requests, req.URL.Path)
+	route, found := t.routes[req.URL.Path]
+	t.lock.Unlock()
+
+	if !t.wait(req, t.Delay+route.Delay) {
+		return
+	}
+	if t.Username != "" {
+		user, pass, ok := req.BasicAuth()
+		if !ok || user != t.Username || pass != t.Password {
+			w.Header().Set("WWW-Authenticate", `Basic realm="scantest"`)
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+	}
+	if !found {
+		if t.SoftNotFound {
+			w.Header().Set("Content-Type", "text/html")
+			fmt.Fprint(w, SoftNotFoundBody)
+			return
+		}
+		http.NotFound(w, req)
+		return
+	}
+	for k, v := range route.Header {
+		w.Header()[k] = v
+	}
+	if route.ContentType != "" {
+		w.Header().Set("Content-Type", route.ContentType)
+	}
+	status := route.Status
+	if route.Redirect != "" {
+		if status == 0 {
+			status = http.StatusFound
+		}
+		w.Header().Set("Location", route.Redirect)
+	}
+	if status == 0 {
+		status = http.StatusOK
+	}
+	w.WriteHeader(status)
+	fmt.Fprint(w, route.Body)
+}
+
+// Wait for d, returning false if the request is cancelled first.
+func (t *Target) wait(req *http.Request, d time.Duration) bool {
+	if d <= 0 {
+		return true
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-req.Context().Done():
+		return false
+	}
+}
+
+// Serve the target on a local port, returning its base URL.  Close stops
+// the server.
+func (t *Target) Start() string {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if t.server == nil {
+		t.server = httptest.NewServer(t)
+	}
+	return t.server.URL + "/"
+}
+
+func (t *Target) Close() {
+	t.lock.Lock()
+	server := t.server
+	t.server = nil
+	t.lock.Unlock()
+	if server != nil {
+		server.Close()
+	}
+}
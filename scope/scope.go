@@ -0,0 +1,177 @@
+// Copyright 2017 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package scope provides include and exclude rules that limit what a scan may
+// request, beyond the subpaths of the base URLs.
+package scope
+
+import (
+	"fmt"
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// A Rule matches URLs by host, port, path prefix and regular expression.  A
+// rule is written as one or more space separated conditions, all of which
+// must match, such as "host:*.example.com port:8443" or "path:/logout".
+type Rule struct {
+	// Glob matched against the hostname
+	Host string
+	// Port, including the default port for the scheme
+	Port string
+	// Prefix of the path
+	Path string
+	// Matched against the whole URL
+	Regex *regexp.Regexp
+	text  string
+}
+
+// Parse a rule from its text form.
+func ParseRule(text string) (*Rule, error) {
+	r := &Rule{text: text}
+	fields := strings.Fields(text)
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("Empty scope rule.")
+	}
+	for _, field := range fields {
+		parts := strings.SplitN(field, ":", 2)
+		if len(parts) != 2 || parts[1] == "" {
+			return nil, fmt.Errorf("Invalid scope condition %q, expected kind:value.", field)
+		}
+		value := parts[1]
+		switch parts[0] {
+		case "host":
+			value = strings.ToLower(value)
+			if _, err := path.Match(value, ""); err != nil {
+				return nil, fmt.Errorf("Invalid host pattern %q: %s", value, err)
+			}
+			r.Host = value
+		case "port":
+			r.Port = value
+		case "path":
+			if !strings.HasPrefix(value, "/") {
+				value = "/" + value
+			}
+			r.Path = value
+		case "regex":
+			re, err := regexp.Compile(value)
+			if err != nil {
+				return nil, fmt.Errorf("Invalid scope regex %q: %s", value, err)
+			}
+			r.Regex = re
+		default:
+			return nil, fmt.Errorf("Unknown scope condition %q.", parts[0])
+		}
+	}
+	return r, nil
+}
+
+// Whether all of the rule's conditions match u.
+func (r *Rule) Match(u *url.URL) bool {
+	if r.Host != "" {
+		if ok, _ := path.Match(r.Host, strings.ToLower(u.Hostname())); !ok {
+			return false
+		}
+	}
+	if r.Port != "" && r.Port != Port(u) {
+		return false
+	}
+	if r.Path != "" {
+		p := u.Path
+		if p == "" {
+			p = "/"
+		}
+		if !strings.HasPrefix(p, r.Path) {
+			return false
+		}
+	}
+	if r.Regex != nil && !r.Regex.MatchString(u.String()) {
+		return false
+	}
+	return true
+}
+
+func (r *Rule) String() string {
+	return r.text
+}
+
+// Port of u, or the default port for its scheme.
+func Port(u *url.URL) string {
+	if p := u.Port(); p != "" {
+		return p
+	}
+	switch u.Scheme {
+	case "http":
+		return "80"
+	case "https":
+		return "443"
+	}
+	return ""
+}
+
+// Rules are the include and exclude rules for a scan.  Included URLs are in
+// scope even outside of the base URLs, and excluded URLs are never in scope.
+// A nil *Rules has no rules.
+type Rules struct {
+	Include []*Rule
+	Exclude []*Rule
+}
+
+// Parse include and exclude rules.
+func NewRules(include, exclude []string) (*Rules, error) {
+	rules := &Rules{}
+	for _, text := range include {
+		r, err := ParseRule(text)
+		if err != nil {
+			return nil, err
+		}
+		rules.Include = append(rules.Include, r)
+	}
+	for _, text := range exclude {
+		r, err := ParseRule(text)
+		if err != nil {
+			return nil, err
+		}
+		rules.Exclude = append(rules.Exclude, r)
+	}
+	return rules, nil
+}
+
+// Whether u matches an include rule.
+func (rs *Rules) Included(u *url.URL) bool {
+	if rs == nil {
+		return false
+	}
+	for _, r := range rs.Include {
+		if r.Match(u) {
+			return true
+		}
+	}
+	return false
+}
+
+// The first exclude rule that matches u, or nil.
+func (rs *Rules) Excluded(u *url.URL) *Rule {
+	if rs == nil {
+		return nil
+	}
+	for _, r := range rs.Exclude {
+		if r.Match(u) {
+			return r
+		}
+	}
+	return nil
+}
@@ -0,0 +1,88 @@
+// Copyright 2017 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scope
+
+import (
+	"net/url"
+	"testing"
+)
+
+func TestParseRule(t *testing.T) {
+	r, err := ParseRule("host:*.Example.com port:8443 path:admin regex:\\.php$")
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if r.Host != "*.example.com" || r.Port != "8443" || r.Path != "/admin" || r.Regex == nil {
+		t.Errorf("Unexpected rule: %+v", r)
+	}
+	for _, bad := range []string{"", "host", "color:red", "regex:(", "host:[", "path:"} {
+		if _, err := ParseRule(bad); err == nil {
+			t.Errorf("Expected error parsing %q", bad)
+		}
+	}
+}
+
+func TestRule_Match(t *testing.T) {
+	cases := []struct {
+		rule  string
+		url   string
+		match bool
+	}{
+		{"path:/logout", "http://example.com/logout", true},
+		{"path:/logout", "http://example.com/logout.php", true},
+		{"path:/logout", "http://example.com/app/logout", false},
+		{"host:*.example.com", "http://www.EXAMPLE.com/", true},
+		{"host:*.example.com", "http://example.com/", false},
+		{"port:443", "https://example.com/", true},
+		{"port:443", "http://example.com/", false},
+		{"port:8443", "https://example.com:8443/", true},
+		{"regex:(?i)delete", "http://example.com/x?action=Delete", true},
+		{"host:example.com path:/api", "http://example.com/api/v1", true},
+		{"host:example.com path:/api", "http://other.com/api/v1", false},
+		{"path:/", "http://example.com", true},
+	}
+	for _, c := range cases {
+		r, err := ParseRule(c.rule)
+		if err != nil {
+			t.Fatalf("Unexpected error parsing %q: %s", c.rule, err)
+		}
+		u, _ := url.Parse(c.url)
+		if r.Match(u) != c.match {
+			t.Errorf("Expected %q matching %s to be %v", c.rule, c.url, c.match)
+		}
+	}
+}
+
+func TestRules(t *testing.T) {
+	rules, err := NewRules([]string{"host:api.example.com"}, []string{"path:/logout", "path:/delete"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	api, _ := url.Parse("https://api.example.com/v1")
+	if !rules.Included(api) || rules.Excluded(api) != nil {
+		t.Errorf("Expected %s to be included", api)
+	}
+	del, _ := url.Parse("https://api.example.com/delete/1")
+	if r := rules.Excluded(del); r == nil || r.String() != "path:/delete" {
+		t.Errorf("Expected %s to be excluded by path:/delete, got %v", del, r)
+	}
+	if _, err := NewRules(nil, []string{"bogus"}); err == nil {
+		t.Errorf("Expected error for invalid rule.")
+	}
+	var none *Rules
+	if none.Included(api) || none.Excluded(api) != nil {
+		t.Errorf("Expected nil rules to match nothing.")
+	}
+}
@@ -0,0 +1,131 @@
+// Copyright 2017 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package settings
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// A CodeRange is an inclusive range of HTTP status codes.
+type CodeRange struct {
+	Min int
+	Max int
+}
+
+// CodeRanges is a set of HTTP status codes, such as 200-299,401,403.
+type CodeRanges []CodeRange
+
+// Codes that are not reported by default, as they indicate that nothing was
+// found or that the server was unable to answer.
+const DefaultNegativeCodes = "404,410,502-504"
+
+// Status codes that are worth a notification by default.
+const DefaultNotifyCodes = "200-299,401,403,500"
+
+// Parse a comma-separated list of codes and ranges of codes.
+func ParseCodeRanges(value string) (CodeRanges, error) {
+	ranges := CodeRanges{}
+	for _, piece := range strings.Split(value, ",") {
+		piece = strings.TrimSpace(piece)
+		if piece == "" {
+			continue
+		}
+		bounds := strings.SplitN(piece, "-", 2)
+		min, err := strconv.Atoi(strings.TrimSpace(bounds[0]))
+		if err != nil {
+			return nil, fmt.Errorf("Unable to parse status code %s.", piece)
+		}
+		max := min
+		if len(bounds) == 2 {
+			if max, err = strconv.Atoi(strings.TrimSpace(bounds[1])); err != nil {
+				return nil, fmt.Errorf("Unable to parse status code %s.", piece)
+			}
+		}
+		if min > max {
+			return nil, fmt.Errorf("Invalid status code range %s.", piece)
+		}
+		ranges = append(ranges, CodeRange{Min: min, Max: max})
+	}
+	return ranges, nil
+}
+
+// Like ParseCodeRanges, but panics on error.  For use with constants.
+func MustParseCodeRanges(value string) CodeRanges {
+	ranges, err := ParseCodeRanges(value)
+	if err != nil {
+		panic(err)
+	}
+	return ranges
+}
+
+// Check if code is in any of the ranges.
+func (r CodeRanges) Contains(code int) bool {
+	for _, cr := range r {
+		if code >= cr.Min && code <= cr.Max {
+			return true
+		}
+	}
+	return false
+}
+
+func (r CodeRanges) String() string {
+	pieces := make([]string, 0, len(r))
+	for _, cr := range r {
+		if cr.Min == cr.Max {
+			pieces = append(pieces, strconv.Itoa(cr.Min))
+		} else {
+			pieces = append(pieces, fmt.Sprintf("%d-%d", cr.Min, cr.Max))
+		}
+	}
+	return strings.Join(pieces, ",")
+}
+
+// Check if a status code is interesting given positive and negative codes.  An
+// empty positive set allows every code, and negative codes always win.  Code 0
+// (no response) is never interesting.
+func IsPositiveCode(code int, positive, negative CodeRanges) bool {
+	if code == 0 || negative.Contains(code) {
+		return false
+	}
+	return len(positive) == 0 || positive.Contains(code)
+}
+
+// Check if a status code should be reported given these settings.
+func (settings *ScanSettings) IsPositiveCode(code int) bool {
+	return IsPositiveCode(code, settings.PositiveCodes, settings.NegativeCodes)
+}
+
+// CodeRangesFlag is a flag.Value for a set of status codes and ranges.
+type CodeRangesFlag struct {
+	ranges *CodeRanges
+}
+
+func (f CodeRangesFlag) String() string {
+	if f.ranges == nil {
+		return ""
+	}
+	return f.ranges.String()
+}
+
+func (f CodeRangesFlag) Set(value string) error {
+	ranges, err := ParseCodeRanges(value)
+	if err != nil {
+		return err
+	}
+	*f.ranges = ranges
+	return nil
+}
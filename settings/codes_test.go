@@ -0,0 +1,70 @@
+// Copyright 2017 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package settings
+
+import (
+	"flag"
+	"testing"
+)
+
+func TestParseCodeRanges(t *testing.T) {
+	ranges, err := ParseCodeRanges("200-299, 401,403")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if ranges.String() != "200-299,401,403" {
+		t.Errorf("Unexpected ranges: %s", ranges.String())
+	}
+	for code, expected := range map[int]bool{200: true, 250: true, 299: true, 300: false, 401: true, 402: false, 403: true} {
+		if ranges.Contains(code) != expected {
+			t.Errorf("Contains(%d): expected %v", code, expected)
+		}
+	}
+	for _, bad := range []string{"abc", "200-", "300-200", "2xx"} {
+		if _, err := ParseCodeRanges(bad); err == nil {
+			t.Errorf("Expected error parsing %s", bad)
+		}
+	}
+}
+
+func TestIsPositiveCode(t *testing.T) {
+	settings := &ScanSettings{NegativeCodes: MustParseCodeRanges(DefaultNegativeCodes)}
+	for code, expected := range map[int]bool{0: false, 200: true, 403: true, 404: false, 503: false} {
+		if settings.IsPositiveCode(code) != expected {
+			t.Errorf("Default IsPositiveCode(%d): expected %v", code, expected)
+		}
+	}
+	settings.PositiveCodes = MustParseCodeRanges("200-299,401-404")
+	for code, expected := range map[int]bool{200: true, 301: false, 403: true, 404: false} {
+		if settings.IsPositiveCode(code) != expected {
+			t.Errorf("IsPositiveCode(%d) with positive codes: expected %v", code, expected)
+		}
+	}
+}
+
+func TestCodeRangesFlag(t *testing.T) {
+	settings := defaultScanSettings()
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	settings.initFlagSet(fs)
+	if settings.NegativeCodes.String() != DefaultNegativeCodes {
+		t.Errorf("Unexpected default negative codes: %s", settings.NegativeCodes)
+	}
+	if err := fs.Parse([]string{"-positive-codes", "200-299", "-negative-codes", "204"}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if settings.PositiveCodes.String() != "200-299" || settings.NegativeCodes.String() != "204" {
+		t.Errorf("Flags not applied: %s / %s", settings.PositiveCodes, settings.NegativeCodes)
+	}
+}
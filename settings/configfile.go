@@ -0,0 +1,287 @@
+// Copyright 2017 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package settings
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// A configEntry is a setting from a config file: a flag name and the values
+// to set it to, in order.
+type configEntry struct {
+	name   string
+	values []string
+	line   int
+}
+
+// Parse the original config format: one flag per line, as "name = value" or
+// "name value".  A name alone sets a boolean flag.
+func parseFlatConfig(r io.Reader) ([]configEntry, error) {
+	var entries []configEntry
+	scanner := bufio.NewScanner(r)
+	for lineno := 1; scanner.Scan(); lineno++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		name, value := line, "true"
+		if i := strings.IndexAny(line, "= \t"); i != -1 {
+			name = strings.TrimSpace(line[:i])
+			value = strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(line[i:]), "="))
+		}
+		entries = append(entries, configEntry{name: name, values: []string{value}, line: lineno})
+	}
+	return entries, scanner.Err()
+}
+
+// Parse the subset of YAML needed for settings: "name: value" pairs, with
+// lists either as [a, b] or as "- item" lines below the name.  Names may be
+// grouped under headings, which are ignored.  Anchors, block scalars and
+// lists of mappings are not supported.
+func parseYAMLConfig(r io.Reader) ([]configEntry, error) {
+	var entries []configEntry
+	// Name waiting for "- item" lines or nested names
+	var pending *configEntry
+	flush := func() {
+		if pending != nil && len(pending.values) > 0 {
+			entries = append(entries, *pending)
+		}
+		pending = nil
+	}
+	scanner := bufio.NewScanner(r)
+	for lineno := 1; scanner.Scan(); lineno++ {
+		line := strings.TrimSpace(stripComment(scanner.Text(), true))
+		if line == "" || line == "---" {
+			continue
+		}
+		if line == "-" || strings.HasPrefix(line, "- ") {
+			if pending == nil {
+				return nil, fmt.Errorf("line %d: list item without a name", lineno)
+			}
+			item := strings.TrimSpace(line[1:])
+			if _, _, ok := splitYAMLPair(item); ok {
+				return nil, fmt.Errorf("line %d: lists of mappings are not supported", lineno)
+			}
+			value, err := parseScalar(item, lineno)
+			if err != nil {
+				return nil, err
+			}
+			pending.values = append(pending.values, value)
+			continue
+		}
+		name, rest, ok := splitYAMLPair(line)
+		if !ok {
+			return nil, fmt.Errorf("line %d: expected name: value", lineno)
+		}
+		flush()
+		entry := configEntry{name: name, line: lineno}
+		switch {
+		case rest == "":
+			// A list follows, or this is a heading
+			pending = &entry
+			continue
+		case rest[0] == '|' || rest[0] == '>' || rest[0] == '&' || rest[0] == '*' || rest[0] == '{':
+			return nil, fmt.Errorf("line %d: unsupported YAML value %s", lineno, rest)
+		case rest[0] == '[':
+			values, err := parseList(rest, lineno)
+			if err != nil {
+				return nil, err
+			}
+			entry.values = values
+		default:
+			value, err := parseScalar(rest, lineno)
+			if err != nil {
+				return nil, err
+			}
+			entry.values = []string{value}
+		}
+		if len(entry.values) > 0 {
+			entries = append(entries, entry)
+		}
+	}
+	flush()
+	return entries, scanner.Err()
+}
+
+// Split "name: value" into its parts, if line is one.
+func splitYAMLPair(line string) (string, string, bool) {
+	if line[0] == '"' || line[0] == '\'' {
+		return "", "", false
+	}
+	i := strings.Index(line, ":")
+	if i <= 0 || (i+1 < len(line) && line[i+1] != ' ' && line[i+1] != '\t') {
+		return "", "", false
+	}
+	return strings.TrimSpace(line[:i]), strings.TrimSpace(line[i+1:]), true
+}
+
+// Parse the subset of TOML needed for settings: name = value pairs, where
+// values are strings, booleans, numbers or arrays of them.  Names may be
+// grouped into [tables], which are ignored.
+func parseTOMLConfig(r io.Reader) ([]configEntry, error) {
+	var entries []configEntry
+	scanner := bufio.NewScanner(r)
+	for lineno := 1; scanner.Scan(); lineno++ {
+		line := strings.TrimSpace(stripComment(scanner.Text(), false))
+		if line == "" {
+			continue
+		}
+		if line[0] == '[' {
+			if !strings.HasSuffix(line, "]") {
+				return nil, fmt.Errorf("line %d: unterminated table header", lineno)
+			}
+			continue
+		}
+		i := strings.Index(line, "=")
+		if i <= 0 {
+			return nil, fmt.Errorf("line %d: expected name = value", lineno)
+		}
+		entry := configEntry{name: strings.Trim(strings.TrimSpace(line[:i]), `"`), line: lineno}
+		rest := strings.TrimSpace(line[i+1:])
+		if strings.HasPrefix(rest, `"""`) || strings.HasPrefix(rest, "'''") {
+			return nil, fmt.Errorf("line %d: multi-line strings are not supported", lineno)
+		}
+		if strings.HasPrefix(rest, "[") {
+			// Arrays may continue over several lines
+			start := lineno
+			for !listClosed(rest) && scanner.Scan() {
+				lineno++
+				rest += " " + strings.TrimSpace(stripComment(scanner.Text(), false))
+			}
+			values, err := parseList(rest, start)
+			if err != nil {
+				return nil, err
+			}
+			entry.values = values
+		} else {
+			value, err := parseScalar(rest, lineno)
+			if err != nil {
+				return nil, err
+			}
+			entry.values = []string{value}
+		}
+		if len(entry.values) > 0 {
+			entries = append(entries, entry)
+		}
+	}
+	return entries, scanner.Err()
+}
+
+// Remove a # comment from line, ignoring # within quotes.  If spaced, the #
+// must start the line or follow whitespace, as in YAML.
+func stripComment(line string, spaced bool) string {
+	var quote byte
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case quote != 0:
+			if c == '\\' && quote == '"' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '#' && (!spaced || i == 0 || line[i-1] == ' ' || line[i-1] == '\t'):
+			return line[:i]
+		}
+	}
+	return line
+}
+
+// Whether the [ list ] in s has been closed.
+func listClosed(s string) bool {
+	_, err := splitList(s)
+	return err == nil
+}
+
+// Parse a [a, "b", 'c'] list of scalars.
+func parseList(s string, lineno int) ([]string, error) {
+	items, err := splitList(s)
+	if err != nil {
+		return nil, fmt.Errorf("line %d: %s", lineno, err.Error())
+	}
+	values := make([]string, 0, len(items))
+	for _, item := range items {
+		value, err := parseScalar(item, lineno)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+	}
+	return values, nil
+}
+
+// Split a [ list ] into its unparsed items.
+func splitList(s string) ([]string, error) {
+	s = strings.TrimSpace(s)
+	var items []string
+	var quote byte
+	start := 1
+	for i := 1; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case quote != 0:
+			if c == '\\' && quote == '"' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '[':
+			return nil, fmt.Errorf("nested lists are not supported")
+		case c == ',' || c == ']':
+			if item := strings.TrimSpace(s[start:i]); item != "" {
+				items = append(items, item)
+			}
+			start = i + 1
+			if c == ']' {
+				if strings.TrimSpace(s[i+1:]) != "" {
+					return nil, fmt.Errorf("unexpected text after list")
+				}
+				return items, nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("unterminated list")
+}
+
+// Parse a quoted or plain scalar value.
+func parseScalar(s string, lineno int) (string, error) {
+	s = strings.TrimSpace(s)
+	switch {
+	case s == "":
+		return "", nil
+	case s[0] == '"':
+		value, err := strconv.Unquote(s)
+		if err != nil {
+			return "", fmt.Errorf("line %d: invalid string %s", lineno, s)
+		}
+		return value, nil
+	case s[0] == '\'':
+		if len(s) < 2 || s[len(s)-1] != '\'' {
+			return "", fmt.Errorf("line %d: invalid string %s", lineno, s)
+		}
+		return strings.Replace(s[1:len(s)-1], "''", "'", -1), nil
+	case s == "~" || s == "null":
+		return "", nil
+	}
+	return s, nil
+}
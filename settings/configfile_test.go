@@ -0,0 +1,133 @@
+// Copyright 2017 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package settings
+
+import (
+	"flag"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func loadTestConfig(t *testing.T, path string) (*ScanSettings, *flag.FlagSet) {
+	ss := defaultScanSettings()
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	ss.initFlagSet(fs)
+	if err := ss.loadConfigFile(fs, path); err != nil {
+		t.Fatalf("Unexpected error loading %s: %v", path, err)
+	}
+	return ss, fs
+}
+
+func TestLoadConfigFile_Structured(t *testing.T) {
+	for _, path := range []string{"testdata/scan.yaml", "testdata/scan.toml"} {
+		ss, _ := loadTestConfig(t, path)
+		if expected := []string{"https://example.com/", "https://example.com/app/"}; !reflect.DeepEqual(ss.BaseURLs, expected) {
+			t.Errorf("%s: expected URLs %v, got %v", path, expected, ss.BaseURLs)
+		}
+		if ss.WordlistPath != "builtin:common" {
+			t.Errorf("%s: unexpected wordlist %s", path, ss.WordlistPath)
+		}
+		if len(ss.Headers) != 2 || ss.Headers[0] != "X-Test: 1" || !strings.HasPrefix(ss.Headers[1], "X-Quote: it") {
+			t.Errorf("%s: unexpected headers %q", path, ss.Headers)
+		}
+		if ss.UserAgent != "webborer (test) #1" {
+			t.Errorf("%s: unexpected User-Agent %q", path, ss.UserAgent)
+		}
+		if !reflect.DeepEqual(ss.ExcludePaths, []string{"/admin", "/private"}) {
+			t.Errorf("%s: unexpected exclude paths %v", path, ss.ExcludePaths)
+		}
+		if ss.SleepTime != 2*time.Second || ss.Workers != 4 {
+			t.Errorf("%s: unexpected rate settings %s, %d", path, ss.SleepTime, ss.Workers)
+		}
+		if ss.OutputPath != "report.html" || ss.LeakDetect {
+			t.Errorf("%s: unexpected output settings %s, %v", path, ss.OutputPath, ss.LeakDetect)
+		}
+		if !ss.IsPositiveCode(200) || ss.IsPositiveCode(404) {
+			t.Errorf("%s: unexpected negative codes", path)
+		}
+	}
+}
+
+func TestLoadConfigFile_FlagsOverride(t *testing.T) {
+	ss, fs := loadTestConfig(t, "testdata/scan.yaml")
+	args := []string{"-header", "X-Other: 2", "-workers=8", "https://other.example/"}
+	ss.resetConfigLists(fs, args)
+	if err := fs.Parse(args); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	ss.addArgURLs(fs.Args(), args)
+	if !reflect.DeepEqual(ss.Headers, []string{"X-Other: 2"}) {
+		t.Errorf("Expected command line headers to replace config, got %q", ss.Headers)
+	}
+	if ss.Workers != 8 {
+		t.Errorf("Expected 8 workers, got %d", ss.Workers)
+	}
+	if !reflect.DeepEqual(ss.BaseURLs, []string{"https://other.example/"}) {
+		t.Errorf("Expected command line URL to replace config, got %v", ss.BaseURLs)
+	}
+	if !reflect.DeepEqual(ss.ExcludePaths, []string{"/admin", "/private"}) {
+		t.Errorf("Expected config exclude paths to be kept, got %v", ss.ExcludePaths)
+	}
+}
+
+func TestParseYAMLConfig_Errors(t *testing.T) {
+	for _, bad := range []string{
+		"- orphan\n",
+		"url:\n  - name: x\n",
+		"note: |\n  text\n",
+		"url: [a, b\n",
+		"just text\n",
+		"url: \"unterminated\n",
+	} {
+		if _, err := parseYAMLConfig(strings.NewReader(bad)); err == nil {
+			t.Errorf("Expected error parsing %q", bad)
+		}
+	}
+}
+
+func TestParseTOMLConfig_Errors(t *testing.T) {
+	for _, bad := range []string{
+		"[table\n",
+		"url\n",
+		"url = [\"a\",\n",
+		"note = \"\"\"\ntext\n\"\"\"\n",
+		"url = [[\"a\"]]\n",
+	} {
+		if _, err := parseTOMLConfig(strings.NewReader(bad)); err == nil {
+			t.Errorf("Expected error parsing %q", bad)
+		}
+	}
+}
+
+func TestStripComment(t *testing.T) {
+	cases := []struct {
+		line     string
+		spaced   bool
+		expected string
+	}{
+		{"a: b # c", true, "a: b "},
+		{"a: b#c", true, "a: b#c"},
+		{`a: "b # c" # d`, true, `a: "b # c" `},
+		{"a = 'x#y'#z", false, "a = 'x#y'"},
+		{`a = "q\"#" # z`, false, `a = "q\"#" `},
+	}
+	for _, c := range cases {
+		if got := stripComment(c.line, c.spaced); got != c.expected {
+			t.Errorf("stripComment(%q): expected %q, got %q", c.line, c.expected, got)
+		}
+	}
+}
@@ -0,0 +1,133 @@
+// Copyright 2017 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package settings
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/textproto"
+	"sort"
+	"strings"
+)
+
+// Headers from a request file that aren't kept: they are set for each
+// request, and a different Accept-Encoding could ask for encodings that can't
+// be decoded.
+var requestFileSkipHeaders = map[string]bool{
+	"Host":            true,
+	"Content-Length":  true,
+	"Content-Type":    true,
+	"Connection":      true,
+	"Accept-Encoding": true,
+}
+
+// Load the raw HTTP request in RequestFile, such as one saved from Burp, as
+// the template for the scan: its URL (using RequestProto) is added to
+// BaseURLs, and its method, headers and body are used for each request unless
+// set by flags.  FUZZ may appear anywhere in it, as with -url, -header and
+// -data.
+func (settings *ScanSettings) LoadRequestFile() error {
+	if settings.RequestFile == "" {
+		return nil
+	}
+	raw, err := ioutil.ReadFile(settings.RequestFile)
+	if err != nil {
+		return fmt.Errorf("Unable to read request file: %s", err.Error())
+	}
+	target, method, header, body, err := parseRawRequest(raw, settings.RequestProto)
+	if err != nil {
+		return fmt.Errorf("Invalid request file %s: %s", settings.RequestFile, err.Error())
+	}
+	settings.BaseURLs = append(settings.BaseURLs, target)
+	if settings.RequestMethod == "" {
+		settings.RequestMethod = method
+	}
+	if settings.RequestData == "" && body != "" {
+		// The body's type comes with it
+		settings.RequestData = body
+		if settings.ContentType == "" {
+			settings.ContentType = header.Get("Content-Type")
+		}
+	}
+	given := make(map[string]bool)
+	for _, h := range settings.Headers {
+		given[textproto.CanonicalMIMEHeaderKey(strings.TrimSpace(strings.SplitN(h, ":", 2)[0]))] = true
+	}
+	names := make([]string, 0, len(header))
+	for name := range header {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if requestFileSkipHeaders[name] || given[name] {
+			continue
+		}
+		for _, v := range header[name] {
+			settings.Headers = append(settings.Headers, name+": "+v)
+		}
+	}
+	return nil
+}
+
+// Find the end of the head of a raw request: the index of the line ending
+// that makes the blank line after the headers, or -1 if there is no body.
+func headEnd(raw []byte) int {
+	for i := 0; i < len(raw); i++ {
+		if raw[i] != '\n' {
+			continue
+		}
+		rest := raw[i+1:]
+		if bytes.HasPrefix(rest, []byte("\n")) || bytes.HasPrefix(rest, []byte("\r\n")) {
+			return i + 1
+		}
+	}
+	return -1
+}
+
+// Parse a raw HTTP request, returning its URL, method, headers and body.  The
+// body is everything after the headers, less trailing newlines, whatever
+// Content-Length says, as the length changes when words are substituted.
+func parseRawRequest(raw []byte, proto string) (string, string, http.Header, string, error) {
+	head, body := raw, []byte(nil)
+	// Only the head's line endings are normalized, as the body may be binary
+	// or multipart data that needs its CRLFs
+	if i := headEnd(raw); i != -1 {
+		head, body = raw[:i], raw[i:]
+		if bytes.HasPrefix(body, []byte("\r\n")) {
+			body = body[2:]
+		} else {
+			body = body[1:]
+		}
+	}
+	head = bytes.Replace(head, []byte("\r\n"), []byte("\n"), -1)
+	req, err := http.ReadRequest(bufio.NewReader(bytes.NewReader(append(head, '\n'))))
+	if err != nil {
+		return "", "", nil, "", err
+	}
+	target := req.RequestURI
+	if !strings.HasPrefix(target, "http://") && !strings.HasPrefix(target, "https://") {
+		if req.Host == "" {
+			return "", "", nil, "", fmt.Errorf("No Host header")
+		}
+		if proto == "" {
+			proto = "https"
+		}
+		target = proto + "://" + req.Host + target
+	}
+	return target, req.Method, req.Header, strings.TrimRight(string(body), "\r\n"), nil
+}
@@ -0,0 +1,98 @@
+// Copyright 2017 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package settings
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestLoadRequestFile(t *testing.T) {
+	ss := &ScanSettings{
+		RequestFile:  "testdata/request.txt",
+		RequestProto: "https",
+		Headers:      []string{"cookie: session=override"},
+	}
+	if err := ss.LoadRequestFile(); err != nil {
+		t.Fatalf("Unexpected error loading request file: %v", err)
+	}
+	if !reflect.DeepEqual(ss.BaseURLs, []string{"https://app.example.com/api/FUZZ?debug=1"}) {
+		t.Errorf("Unexpected URLs: %v", ss.BaseURLs)
+	}
+	if ss.RequestMethod != "POST" || ss.ContentType != "application/json" {
+		t.Errorf("Unexpected method %q or content type %q", ss.RequestMethod, ss.ContentType)
+	}
+	if ss.RequestData != `{"name": "FUZZ"}` {
+		t.Errorf("Unexpected body %q", ss.RequestData)
+	}
+	// The cookie from the command line wins
+	expected := []string{"cookie: session=override", "User-Agent: Mozilla/5.0"}
+	if !reflect.DeepEqual(ss.Headers, expected) {
+		t.Errorf("Expected headers %v, got %v", expected, ss.Headers)
+	}
+	if !ss.Fuzzing() {
+		t.Errorf("Expected FUZZ in the request to make it a fuzzing scan.")
+	}
+}
+
+func TestLoadRequestFile_FlagsWin(t *testing.T) {
+	ss := &ScanSettings{
+		RequestFile:   "testdata/request.txt",
+		RequestProto:  "http",
+		RequestMethod: "PUT",
+		RequestData:   "raw",
+	}
+	if err := ss.LoadRequestFile(); err != nil {
+		t.Fatalf("Unexpected error loading request file: %v", err)
+	}
+	if ss.BaseURLs[0] != "http://app.example.com/api/FUZZ?debug=1" {
+		t.Errorf("Expected http URL, got %v", ss.BaseURLs)
+	}
+	if ss.RequestMethod != "PUT" || ss.RequestData != "raw" || ss.ContentType != "" {
+		t.Errorf("Expected flags to override the request file, got %q %q %q", ss.RequestMethod, ss.RequestData, ss.ContentType)
+	}
+}
+
+func TestParseRawRequest(t *testing.T) {
+	target, method, _, body, err := parseRawRequest([]byte("GET http://other.example/x HTTP/1.1\nHost: ignored\n"), "")
+	if err != nil || target != "http://other.example/x" || method != "GET" || body != "" {
+		t.Errorf("Unexpected parse of absolute request: %s %s %q %v", method, target, body, err)
+	}
+	if _, _, _, _, err := parseRawRequest([]byte("GET / HTTP/1.1\n\n"), "https"); err == nil {
+		t.Errorf("Expected error for request without Host.")
+	}
+	if _, _, _, _, err := parseRawRequest([]byte("not a request"), "https"); err == nil {
+		t.Errorf("Expected error for garbage.")
+	}
+	ss := &ScanSettings{RequestFile: "testdata/does-not-exist"}
+	if err := ss.LoadRequestFile(); err == nil {
+		t.Errorf("Expected error for missing request file.")
+	}
+}
+
+func TestParseRawRequest_BinaryBody(t *testing.T) {
+	multipart := "--b\r\nContent-Disposition: form-data; name=\"f\"\r\n\r\nFUZZ\r\n--b--"
+	raw := "POST /upload HTTP/1.1\r\nHost: example.com\r\nContent-Type: multipart/form-data; boundary=b\r\n\r\n" + multipart
+	target, method, header, body, err := parseRawRequest([]byte(raw), "https")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if target != "https://example.com/upload" || method != "POST" || header.Get("Content-Type") != "multipart/form-data; boundary=b" {
+		t.Errorf("Unexpected parse: %s %s %v", method, target, header)
+	}
+	if body != multipart {
+		t.Errorf("Expected body to keep its CRLFs, got %q", body)
+	}
+}
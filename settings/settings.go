@@ -16,12 +16,16 @@
 package settings
 
 import (
+	"bufio"
 	"errors"
 	"flag"
 	"fmt"
 	"github.com/Matir/webborer/logging"
+	"github.com/Matir/webborer/util"
+	"io/ioutil"
 	"net/url"
 	"os"
+	"path/filepath"
 	"runtime"
 	"strconv"
 	"strings"
@@ -34,26 +38,78 @@ import (
 type ScanSettings struct {
 	// Starting point and scope of scan
 	BaseURLs []string
+	// File containing additional BaseURLs, one per line
+	TargetFile string
+	// Maximum number of tasks in progress for any single host
+	HostConcurrency int
+	// Maximum connections open to each host, 0 for no limit
+	MaxConnsPerHost int
+	// Open a new connection for every request
+	NoKeepAlive bool
 	// Number of threads to run
 	Threads int
 	// Number of workers to run
 	Workers int
 	// Exclusions
 	ExcludePaths []string
+	// Scope rules to include beyond the base URLs
+	ScopeInclude []string
+	// Scope rules that are never requested
+	ScopeExclude []string
 	// Proxies
 	Proxies []string
+	// Rules routing matching hosts through particular proxies
+	ProxyRules []string
+	// Addresses to connect to for particular hosts, as host:ip
+	Resolve []string
+	// Extra request headers, as "Name: value"
+	Headers []string
+	// Body to send with each request
+	RequestData string
+	// Content type of RequestData, form-encoded if empty
+	ContentType string
+	// HTTP method, GET (or POST with RequestData) if empty
+	RequestMethod string
+	// Raw HTTP request to use as the template for requests
+	RequestFile string
+	// Scheme for the URL of RequestFile, which doesn't say
+	RequestProto string
+	// Where to log each request and response
+	RequestLogPath string
 	// Parse HTML for links?
 	ParseHTML bool
+	// Parse JavaScript for paths and API routes
+	ParseJS bool
 	// Time to sleep between requests, per thread
 	SleepTime time.Duration
+	// Most that SleepTime is randomly shortened or lengthened by
+	Jitter time.Duration
+	// Request words in a random order
+	Shuffle bool
+	// Read the wordlist from disk as it is used instead of loading it
+	StreamWordlist bool
 	// Log file path
 	LogfilePath string
 	// Level of logging
 	LogLevel string
 	// Wordlist for scanning
 	WordlistPath string
+	// Case variants to add for each word
+	WordCases []string
+	// Prefixes and suffixes to add to each word
+	WordPrefixes []string
+	WordSuffixes []string
+	// Whether to add percent-encoded variants of each word
+	WordEncode bool
+	// Whether to drop duplicate words
+	WordDedup bool
 	// Extensions for mangling
 	Extensions []string
+	// Probe targets first and pick extensions and wordlists for their stack
+	Fingerprint bool
+	// Check that targets resolve and respond, and record their TLS
+	// certificates, before scanning
+	Preflight bool
 	// Whether or not to mangle
 	Mangle bool
 	// How long should internal queues be sized
@@ -64,26 +120,134 @@ type ScanSettings struct {
 	OutputFormat string
 	// Output path
 	OutputPath string
+	// Directory or storage URL for a report per host, if any
+	PerHostDir string
 	// User-Agent for requests
 	UserAgent string
+	// File of User-Agents to pick from for each request
+	UserAgentFile string
+	// Pick a browser User-Agent for each request
+	RandomAgent bool
+	// Reuse earlier responses to the same request instead of sending it again
+	Cache bool
+	// Directory to keep cached responses in between scans, if any.  Setting
+	// it turns on Cache.
+	CacheDir string
+	// How long cached responses are used for
+	CacheTTL time.Duration
+	// Disable the cache, overriding Cache and CacheDir
+	noCache bool
 	// Whether to include redirects in reporting
 	IncludeRedirects bool
+	// Report aliases of a finding (/Admin, /admin/) with it instead of
+	// separately
+	CollapseAliases bool
+	// Flag responses much slower than others in their directory
+	LatencyOutliers bool
+	// Suppress repeats of the most common response in each directory
+	Denoise bool
+	// Print text results as a directory tree per host
+	OutputTree bool
+	// Webhook to POST high-interest results to as they are found
+	NotifyWebhook string
+	// Payload for NotifyWebhook: "json" or "slack"
+	NotifyFormat string
+	// Status codes worth a notification
+	NotifyCodes CodeRanges
 	// How to handle Robots.txt
 	RobotsMode int
 	// Whether to allow upgrade from http to https
 	AllowHTTPSUpgrade bool
 	// Spider which http response codes
 	SpiderCodes []int
+	// Report only these response codes (all if empty)
+	PositiveCodes CodeRanges
+	// Never report or spider these response codes
+	NegativeCodes CodeRanges
 	// HTTP Auth Username
 	HTTPUsername string
 	// HTTP Auth Password
 	HTTPPassword string
+	// Report the entries of directory listings and recurse into them
+	DirListings bool
+	// Files of extra signatures of high-value paths, for severity scoring
+	SignatureFiles []string
+	// Sort reports written to files by severity
+	SortSeverity bool
+	// Go plugins to load, with hooks for requests, responses and results
+	Plugins []string
+	// List the contents of discovered archives
+	ArchivePeek bool
+	// Most of each response body to read, in bytes, or 0 for no limit
+	MaxBodySize int64
+	// Largest archive to list, in bytes
+	ArchivePeekSize int64
+	// Look for internal hostnames and addresses in responses
+	LeakDetect bool
+	// Report missing security headers, version banners and open CORS
+	HeaderChecks bool
+	// Number of redirects to follow, 0 to report them without following
+	FollowRedirects int
+	// Report redirects that leave the scope as findings instead of dropping
+	// them
+	ReportOffScopeRedirects bool
+	// Second User-Agent to request paths with, reporting differences
+	CompareAgent string
+	// Path patterns to compare; findings are compared if empty
+	ComparePaths []string
+	// Recognize CDN challenge and CAPTCHA pages
+	ChallengeDetect bool
+	// How long to stop scanning a host that returns a challenge page, 0 to
+	// keep going
+	ChallengePause time.Duration
+	// What to do when a WAF or rate limiter starts blocking the scan: one of
+	// the Block* actions, or empty to do nothing
+	BlockAction string
+	// How long to pause a blocking host with BlockPause
+	BlockPauseTime time.Duration
+	// First delay between requests to a blocking host with BlockSlow
+	BlockDelay time.Duration
+	// File of user:pass lines to try where Basic authentication is asked
+	// for, if any
+	AuthWordlist string
+	// Delay between credentials tried against an endpoint
+	AuthDelay time.Duration
 	// Progress bar
 	ProgressBar bool
+	// Disable the progress bar, overriding ProgressBar
+	noProgressBar bool
 	// Whether or not to do CPU Profiling
 	DebugCPUProf bool
-	// Config file used when loading (for debugging only)
+	// Mode of operation: ScanMode, ServeMode, or AgentMode
+	Mode string
+	// Address for the coordinator to listen on
+	ListenAddr string
+	// URL of the coordinator for agents
+	CoordinatorURL string
+	// Shared secret between coordinator and agents
+	APIToken string
+	// How long an agent may hold a task before it is handed out again
+	LeaseTime time.Duration
+	// Where to write a checkpoint if the scan is interrupted
+	CheckpointPath string
+	// Checkpoint to resume from
+	ResumePath string
+	// Where to write the scope manifest
+	ManifestPath string
+	// JSON results of an earlier scan to report changes from
+	DiffPath string
+	// Where to write the end-of-scan summary
+	SummaryPath string
+	// Status codes of findings that make the scan fail
+	FailOn CodeRanges
+	// Read control commands from stdin
+	ControlStdin bool
+	// Config file used when loading
 	configPath string
+	// Flags set by the config file
+	configSet map[string]bool
+	// Command line arguments, kept for reloading
+	args []string
 	// Have flags been set up?
 	flagsSet bool
 }
@@ -102,6 +266,28 @@ var robotsModeStrings = [...]string{
 	"seed",
 }
 
+// Modes of operation, selected by the first command-line argument.
+const (
+	// A normal, standalone scan
+	ScanMode = "scan"
+	// Coordinate a scan, serving work to agents
+	ServeMode = "serve"
+	// Perform work for a coordinator
+	AgentMode = "agent"
+)
+
+// Actions when a WAF or rate limiter is detected
+const (
+	// Just report it
+	BlockWarn = "warn"
+	// Stop requesting from the host for BlockPauseTime
+	BlockPause = "pause"
+	// Slow down requests to the host, more each time it happens
+	BlockSlow = "slow"
+	// Don't look for blocking at all
+	BlockOff = "off"
+)
+
 var DefaultUserAgent = "WebBorer 0.01"
 var outputFormats []string
 
@@ -124,6 +310,24 @@ func (f StringSliceFlag) Set(value string) error {
 	return nil
 }
 
+// RepeatedStringFlag is a flag.Value that collects a string each time the flag
+// is given, for values that may themselves contain commas.
+type RepeatedStringFlag struct {
+	slice *[]string
+}
+
+func (f RepeatedStringFlag) String() string {
+	if f.slice == nil {
+		return ""
+	}
+	return strings.Join(*f.slice, ", ")
+}
+
+func (f RepeatedStringFlag) Set(value string) error {
+	*f.slice = append(*f.slice, value)
+	return nil
+}
+
 // IntSliceFlag is a flag.Value that takes a comma-separated string and turns
 // it into a slice of ints.
 type IntSliceFlag struct {
@@ -177,6 +381,11 @@ func (f DurationFlag) Set(value string) error {
 	return nil
 }
 
+// Name of a robots mode, as used on the command line.
+func RobotsModeName(mode int) string {
+	return robotsFlag{&mode}.String()
+}
+
 // RobotsFlag is a RobotsMode as a flag
 type robotsFlag struct {
 	mode *int
@@ -201,27 +410,62 @@ func (f robotsFlag) Set(value string) error {
 
 // Constructs a ScanSettings struct with all of the defaults to be used.
 func NewScanSettings() *ScanSettings {
-	settings := &ScanSettings{
-		Threads:     runtime.NumCPU(),
-		Extensions:  []string{"html", "php", "asp", "aspx"},
-		Mangle:      true,
-		QueueSize:   1024,
-		Timeout:     30 * time.Second,
-		LogLevel:    "WARNING",
-		SpiderCodes: []int{200},
-		ProgressBar: true,
-	}
+	settings := defaultScanSettings()
 	settings.InitFlags()
 	return settings
 }
 
+// Defaults for settings that aren't set by the flag definitions.
+func defaultScanSettings() *ScanSettings {
+	return &ScanSettings{
+		Threads:         runtime.NumCPU(),
+		Extensions:      []string{"html", "php", "asp", "aspx"},
+		Mangle:          true,
+		QueueSize:       1024,
+		Timeout:         30 * time.Second,
+		LogLevel:        "WARNING",
+		SpiderCodes:     []int{200},
+		NegativeCodes:   MustParseCodeRanges(DefaultNegativeCodes),
+		ProgressBar:     true,
+		ArchivePeekSize: 10 * 1024 * 1024,
+		MaxBodySize:     10 * 1024 * 1024,
+		LeakDetect:      true,
+		HeaderChecks:    true,
+		CollapseAliases: true,
+		LatencyOutliers: true,
+		Preflight:       true,
+		ChallengeDetect: true,
+		Mode:            ScanMode,
+		LeaseTime:       2 * time.Minute,
+		BlockAction:     BlockSlow,
+		NotifyCodes:     MustParseCodeRanges(DefaultNotifyCodes),
+		BlockPauseTime:  time.Minute,
+		BlockDelay:      time.Second,
+		AuthDelay:       time.Second,
+		Cache:           true,
+		CacheTTL:        time.Hour,
+	}
+}
+
 // Create settings that includes configuration files and command line flags.
 // Generally, this should be called very early and is the best way to get the
 // settings.
 func GetScanSettings() (*ScanSettings, error) {
 	settings := NewScanSettings()
-	settings.LoadFromDefaultConfigFiles()
+	if path := configPathFromArgs(os.Args[1:]); path != "" {
+		if err := settings.loadConfigFile(flag.CommandLine, path); err != nil {
+			return nil, err
+		}
+	} else {
+		settings.LoadFromDefaultConfigFiles()
+	}
 	settings.ParseFlags()
+	if err := settings.LoadTargetFile(); err != nil {
+		return nil, err
+	}
+	if err := settings.LoadRequestFile(); err != nil {
+		return nil, err
+	}
 	if err := settings.Validate(); err != nil {
 		return nil, err
 	}
@@ -233,48 +477,153 @@ func (settings *ScanSettings) InitFlags() {
 	if settings.flagsSet {
 		return
 	}
+	settings.initFlagSet(flag.CommandLine)
+	settings.flagsSet = true
+}
+
+// Define the flags in fs, bound to the fields of settings.
+func (settings *ScanSettings) initFlagSet(fs *flag.FlagSet) {
+	fs.StringVar(&settings.configPath, "config", "", "Config `file` to load before the command line: flag = value lines, or YAML (.yaml) or TOML (.toml).")
 
 	baseUrlValue := StringSliceFlag{&settings.BaseURLs}
-	flag.Var(baseUrlValue, "url", "Starting `URL` & scopes.")
-	flag.IntVar(&settings.Threads, "threads", runtime.NumCPU(), "Number of worker `threads`.")
-	flag.IntVar(&settings.Workers, "workers", runtime.NumCPU()*2, "Number of `workers`.")
+	fs.Var(baseUrlValue, "url", "Starting `URL` & scopes.  unix:///path/to.sock:/path scans over a Unix socket.")
+	fs.StringVar(&settings.TargetFile, "target-file", "", "`File` containing starting URLs, one per line.")
+	fs.IntVar(&settings.MaxConnsPerHost, "max-conns-per-host", 0, "Maximum `connections` open to each host, shared by all workers (0 for unlimited).")
+	fs.BoolVar(&settings.NoKeepAlive, "no-keepalive", false, "Open a new connection for every request instead of reusing them.")
+	fs.IntVar(&settings.HostConcurrency, "host-concurrency", 0, "Maximum concurrent `tasks` per host (0 for unlimited).")
+	fs.IntVar(&settings.Threads, "threads", runtime.NumCPU(), "Number of worker `threads`.")
+	fs.IntVar(&settings.Workers, "workers", runtime.NumCPU()*2, "Number of `workers`.")
 	excludePathValue := StringSliceFlag{&settings.ExcludePaths}
-	flag.Var(excludePathValue, "exclude", "List of `paths` to exclude from search.")
-	flag.BoolVar(&settings.ParseHTML, "html", true, "Parse HTML documents for links to follow.")
-	flag.BoolVar(&settings.AllowHTTPSUpgrade, "allow-upgrade", false, "Allow HTTP->HTTPS upgrades.")
+	fs.Var(excludePathValue, "exclude", "List of `paths` to exclude from search.")
+	scopeIncludeValue := RepeatedStringFlag{&settings.ScopeInclude}
+	fs.Var(scopeIncludeValue, "scope-include", "Scope `rule` to include beyond the base URLs, such as \"host:*.example.com port:443\" (may be repeated).  Conditions are host, port, path and regex.")
+	scopeExcludeValue := RepeatedStringFlag{&settings.ScopeExclude}
+	fs.Var(scopeExcludeValue, "scope-exclude", "Scope `rule` never to request, such as \"path:/logout\" (may be repeated).  Applies to recursion, spidered links and redirects.")
+	fs.BoolVar(&settings.ParseHTML, "html", true, "Parse HTML documents for links to follow.")
+	fs.BoolVar(&settings.ParseJS, "js", true, "Parse JavaScript files for paths and API routes to request.")
+	fs.BoolVar(&settings.AllowHTTPSUpgrade, "allow-upgrade", false, "Allow HTTP->HTTPS upgrades.")
 	sleepTimeValue := DurationFlag{&settings.SleepTime}
-	flag.Var(sleepTimeValue, "sleep", "Time (as `duration`) to sleep between requests.")
-	flag.StringVar(&settings.LogfilePath, "logfile", "", "Logfile `filename` (defaults to stderr)")
-	flag.StringVar(&settings.WordlistPath, "wordlist", "", "Wordlist `filename` to use (default built-in)")
+	fs.Var(sleepTimeValue, "sleep", "Time (as `duration`) to sleep between requests.")
+	fs.Var(sleepTimeValue, "delay", "Time (as `duration`) to wait between requests (same as -sleep).")
+	jitterValue := DurationFlag{&settings.Jitter}
+	fs.Var(jitterValue, "jitter", "Randomly lengthen or shorten each -delay by up to this `duration`.")
+	fs.BoolVar(&settings.StreamWordlist, "stream-wordlist", false, "Read the wordlist from disk as it is used instead of loading it into memory (automatic for large files, - and URLs).")
+	fs.BoolVar(&settings.Shuffle, "shuffle", false, "Request words in a random order instead of wordlist order.")
+	fs.StringVar(&settings.LogfilePath, "logfile", "", "Logfile `filename` (defaults to stderr)")
+	fs.StringVar(&settings.WordlistPath, "wordlist", "", "Wordlist `filename` to use, - for standard input, an http(s) URL, or a built-in list: builtin:common, builtin:raft-small, builtin:api-endpoints, builtin:php, ... (default built-in)")
+	wordCasesValue := StringSliceFlag{&settings.WordCases}
+	fs.Var(wordCasesValue, "word-case", "Add case variants of each word: `cases` from lower, upper, title, or all.")
+	wordPrefixesValue := StringSliceFlag{&settings.WordPrefixes}
+	fs.Var(wordPrefixesValue, "word-prefix", "`Prefixes` to add to each word, e.g. admin_,old_")
+	wordSuffixesValue := StringSliceFlag{&settings.WordSuffixes}
+	fs.Var(wordSuffixesValue, "word-suffix", "`Suffixes` to add to each word, e.g. 2024,_bak")
+	fs.BoolVar(&settings.WordEncode, "word-encode", false, "Add percent-encoded and double-encoded variants of each word.")
+	fs.BoolVar(&settings.WordDedup, "word-dedup", false, "Remove duplicate words from the wordlist as it is loaded, before they are transformed.")
 	extensionValue := StringSliceFlag{&settings.Extensions}
-	flag.Var(extensionValue, "extensions", "List of `extensions` to mangle with.")
-	flag.BoolVar(&settings.Mangle, "mangle", true, "Mangle by adding extensions.")
+	fs.Var(extensionValue, "extensions", "List of `extensions` to mangle with.")
+	fs.BoolVar(&settings.Preflight, "preflight", true, "Check that targets resolve and respond before scanning, skipping those that don't, and log their TLS certificates.")
+	fs.BoolVar(&settings.Fingerprint, "fingerprint", false, "Probe targets before scanning and use the extensions and built-in wordlists for the technologies found.")
+	fs.BoolVar(&settings.Mangle, "mangle", true, "Mangle by adding extensions.")
 	proxyValue := StringSliceFlag{&settings.Proxies}
-	flag.Var(proxyValue, "proxy", "Proxy or `proxies` to use.")
+	fs.Var(proxyValue, "proxy", "Proxy or `proxies` to use.")
+	headerValue := RepeatedStringFlag{&settings.Headers}
+	fs.Var(headerValue, "header", "Extra request `header` as \"Name: value\" (may be repeated).  FUZZ in the value is replaced with each word.")
+	fs.StringVar(&settings.RequestData, "data", "", "Request body `data` to send with each request (makes them POSTs).  FUZZ is replaced with each word, escaped to suit -content-type.")
+	fs.StringVar(&settings.ContentType, "content-type", "", "Content `type` of -data, e.g. application/json (default form-encoded).")
+	fs.StringVar(&settings.RequestMethod, "method", "", "HTTP `method` for requests, e.g. PUT (default GET, or POST with -data).")
+	fs.StringVar(&settings.RequestFile, "request", "", "Raw HTTP request `file` (e.g. saved from Burp) to use as the URL, method, headers and body.  FUZZ may appear anywhere in it.")
+	fs.StringVar(&settings.RequestProto, "request-proto", "https", "`Scheme` (http or https) for the URL of the -request file.")
+	fs.StringVar(&settings.RequestLogPath, "request-log", "", "Log each request and response to `file` or storage URL, in Burp's proxy log format for replaying.")
+	proxyRuleValue := StringSliceFlag{&settings.ProxyRules}
+	fs.Var(proxyRuleValue, "proxy-rules", "Per-host proxy `rules` as pattern=proxy, e.g. *.internal.corp=socks5://pivot:1080,10.0.0.0/8=direct.")
+	fs.BoolVar(&settings.DirListings, "dir-listings", true, "Report every entry of open directory listings without requesting them, and recurse into listed subdirectories.")
+	signatureValue := RepeatedStringFlag{&settings.SignatureFiles}
+	fs.Var(signatureValue, "signatures", "Load extra signatures of high-value paths from `file`, one per line as: severity pattern [description] (may be repeated).")
+	fs.BoolVar(&settings.SortSeverity, "sort-severity", true, "Sort reports written with -outfile or -per-host-dir by severity, most severe first.")
+	pluginValue := RepeatedStringFlag{&settings.Plugins}
+	fs.Var(pluginValue, "plugin", "Load a Go plugin from `file` (built with -buildmode=plugin) to add custom checks (may be repeated).")
+	resolveValue := RepeatedStringFlag{&settings.Resolve}
+	fs.Var(resolveValue, "resolve", "Connect to `host:ip` instead of resolving host, keeping the hostname in the Host header and TLS SNI (may be repeated).")
 	timeoutValue := DurationFlag{&settings.Timeout}
-	flag.Var(timeoutValue, "timeout", "Network connection timeout (`duration`).")
+	fs.Var(timeoutValue, "timeout", "Network connection timeout (`duration`).")
 	if len(outputFormats) > 1 {
 		formatHelp := fmt.Sprintf("Output `format`.  Options: [%s]", strings.Join(outputFormats, ", "))
-		flag.StringVar(&settings.OutputFormat, "format", outputFormats[0], formatHelp)
+		fs.StringVar(&settings.OutputFormat, "format", outputFormats[0], formatHelp)
 	}
-	flag.StringVar(&settings.OutputPath, "outfile", "", "Output `file`, defaults to stdout.")
+	fs.StringVar(&settings.OutputPath, "outfile", "", "Output `file` or storage URL (s3://, gs://), defaults to stdout.")
+	fs.StringVar(&settings.PerHostDir, "per-host-dir", "", "Also write a report for each host to `dir`/<host>/ (a directory or storage URL).")
 	loglevelHelp := fmt.Sprintf("Log `level`.  Options: [%s]", strings.Join(logging.LogLevelStrings[:], ", "))
-	flag.StringVar(&settings.LogLevel, "loglevel", settings.LogLevel, loglevelHelp)
-	flag.StringVar(&settings.UserAgent, "user-agent", DefaultUserAgent, "`User-Agent` for requests")
-	flag.BoolVar(&settings.IncludeRedirects, "include-redirects", false, "Include redirects in reports.")
+	fs.StringVar(&settings.LogLevel, "loglevel", settings.LogLevel, loglevelHelp)
+	fs.StringVar(&settings.UserAgent, "user-agent", DefaultUserAgent, "`User-Agent` for requests")
+	fs.StringVar(&settings.UserAgentFile, "user-agent-file", "", "Pick each request's User-Agent from the lines of `file`.")
+	fs.BoolVar(&settings.RandomAgent, "random-agent", false, "Pick a realistic browser User-Agent for each request.")
+	fs.BoolVar(&settings.Cache, "cache", true, "Reuse responses already received for the same request instead of sending it again.")
+	fs.BoolVar(&settings.noCache, "no-cache", false, "Send every request, even if the same one was already answered (overrides -cache and -cache-dir).")
+	fs.StringVar(&settings.CacheDir, "cache-dir", "", "Cache responses in `dir` as well as in memory, so later scans can reuse them.  Implies -cache.")
+	cacheTTLValue := DurationFlag{&settings.CacheTTL}
+	fs.Var(cacheTTLValue, "cache-ttl", "How long cached responses are reused for (`duration`).")
+	fs.BoolVar(&settings.IncludeRedirects, "include-redirects", false, "Include redirects in reports.")
+	fs.BoolVar(&settings.LatencyOutliers, "latency-outliers", true, "Flag responses much slower than others in their directory (heavy endpoints, debug handlers, blind injection).")
+	fs.BoolVar(&settings.CollapseAliases, "collapse-aliases", true, "Report /admin, /admin/ and (on case-insensitive servers) /Admin once, listing the aliases.")
+	fs.BoolVar(&settings.Denoise, "denoise", true, "Once most responses in a directory are alike, report only the first and count the rest.")
+	fs.BoolVar(&settings.OutputTree, "output-tree", false, "Print text results as an indented directory tree for each host.")
+	fs.StringVar(&settings.NotifyWebhook, "notify-webhook", "", "POST each high-interest result to this `URL` as it is found.")
+	fs.StringVar(&settings.NotifyFormat, "notify-format", "json", "Webhook payload `format`: json (the result) or slack (a Slack message).")
+	notifyCodesValue := CodeRangesFlag{&settings.NotifyCodes}
+	fs.Var(notifyCodesValue, "notify-codes", "HTTP response `codes` worth a notification.")
 	spiderCodesValue := IntSliceFlag{&settings.SpiderCodes}
-	flag.Var(spiderCodesValue, "spider-codes", "HTTP Response Codes to Continue Spidering On.")
+	fs.Var(spiderCodesValue, "spider-codes", "HTTP Response Codes to Continue Spidering On.")
+	positiveCodesValue := CodeRangesFlag{&settings.PositiveCodes}
+	fs.Var(positiveCodesValue, "positive-codes", "Only report these HTTP response `codes` (e.g. 200-299,401,403).  Default is all codes not in -negative-codes.")
+	negativeCodesValue := CodeRangesFlag{&settings.NegativeCodes}
+	fs.Var(negativeCodesValue, "negative-codes", "Never report or spider on these HTTP response `codes`.")
 	robotsModeHelp := fmt.Sprintf("Robots `mode`.  Options: [%s]", strings.Join(robotsModeStrings[:], ", "))
 	robotsModeVar := robotsFlag{&settings.RobotsMode}
-	flag.Var(robotsModeVar, "robots-mode", robotsModeHelp)
-	flag.StringVar(&settings.HTTPUsername, "http-username", "", "Username to be used for HTTP Auth")
-	flag.StringVar(&settings.HTTPPassword, "http-password", "", "Password to be used for HTTP Auth")
-	flag.BoolVar(&settings.ProgressBar, "progress", true, "Display a progress bar on stderr.")
+	fs.Var(robotsModeVar, "robots-mode", robotsModeHelp)
+	fs.StringVar(&settings.HTTPUsername, "http-username", "", "Username to be used for HTTP Auth")
+	fs.StringVar(&settings.HTTPPassword, "http-password", "", "Password to be used for HTTP Auth")
+	fs.BoolVar(&settings.ArchivePeek, "archive-peek", false, "List the contents of discovered archives.")
+	fs.Int64Var(&settings.MaxBodySize, "max-body-size", settings.MaxBodySize, "Read at most this many `bytes` of each response body, reporting larger ones as truncated (0 for no limit).")
+	fs.Int64Var(&settings.ArchivePeekSize, "archive-peek-size", settings.ArchivePeekSize, "Largest archive (in `bytes`) to list with -archive-peek.")
+	fs.BoolVar(&settings.LeakDetect, "leak-detect", true, "Report internal hostnames and addresses found in responses.")
+	fs.BoolVar(&settings.HeaderChecks, "header-checks", true, "Report missing HSTS and CSP headers, version banners, backend names and CORS open to any origin.")
+	fs.IntVar(&settings.FollowRedirects, "follow-redirects", 0, "Follow up to `N` redirects, recording each hop (0 reports redirects without following them).")
+	fs.BoolVar(&settings.ReportOffScopeRedirects, "report-offscope-redirects", false, "Report redirects that leave the scope as findings instead of dropping them.")
+	fs.StringVar(&settings.CompareAgent, "compare-agent", "", "Request paths again with this `User-Agent` and report responses that differ.")
+	comparePathsValue := StringSliceFlag{&settings.ComparePaths}
+	fs.Var(comparePathsValue, "compare-paths", "Path `patterns` (e.g. /admin/*) to request with -compare-agent (default: paths found).")
+	fs.BoolVar(&settings.ChallengeDetect, "challenge-detect", true, "Report JS challenge and CAPTCHA pages separately instead of as findings.")
+	challengePauseValue := DurationFlag{&settings.ChallengePause}
+	fs.Var(challengePauseValue, "challenge-pause", "Stop requesting from a host for this `duration` after it returns a challenge page.")
+	fs.StringVar(&settings.BlockAction, "on-block", BlockSlow, "`Action` when a WAF or rate limiter starts blocking the scan: slow, pause, warn or off.")
+	blockPauseValue := DurationFlag{&settings.BlockPauseTime}
+	fs.Var(blockPauseValue, "block-pause", "How long to stop requesting from a blocking host with -on-block pause (`duration`).")
+	blockDelayValue := DurationFlag{&settings.BlockDelay}
+	fs.Var(blockDelayValue, "block-delay", "Delay between requests to a blocking host with -on-block slow, doubled each time blocking recurs (`duration`).")
+	fs.StringVar(&settings.AuthWordlist, "auth-wordlist", "", "Try the user:pass lines in `file` against endpoints asking for Basic authentication.")
+	authDelayValue := DurationFlag{&settings.AuthDelay}
+	fs.Var(authDelayValue, "auth-delay", "Delay between credentials tried against an endpoint with -auth-wordlist (`duration`).")
+	fs.BoolVar(&settings.ProgressBar, "progress", true, "Display a progress bar on stderr.")
+	fs.BoolVar(&settings.noProgressBar, "no-progress", false, "Disable the progress bar (e.g., when stderr is not a TTY).")
+
+	fs.StringVar(&settings.CheckpointPath, "checkpoint", "", "Write a checkpoint to `file` or storage URL if the scan is interrupted.")
+	fs.StringVar(&settings.ResumePath, "resume", "", "Resume an interrupted scan from a checkpoint `file` or storage URL.")
+	fs.BoolVar(&settings.ControlStdin, "control-stdin", false, "Read commands to add words (word w...) or targets (target url...) to the running scan from stdin.")
+	fs.StringVar(&settings.ManifestPath, "manifest", "", "Write a JSON manifest of what was in and out of scope to `file` or storage URL.")
+	fs.StringVar(&settings.SummaryPath, "summary", "", "Write a JSON summary of the scan (responses per status class, findings, changes from -diff) to `file` or storage URL.")
+	failOnValue := CodeRangesFlag{&settings.FailOn}
+	fs.Var(failOnValue, "fail-on", "Exit with status 3 if there are findings with these HTTP response `codes` (only new or changed ones with -diff).")
+	fs.StringVar(&settings.DiffPath, "diff", "", "Re-check the results in `file` (from -format json) with conditional requests and report only new, changed and removed resources.")
+
+	// Distributed scanning flags
+	fs.StringVar(&settings.ListenAddr, "listen", "127.0.0.1:8989", "`Address` to listen on in serve mode.  Addresses other than loopback need -api-token.")
+	fs.StringVar(&settings.CoordinatorURL, "coordinator", "", "`URL` of the coordinator in agent mode.")
+	fs.StringVar(&settings.APIToken, "api-token", "", "Shared `secret` between coordinator and agents.")
+	leaseTimeValue := DurationFlag{&settings.LeaseTime}
+	fs.Var(leaseTimeValue, "lease-time", "How long (as `duration`) an agent may hold a task.")
 
 	// Debugging flags
-	flag.BoolVar(&settings.DebugCPUProf, "debug-cpuprof", false, "[DEBUG] CPU Profiling")
-
-	settings.flagsSet = true
+	fs.BoolVar(&settings.DebugCPUProf, "debug-cpuprof", false, "[DEBUG] CPU Profiling")
 }
 
 // Load settings from the first file found in searchPaths
@@ -293,17 +642,199 @@ func (settings *ScanSettings) LoadFromDefaultConfigFiles() {
 // Load from the specified file
 func (settings *ScanSettings) LoadFromConfigFile(path string) {
 	settings.InitFlags()
-	// TODO: load
+	if err := settings.loadConfigFile(flag.CommandLine, path); err != nil {
+		logging.Logf(logging.LogWarning, "Error loading config file: %s", err.Error())
+	}
+}
+
+// Config files set flags by name.  Files ending in .yaml or .yml are YAML,
+// and .toml files TOML, with lists for flags that take several values;
+// otherwise there is one flag per line, as "name = value" or "name value",
+// and a name alone sets a boolean flag.  Lines starting with '#' are ignored.
+func (settings *ScanSettings) loadConfigFile(fs *flag.FlagSet, path string) error {
 	settings.configPath = path
+	fp, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("Unable to open config file: %s", err.Error())
+	}
+	defer fp.Close()
+	var entries []configEntry
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		entries, err = parseYAMLConfig(fp)
+	case ".toml":
+		entries, err = parseTOMLConfig(fp)
+	default:
+		entries, err = parseFlatConfig(fp)
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %s", path, err.Error())
+	}
+	settings.configSet = make(map[string]bool)
+	for _, entry := range entries {
+		name := strings.Replace(strings.TrimLeft(entry.name, "-"), "_", "-", -1)
+		f := fs.Lookup(name)
+		if f == nil {
+			return fmt.Errorf("%s:%d: unknown setting %s", path, entry.line, entry.name)
+		}
+		values := entry.values
+		switch f.Value.(type) {
+		case StringSliceFlag, IntSliceFlag:
+			// Takes a comma-separated list in one go
+			values = []string{strings.Join(values, ",")}
+		}
+		for _, value := range values {
+			if err := fs.Set(name, value); err != nil {
+				return fmt.Errorf("%s:%d: %s", path, entry.line, err.Error())
+			}
+		}
+		settings.configSet[name] = true
+	}
+	return nil
+}
+
+// Names of the flags given in args.
+func flagNamesInArgs(args []string) map[string]bool {
+	names := make(map[string]bool)
+	for _, arg := range args {
+		if arg == "--" {
+			break
+		}
+		name := strings.TrimLeft(arg, "-")
+		if name == arg || name == "" {
+			continue
+		}
+		if i := strings.Index(name, "="); i != -1 {
+			name = name[:i]
+		}
+		names[name] = true
+	}
+	return names
+}
+
+// Clear list flags from the config file that are given again in args, so the
+// command line replaces their values instead of adding to them.
+func (settings *ScanSettings) resetConfigLists(fs *flag.FlagSet, args []string) {
+	for name := range flagNamesInArgs(args) {
+		if !settings.configSet[name] {
+			continue
+		}
+		if f := fs.Lookup(name); f != nil {
+			if r, ok := f.Value.(RepeatedStringFlag); ok {
+				*r.slice = nil
+			}
+		}
+	}
+}
+
+// Whether the flag with the given name was set, by the config file or on the
+// command line, rather than left at its default.
+func (settings *ScanSettings) IsSet(name string) bool {
+	return settings.configSet[name] || flagNamesInArgs(settings.args)[name]
+}
+
+// Add URLs given as arguments rather than flags.  They replace any URLs
+// from the config file, unless -url was given as well.
+func (settings *ScanSettings) addArgURLs(urls, args []string) {
+	if len(urls) == 0 {
+		return
+	}
+	if settings.configSet["url"] && !flagNamesInArgs(args)["url"] {
+		settings.BaseURLs = nil
+	}
+	settings.BaseURLs = append(settings.BaseURLs, urls...)
+}
+
+// Find the value of the config flag, which must be known before the rest of
+// the command line is parsed.
+func configPathFromArgs(args []string) string {
+	for i, arg := range args {
+		if arg == "--" {
+			break
+		}
+		name := strings.TrimLeft(arg, "-")
+		if name == arg {
+			continue
+		}
+		if name == "config" && i+1 < len(args) {
+			return args[i+1]
+		}
+		if strings.HasPrefix(name, "config=") {
+			return strings.TrimPrefix(name, "config=")
+		}
+	}
+	return ""
+}
+
+// Load a fresh copy of the settings from the config file and command line, in
+// the same way as at startup.  The receiver is not modified, so it's up to
+// the caller to apply whichever settings can change while running.
+func (settings *ScanSettings) Reload() (*ScanSettings, error) {
+	fresh := defaultScanSettings()
+	fs := flag.NewFlagSet("reload", flag.ContinueOnError)
+	fs.SetOutput(ioutil.Discard)
+	fresh.initFlagSet(fs)
+	if settings.configPath != "" {
+		if err := fresh.loadConfigFile(fs, settings.configPath); err != nil {
+			return nil, err
+		}
+	}
+	fresh.resetConfigLists(fs, settings.args)
+	if err := fs.Parse(settings.args); err != nil {
+		return nil, err
+	}
+	fresh.addArgURLs(fs.Args(), settings.args)
+	fresh.Mode = settings.Mode
+	if fresh.noProgressBar {
+		fresh.ProgressBar = false
+	}
+	if fresh.noCache {
+		fresh.Cache, fresh.CacheDir = false, ""
+	}
+	return fresh, nil
 }
 
 // Parse command line flags into settings
+// The first argument may select a mode other than ScanMode.
 func (settings *ScanSettings) ParseFlags() {
 	settings.InitFlags()
-	flag.Parse()
-	for i := 0; i < flag.NArg(); i++ {
-		settings.BaseURLs = append(settings.BaseURLs, flag.Arg(i))
+	args := os.Args[1:]
+	if len(args) > 0 && (args[0] == ServeMode || args[0] == AgentMode) {
+		settings.Mode = args[0]
+		args = args[1:]
+	}
+	settings.args = args
+	settings.resetConfigLists(flag.CommandLine, args)
+	flag.CommandLine.Parse(args)
+	settings.addArgURLs(flag.Args(), args)
+	if settings.noProgressBar {
+		settings.ProgressBar = false
+	}
+	if settings.noCache {
+		settings.Cache, settings.CacheDir = false, ""
+	}
+}
+
+// Add the URLs listed in TargetFile to BaseURLs.  Blank lines and lines
+// starting with '#' are ignored.
+func (settings *ScanSettings) LoadTargetFile() error {
+	if settings.TargetFile == "" {
+		return nil
 	}
+	fp, err := os.Open(settings.TargetFile)
+	if err != nil {
+		return fmt.Errorf("Unable to open target file: %s", err.Error())
+	}
+	defer fp.Close()
+	scanner := bufio.NewScanner(fp)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		settings.BaseURLs = append(settings.BaseURLs, line)
+	}
+	return scanner.Err()
 }
 
 // Validate settings
@@ -313,9 +844,20 @@ func (settings *ScanSettings) Validate() error {
 		flag.PrintDefaults()
 		return errors.New(str)
 	}
+	if settings.Mode == AgentMode {
+		if settings.CoordinatorURL == "" {
+			return flagError("Coordinator URL is required in agent mode.")
+		}
+		return nil
+	}
 	if len(settings.BaseURLs) == 0 {
 		return flagError("URL is required.")
 	}
+	switch settings.BlockAction {
+	case "", BlockWarn, BlockPause, BlockSlow, BlockOff:
+	default:
+		return flagError(fmt.Sprintf("Invalid -on-block action: %s", settings.BlockAction))
+	}
 	return nil
 }
 
@@ -330,10 +872,19 @@ func (settings *ScanSettings) String() string {
 	return strings.Join(flags, " ")
 }
 
-// Convert BaseURL strings to URLs
+// Convert BaseURL strings to URLs.  Unix socket targets become http URLs
+// whose host stands for the socket, see UnixSockets.
 func (settings *ScanSettings) GetScopes() ([]*url.URL, error) {
 	scopes := make([]*url.URL, len(settings.BaseURLs))
 	for i, baseURL := range settings.BaseURLs {
+		if util.IsUnixTarget(baseURL) {
+			parsed, _, err := util.ParseUnixTarget(baseURL)
+			if err != nil {
+				return nil, err
+			}
+			scopes[i] = parsed
+			continue
+		}
 		parsed, err := url.Parse(baseURL)
 		scopes[i] = parsed
 		if err != nil {
@@ -347,6 +898,57 @@ func (settings *ScanSettings) GetScopes() ([]*url.URL, error) {
 	return scopes, nil
 }
 
+// Idle connections to keep for reuse per host: enough for each worker to
+// have one, within MaxConnsPerHost.
+func (settings *ScanSettings) IdleConnsPerHost() int {
+	idle := settings.Workers
+	if settings.MaxConnsPerHost > 0 && settings.MaxConnsPerHost < idle {
+		idle = settings.MaxConnsPerHost
+	}
+	return idle
+}
+
+// Map of host to socket path for the Unix socket targets, if any.
+func (settings *ScanSettings) UnixSockets() (map[string]string, error) {
+	sockets := make(map[string]string)
+	for _, baseURL := range settings.BaseURLs {
+		if !util.IsUnixTarget(baseURL) {
+			continue
+		}
+		u, socket, err := util.ParseUnixTarget(baseURL)
+		if err != nil {
+			return nil, err
+		}
+		if other, ok := sockets[u.Host]; ok && other != socket {
+			return nil, fmt.Errorf("Sockets %s and %s have the same name, %s", other, socket, u.Host)
+		}
+		sockets[u.Host] = socket
+	}
+	return sockets, nil
+}
+
+// Whether the scan fuzzes the FUZZ placeholder in the URLs, headers or body
+// with each word instead of brute forcing paths.
+func (settings *ScanSettings) Fuzzing() bool {
+	for _, u := range settings.BaseURLs {
+		if strings.Contains(u, util.FuzzMarker) {
+			return true
+		}
+	}
+	return settings.FuzzRequest()
+}
+
+// Whether FUZZ appears in the headers or body, so requests for different words
+// may have the same URL.
+func (settings *ScanSettings) FuzzRequest() bool {
+	for _, h := range settings.Headers {
+		if strings.Contains(h, util.FuzzMarker) {
+			return true
+		}
+	}
+	return strings.Contains(settings.RequestData, util.FuzzMarker)
+}
+
 // Init output formats
 func SetOutputFormats(formats []string) {
 	outputFormats = formats
@@ -15,6 +15,7 @@
 package settings
 
 import (
+	"flag"
 	"github.com/Matir/webborer/logging"
 	"testing"
 	"time"
@@ -196,6 +197,30 @@ func TestScanSettings_GetScopes_Error(t *testing.T) {
 	}
 }
 
+func TestScanSettings_UnixSockets(t *testing.T) {
+	ss := &ScanSettings{
+		BaseURLs: []string{"http://localhost/", "unix:///var/run/app.sock:/api/"},
+	}
+	scopes, err := ss.GetScopes()
+	if err != nil {
+		t.Fatalf("Expected no error getting scope, got %v.", err)
+	}
+	if scopes[1].String() != "http://var-run-app.sock/api/" {
+		t.Errorf("Unexpected scope for socket: %v", scopes[1])
+	}
+	sockets, err := ss.UnixSockets()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(sockets) != 1 || sockets["var-run-app.sock"] != "/var/run/app.sock" {
+		t.Errorf("Unexpected sockets: %v", sockets)
+	}
+	ss.BaseURLs = append(ss.BaseURLs, "unix:///var/run-app.sock:/")
+	if _, err := ss.UnixSockets(); err == nil {
+		t.Error("Expected error for sockets with the same name.")
+	}
+}
+
 func TestScanSettings_Validate(t *testing.T) {
 	ss := &ScanSettings{
 		BaseURLs: []string{},
@@ -209,4 +234,140 @@ func TestScanSettings_Validate(t *testing.T) {
 	if err := ss.Validate(); err != nil {
 		t.Errorf("Expected no errors with BaseURLs.")
 	}
+	ss.BlockAction = "explode"
+	if err := ss.Validate(); err == nil {
+		t.Errorf("Expected error with invalid block action.")
+	}
+}
+
+func TestLoadTargetFile(t *testing.T) {
+	ss := &ScanSettings{
+		BaseURLs:   []string{"http://a.example.com/"},
+		TargetFile: "testdata/targets.txt",
+	}
+	if err := ss.LoadTargetFile(); err != nil {
+		t.Fatalf("Unexpected error loading target file: %v", err)
+	}
+	expected := []string{"http://a.example.com/", "http://b.example.com/", "https://c.example.com/app/"}
+	if len(ss.BaseURLs) != len(expected) {
+		t.Fatalf("Expected %v, got %v", expected, ss.BaseURLs)
+	}
+	for i := range expected {
+		if ss.BaseURLs[i] != expected[i] {
+			t.Errorf("Expected %s, got %s", expected[i], ss.BaseURLs[i])
+		}
+	}
+	ss.TargetFile = "testdata/does-not-exist"
+	if err := ss.LoadTargetFile(); err == nil {
+		t.Errorf("Expected error for missing target file.")
+	}
+}
+
+func TestLoadConfigFile(t *testing.T) {
+	ss := defaultScanSettings()
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	ss.initFlagSet(fs)
+	ss.LeakDetect = false
+	if err := ss.loadConfigFile(fs, "testdata/webborer.conf"); err != nil {
+		t.Fatalf("Unexpected error loading config file: %v", err)
+	}
+	if len(ss.ExcludePaths) != 2 || ss.ExcludePaths[1] != "/private" {
+		t.Errorf("Unexpected exclude paths: %v", ss.ExcludePaths)
+	}
+	if ss.Mangle {
+		t.Error("Expected mangle to be disabled.")
+	}
+	if ss.SleepTime != 2*time.Second {
+		t.Errorf("Expected sleep of 2s, got %s", ss.SleepTime)
+	}
+	if !ss.LeakDetect {
+		t.Error("Expected bare flag name to enable leak-detect.")
+	}
+	if ss.configPath != "testdata/webborer.conf" {
+		t.Errorf("Config path not recorded: %s", ss.configPath)
+	}
+	if err := ss.loadConfigFile(fs, "testdata/targets.txt"); err == nil {
+		t.Error("Expected error for unknown flags.")
+	}
+}
+
+func TestScanSettings_IsSet(t *testing.T) {
+	ss := defaultScanSettings()
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	ss.initFlagSet(fs)
+	if err := ss.loadConfigFile(fs, "testdata/webborer.conf"); err != nil {
+		t.Fatalf("Unexpected error loading config file: %v", err)
+	}
+	ss.args = []string{"-extensions=php", "http://localhost/"}
+	for name, set := range map[string]bool{"extensions": true, "mangle": true, "workers": false} {
+		if ss.IsSet(name) != set {
+			t.Errorf("Expected IsSet(%s) to be %v", name, set)
+		}
+	}
+}
+
+func TestConfigPathFromArgs(t *testing.T) {
+	cases := []struct {
+		args     []string
+		expected string
+	}{
+		{[]string{"-url", "http://localhost/"}, ""},
+		{[]string{"-config", "a.conf"}, "a.conf"},
+		{[]string{"--config=b.conf", "-mangle"}, "b.conf"},
+		{[]string{"--", "-config", "c.conf"}, ""},
+		{[]string{"-config"}, ""},
+	}
+	for _, c := range cases {
+		if path := configPathFromArgs(c.args); path != c.expected {
+			t.Errorf("configPathFromArgs(%v): expected %q, got %q", c.args, c.expected, path)
+		}
+	}
+}
+
+func TestScanSettings_Reload(t *testing.T) {
+	ss := &ScanSettings{
+		Mode:       ServeMode,
+		configPath: "testdata/webborer.conf",
+		args:       []string{"-sleep", "5s", "http://localhost/"},
+	}
+	fresh, err := ss.Reload()
+	if err != nil {
+		t.Fatalf("Unexpected error reloading: %v", err)
+	}
+	if len(fresh.ExcludePaths) != 2 {
+		t.Errorf("Expected exclusions from config file, got %v", fresh.ExcludePaths)
+	}
+	if fresh.SleepTime != 5*time.Second {
+		t.Errorf("Expected command line to override config file, got %s", fresh.SleepTime)
+	}
+	if len(fresh.BaseURLs) != 1 || fresh.BaseURLs[0] != "http://localhost/" {
+		t.Errorf("Unexpected BaseURLs: %v", fresh.BaseURLs)
+	}
+	if fresh.Mode != ServeMode {
+		t.Errorf("Mode not preserved: %s", fresh.Mode)
+	}
+	if len(fresh.Extensions) == 0 {
+		t.Error("Expected default extensions.")
+	}
+	if ss.SleepTime != 0 {
+		t.Error("Reload modified the original settings.")
+	}
+}
+
+func TestScanSettings_NoCache(t *testing.T) {
+	ss := &ScanSettings{args: []string{"http://localhost/"}}
+	fresh, err := ss.Reload()
+	if err != nil {
+		t.Fatalf("Unexpected error reloading: %v", err)
+	}
+	if !fresh.Cache {
+		t.Error("Expected the cache to be on by default.")
+	}
+	ss.args = []string{"-cache-dir", "/tmp/cache", "-no-cache", "http://localhost/"}
+	if fresh, err = ss.Reload(); err != nil {
+		t.Fatalf("Unexpected error reloading: %v", err)
+	}
+	if fresh.Cache || fresh.CacheDir != "" {
+		t.Errorf("Expected -no-cache to turn off the cache, got %v %q", fresh.Cache, fresh.CacheDir)
+	}
 }
@@ -0,0 +1,89 @@
+// Copyright 2017 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package storage
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// Google Cloud Storage backend.  Requests are authorized with an OAuth2
+// access token from GOOGLE_OAUTH_ACCESS_TOKEN (for example, the output of
+// `gcloud auth print-access-token`).  STORAGE_EMULATOR_HOST may be set to use
+// an emulator instead of the real service.
+type gcsBackend struct{}
+
+func gcsObjectURL(bucket, key string) string {
+	endpoint := "https://storage.googleapis.com"
+	if host := os.Getenv("STORAGE_EMULATOR_HOST"); host != "" {
+		endpoint = strings.TrimSuffix(host, "/")
+		if !strings.Contains(endpoint, "://") {
+			endpoint = "http://" + endpoint
+		}
+	}
+	return endpoint + "/" + bucket + escapeKey(key)
+}
+
+func (b *gcsBackend) Create(u *url.URL) (io.WriteCloser, error) {
+	req, err := b.newRequest("PUT", u)
+	if err != nil {
+		return nil, err
+	}
+	return &uploadWriter{upload: func(data []byte) error {
+		req.Body = ioutil.NopCloser(bytes.NewReader(data))
+		req.ContentLength = int64(len(data))
+		resp, err := doRequest(req)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		return nil
+	}}, nil
+}
+
+func (b *gcsBackend) Open(u *url.URL) (io.ReadCloser, error) {
+	req, err := b.newRequest("GET", u)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := doRequest(req)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+func (b *gcsBackend) newRequest(method string, u *url.URL) (*http.Request, error) {
+	bucket, key, err := bucketAndKey(u)
+	if err != nil {
+		return nil, err
+	}
+	token := os.Getenv("GOOGLE_OAUTH_ACCESS_TOKEN")
+	if token == "" {
+		return nil, fmt.Errorf("GOOGLE_OAUTH_ACCESS_TOKEN must be set for GCS storage")
+	}
+	req, err := http.NewRequest(method, gcsObjectURL(bucket, key), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	return req, nil
+}
@@ -0,0 +1,72 @@
+// Copyright 2017 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package storage
+
+import (
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestGCSBackend_RoundTrip(t *testing.T) {
+	objects := make(map[string]string)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch r.Method {
+		case "PUT":
+			body, _ := ioutil.ReadAll(r.Body)
+			objects[r.URL.Path] = string(body)
+		case "GET":
+			if body, ok := objects[r.URL.Path]; ok {
+				io.WriteString(w, body)
+			} else {
+				w.WriteHeader(http.StatusNotFound)
+			}
+		}
+	}))
+	defer srv.Close()
+	t.Setenv("GOOGLE_OAUTH_ACCESS_TOKEN", "token")
+	t.Setenv("STORAGE_EMULATOR_HOST", srv.URL)
+
+	w, err := Create("gs://bucket/resume.json")
+	if err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	io.WriteString(w, "{}")
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	if objects["/bucket/resume.json"] != "{}" {
+		t.Errorf("Object not uploaded: %v", objects)
+	}
+	r, err := Open("gs://bucket/resume.json")
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer r.Close()
+	if body, _ := ioutil.ReadAll(r); string(body) != "{}" {
+		t.Errorf("Unexpected object contents: %q", body)
+	}
+
+	t.Setenv("GOOGLE_OAUTH_ACCESS_TOKEN", "")
+	if _, err := Open("gs://bucket/resume.json"); err == nil {
+		t.Error("Expected error without token.")
+	}
+}
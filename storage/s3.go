@@ -0,0 +1,220 @@
+// Copyright 2017 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package storage
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Amazon S3 backend.  Credentials are read from the standard AWS environment
+// variables (AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY, AWS_SESSION_TOKEN and
+// AWS_REGION).  AWS_ENDPOINT_URL may be set to use an S3-compatible service,
+// in which case path-style requests are made against that endpoint.
+type s3Backend struct {
+	// Used for tests
+	now func() time.Time
+}
+
+type s3Config struct {
+	accessKey    string
+	secretKey    string
+	sessionToken string
+	region       string
+	endpoint     string
+}
+
+func loadS3Config() (*s3Config, error) {
+	c := &s3Config{
+		accessKey:    os.Getenv("AWS_ACCESS_KEY_ID"),
+		secretKey:    os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		sessionToken: os.Getenv("AWS_SESSION_TOKEN"),
+		region:       os.Getenv("AWS_REGION"),
+		endpoint:     os.Getenv("AWS_ENDPOINT_URL"),
+	}
+	if c.accessKey == "" || c.secretKey == "" {
+		return nil, fmt.Errorf("AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY must be set for S3 storage")
+	}
+	if c.region == "" {
+		c.region = os.Getenv("AWS_DEFAULT_REGION")
+	}
+	if c.region == "" {
+		c.region = "us-east-1"
+	}
+	return c, nil
+}
+
+func (c *s3Config) objectURL(bucket, key string) string {
+	if c.endpoint != "" {
+		return strings.TrimSuffix(c.endpoint, "/") + "/" + bucket + escapeKey(key)
+	}
+	return fmt.Sprintf("https://%s.s3.%s.amazonaws.com%s", bucket, c.region, escapeKey(key))
+}
+
+func (b *s3Backend) Create(u *url.URL) (io.WriteCloser, error) {
+	c, req, err := b.newRequest("PUT", u)
+	if err != nil {
+		return nil, err
+	}
+	return &uploadWriter{upload: func(data []byte) error {
+		req.Body = ioutil.NopCloser(bytes.NewReader(data))
+		req.ContentLength = int64(len(data))
+		b.sign(req, data, c)
+		resp, err := doRequest(req)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		return nil
+	}}, nil
+}
+
+func (b *s3Backend) Open(u *url.URL) (io.ReadCloser, error) {
+	c, req, err := b.newRequest("GET", u)
+	if err != nil {
+		return nil, err
+	}
+	b.sign(req, nil, c)
+	resp, err := doRequest(req)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+func (b *s3Backend) newRequest(method string, u *url.URL) (*s3Config, *http.Request, error) {
+	bucket, key, err := bucketAndKey(u)
+	if err != nil {
+		return nil, nil, err
+	}
+	c, err := loadS3Config()
+	if err != nil {
+		return nil, nil, err
+	}
+	req, err := http.NewRequest(method, c.objectURL(bucket, key), nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	return c, req, nil
+}
+
+func (b *s3Backend) sign(req *http.Request, payload []byte, c *s3Config) {
+	now := time.Now
+	if b.now != nil {
+		now = b.now
+	}
+	if c.sessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", c.sessionToken)
+	}
+	signV4(req, payload, c.accessKey, c.secretKey, c.region, "s3", now())
+}
+
+// Sign a request with AWS Signature Version 4.  All headers present on the
+// request, plus the Host header, are signed.
+func signV4(req *http.Request, payload []byte, accessKey, secretKey, region, service string, now time.Time) {
+	now = now.UTC()
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	payloadHash := sha256Hex(payload)
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	headers := map[string]string{"host": req.URL.Host}
+	if req.Host != "" {
+		headers["host"] = req.Host
+	}
+	for k, v := range req.Header {
+		headers[strings.ToLower(k)] = strings.TrimSpace(strings.Join(v, ","))
+	}
+	names := make([]string, 0, len(headers))
+	for k := range headers {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	var canonHeaders strings.Builder
+	for _, k := range names {
+		canonHeaders.WriteString(k + ":" + headers[k] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		canonicalQuery(req.URL.Query()),
+		canonHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+	scope := strings.Join([]string{date, region, service, "aws4_request"}, "/")
+	toSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		amzDate,
+		scope,
+		sha256Hex([]byte(canonRequest)),
+	}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+secretKey), date)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, service)
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, toSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf(
+		"AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		accessKey, scope, signedHeaders, signature))
+}
+
+func canonicalQuery(q url.Values) string {
+	keys := make([]string, 0, len(q))
+	for k := range q {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	parts := make([]string, 0, len(keys))
+	for _, k := range keys {
+		vals := append([]string{}, q[k]...)
+		sort.Strings(vals)
+		for _, v := range vals {
+			parts = append(parts, awsEscape(k)+"="+awsEscape(v))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+func awsEscape(s string) string {
+	return strings.Replace(url.QueryEscape(s), "+", "%20", -1)
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
@@ -0,0 +1,180 @@
+// Copyright 2017 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package storage provides access to scan artifacts (reports, checkpoints,
+// etc.) on the local filesystem or in cloud object storage.  The backend is
+// selected by the scheme of the path: plain paths and file:// URLs use the
+// local filesystem, s3://bucket/key uses Amazon S3, and gs://bucket/object
+// uses Google Cloud Storage.
+package storage
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Longest a request to an object store may take, including the upload of a
+// large report, so that a stalled endpoint can't hang the scan.
+const requestTimeout = 5 * time.Minute
+
+var httpClient = &http.Client{Timeout: requestTimeout}
+
+// A Backend stores and retrieves objects identified by URL.
+type Backend interface {
+	// Create an object for writing, replacing any existing object.  The
+	// object may not be visible until the writer is closed.
+	Create(u *url.URL) (io.WriteCloser, error)
+	// Open an existing object for reading.
+	Open(u *url.URL) (io.ReadCloser, error)
+}
+
+var (
+	backends     = make(map[string]Backend)
+	backendsLock sync.RWMutex
+)
+
+func init() {
+	Register("file", localBackend{})
+	Register("s3", &s3Backend{})
+	Register("gs", &gcsBackend{})
+}
+
+// Register a backend for the given URL scheme, replacing any existing backend.
+func Register(scheme string, b Backend) {
+	backendsLock.Lock()
+	defer backendsLock.Unlock()
+	backends[strings.ToLower(scheme)] = b
+}
+
+// Create the object at path for writing.
+func Create(path string) (io.WriteCloser, error) {
+	b, u, err := lookup(path)
+	if err != nil {
+		return nil, err
+	}
+	return b.Create(u)
+}
+
+// Like Create, but also creates any missing parent directories of a local
+// file.  Object stores have no directories, so this is the same as Create.
+func CreateAll(path string) (io.WriteCloser, error) {
+	b, u, err := lookup(path)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := b.(localBackend); ok {
+		if err := os.MkdirAll(filepath.Dir(u.Path), 0755); err != nil {
+			return nil, err
+		}
+	}
+	return b.Create(u)
+}
+
+// Join elements onto a local path or storage URL.
+func Join(base string, elem ...string) string {
+	if !strings.Contains(base, "://") {
+		return filepath.Join(append([]string{base}, elem...)...)
+	}
+	return strings.TrimSuffix(base, "/") + "/" + strings.Join(elem, "/")
+}
+
+// Open the object at path for reading.
+func Open(path string) (io.ReadCloser, error) {
+	b, u, err := lookup(path)
+	if err != nil {
+		return nil, err
+	}
+	return b.Open(u)
+}
+
+// Find the backend for a path.  Anything that doesn't look like a URL is
+// treated as a local filename so that paths are never mangled by URL parsing.
+func lookup(path string) (Backend, *url.URL, error) {
+	if !strings.Contains(path, "://") {
+		return localBackend{}, &url.URL{Scheme: "file", Path: path}, nil
+	}
+	u, err := url.Parse(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("Invalid storage path %s: %s", path, err.Error())
+	}
+	backendsLock.RLock()
+	defer backendsLock.RUnlock()
+	b, ok := backends[strings.ToLower(u.Scheme)]
+	if !ok {
+		return nil, nil, fmt.Errorf("Unsupported storage scheme: %s", u.Scheme)
+	}
+	return b, u, nil
+}
+
+// Split an object URL into bucket and key.
+func bucketAndKey(u *url.URL) (string, string, error) {
+	key := strings.TrimPrefix(u.Path, "/")
+	if u.Host == "" || key == "" {
+		return "", "", fmt.Errorf("Storage URL must be %s://bucket/key: %s", u.Scheme, u.String())
+	}
+	return u.Host, key, nil
+}
+
+// Escape an object key for use as a URL path.
+func escapeKey(key string) string {
+	return (&url.URL{Path: "/" + key}).EscapedPath()
+}
+
+// Perform a request against an object store, treating any non-2xx status as
+// an error.
+func doRequest(req *http.Request) (*http.Response, error) {
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		resp.Body.Close()
+		return nil, fmt.Errorf("%s %s failed: %s", req.Method, req.URL.String(), resp.Status)
+	}
+	return resp, nil
+}
+
+type localBackend struct{}
+
+func (localBackend) Create(u *url.URL) (io.WriteCloser, error) {
+	return os.Create(u.Path)
+}
+
+func (localBackend) Open(u *url.URL) (io.ReadCloser, error) {
+	return os.Open(u.Path)
+}
+
+// Object stores need the whole object at once, so writes are buffered and
+// uploaded when the writer is closed.
+type uploadWriter struct {
+	bytes.Buffer
+	upload func([]byte) error
+	closed bool
+}
+
+func (w *uploadWriter) Close() error {
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+	return w.upload(w.Bytes())
+}
@@ -0,0 +1,100 @@
+// Copyright 2017 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package storage
+
+import (
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLocalBackend(t *testing.T) {
+	dir := t.TempDir()
+	for _, path := range []string{
+		filepath.Join(dir, "plain.txt"),
+		"file://" + filepath.Join(dir, "url.txt"),
+	} {
+		w, err := Create(path)
+		if err != nil {
+			t.Fatalf("Create(%s) failed: %v", path, err)
+		}
+		io.WriteString(w, "contents")
+		if err := w.Close(); err != nil {
+			t.Fatalf("Close(%s) failed: %v", path, err)
+		}
+		r, err := Open(path)
+		if err != nil {
+			t.Fatalf("Open(%s) failed: %v", path, err)
+		}
+		body, _ := ioutil.ReadAll(r)
+		r.Close()
+		if string(body) != "contents" {
+			t.Errorf("Unexpected contents for %s: %q", path, body)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "url.txt")); err != nil {
+		t.Errorf("file:// URL not written to local path: %v", err)
+	}
+}
+
+func TestLookup_Errors(t *testing.T) {
+	for _, path := range []string{
+		"ftp://host/file",
+		"s3://bucket",
+		"gs:///object",
+	} {
+		if _, err := Create(path); err == nil {
+			t.Errorf("Expected error for %s", path)
+		}
+	}
+}
+
+func TestJoin(t *testing.T) {
+	cases := []struct {
+		base     string
+		elem     []string
+		expected string
+	}{
+		{"out", []string{"host", "results.txt"}, filepath.Join("out", "host", "results.txt")},
+		{"s3://bucket/scans/", []string{"host", "results.txt"}, "s3://bucket/scans/host/results.txt"},
+		{"gs://bucket", []string{"host"}, "gs://bucket/host"},
+	}
+	for _, c := range cases {
+		if got := Join(c.base, c.elem...); got != c.expected {
+			t.Errorf("Join(%s, %v): expected %s, got %s", c.base, c.elem, c.expected, got)
+		}
+	}
+}
+
+func TestDoRequest_Timeout(t *testing.T) {
+	stall := make(chan bool)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-stall
+	}))
+	defer srv.Close()
+	defer close(stall)
+	saved := httpClient
+	httpClient = &http.Client{Timeout: 50 * time.Millisecond}
+	defer func() { httpClient = saved }()
+	req, _ := http.NewRequest("GET", srv.URL, nil)
+	if _, err := doRequest(req); err == nil {
+		t.Error("Expected a stalled request to time out")
+	}
+}
@@ -0,0 +1,69 @@
+// Copyright 2017 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"net/url"
+	"strings"
+)
+
+// Placeholder replaced with each word when fuzzing a URL, header or body
+// instead of brute forcing paths.
+const FuzzMarker = "FUZZ"
+
+// Replace FuzzMarker in the path and query of template with word.  Words
+// containing valid percent-encoding are inserted as-is rather than encoded
+// again, as with encoded wordlist variants.
+func FuzzURL(template *url.URL, word string) *url.URL {
+	u := *template
+	if strings.Contains(u.Path, FuzzMarker) {
+		raw := url.PathEscape(word)
+		plain := word
+		if unescaped, err := url.PathUnescape(word); err == nil && strings.Contains(word, "%") {
+			raw, plain = word, unescaped
+		}
+		u.RawPath = strings.Replace(template.EscapedPath(), FuzzMarker, raw, -1)
+		u.Path = strings.Replace(u.Path, FuzzMarker, plain, -1)
+	}
+	if strings.Contains(u.RawQuery, FuzzMarker) {
+		raw := url.QueryEscape(word)
+		if _, err := url.QueryUnescape(word); err == nil && strings.Contains(word, "%") {
+			raw = word
+		}
+		u.RawQuery = strings.Replace(u.RawQuery, FuzzMarker, raw, -1)
+	}
+	return &u
+}
+
+// A task that substitutes a word into the request headers or body, rather
+// than the URL, carries the word as the payload of its URL, so that it stays
+// distinct from the tasks for other words through the work queue and in
+// reports.  Only WithPayload, Payload and WithoutPayload know how it is
+// carried.
+func WithPayload(u *url.URL, word string) *url.URL {
+	clone := *u
+	clone.Fragment, clone.RawFragment = word, ""
+	return &clone
+}
+
+// The payload of a task URL, if any.
+func Payload(u *url.URL) string {
+	return u.Fragment
+}
+
+// The URL to request for a task, without its payload.
+func WithoutPayload(u *url.URL) *url.URL {
+	return WithPayload(u, "")
+}
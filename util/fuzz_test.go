@@ -0,0 +1,45 @@
+// Copyright 2017 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"net/url"
+	"testing"
+)
+
+func TestFuzzURL(t *testing.T) {
+	cases := []struct {
+		template string
+		word     string
+		expected string
+	}{
+		{"https://host/item?id=FUZZ", "42", "https://host/item?id=42"},
+		{"https://host/item?id=FUZZ&x=1", "a b&c", "https://host/item?id=a+b%26c&x=1"},
+		{"https://host/api/FUZZ/details", "users", "https://host/api/users/details"},
+		{"https://host/api/FUZZ", "a/b", "https://host/api/a%2Fb"},
+		{"https://host/api/FUZZ", "%2e%2e", "https://host/api/%2e%2e"},
+		{"https://host/FUZZ?q=FUZZ", "x", "https://host/x?q=x"},
+		{"https://host/static", "x", "https://host/static"},
+	}
+	for _, c := range cases {
+		template, _ := url.Parse(c.template)
+		if got := FuzzURL(template, c.word).String(); got != c.expected {
+			t.Errorf("FuzzURL(%s, %q): expected %s, got %s", c.template, c.word, c.expected, got)
+		}
+		if template.String() != c.template {
+			t.Errorf("FuzzURL modified template %s", c.template)
+		}
+	}
+}
@@ -0,0 +1,140 @@
+// Copyright 2017 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"bytes"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+// Number of bytes of a body needed for sniffing.
+const SniffLen = 512
+
+// Content types that say nothing useful about the content.
+var genericContentTypes = map[string]bool{
+	"":                         true,
+	"application/octet-stream": true,
+	"application/unknown":      true,
+	"application/x-download":   true,
+	"binary/octet-stream":      true,
+	"text/plain":               true,
+}
+
+// Signatures not recognized by http.DetectContentType.
+var extraSignatures = []struct {
+	offset int
+	magic  []byte
+	ctype  string
+}{
+	{0, []byte("7z\xBC\xAF\x27\x1C"), "application/x-7z-compressed"},
+	{0, []byte("BZh"), "application/x-bzip2"},
+	{0, []byte("\xFD7zXZ\x00"), "application/x-xz"},
+	{0, []byte("SQLite format 3\x00"), "application/vnd.sqlite3"},
+	{257, []byte("ustar"), "application/x-tar"},
+	{0, []byte("-- MySQL dump"), "application/sql"},
+	{0, []byte("-- PostgreSQL database dump"), "application/sql"},
+	{0, []byte("<?php"), "application/x-httpd-php"},
+	{0, []byte("#!"), "text/x-shellscript"},
+}
+
+// Prefixes commonly found at the start of JavaScript files.
+var javascriptPrefixes = []string{
+	"!function",
+	"\"use strict\"",
+	"'use strict'",
+	"(function",
+	"/*!",
+	"const ",
+	"define(",
+	"function ",
+	"let ",
+	"var ",
+	"window.",
+}
+
+// Return the lower-cased media type of a Content-Type header, without any
+// parameters.
+func MediaType(contentType string) string {
+	if mt, _, err := mime.ParseMediaType(contentType); err == nil {
+		return mt
+	}
+	mt := strings.SplitN(contentType, ";", 2)[0]
+	return strings.ToLower(strings.TrimSpace(mt))
+}
+
+// Check if a content type is missing or too generic to be trusted.
+func IsGenericContentType(contentType string) bool {
+	return genericContentTypes[MediaType(contentType)]
+}
+
+// Determine the content type of body based on its contents.  Only the first
+// SniffLen bytes are considered.
+func SniffContentType(body []byte) string {
+	if len(body) > SniffLen {
+		body = body[:SniffLen]
+	}
+	for _, sig := range extraSignatures {
+		if len(body) >= sig.offset+len(sig.magic) &&
+			bytes.Equal(body[sig.offset:sig.offset+len(sig.magic)], sig.magic) {
+			return sig.ctype
+		}
+	}
+	detected := http.DetectContentType(body)
+	if MediaType(detected) != "text/plain" {
+		return detected
+	}
+	trimmed := bytes.TrimSpace(body)
+	if looksLikeJSON(trimmed) {
+		return "application/json"
+	}
+	for _, prefix := range javascriptPrefixes {
+		if bytes.HasPrefix(trimmed, []byte(prefix)) {
+			return "application/javascript"
+		}
+	}
+	return detected
+}
+
+// Determine the content type to use for a response, given the Content-Type
+// header and the start of the body.  Returns the type and whether or not it
+// was determined by sniffing.
+func EffectiveContentType(header string, body []byte) (string, bool) {
+	if !IsGenericContentType(header) || len(body) == 0 {
+		return header, false
+	}
+	sniffed := SniffContentType(body)
+	if MediaType(sniffed) == MediaType(header) {
+		return header, false
+	}
+	return sniffed, true
+}
+
+// Bodies are usually truncated, so this can't use json.Valid.
+func looksLikeJSON(body []byte) bool {
+	if len(body) < 2 {
+		return false
+	}
+	switch body[0] {
+	case '{':
+		rest := bytes.TrimSpace(body[1:])
+		return len(rest) > 0 && (rest[0] == '"' || rest[0] == '}')
+	case '[':
+		rest := bytes.TrimSpace(body[1:])
+		return len(rest) > 0 && bytes.IndexByte([]byte("{[\"]-0123456789tfn"), rest[0]) != -1
+	}
+	return false
+}
@@ -0,0 +1,72 @@
+// Copyright 2017 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"testing"
+)
+
+func TestMediaType(t *testing.T) {
+	tests := map[string]string{
+		"text/html":                 "text/html",
+		"Text/HTML; charset=utf-8":  "text/html",
+		"":                          "",
+		"application/json;charset=": "application/json",
+	}
+	for in, expected := range tests {
+		if got := MediaType(in); got != expected {
+			t.Errorf("MediaType(%q): expected %q, got %q", in, expected, got)
+		}
+	}
+}
+
+func TestSniffContentType(t *testing.T) {
+	tests := []struct {
+		body     string
+		expected string
+	}{
+		{`{"a": 1}`, "application/json"},
+		{`[{"a": 1}]`, "application/json"},
+		{"PK\x03\x04rest of zip", "application/zip"},
+		{"\x1f\x8b\x08\x00", "application/x-gzip"},
+		{"BZh91AY", "application/x-bzip2"},
+		{"<?php echo 'hi'; ?>", "application/x-httpd-php"},
+		{"(function(){ return 1; })();", "application/javascript"},
+		{"#!/bin/sh\necho hi", "text/x-shellscript"},
+		{"-- MySQL dump 10.13", "application/sql"},
+		{"just some text", "text/plain; charset=utf-8"},
+	}
+	for _, test := range tests {
+		if got := SniffContentType([]byte(test.body)); got != test.expected {
+			t.Errorf("SniffContentType(%q): expected %q, got %q", test.body, test.expected, got)
+		}
+	}
+}
+
+func TestEffectiveContentType(t *testing.T) {
+	body := []byte(`{"a": 1}`)
+	if ct, sniffed := EffectiveContentType("", body); !sniffed || ct != "application/json" {
+		t.Errorf("Expected sniffed JSON for missing header, got %q (%v)", ct, sniffed)
+	}
+	if ct, sniffed := EffectiveContentType("application/octet-stream", body); !sniffed || ct != "application/json" {
+		t.Errorf("Expected sniffed JSON for generic header, got %q (%v)", ct, sniffed)
+	}
+	if ct, sniffed := EffectiveContentType("text/html", body); sniffed || ct != "text/html" {
+		t.Errorf("Expected header to be trusted, got %q (%v)", ct, sniffed)
+	}
+	if ct, sniffed := EffectiveContentType("text/plain", []byte("plain")); sniffed || ct != "text/plain" {
+		t.Errorf("Expected plain text to be left alone, got %q (%v)", ct, sniffed)
+	}
+}
@@ -0,0 +1,65 @@
+// Copyright 2017 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// Prefix of targets served over a Unix socket, as unix:///path/to.sock:/path
+const UnixTargetPrefix = "unix://"
+
+// Whether target names a Unix socket rather than a URL.
+func IsUnixTarget(target string) bool {
+	return strings.HasPrefix(strings.ToLower(target), UnixTargetPrefix)
+}
+
+// Parse a target of the form unix:///path/to.sock:/url/path into the socket
+// path and the http URL to scan.  The URL's host stands for the socket, see
+// UnixSocketHost.
+func ParseUnixTarget(target string) (*url.URL, string, error) {
+	rest := target[len(UnixTargetPrefix):]
+	socket, path := rest, "/"
+	if i := strings.Index(rest, ":"); i >= 0 {
+		socket, path = rest[:i], rest[i+1:]
+	}
+	if socket == "" {
+		return nil, "", fmt.Errorf("Missing socket path in %s", target)
+	}
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+	u, err := url.Parse("http://" + UnixSocketHost(socket) + path)
+	if err != nil {
+		return nil, "", fmt.Errorf("Unable to parse %s: %s", target, err.Error())
+	}
+	return u, socket, nil
+}
+
+// Hostname standing for a Unix socket in URLs: the socket path with other
+// characters replaced by dashes, e.g. var-run-app.sock for /var/run/app.sock.
+func UnixSocketHost(socket string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9', r == '.', r == '-':
+			return r
+		case r >= 'A' && r <= 'Z':
+			return r - 'A' + 'a'
+		}
+		return '-'
+	}, strings.TrimLeft(socket, "/"))
+}
@@ -0,0 +1,49 @@
+// Copyright 2017 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"testing"
+)
+
+func TestParseUnixTarget(t *testing.T) {
+	cases := []struct {
+		target, url, socket string
+	}{
+		{"unix:///var/run/app.sock:/", "http://var-run-app.sock/", "/var/run/app.sock"},
+		{"unix:///var/run/Docker.sock:/v1.40/", "http://var-run-docker.sock/v1.40/", "/var/run/Docker.sock"},
+		{"unix:///tmp/app.sock", "http://tmp-app.sock/", "/tmp/app.sock"},
+		{"unix://relative/app.sock:admin", "http://relative-app.sock/admin", "relative/app.sock"},
+	}
+	for _, c := range cases {
+		if !IsUnixTarget(c.target) {
+			t.Errorf("Expected %s to be a Unix target", c.target)
+		}
+		u, socket, err := ParseUnixTarget(c.target)
+		if err != nil {
+			t.Errorf("Unexpected error for %s: %v", c.target, err)
+			continue
+		}
+		if u.String() != c.url || socket != c.socket {
+			t.Errorf("%s: expected %s %s, got %s %s", c.target, c.url, c.socket, u.String(), socket)
+		}
+	}
+	if _, _, err := ParseUnixTarget("unix://:/"); err == nil {
+		t.Error("Expected error for missing socket path.")
+	}
+	if IsUnixTarget("http://example.com/") {
+		t.Error("Expected http URL not to be a Unix target.")
+	}
+}
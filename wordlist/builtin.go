@@ -0,0 +1,63 @@
+// Copyright 2017 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wordlist
+
+import (
+	"embed"
+	"errors"
+	"path"
+	"sort"
+	"strings"
+)
+
+// Prefix for selecting a built-in wordlist by name, as in builtin:common.
+const BuiltinPrefix = "builtin:"
+
+// Curated wordlists embedded in the binary so that scans work without any
+// external files.
+//
+//go:embed lists/*.txt
+var builtinLists embed.FS
+
+// Names of all of the built-in wordlists.
+func BuiltinWordlists() []string {
+	names := []string{"default", "short"}
+	entries, _ := builtinLists.ReadDir("lists")
+	for _, e := range entries {
+		names = append(names, strings.TrimSuffix(e.Name(), ".txt"))
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Loads a built-in wordlist for basic scans.
+func LoadBuiltinWordlist(which string) ([]string, error) {
+	which = strings.TrimPrefix(which, BuiltinPrefix)
+	switch which {
+	case "default":
+		return ReadWordlist(strings.NewReader(DefaultWordlist))
+	case "short":
+		return ReadWordlist(strings.NewReader(ShortWordlist))
+	}
+	if which == "" || strings.ContainsAny(which, "/\\") {
+		return nil, errors.New("No such built-in wordlist.")
+	}
+	fp, err := builtinLists.Open(path.Join("lists", which+".txt"))
+	if err != nil {
+		return nil, errors.New("No such built-in wordlist.")
+	}
+	defer fp.Close()
+	return ReadWordlist(fp)
+}
@@ -0,0 +1,294 @@
+// Copyright 2017 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wordlist
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"github.com/Matir/webborer/logging"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	// Wordlist files larger than this are streamed rather than loaded
+	StreamThreshold = 64 * 1024 * 1024
+	// Bytes read from the start of a stream to estimate its length
+	streamSampleSize = 1024 * 1024
+	// Words of a list stream transformed to estimate its length
+	listSampleWords = 1000
+	// Longest a wordlist download may take
+	fetchTimeout = 10 * time.Minute
+)
+
+var fetchClient = &http.Client{Timeout: fetchTimeout}
+
+// A Stream is a wordlist read from disk each time it is used, rather than
+// held in memory, for lists too large to load.  Wordlists from standard input
+// ("-") or a URL are first copied to a temporary file so they can be read
+// more than once.  Duplicate words are not removed from streamed files, as
+// that would mean remembering every word.
+//
+// A Stream can also hold a list already in memory (see NewListStream), so
+// that its transformations are produced as each word is reached.
+type Stream struct {
+	path string
+	// Whether path is a temporary copy to remove on Close
+	temp bool
+	// Words of a list stream, instead of path
+	words []string
+	t     *Transformer
+	// Estimated number of words, and transformed words from the start of the
+	// list
+	estimate int
+	sample   []string
+}
+
+// Whether the wordlist at path should be streamed: lists from standard input
+// or a URL always are, as are files larger than StreamThreshold.  If force is
+// set, any list other than a built-in one is streamed.
+func ShouldStream(path string, force bool) bool {
+	if path == "" || strings.HasPrefix(path, BuiltinPrefix) {
+		return false
+	}
+	if path == "-" || isURL(path) || force {
+		return true
+	}
+	fi, err := os.Stat(path)
+	return err == nil && fi.Size() > StreamThreshold
+}
+
+func isURL(path string) bool {
+	return strings.HasPrefix(path, "http://") || strings.HasPrefix(path, "https://")
+}
+
+// Open a wordlist for streaming from a file, standard input ("-") or an
+// http(s) URL.  Each word is passed through t, if it is not nil.
+func OpenStream(path string, t *Transformer) (*Stream, error) {
+	s := &Stream{path: path, t: t}
+	switch {
+	case path == "-":
+		if err := s.spool(os.Stdin); err != nil {
+			return nil, err
+		}
+	case isURL(path):
+		resp, err := fetchClient.Get(path)
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("Unable to fetch wordlist %s: %s", path, resp.Status)
+		}
+		if err := s.spool(resp.Body); err != nil {
+			return nil, err
+		}
+	}
+	if err := s.estimateSize(); err != nil {
+		s.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// Use a list of words held in memory as a Stream, passing each word through t
+// as it is reached rather than holding every variant at once.  Variants of
+// different words may repeat; they are not remembered to drop them.
+func NewListStream(words []string, t *Transformer) (*Stream, error) {
+	if len(words) == 0 {
+		return nil, errors.New("Wordlist is empty.")
+	}
+	s := &Stream{words: words, t: t}
+	n := len(words)
+	if n > listSampleWords {
+		n = listSampleWords
+	}
+	it := s.listIter(words[:n])
+	for {
+		w, ok := it.Next()
+		if !ok {
+			break
+		}
+		s.sample = append(s.sample, w)
+	}
+	s.estimate = len(s.sample) * len(words) / n
+	return s, nil
+}
+
+// Copy r to a temporary file to read from.
+func (s *Stream) spool(r io.Reader) error {
+	fp, err := ioutil.TempFile("", "webborer-wordlist")
+	if err != nil {
+		return err
+	}
+	defer fp.Close()
+	s.path = fp.Name()
+	s.temp = true
+	if _, err := io.Copy(fp, r); err != nil {
+		os.Remove(s.path)
+		return err
+	}
+	return nil
+}
+
+// Estimate the number of words from those in the first part of the file.
+func (s *Stream) estimateSize() error {
+	fp, err := os.Open(s.path)
+	if err != nil {
+		return err
+	}
+	defer fp.Close()
+	fi, err := fp.Stat()
+	if err != nil {
+		return err
+	}
+	counter := &countingReader{r: io.LimitReader(fp, streamSampleSize)}
+	it := newFileIterator(nil, counter, s.t)
+	for {
+		w, ok := it.Next()
+		if !ok {
+			break
+		}
+		s.sample = append(s.sample, w)
+	}
+	if len(s.sample) == 0 {
+		return errors.New("Wordlist is empty.")
+	}
+	if counter.n >= fi.Size() {
+		s.estimate = len(s.sample)
+	} else {
+		s.estimate = int(float64(len(s.sample)) * float64(fi.Size()) / float64(counter.n))
+	}
+	logging.Logf(logging.LogInfo, "Streaming wordlist of about %d words.", s.estimate)
+	return nil
+}
+
+// Estimated number of words in the stream, after transformation.
+func (s *Stream) Estimate() int {
+	return s.estimate
+}
+
+// Words from the start of the stream, after transformation.
+func (s *Stream) Sample() []string {
+	return s.sample
+}
+
+// Start reading the words from the beginning.
+func (s *Stream) Iter() (*Iterator, error) {
+	if s.words != nil {
+		return s.listIter(s.words), nil
+	}
+	fp, err := os.Open(s.path)
+	if err != nil {
+		return nil, err
+	}
+	return newFileIterator(fp, fp, s.t), nil
+}
+
+func (s *Stream) listIter(words []string) *Iterator {
+	it := &Iterator{t: s.t}
+	pos := 0
+	it.read = func() (string, bool) {
+		if pos >= len(words) {
+			return "", false
+		}
+		pos++
+		return words[pos-1], true
+	}
+	return it
+}
+
+// Remove any temporary copy of the wordlist.
+func (s *Stream) Close() error {
+	if s.temp {
+		return os.Remove(s.path)
+	}
+	return nil
+}
+
+// An Iterator reads the words of a Stream in order.
+type Iterator struct {
+	fp io.Closer
+	// Reads the next word, before it is transformed
+	read func() (string, bool)
+	t    *Transformer
+	// Variants of the last word read, waiting to be returned
+	pending []string
+}
+
+// Iterate over the lines of r, closing fp (if set) when done.  Errors reading
+// the list are logged and end the iteration.
+func newFileIterator(fp io.Closer, r io.Reader, t *Transformer) *Iterator {
+	scanner := bufio.NewScanner(r)
+	return &Iterator{
+		fp: fp,
+		t:  t,
+		read: func() (string, bool) {
+			if !scanner.Scan() {
+				if err := scanner.Err(); err != nil {
+					logging.Logf(logging.LogWarning, "Error reading wordlist: %s", err.Error())
+				}
+				return "", false
+			}
+			return scanner.Text(), true
+		},
+	}
+}
+
+// The next word, or false once there are none left.
+func (it *Iterator) Next() (string, bool) {
+	for len(it.pending) == 0 {
+		w, ok := it.read()
+		if !ok {
+			return "", false
+		}
+		if w == "" {
+			continue
+		}
+		if it.t == nil {
+			it.pending = append(it.pending, w)
+			continue
+		}
+		it.t.Transform(w, func(v string) {
+			it.pending = append(it.pending, v)
+		})
+	}
+	w := it.pending[0]
+	it.pending = it.pending[1:]
+	return w, true
+}
+
+func (it *Iterator) Close() error {
+	if it.fp == nil {
+		return nil
+	}
+	return it.fp.Close()
+}
+
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
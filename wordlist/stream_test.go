@@ -0,0 +1,153 @@
+// Copyright 2017 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wordlist
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func writeTempWordlist(t *testing.T, contents string) string {
+	fp, err := ioutil.TempFile("", "stream")
+	if err != nil {
+		t.Fatalf("Unable to create wordlist: %v", err)
+	}
+	defer fp.Close()
+	fp.WriteString(contents)
+	return fp.Name()
+}
+
+func readStream(t *testing.T, s *Stream) []string {
+	it, err := s.Iter()
+	if err != nil {
+		t.Fatalf("Unable to read stream: %v", err)
+	}
+	defer it.Close()
+	var words []string
+	for {
+		w, ok := it.Next()
+		if !ok {
+			return words
+		}
+		words = append(words, w)
+	}
+}
+
+func TestStream(t *testing.T) {
+	path := writeTempWordlist(t, "admin\n\nbackup\nadmin\n")
+	defer os.Remove(path)
+	tr, _ := NewTransformer([]string{"upper"}, nil, nil, false)
+	s, err := OpenStream(path, tr)
+	if err != nil {
+		t.Fatalf("Unable to open stream: %v", err)
+	}
+	defer s.Close()
+	// Duplicates are kept, as they would have to be remembered to drop them
+	expected := []string{"admin", "ADMIN", "backup", "BACKUP", "admin", "ADMIN"}
+	for i := 0; i < 2; i++ {
+		if got := readStream(t, s); !reflect.DeepEqual(got, expected) {
+			t.Errorf("Pass %d: expected %v, got %v", i, expected, got)
+		}
+	}
+	if s.Estimate() != len(expected) {
+		t.Errorf("Expected exact estimate for a short list, got %d", s.Estimate())
+	}
+}
+
+func TestStream_Estimate(t *testing.T) {
+	var b strings.Builder
+	for i := 0; b.Len() < 3*streamSampleSize; i++ {
+		fmt.Fprintf(&b, "word%06d\n", i)
+	}
+	actual := strings.Count(b.String(), "\n")
+	path := writeTempWordlist(t, b.String())
+	defer os.Remove(path)
+	s, err := OpenStream(path, nil)
+	if err != nil {
+		t.Fatalf("Unable to open stream: %v", err)
+	}
+	if s.Estimate() < actual*9/10 || s.Estimate() > actual*11/10 {
+		t.Errorf("Expected estimate near %d, got %d", actual, s.Estimate())
+	}
+	if len(s.Sample()) == 0 || s.Sample()[0] != "word000000" {
+		t.Errorf("Unexpected sample: %v", s.Sample()[:1])
+	}
+}
+
+func TestStream_URL(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/words.txt" {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprint(w, "one\ntwo\n")
+	}))
+	defer server.Close()
+	s, err := OpenStream(server.URL+"/words.txt", nil)
+	if err != nil {
+		t.Fatalf("Unable to open stream: %v", err)
+	}
+	if got := readStream(t, s); !reflect.DeepEqual(got, []string{"one", "two"}) {
+		t.Errorf("Unexpected words: %v", got)
+	}
+	temp := s.path
+	s.Close()
+	if _, err := os.Stat(temp); !os.IsNotExist(err) {
+		t.Errorf("Expected temporary copy to be removed, got %v", err)
+	}
+	if _, err := OpenStream(server.URL+"/missing", nil); err == nil {
+		t.Error("Expected error for missing wordlist.")
+	}
+}
+
+func TestStream_Empty(t *testing.T) {
+	path := writeTempWordlist(t, "\n\n")
+	defer os.Remove(path)
+	if _, err := OpenStream(path, nil); err == nil {
+		t.Error("Expected error for empty wordlist.")
+	}
+	if _, err := OpenStream(filepath.Join(os.TempDir(), "no-such-wordlist"), nil); err == nil {
+		t.Error("Expected error for missing file.")
+	}
+}
+
+func TestShouldStream(t *testing.T) {
+	path := writeTempWordlist(t, "a\n")
+	defer os.Remove(path)
+	cases := []struct {
+		path     string
+		force    bool
+		expected bool
+	}{
+		{"", true, false},
+		{"builtin:common", true, false},
+		{"-", false, true},
+		{"https://example.com/words.txt", false, true},
+		{path, false, false},
+		{path, true, true},
+	}
+	for _, c := range cases {
+		if got := ShouldStream(c.path, c.force); got != c.expected {
+			t.Errorf("ShouldStream(%s, %v): expected %v", c.path, c.force, c.expected)
+		}
+	}
+}
@@ -0,0 +1,147 @@
+// Copyright 2017 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wordlist
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// Supported case transformations
+var WordCases = []string{"lower", "upper", "title"}
+
+// A Transformer produces variants of each word in a wordlist: case
+// permutations, prefixed and suffixed forms, and percent-encoded forms.  The
+// original word is always included.  A Transformer holds no state, so the
+// variants of a list are produced as each word is reached (see
+// NewListStream) and one Transformer can be shared by every pass over it.
+type Transformer struct {
+	// Case transformations to apply, from WordCases
+	Cases []string
+	// Strings to prepend to each word (and each case variant)
+	Prefixes []string
+	// Strings to append to each word (and each case variant)
+	Suffixes []string
+	// Add percent-encoded and double percent-encoded variants
+	Encode bool
+}
+
+// Build a Transformer, checking that the case transformations are valid.
+func NewTransformer(cases, prefixes, suffixes []string, encode bool) (*Transformer, error) {
+	t := &Transformer{
+		Prefixes: nonEmpty(prefixes),
+		Suffixes: nonEmpty(suffixes),
+		Encode:   encode,
+	}
+	for _, c := range nonEmpty(cases) {
+		c = strings.ToLower(c)
+		if c == "all" {
+			t.Cases = append(t.Cases, WordCases...)
+			continue
+		}
+		if !isWordCase(c) {
+			return nil, fmt.Errorf("Unknown word case %s, expected one of %s or all.",
+				c, strings.Join(WordCases, ", "))
+		}
+		t.Cases = append(t.Cases, c)
+	}
+	return t, nil
+}
+
+// Whether every word is left as it is.
+func (t *Transformer) Identity() bool {
+	return len(t.Cases) == 0 && len(t.Prefixes) == 0 && len(t.Suffixes) == 0 && !t.Encode
+}
+
+// Pass each variant of word to emit, once each.
+func (t *Transformer) Transform(word string, emit func(string)) {
+	local := make(map[string]bool)
+	variants := make([]string, 0)
+	add := func(w string) {
+		if local[w] {
+			return
+		}
+		local[w] = true
+		variants = append(variants, w)
+	}
+	bases := []string{word}
+	for _, c := range t.Cases {
+		bases = append(bases, applyCase(c, word))
+	}
+	for _, b := range bases {
+		add(b)
+		for _, p := range t.Prefixes {
+			add(p + b)
+		}
+		for _, s := range t.Suffixes {
+			add(b + s)
+		}
+	}
+	if t.Encode {
+		for _, v := range variants {
+			encoded := percentEncode(v)
+			add(encoded)
+			add(strings.Replace(encoded, "%", "%25", -1))
+		}
+	}
+	for _, v := range variants {
+		emit(v)
+	}
+}
+
+func isWordCase(c string) bool {
+	for _, wc := range WordCases {
+		if c == wc {
+			return true
+		}
+	}
+	return false
+}
+
+func applyCase(c, word string) string {
+	switch c {
+	case "lower":
+		return strings.ToLower(word)
+	case "upper":
+		return strings.ToUpper(word)
+	case "title":
+		lower := []rune(strings.ToLower(word))
+		if len(lower) > 0 {
+			lower[0] = unicode.ToUpper(lower[0])
+		}
+		return string(lower)
+	}
+	return word
+}
+
+// Percent-encode every byte of the word.
+func percentEncode(word string) string {
+	var b strings.Builder
+	for i := 0; i < len(word); i++ {
+		fmt.Fprintf(&b, "%%%02X", word[i])
+	}
+	return b.String()
+}
+
+func nonEmpty(strs []string) []string {
+	res := make([]string, 0, len(strs))
+	for _, s := range strs {
+		if s != "" {
+			res = append(res, s)
+		}
+	}
+	return res
+}
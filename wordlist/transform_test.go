@@ -0,0 +1,95 @@
+// Copyright 2017 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wordlist
+
+import (
+	"reflect"
+	"testing"
+)
+
+func transformAll(t *Transformer, words ...string) []string {
+	res := make([]string, 0)
+	for _, w := range words {
+		t.Transform(w, func(v string) {
+			res = append(res, v)
+		})
+	}
+	return res
+}
+
+func TestTransformer_Cases(t *testing.T) {
+	tr, err := NewTransformer([]string{"all"}, nil, nil, false)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	got := transformAll(tr, "adMin")
+	expected := []string{"adMin", "admin", "ADMIN", "Admin"}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected %v, got %v", expected, got)
+	}
+	if _, err := NewTransformer([]string{"sideways"}, nil, nil, false); err == nil {
+		t.Error("Expected error for unknown case.")
+	}
+}
+
+func TestTransformer_PrefixSuffix(t *testing.T) {
+	tr, _ := NewTransformer([]string{"upper"}, []string{"admin_", ""}, []string{"2024"}, false)
+	got := transformAll(tr, "db")
+	expected := []string{"db", "admin_db", "db2024", "DB", "admin_DB", "DB2024"}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected %v, got %v", expected, got)
+	}
+}
+
+func TestTransformer_Encode(t *testing.T) {
+	tr, _ := NewTransformer(nil, nil, nil, true)
+	got := transformAll(tr, "a.b")
+	expected := []string{"a.b", "%61%2E%62", "%2561%252E%2562"}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected %v, got %v", expected, got)
+	}
+}
+
+func TestTransformer_Identity(t *testing.T) {
+	tr, _ := NewTransformer(nil, []string{""}, nil, false)
+	if !tr.Identity() {
+		t.Error("Expected transformer without transforms to be the identity.")
+	}
+	tr, _ = NewTransformer(nil, nil, []string{".bak"}, false)
+	if tr.Identity() {
+		t.Error("Expected transformer with a suffix not to be the identity.")
+	}
+}
+
+func TestListStream(t *testing.T) {
+	tr, _ := NewTransformer([]string{"lower"}, nil, []string{".bak"}, false)
+	s, err := NewListStream([]string{"a", "A", "b"}, tr)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	// Variants of different words aren't remembered to drop repeats
+	expected := []string{"a", "a.bak", "A", "A.bak", "a", "a.bak", "b", "b.bak"}
+	for i := 0; i < 2; i++ {
+		if got := readStream(t, s); !reflect.DeepEqual(got, expected) {
+			t.Errorf("Pass %d: expected %v, got %v", i, expected, got)
+		}
+	}
+	if s.Estimate() != len(expected) {
+		t.Errorf("Expected estimate of all variants, got %d", s.Estimate())
+	}
+	if _, err := NewListStream(nil, tr); err == nil {
+		t.Error("Expected error for empty list.")
+	}
+}
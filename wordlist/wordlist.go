@@ -18,8 +18,8 @@ package wordlist
 
 import (
 	"bufio"
-	"errors"
 	"io"
+	"math/rand"
 	"os"
 	"strings"
 )
@@ -29,6 +29,9 @@ func LoadWordlist(path string) ([]string, error) {
 	if path == "" {
 		return LoadBuiltinWordlist("default")
 	}
+	if strings.HasPrefix(path, BuiltinPrefix) {
+		return LoadBuiltinWordlist(path)
+	}
 	wl, wl_err := ReadWordlistFile(path)
 	if wl_err == nil {
 		return wl, nil
@@ -39,6 +42,13 @@ func LoadWordlist(path string) ([]string, error) {
 	return nil, wl_err
 }
 
+// Put words in a random order, so requests don't follow the wordlist.
+func Shuffle(words []string) {
+	rand.Shuffle(len(words), func(i, j int) {
+		words[i], words[j] = words[j], words[i]
+	})
+}
+
 // Load a Wordlist from a file.
 func ReadWordlistFile(path string) ([]string, error) {
 	if fp, err := os.Open(path); err != nil {
@@ -65,14 +75,3 @@ func ReadWordlist(rdr io.Reader) ([]string, error) {
 	}
 	return wordlist, nil
 }
-
-// Loads a built-in wordlist for basic scans.
-func LoadBuiltinWordlist(which string) ([]string, error) {
-	switch which {
-	case "default":
-		return ReadWordlist(strings.NewReader(DefaultWordlist))
-	case "short":
-		return ReadWordlist(strings.NewReader(ShortWordlist))
-	}
-	return nil, errors.New("No such built-in wordlist.")
-}
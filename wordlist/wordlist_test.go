@@ -15,6 +15,8 @@
 package wordlist
 
 import (
+	"sort"
+	"strings"
 	"testing"
 )
 
@@ -67,3 +69,40 @@ func TestLoadWordlist_Default(t *testing.T) {
 		t.Errorf("Expected wordlist on return, got nil.")
 	}
 }
+
+func TestLoadWordlist_Embedded(t *testing.T) {
+	for _, name := range BuiltinWordlists() {
+		wl, err := LoadWordlist(BuiltinPrefix + name)
+		if err != nil {
+			t.Errorf("Error loading builtin:%s: %v", name, err)
+		} else if len(wl) == 0 {
+			t.Errorf("Builtin wordlist %s is empty.", name)
+		}
+	}
+	for _, name := range []string{"common", "raft-small", "api-endpoints"} {
+		if _, err := LoadWordlist("builtin:" + name); err != nil {
+			t.Errorf("Expected builtin:%s to exist: %v", name, err)
+		}
+	}
+	for _, name := range []string{"builtin:", "builtin:nope", "builtin:../wordlist", "builtin:lists/common"} {
+		if _, err := LoadWordlist(name); err == nil {
+			t.Errorf("Expected error loading %s", name)
+		}
+	}
+}
+
+func TestShuffle(t *testing.T) {
+	words := make([]string, 100)
+	for i := range words {
+		words[i] = strings.Repeat("a", i+1)
+	}
+	shuffled := append([]string(nil), words...)
+	Shuffle(shuffled)
+	if strings.Join(shuffled, " ") == strings.Join(words, " ") {
+		t.Error("Expected shuffled words to be reordered.")
+	}
+	sort.Slice(shuffled, func(i, j int) bool { return len(shuffled[i]) < len(shuffled[j]) })
+	if strings.Join(shuffled, " ") != strings.Join(words, " ") {
+		t.Error("Expected shuffle to keep every word.")
+	}
+}
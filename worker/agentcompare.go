@@ -0,0 +1,163 @@
+// Copyright 2017 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package worker
+
+import (
+	"context"
+	"fmt"
+	"github.com/Matir/webborer/client"
+	"github.com/Matir/webborer/logging"
+	"github.com/Matir/webborer/results"
+	"github.com/Matir/webborer/workqueue"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+)
+
+// Responses whose lengths differ by less than this fraction, or this many
+// bytes, are considered the same, to allow for timestamps, tokens and the like.
+const (
+	agentLengthTolerance = 0.1
+	agentLengthSlack     = 32
+)
+
+// An agentComparer requests paths again with a second User-Agent and
+// describes how the response differs, to spot cloaking and access rules
+// based on the User-Agent.
+type agentComparer struct {
+	client client.Client
+	agent  string
+	// Path patterns to compare; if empty, findings are compared
+	paths []string
+	// Redirects to follow, as for the worker's own requests
+	follow int
+}
+
+// Build a comparer for agent, if factory can make clients with a different
+// User-Agent.  Like the worker, it follows up to follow redirects.
+func newAgentComparer(factory client.ClientFactory, agent string, paths []string, follow int) *agentComparer {
+	af, ok := factory.(client.AgentClientFactory)
+	if !ok {
+		logging.Logf(logging.LogWarning, "Client factory does not support -compare-agent.")
+		return nil
+	}
+	return &agentComparer{client: af.GetWithAgent(agent), agent: agent, paths: nonEmptyStrings(paths), follow: follow}
+}
+
+// Whether a path should be compared, given whether it was a finding.
+func (c *agentComparer) selected(u *url.URL, found bool) bool {
+	if len(c.paths) == 0 {
+		return found
+	}
+	for _, pattern := range c.paths {
+		if ok, _ := path.Match(pattern, u.Path); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Request u with the comparison agent and describe any meaningful
+// differences from resp, which stopped at a redirect to redir if not nil.
+// Redirects are followed as the worker follows them, never leaving scope, so
+// that both responses come from the same point in the chain.
+func (c *agentComparer) compare(ctx context.Context, u *url.URL, resp *http.Response, redir *url.URL, scope workqueue.QueueScopeFunc) string {
+	var otherRedir *url.URL
+	hops := 0
+	c.client.SetCheckRedirect(func(req *http.Request, via []*http.Request) error {
+		hops++
+		if (scope != nil && !scope(req.URL)) || hops > c.follow {
+			otherRedir = req.URL
+			return fmt.Errorf("Stop redirect.")
+		}
+		return nil
+	})
+	other, err := c.client.RequestURLContext(ctx, u)
+	if err != nil && (otherRedir == nil || other == nil) {
+		if ctx.Err() == nil {
+			logging.Logf(logging.LogInfo, "Error requesting %s as %s: %s", u.String(), c.agent, err.Error())
+		}
+		return ""
+	}
+	defer other.Body.Close()
+	body, _ := other.Body.(*client.Body)
+	measureBody(other, body, &results.Result{})
+	diffs := agentDiffs(resp, redir, other, otherRedir)
+	if len(diffs) == 0 {
+		return ""
+	}
+	return fmt.Sprintf("with User-Agent %q: %s", c.agent, strings.Join(diffs, ", "))
+}
+
+// List the meaningful differences between two responses to the same request.
+func agentDiffs(resp *http.Response, redir *url.URL, other *http.Response, otherRedir *url.URL) []string {
+	var diffs []string
+	if resp.StatusCode != other.StatusCode {
+		diffs = append(diffs, fmt.Sprintf("status %d vs %d", other.StatusCode, resp.StatusCode))
+	}
+	if a, b := urlOrNone(otherRedir), urlOrNone(redir); a != b {
+		diffs = append(diffs, fmt.Sprintf("redirect %s vs %s", a, b))
+	}
+	if a, b := mediaType(other), mediaType(resp); a != b {
+		diffs = append(diffs, fmt.Sprintf("Content-Type %s vs %s", a, b))
+	}
+	if lengthsDiffer(other.ContentLength, resp.ContentLength) {
+		diffs = append(diffs, fmt.Sprintf("length %d vs %d", other.ContentLength, resp.ContentLength))
+	}
+	return diffs
+}
+
+// Lengths only differ meaningfully if both are known and they are further
+// apart than both agentLengthTolerance and agentLengthSlack.
+func lengthsDiffer(a, b int64) bool {
+	if a < 0 || b < 0 {
+		return false
+	}
+	diff := a - b
+	if diff < 0 {
+		diff = -diff
+	}
+	max := a
+	if b > max {
+		max = b
+	}
+	return diff > agentLengthSlack && float64(diff) > agentLengthTolerance*float64(max)
+}
+
+func urlOrNone(u *url.URL) string {
+	if u == nil {
+		return "none"
+	}
+	return u.String()
+}
+
+func mediaType(resp *http.Response) string {
+	ctype := strings.TrimSpace(strings.SplitN(resp.Header.Get("Content-Type"), ";", 2)[0])
+	if ctype == "" {
+		return "none"
+	}
+	return strings.ToLower(ctype)
+}
+
+func nonEmptyStrings(s []string) []string {
+	res := make([]string, 0, len(s))
+	for _, v := range s {
+		if v = strings.TrimSpace(v); v != "" {
+			res = append(res, v)
+		}
+	}
+	return res
+}
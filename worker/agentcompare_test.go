@@ -0,0 +1,132 @@
+// Copyright 2017 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package worker
+
+import (
+	"github.com/Matir/webborer/client"
+	"github.com/Matir/webborer/results"
+	ss "github.com/Matir/webborer/settings"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAgentDiffs(t *testing.T) {
+	response := func(code int, ctype string, length int64) *http.Response {
+		return &http.Response{
+			StatusCode:    code,
+			Header:        http.Header{"Content-Type": []string{ctype}},
+			ContentLength: length,
+		}
+	}
+	login := &url.URL{Scheme: "http", Host: "localhost", Path: "/login"}
+	cases := []struct {
+		resp, other *http.Response
+		redir       *url.URL
+		expected    []string
+	}{
+		{response(200, "text/html", 1000), response(200, "text/html; charset=utf-8", 1050), nil, nil},
+		{response(200, "text/html", 1000), response(403, "text/html", 1000), nil, []string{"status 403 vs 200"}},
+		{response(200, "text/html", 1000), response(200, "application/json", 200), nil,
+			[]string{"Content-Type application/json vs text/html", "length 200 vs 1000"}},
+		{response(302, "text/html", -1), response(200, "text/html", 10), login,
+			[]string{"status 200 vs 302", "redirect none vs http://localhost/login"}},
+	}
+	for i, c := range cases {
+		if got := agentDiffs(c.resp, c.redir, c.other, nil); !reflect.DeepEqual(got, c.expected) {
+			t.Errorf("Case %d: expected %v, got %v", i, c.expected, got)
+		}
+	}
+}
+
+func TestAgentComparer_Selected(t *testing.T) {
+	c := &agentComparer{}
+	u := &url.URL{Path: "/admin/users"}
+	if !c.selected(u, true) || c.selected(u, false) {
+		t.Error("Expected only findings to be selected without patterns.")
+	}
+	c.paths = []string{"/admin/*"}
+	if !c.selected(u, false) {
+		t.Error("Expected /admin/users to match /admin/*.")
+	}
+	if c.selected(&url.URL{Path: "/other"}, true) {
+		t.Error("Expected /other not to match /admin/*.")
+	}
+}
+
+func TestWorker_CompareAgent(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.UserAgent(), "curl/") {
+			http.Error(w, "no bots", http.StatusForbidden)
+			return
+		}
+		w.Write([]byte("welcome"))
+	}))
+	defer server.Close()
+	settings := &ss.ScanSettings{
+		UserAgent:    "Mozilla/5.0",
+		CompareAgent: "curl/8.0",
+		Timeout:      5 * time.Second,
+	}
+	factory, _ := client.NewProxyClientFactory(nil, settings.Timeout, settings.UserAgent)
+	rchan := make(chan results.Result, 1)
+	w := NewConfiguredWorker(settings, factory, nil, noopUrl, noopInt, nil, rchan)
+	u, _ := url.Parse(server.URL + "/admin")
+	w.TryURL(u)
+	res := <-rchan
+	expected := `with User-Agent "curl/8.0": status 403 vs 200`
+	if res.AgentDiff != expected {
+		t.Errorf("Expected %q, got %q", expected, res.AgentDiff)
+	}
+}
+
+func TestWorker_CompareAgentRedirect(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/old":
+			http.Redirect(w, r, "/new", http.StatusFound)
+		case "/away":
+			http.Redirect(w, r, "http://elsewhere.example/", http.StatusFound)
+		default:
+			w.Write([]byte("welcome"))
+		}
+	}))
+	defer server.Close()
+	settings := &ss.ScanSettings{
+		UserAgent:       "Mozilla/5.0",
+		CompareAgent:    "curl/8.0",
+		ComparePaths:    []string{"/*"},
+		FollowRedirects: 1,
+		Timeout:         5 * time.Second,
+	}
+	factory, _ := client.NewProxyClientFactory(nil, settings.Timeout, settings.UserAgent)
+	rchan := make(chan results.Result, 1)
+	w := NewConfiguredWorker(settings, factory, nil, noopUrl, noopInt, nil, rchan)
+	w.SetScopeFunc(func(u *url.URL) bool {
+		return u.Host != "elsewhere.example"
+	})
+	// Both requests follow the redirect, or both stop where scope ends
+	for _, p := range []string{"/old", "/away"} {
+		u, _ := url.Parse(server.URL + p)
+		w.TryURL(u)
+		if res := <-rchan; res.AgentDiff != "" {
+			t.Errorf("Expected no difference for %s, got %q", p, res.AgentDiff)
+		}
+	}
+}
@@ -0,0 +1,171 @@
+// Copyright 2017 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package worker
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"github.com/Matir/webborer/logging"
+	"github.com/Matir/webborer/results"
+	"github.com/Matir/webborer/util"
+	"io"
+	"net/http"
+	"strings"
+)
+
+const (
+	// Stop listing after this many entries
+	maxArchiveEntries = 500
+)
+
+var archiveContentTypes = map[string]string{
+	"application/zip":              "zip",
+	"application/x-zip-compressed": "zip",
+	"application/x-gzip":           "tgz",
+	"application/gzip":             "tgz",
+	"application/x-compressed-tar": "tgz",
+	"application/x-tar":            "tar",
+}
+
+var archiveExtensions = map[string]string{
+	".zip":    "zip",
+	".jar":    "zip",
+	".war":    "zip",
+	".tar.gz": "tgz",
+	".tgz":    "tgz",
+	".gz":     "tgz",
+	".tar":    "tar",
+}
+
+// ArchiveAnalyzer lists the contents of archives (zip, tar, and tar.gz) found
+// during the scan, so exposed backups can be triaged without downloading them.
+// Nothing is extracted; only the archive headers are read.
+type ArchiveAnalyzer struct {
+	maxSize int64
+}
+
+func NewArchiveAnalyzer(maxSize int64) *ArchiveAnalyzer {
+	return &ArchiveAnalyzer{maxSize: maxSize}
+}
+
+func (a *ArchiveAnalyzer) Eligible(resp *http.Response) bool {
+	if resp.StatusCode != http.StatusOK {
+		return false
+	}
+	if resp.ContentLength > a.maxSize {
+		return false
+	}
+	return archiveType(resp) != ""
+}
+
+func (a *ArchiveAnalyzer) MaxSize() int64 {
+	return a.maxSize
+}
+
+func (a *ArchiveAnalyzer) Analyze(resp *http.Response, body []byte, res *results.Result) {
+	var listing []string
+	var err error
+	switch archiveType(resp) {
+	case "zip":
+		listing, err = listZip(body)
+	case "tgz":
+		listing, err = listGzip(body)
+	case "tar":
+		listing, err = listTar(bytes.NewReader(body))
+	}
+	if err != nil {
+		logging.Logf(logging.LogInfo, "Unable to list archive %s: %s", res.URL.String(), err.Error())
+	}
+	res.ArchiveListing = listing
+}
+
+// Determine the type of archive from the content type or the path.
+func archiveType(resp *http.Response) string {
+	if t, ok := archiveContentTypes[util.MediaType(resp.Header.Get("Content-Type"))]; ok {
+		return t
+	}
+	if resp.Request == nil || resp.Request.URL == nil {
+		return ""
+	}
+	path := strings.ToLower(resp.Request.URL.Path)
+	for ext, t := range archiveExtensions {
+		if strings.HasSuffix(path, ext) {
+			return t
+		}
+	}
+	return ""
+}
+
+func listZip(body []byte) ([]string, error) {
+	rdr, err := zip.NewReader(bytes.NewReader(body), int64(len(body)))
+	if err != nil {
+		return nil, err
+	}
+	listing := make([]string, 0, len(rdr.File))
+	for _, f := range rdr.File {
+		if len(listing) == maxArchiveEntries {
+			listing = append(listing, fmt.Sprintf("... (%d more)", len(rdr.File)-maxArchiveEntries))
+			break
+		}
+		listing = append(listing, archiveEntry(f.Name, int64(f.UncompressedSize64)))
+	}
+	return listing, nil
+}
+
+// A gzip file may be a tarball or just a single compressed file.
+func listGzip(body []byte) ([]string, error) {
+	gz, err := gzip.NewReader(bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	defer gz.Close()
+	listing, err := listTar(gz)
+	if err == nil || len(listing) > 0 {
+		return listing, err
+	}
+	if gz.Name != "" {
+		return []string{gz.Name}, nil
+	}
+	return nil, err
+}
+
+func listTar(rdr io.Reader) ([]string, error) {
+	tr := tar.NewReader(rdr)
+	listing := make([]string, 0)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return listing, nil
+		}
+		if err != nil {
+			// Truncated archives still give a partial listing
+			return listing, err
+		}
+		if len(listing) == maxArchiveEntries {
+			return append(listing, "..."), nil
+		}
+		listing = append(listing, archiveEntry(hdr.Name, hdr.Size))
+	}
+}
+
+func archiveEntry(name string, size int64) string {
+	if strings.HasSuffix(name, "/") {
+		return name
+	}
+	return fmt.Sprintf("%s (%d bytes)", name, size)
+}
@@ -0,0 +1,128 @@
+// Copyright 2017 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package worker
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"github.com/Matir/webborer/results"
+	"net/http"
+	"net/url"
+	"testing"
+)
+
+func makeZip(t *testing.T, names ...string) []byte {
+	buf := &bytes.Buffer{}
+	zw := zip.NewWriter(buf)
+	for _, n := range names {
+		w, err := zw.Create(n)
+		if err != nil {
+			t.Fatalf("Error creating zip entry: %v", err)
+		}
+		w.Write([]byte("data"))
+	}
+	zw.Close()
+	return buf.Bytes()
+}
+
+func makeTarGz(t *testing.T, names ...string) []byte {
+	buf := &bytes.Buffer{}
+	gz := gzip.NewWriter(buf)
+	tw := tar.NewWriter(gz)
+	for _, n := range names {
+		hdr := &tar.Header{Name: n, Mode: 0644, Size: 4}
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatalf("Error writing tar header: %v", err)
+		}
+		tw.Write([]byte("data"))
+	}
+	tw.Close()
+	gz.Close()
+	return buf.Bytes()
+}
+
+func archiveResponse(path, ctype string, body []byte) *http.Response {
+	u := &url.URL{Scheme: "http", Host: "localhost", Path: path}
+	return &http.Response{
+		StatusCode:    200,
+		ContentLength: int64(len(body)),
+		Header:        http.Header{"Content-Type": []string{ctype}},
+		Request:       &http.Request{URL: u},
+	}
+}
+
+func TestArchiveAnalyzer_Zip(t *testing.T) {
+	body := makeZip(t, "backup/", "backup/db.sql")
+	resp := archiveResponse("/backup.zip", "application/zip", body)
+	a := NewArchiveAnalyzer(1024 * 1024)
+	if !a.Eligible(resp) {
+		t.Fatalf("Expected zip to be eligible.")
+	}
+	res := &results.Result{URL: resp.Request.URL}
+	a.Analyze(resp, body, res)
+	expected := []string{"backup/", "backup/db.sql (4 bytes)"}
+	if len(res.ArchiveListing) != len(expected) {
+		t.Fatalf("Expected %v, got %v", expected, res.ArchiveListing)
+	}
+	for i := range expected {
+		if res.ArchiveListing[i] != expected[i] {
+			t.Errorf("Expected %s, got %s", expected[i], res.ArchiveListing[i])
+		}
+	}
+}
+
+func TestArchiveAnalyzer_TarGz(t *testing.T) {
+	body := makeTarGz(t, "etc/passwd", "etc/shadow")
+	// Type determined by extension
+	resp := archiveResponse("/site.tar.gz", "application/octet-stream", body)
+	a := NewArchiveAnalyzer(1024 * 1024)
+	if !a.Eligible(resp) {
+		t.Fatalf("Expected tar.gz to be eligible.")
+	}
+	res := &results.Result{URL: resp.Request.URL}
+	a.Analyze(resp, body, res)
+	if len(res.ArchiveListing) != 2 || res.ArchiveListing[1] != "etc/shadow (4 bytes)" {
+		t.Errorf("Unexpected listing: %v", res.ArchiveListing)
+	}
+}
+
+func TestArchiveAnalyzer_Ineligible(t *testing.T) {
+	a := NewArchiveAnalyzer(10)
+	resp := archiveResponse("/big.zip", "application/zip", make([]byte, 11))
+	if a.Eligible(resp) {
+		t.Errorf("Expected archive over size limit to be ineligible.")
+	}
+	resp = archiveResponse("/index.html", "text/html", []byte{})
+	if a.Eligible(resp) {
+		t.Errorf("Expected HTML to be ineligible.")
+	}
+	resp = archiveResponse("/missing.zip", "application/zip", []byte{})
+	resp.StatusCode = 404
+	if a.Eligible(resp) {
+		t.Errorf("Expected 404 to be ineligible.")
+	}
+}
+
+func TestArchiveAnalyzer_Corrupt(t *testing.T) {
+	body := []byte("PK\x03\x04 not really a zip")
+	resp := archiveResponse("/broken.zip", "application/zip", body)
+	res := &results.Result{URL: resp.Request.URL}
+	NewArchiveAnalyzer(1024).Analyze(resp, body, res)
+	if len(res.ArchiveListing) != 0 {
+		t.Errorf("Expected no listing for corrupt zip, got %v", res.ArchiveListing)
+	}
+}
@@ -0,0 +1,250 @@
+// Copyright 2017 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package worker
+
+import (
+	"errors"
+	"fmt"
+	"github.com/Matir/webborer/logging"
+	"github.com/Matir/webborer/results"
+	ss "github.com/Matir/webborer/settings"
+	"github.com/Matir/webborer/workqueue"
+	"io"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const (
+	// Number of recent responses per host considered
+	blockWindow = 10
+	// Responses in the window that must look blocked
+	blockThreshold = 8
+	// Ordinary responses a host must have served first, so hosts that block
+	// everything from the start aren't mistaken for a WAF kicking in
+	blockMinNormal = 5
+	// Longest delay -on-block slow will back off to
+	maxBlockDelay = time.Minute
+)
+
+// BlockDetector watches the results for each host for signs that a WAF or
+// rate limiter has started blocking the scan part way through: a run of 429s,
+// challenge pages, connection resets, or 403s that all look the same.  When
+// it sees one it warns, then pauses or slows down the host, and marks the
+// result where it happened and the host's later results so the report shows
+// which findings can't be trusted.  Once the host's responses are back to
+// normal, a slowed host is sped up again and the result where that happened
+// is marked too.
+type BlockDetector struct {
+	settings *ss.ScanSettings
+	pause    workqueue.QueuePauseFunc
+	throttle workqueue.QueueThrottleFunc
+	hosts    map[string]*hostBlockState
+	lock     sync.Mutex
+}
+
+type hostBlockState struct {
+	// Most recent responses, oldest first
+	window []blockSample
+	// Ordinary responses seen
+	normal int
+	// Ordinary responses in a row
+	run int
+	// Whether the host is currently blocking
+	blocking bool
+	// Current delay for BlockSlow
+	delay time.Duration
+}
+
+type blockSample struct {
+	// Why the response looks blocked, or empty
+	reason string
+	length int64
+}
+
+// Create a BlockDetector that pauses or throttles hosts according to the
+// settings.  Either function may be nil.
+func NewBlockDetector(settings *ss.ScanSettings, pause workqueue.QueuePauseFunc, throttle workqueue.QueueThrottleFunc) *BlockDetector {
+	return &BlockDetector{
+		settings: settings,
+		pause:    pause,
+		throttle: throttle,
+		hosts:    make(map[string]*hostBlockState),
+	}
+}
+
+// Whether blocking detection is turned on in settings.
+func BlockDetectionEnabled(settings *ss.ScanSettings) bool {
+	return settings.BlockAction != "" && settings.BlockAction != ss.BlockOff
+}
+
+// Record a result, annotating it if blocking is detected or is ongoing for
+// its host.
+func (d *BlockDetector) Observe(res *results.Result) {
+	if res.URL == nil {
+		return
+	}
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	st, ok := d.hosts[res.URL.Host]
+	if !ok {
+		st = &hostBlockState{}
+		d.hosts[res.URL.Host] = st
+	}
+	if st.blocking {
+		res.Suspect = true
+	}
+	sample := blockSample{reason: blockReason(res), length: res.Length}
+	if sample.reason == "" {
+		st.normal++
+		st.run++
+		if st.blocking && st.run >= blockWindow {
+			st.blocking = false
+			res.Unblocked = true
+			d.unblock(res)
+		}
+	} else {
+		st.run = 0
+	}
+	st.window = append(st.window, sample)
+	if len(st.window) > blockWindow {
+		st.window = st.window[1:]
+	}
+	if st.blocking || st.normal < blockMinNormal {
+		return
+	}
+	if reason := st.blocked(); reason != "" {
+		st.blocking = true
+		st.window = nil
+		res.Blocked = reason
+		res.Suspect = true
+		d.act(res, st)
+	}
+}
+
+// Describe why the window looks like blocking, or return an empty string.
+func (st *hostBlockState) blocked() string {
+	if len(st.window) < blockWindow {
+		return ""
+	}
+	counts := make(map[string]int)
+	total := 0
+	var lengths []int64
+	for _, s := range st.window {
+		if s.reason == "" {
+			continue
+		}
+		counts[s.reason]++
+		total++
+		if s.reason == "403" {
+			lengths = append(lengths, s.length)
+		}
+	}
+	if total < blockThreshold {
+		return ""
+	}
+	// Plenty of sites forbid many paths; only identical 403s look like a
+	// blanket block
+	if counts["403"] == total && !sameLength(lengths) {
+		return ""
+	}
+	common := ""
+	for reason, n := range counts {
+		if common == "" || n > counts[common] || (n == counts[common] && reason < common) {
+			common = reason
+		}
+	}
+	if common == "403" {
+		common = "identical 403 responses"
+	}
+	return fmt.Sprintf("%d of the last %d responses were blocked, mostly %s", total, len(st.window), common)
+}
+
+func sameLength(lengths []int64) bool {
+	for _, l := range lengths {
+		if l != lengths[0] {
+			return false
+		}
+	}
+	return true
+}
+
+// Take the configured action for a host that has started blocking.
+func (d *BlockDetector) act(res *results.Result, st *hostBlockState) {
+	host := res.URL.Host
+	switch {
+	case d.settings.BlockAction == ss.BlockPause && d.pause != nil:
+		logging.Logf(logging.LogWarning, "%s appears to be blocking the scan (%s), pausing for %s.",
+			host, res.Blocked, d.settings.BlockPauseTime)
+		d.pause(res.URL, d.settings.BlockPauseTime)
+	case d.settings.BlockAction == ss.BlockSlow && d.throttle != nil:
+		if st.delay == 0 {
+			st.delay = d.settings.BlockDelay
+		} else {
+			st.delay *= 2
+		}
+		if st.delay > maxBlockDelay {
+			st.delay = maxBlockDelay
+		}
+		logging.Logf(logging.LogWarning, "%s appears to be blocking the scan (%s), slowing to one request every %s.",
+			host, res.Blocked, st.delay)
+		d.throttle(res.URL, st.delay)
+	default:
+		logging.Logf(logging.LogWarning, "%s appears to be blocking the scan (%s); later results may not be reliable.",
+			host, res.Blocked)
+	}
+}
+
+// Speed a slowed host up again once it has stopped blocking.  Its delay is
+// kept, so if it starts blocking again it is slowed down further.
+func (d *BlockDetector) unblock(res *results.Result) {
+	logging.Logf(logging.LogInfo, "%s no longer appears to be blocking requests.", res.URL.Host)
+	if d.settings.BlockAction == ss.BlockSlow && d.throttle != nil {
+		d.throttle(res.URL, 0)
+	}
+}
+
+// Why a single result looks like it was blocked, or an empty string.
+func blockReason(res *results.Result) string {
+	if res.Error != nil {
+		if isConnectionReset(res.Error) {
+			return "connection resets"
+		}
+		return ""
+	}
+	if res.Challenge != "" {
+		return "challenge pages"
+	}
+	switch res.Code {
+	case 429:
+		return "rate limiting (429)"
+	case 403:
+		return "403"
+	}
+	return ""
+}
+
+// Whether err means the server dropped the connection.  Errors from agents
+// arrive as plain strings, so the message is checked as well.
+func isConnectionReset(err error) bool {
+	if errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return true
+	}
+	msg := err.Error()
+	return strings.Contains(msg, "connection reset") || strings.Contains(msg, "connection refused") ||
+		strings.HasSuffix(msg, ": EOF")
+}
@@ -0,0 +1,176 @@
+// Copyright 2017 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package worker
+
+import (
+	"errors"
+	"fmt"
+	"github.com/Matir/webborer/results"
+	ss "github.com/Matir/webborer/settings"
+	"net/url"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func blockResult(path string, code int, length int64) *results.Result {
+	return &results.Result{
+		URL:    &url.URL{Scheme: "http", Host: "example.com", Path: path},
+		Code:   code,
+		Length: length,
+	}
+}
+
+func TestBlockDetector_RateLimit(t *testing.T) {
+	var throttled []time.Duration
+	throttle := func(_ *url.URL, d time.Duration) { throttled = append(throttled, d) }
+	s := &ss.ScanSettings{BlockAction: ss.BlockSlow, BlockDelay: time.Second}
+	d := NewBlockDetector(s, nil, throttle)
+	for i := 0; i < 10; i++ {
+		d.Observe(blockResult(fmt.Sprintf("/ok%d", i), 404, 10))
+	}
+	var blocked *results.Result
+	for i := 0; i < 10; i++ {
+		res := blockResult(fmt.Sprintf("/limited%d", i), 429, 10)
+		d.Observe(res)
+		if res.Blocked != "" {
+			blocked = res
+			break
+		}
+	}
+	if blocked == nil {
+		t.Fatal("Expected run of 429s to be detected.")
+	}
+	if !strings.Contains(blocked.Blocked, "rate limiting (429)") || !blocked.Suspect {
+		t.Errorf("Unexpected blocked result: %q %v", blocked.Blocked, blocked.Suspect)
+	}
+	later := blockResult("/admin", 200, 10)
+	d.Observe(later)
+	if !later.Suspect || later.Blocked != "" {
+		t.Errorf("Expected later results to be suspect, got %v %q", later.Suspect, later.Blocked)
+	}
+	if len(throttled) != 1 || throttled[0] != time.Second {
+		t.Errorf("Expected host to be throttled once by 1s, got %v", throttled)
+	}
+
+	// Recovers after a run of ordinary responses, and backs off further if
+	// blocking happens again
+	unblocked := 0
+	for i := 0; i < blockWindow; i++ {
+		res := blockResult("/ok", 404, 10)
+		d.Observe(res)
+		if res.Unblocked {
+			unblocked++
+		}
+	}
+	if unblocked != 1 {
+		t.Errorf("Expected one result to be marked where blocking stopped, got %d", unblocked)
+	}
+	if len(throttled) != 2 || throttled[1] != 0 {
+		t.Errorf("Expected host to be sped up again, got %v", throttled)
+	}
+	fine := blockResult("/fine", 200, 10)
+	d.Observe(fine)
+	if fine.Suspect || fine.Unblocked {
+		t.Error("Expected host to recover.")
+	}
+	for i := 0; i < blockWindow; i++ {
+		d.Observe(blockResult("/limited", 429, 10))
+	}
+	if len(throttled) != 3 || throttled[2] != 2*time.Second {
+		t.Errorf("Expected host to be throttled again by 2s, got %v", throttled)
+	}
+}
+
+func TestBlockDetector_Forbidden(t *testing.T) {
+	paused := 0
+	pause := func(_ *url.URL, d time.Duration) {
+		if d != time.Minute {
+			t.Errorf("Expected pause of 1m, got %s", d)
+		}
+		paused++
+	}
+	s := &ss.ScanSettings{BlockAction: ss.BlockPause, BlockPauseTime: time.Minute}
+
+	// 403s of varying lengths are ordinary access control
+	d := NewBlockDetector(s, pause, nil)
+	for i := 0; i < 10; i++ {
+		d.Observe(blockResult("/ok", 200, 10))
+	}
+	for i := 0; i < 20; i++ {
+		res := blockResult("/forbidden", 403, int64(100+i))
+		d.Observe(res)
+		if res.Blocked != "" {
+			t.Fatalf("Expected varied 403s not to be blocking: %s", res.Blocked)
+		}
+	}
+
+	// Identical ones are a blanket block
+	d = NewBlockDetector(s, pause, nil)
+	for i := 0; i < 10; i++ {
+		d.Observe(blockResult("/ok", 200, 10))
+	}
+	detected := false
+	for i := 0; i < 20; i++ {
+		res := blockResult("/forbidden", 403, 120)
+		d.Observe(res)
+		detected = detected || strings.Contains(res.Blocked, "identical 403 responses")
+	}
+	if !detected || paused != 1 {
+		t.Errorf("Expected identical 403s to pause host once, got %v %d", detected, paused)
+	}
+}
+
+func TestBlockDetector_BlockedFromStart(t *testing.T) {
+	d := NewBlockDetector(&ss.ScanSettings{BlockAction: ss.BlockWarn}, nil, nil)
+	for i := 0; i < 20; i++ {
+		res := blockResult("/x", 429, 0)
+		d.Observe(res)
+		if res.Blocked != "" || res.Suspect {
+			t.Fatal("Expected a host blocking from the start not to be flagged.")
+		}
+	}
+}
+
+func TestBlockReason(t *testing.T) {
+	u := &url.URL{Scheme: "http", Host: "example.com", Path: "/"}
+	cases := []struct {
+		res      results.Result
+		expected string
+	}{
+		{results.Result{URL: u, Code: 200}, ""},
+		{results.Result{URL: u, Code: 404}, ""},
+		{results.Result{URL: u, Code: 429}, "rate limiting (429)"},
+		{results.Result{URL: u, Code: 403}, "403"},
+		{results.Result{URL: u, Code: 503, Challenge: "cloudflare js-challenge"}, "challenge pages"},
+		{results.Result{URL: u, Error: fmt.Errorf("read: %w", syscall.ECONNRESET)}, "connection resets"},
+		{results.Result{URL: u, Error: errors.New(`Get "http://example.com/": EOF`)}, "connection resets"},
+		{results.Result{URL: u, Error: errors.New("no such host")}, ""},
+	}
+	for _, c := range cases {
+		if got := blockReason(&c.res); got != c.expected {
+			t.Errorf("Expected %q for %d %v, got %q", c.expected, c.res.Code, c.res.Error, got)
+		}
+	}
+}
+
+func TestBlockDetectionEnabled(t *testing.T) {
+	for action, expected := range map[string]bool{"": false, ss.BlockOff: false, ss.BlockWarn: true, ss.BlockSlow: true} {
+		if BlockDetectionEnabled(&ss.ScanSettings{BlockAction: action}) != expected {
+			t.Errorf("Expected %q enabled to be %v", action, expected)
+		}
+	}
+}
@@ -0,0 +1,117 @@
+// Copyright 2017 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package worker
+
+import (
+	"bytes"
+	"github.com/Matir/webborer/logging"
+	"github.com/Matir/webborer/results"
+	ss "github.com/Matir/webborer/settings"
+	"github.com/Matir/webborer/workqueue"
+	"net/http"
+	"strings"
+)
+
+// Challenge pages are small; only the start of a response is examined.
+const maxChallengeScanSize = 64 * 1024
+
+// A challengeSignature recognizes the interstitial page served by a CDN or
+// bot-protection service in place of the requested resource.
+type challengeSignature struct {
+	// Service serving the page
+	vendor string
+	// Either "js-challenge" or "captcha"
+	kind string
+	// Header that must contain value, if set
+	header, value string
+	// Lower-case text that must appear in the body, if set
+	body string
+	// Only match blocking status codes (403, 429, 503).  Used for widgets
+	// that also appear on ordinary pages, such as login forms.
+	blockedOnly bool
+}
+
+var challengeSignatures = []challengeSignature{
+	{vendor: "cloudflare", kind: "js-challenge", header: "Cf-Mitigated", value: "challenge"},
+	{vendor: "cloudflare", kind: "js-challenge", body: "window._cf_chl_opt"},
+	{vendor: "cloudflare", kind: "js-challenge", body: "<title>just a moment...</title>"},
+	{vendor: "akamai", kind: "js-challenge", body: "/_sec/cp_challenge/"},
+	{vendor: "akamai", kind: "js-challenge", body: "bm-verify"},
+	{vendor: "sucuri", kind: "js-challenge", body: "sucuri_cloudproxy_js"},
+	{vendor: "turnstile", kind: "captcha", body: "challenges.cloudflare.com/turnstile", blockedOnly: true},
+	{vendor: "recaptcha", kind: "captcha", body: "g-recaptcha", blockedOnly: true},
+	{vendor: "hcaptcha", kind: "captcha", body: "h-captcha", blockedOnly: true},
+}
+
+// ChallengeAnalyzer recognizes JS challenge and CAPTCHA pages from services
+// such as Cloudflare and Akamai.  These pages say nothing about whether the
+// requested resource exists, so they are classified separately rather than
+// reported as findings.
+type ChallengeAnalyzer struct{}
+
+func NewChallengeAnalyzer() *ChallengeAnalyzer {
+	return &ChallengeAnalyzer{}
+}
+
+func (a *ChallengeAnalyzer) Eligible(resp *http.Response) bool {
+	return isTextResponse(resp) || resp.Header.Get("Cf-Mitigated") != ""
+}
+
+func (a *ChallengeAnalyzer) MaxSize() int64 {
+	return maxChallengeScanSize
+}
+
+func (a *ChallengeAnalyzer) Analyze(resp *http.Response, body []byte, res *results.Result) {
+	res.Challenge = findChallenge(resp, body)
+}
+
+// Describe the challenge served in resp, or return an empty string if it is
+// an ordinary response.
+func findChallenge(resp *http.Response, body []byte) string {
+	lower := bytes.ToLower(body)
+	blocked := isBlockingCode(resp.StatusCode)
+	for _, sig := range challengeSignatures {
+		if sig.blockedOnly && !blocked {
+			continue
+		}
+		if sig.header != "" && !strings.Contains(strings.ToLower(resp.Header.Get(sig.header)), sig.value) {
+			continue
+		}
+		if sig.body != "" && !bytes.Contains(lower, []byte(sig.body)) {
+			continue
+		}
+		return sig.vendor + " " + sig.kind
+	}
+	return ""
+}
+
+func isBlockingCode(code int) bool {
+	return code == http.StatusForbidden || code == http.StatusTooManyRequests || code == http.StatusServiceUnavailable
+}
+
+// Log a challenge page and, if configured, pause its host so the scan does
+// not keep collecting challenges in place of results.
+func HandleChallenge(settings *ss.ScanSettings, res *results.Result, pause workqueue.QueuePauseFunc) {
+	if res.Challenge == "" {
+		return
+	}
+	if pause == nil || settings.ChallengePause <= 0 {
+		logging.Logf(logging.LogInfo, "Challenge page (%s) served for %s.", res.Challenge, res.URL.String())
+		return
+	}
+	logging.Logf(logging.LogWarning, "Challenge page (%s) served for %s, pausing %s for %s.",
+		res.Challenge, res.URL.String(), res.URL.Host, settings.ChallengePause)
+	pause(res.URL, settings.ChallengePause)
+}
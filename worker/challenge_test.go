@@ -0,0 +1,91 @@
+// Copyright 2017 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package worker
+
+import (
+	"github.com/Matir/webborer/results"
+	ss "github.com/Matir/webborer/settings"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestFindChallenge(t *testing.T) {
+	cases := []struct {
+		code     int
+		header   http.Header
+		body     string
+		expected string
+	}{
+		{200, nil, "<html><title>Welcome</title></html>", ""},
+		{403, http.Header{"Cf-Mitigated": []string{"challenge"}}, "", "cloudflare js-challenge"},
+		{503, nil, "<html><head><title>Just a moment...</title>", "cloudflare js-challenge"},
+		{403, nil, "<script>window._cf_chl_opt={cvId: '3'}</script>", "cloudflare js-challenge"},
+		{200, nil, `<script src="/_sec/cp_challenge/ak-challenge-3-3.js"></script>`, "akamai js-challenge"},
+		{200, nil, "<script>var sucuri_cloudproxy_js='';</script>", "sucuri js-challenge"},
+		{429, nil, `<div class="g-recaptcha" data-sitekey="x"></div>`, "recaptcha captcha"},
+		// A login form with a CAPTCHA is still a finding
+		{200, nil, `<form><div class="g-recaptcha" data-sitekey="x"></div></form>`, ""},
+		{403, nil, `<div class="h-captcha"></div>`, "hcaptcha captcha"},
+	}
+	for _, c := range cases {
+		header := c.header
+		if header == nil {
+			header = http.Header{}
+		}
+		resp := &http.Response{StatusCode: c.code, Header: header}
+		if got := findChallenge(resp, []byte(c.body)); got != c.expected {
+			t.Errorf("findChallenge(%d, %q): expected %q, got %q", c.code, c.body, c.expected, got)
+		}
+	}
+}
+
+func TestChallengeAnalyzer(t *testing.T) {
+	a := NewChallengeAnalyzer()
+	resp := testResponse("http://example.com/", "image/png", http.Header{"Cf-Mitigated": []string{"challenge"}})
+	resp.StatusCode = 403
+	if !a.Eligible(resp) {
+		t.Fatal("Expected response with Cf-Mitigated to be eligible.")
+	}
+	res := &results.Result{}
+	a.Analyze(resp, nil, res)
+	if res.Challenge != "cloudflare js-challenge" {
+		t.Errorf("Expected cloudflare js-challenge, got %q", res.Challenge)
+	}
+}
+
+func TestHandleChallenge(t *testing.T) {
+	var paused *url.URL
+	var pausedFor time.Duration
+	pause := func(u *url.URL, d time.Duration) {
+		paused, pausedFor = u, d
+	}
+	u := &url.URL{Scheme: "http", Host: "example.com", Path: "/admin"}
+	settings := &ss.ScanSettings{}
+	HandleChallenge(settings, &results.Result{URL: u, Challenge: "akamai js-challenge"}, pause)
+	if paused != nil {
+		t.Errorf("Expected no pause without -challenge-pause.")
+	}
+	settings.ChallengePause = time.Minute
+	HandleChallenge(settings, &results.Result{URL: u}, pause)
+	if paused != nil {
+		t.Errorf("Expected no pause for an ordinary result.")
+	}
+	HandleChallenge(settings, &results.Result{URL: u, Challenge: "akamai js-challenge"}, pause)
+	if paused != u || pausedFor != time.Minute {
+		t.Errorf("Expected %s paused for 1m, got %v for %s", u, paused, pausedFor)
+	}
+}
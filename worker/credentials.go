@@ -0,0 +1,224 @@
+// Copyright 2017 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package worker
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"github.com/Matir/webborer/client"
+	"github.com/Matir/webborer/logging"
+	"github.com/Matir/webborer/results"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// A Credential is a username and password to try.
+type Credential struct {
+	Username string
+	Password string
+}
+
+func (c Credential) String() string {
+	return c.Username + ":" + c.Password
+}
+
+// Read credentials from a file of user:pass lines.  Blank lines and lines
+// starting with # are ignored.
+func ReadCredentialFile(path string) ([]Credential, error) {
+	fp, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer fp.Close()
+	var creds []Credential
+	scanner := bufio.NewScanner(fp)
+	for line := 1; scanner.Scan(); line++ {
+		text := scanner.Text()
+		if strings.TrimSpace(text) == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		pieces := strings.SplitN(text, ":", 2)
+		if len(pieces) != 2 {
+			return nil, fmt.Errorf("Expected user:pass on line %d of %s", line, path)
+		}
+		creds = append(creds, Credential{Username: pieces[0], Password: pieces[1]})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return creds, nil
+}
+
+// CredentialTester tries a list of credentials against each endpoint that
+// asks for HTTP Basic authentication, one attempt at a time with its own
+// delay so that it doesn't trip lockouts as fast as the scan could.  Each
+// protection space (host and realm) is tried once, stopping at the first
+// credentials that work, which are reported as a result.
+type CredentialTester struct {
+	factory client.CredentialClientFactory
+	creds   []Credential
+	delay   time.Duration
+	rchan   chan<- results.Result
+	// Protection spaces seen, and endpoints waiting to be tried
+	seen    map[string]bool
+	pending []*url.URL
+	// Set once no more endpoints will be added
+	finished bool
+	lock     sync.Mutex
+	wake     chan bool
+	done     chan bool
+}
+
+// Create a CredentialTester that sends working credentials to rchan, if
+// factory can make clients with credentials.
+func NewCredentialTester(factory client.ClientFactory, creds []Credential, delay time.Duration, rchan chan<- results.Result) *CredentialTester {
+	cf, ok := factory.(client.CredentialClientFactory)
+	if !ok {
+		logging.Logf(logging.LogWarning, "Client factory does not support -auth-wordlist.")
+		return nil
+	}
+	return &CredentialTester{
+		factory: cf,
+		creds:   creds,
+		delay:   delay,
+		rchan:   rchan,
+		seen:    make(map[string]bool),
+		wake:    make(chan bool, 1),
+		done:    make(chan bool),
+	}
+}
+
+// Queue the endpoint of res for testing, if it asked for Basic
+// authentication in a protection space not yet tried.
+func (t *CredentialTester) Observe(res *results.Result) {
+	if res.Code != 401 || res.URL == nil {
+		return
+	}
+	scheme, realm := parseChallenge(res.Authenticate)
+	if scheme != "basic" {
+		return
+	}
+	key := res.URL.Scheme + "://" + res.URL.Host + " " + realm
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if t.seen[key] || t.finished {
+		return
+	}
+	t.seen[key] = true
+	t.pending = append(t.pending, res.URL)
+	select {
+	case t.wake <- true:
+	default:
+	}
+}
+
+// The lowercased scheme of a WWW-Authenticate challenge and its realm.
+func parseChallenge(challenge string) (string, string) {
+	pieces := strings.SplitN(strings.TrimSpace(challenge), " ", 2)
+	scheme := strings.ToLower(pieces[0])
+	if len(pieces) < 2 {
+		return scheme, ""
+	}
+	for _, param := range strings.Split(pieces[1], ",") {
+		kv := strings.SplitN(strings.TrimSpace(param), "=", 2)
+		if len(kv) == 2 && strings.ToLower(kv[0]) == "realm" {
+			return scheme, strings.Trim(kv[1], `"`)
+		}
+	}
+	return scheme, ""
+}
+
+// Test endpoints as they are queued, until Finish is called and they have
+// all been tried, or ctx is cancelled.
+func (t *CredentialTester) Run(ctx context.Context) {
+	go func() {
+		defer close(t.done)
+		for {
+			t.lock.Lock()
+			var next *url.URL
+			if len(t.pending) > 0 {
+				next, t.pending = t.pending[0], t.pending[1:]
+			}
+			finished := t.finished
+			t.lock.Unlock()
+			if next != nil {
+				t.test(ctx, next)
+				continue
+			}
+			if finished {
+				return
+			}
+			select {
+			case <-t.wake:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// Stop accepting endpoints and wait until those queued have been tried.
+func (t *CredentialTester) Finish() {
+	t.lock.Lock()
+	t.finished = true
+	t.lock.Unlock()
+	select {
+	case t.wake <- true:
+	default:
+	}
+	<-t.done
+}
+
+func (t *CredentialTester) test(ctx context.Context, u *url.URL) {
+	logging.Logf(logging.LogInfo, "Trying %d credentials against %s", len(t.creds), u.String())
+	for i, cred := range t.creds {
+		if i > 0 && t.delay > 0 {
+			select {
+			case <-time.After(t.delay):
+			case <-ctx.Done():
+			}
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		resp, err := t.factory.GetWithCredentials(cred.Username, cred.Password).RequestURLContext(ctx, u)
+		if err != nil {
+			logging.Logf(logging.LogInfo, "Error trying credentials against %s: %s", u.String(), err.Error())
+			continue
+		}
+		resp.Body.Close()
+		if resp.StatusCode == 429 || resp.StatusCode == 503 {
+			logging.Logf(logging.LogWarning, "Stopped trying credentials against %s after status %d", u.String(), resp.StatusCode)
+			return
+		}
+		// Only success or a redirect means the credentials were accepted
+		if resp.StatusCode < 200 || resp.StatusCode >= 400 {
+			continue
+		}
+		logging.Logf(logging.LogWarning, "Credentials %s work for %s", cred.String(), u.String())
+		t.rchan <- results.Result{
+			URL:         u,
+			Code:        resp.StatusCode,
+			Length:      resp.ContentLength,
+			ContentType: resp.Header.Get("Content-Type"),
+			Credentials: cred.String(),
+		}
+		return
+	}
+}
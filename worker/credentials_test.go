@@ -0,0 +1,169 @@
+// Copyright 2017 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package worker
+
+import (
+	"context"
+	"github.com/Matir/webborer/client"
+	"github.com/Matir/webborer/results"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestReadCredentialFile(t *testing.T) {
+	fp, err := ioutil.TempFile("", "creds")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(fp.Name())
+	fp.WriteString("# defaults\nadmin:admin\n\nroot:pass:word\nguest:\n")
+	fp.Close()
+	creds, err := ReadCredentialFile(fp.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []Credential{{"admin", "admin"}, {"root", "pass:word"}, {"guest", ""}}
+	if !reflect.DeepEqual(creds, expected) {
+		t.Errorf("Expected %v, got %v", expected, creds)
+	}
+
+	bad, _ := ioutil.TempFile("", "creds")
+	defer os.Remove(bad.Name())
+	bad.WriteString("admin\n")
+	bad.Close()
+	if _, err := ReadCredentialFile(bad.Name()); err == nil {
+		t.Error("Expected error for line without a colon.")
+	}
+}
+
+func TestParseChallenge(t *testing.T) {
+	cases := []struct {
+		challenge, scheme, realm string
+	}{
+		{`Basic realm="Admin area"`, "basic", "Admin area"},
+		{`basic charset="UTF-8", realm="x"`, "basic", "x"},
+		{`Bearer`, "bearer", ""},
+		{``, "", ""},
+	}
+	for _, c := range cases {
+		scheme, realm := parseChallenge(c.challenge)
+		if scheme != c.scheme || realm != c.realm {
+			t.Errorf("%q: expected %q %q, got %q %q", c.challenge, c.scheme, c.realm, scheme, realm)
+		}
+	}
+}
+
+func TestCredentialTester(t *testing.T) {
+	attempts := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, pass, ok := r.BasicAuth()
+		if ok {
+			attempts++
+		}
+		if !ok || user != "admin" || pass != "secret" {
+			w.Header().Set("WWW-Authenticate", `Basic realm="test"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte("welcome"))
+	}))
+	defer server.Close()
+	factory, err := client.NewProxyClientFactory(nil, 5*time.Second, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	creds := []Credential{{"admin", "admin"}, {"admin", "secret"}, {"root", "root"}}
+	rchan := make(chan results.Result, 10)
+	tester := NewCredentialTester(factory, creds, time.Millisecond, rchan)
+	tester.Run(context.Background())
+	base, _ := url.Parse(server.URL)
+	challenge := func(path, authenticate string) *results.Result {
+		return &results.Result{URL: base.ResolveReference(&url.URL{Path: path}), Code: 401, Authenticate: authenticate}
+	}
+	tester.Observe(challenge("/admin/", `Basic realm="test"`))
+	// Same protection space, not tried again
+	tester.Observe(challenge("/admin/users", `Basic realm="test"`))
+	// Not Basic
+	tester.Observe(challenge("/api/", `Bearer realm="test"`))
+	tester.Finish()
+	close(rchan)
+
+	var found []results.Result
+	for r := range rchan {
+		found = append(found, r)
+	}
+	if len(found) != 1 {
+		t.Fatalf("Expected 1 result, got %v", found)
+	}
+	if found[0].Credentials != "admin:secret" || found[0].Code != 200 || found[0].URL.Path != "/admin/" {
+		t.Errorf("Unexpected result %v", found[0])
+	}
+	if attempts != 2 {
+		t.Errorf("Expected to stop after 2 attempts, made %d", attempts)
+	}
+}
+
+func TestCredentialTester_Status(t *testing.T) {
+	cases := []struct {
+		code, attempts int
+	}{
+		// Forbidden isn't success, so every credential is tried
+		{403, 3},
+		// Rate limited, so give up on the endpoint
+		{429, 1},
+	}
+	for _, c := range cases {
+		attempts := 0
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			attempts++
+			w.WriteHeader(c.code)
+		}))
+		factory, err := client.NewProxyClientFactory(nil, 5*time.Second, "test")
+		if err != nil {
+			t.Fatal(err)
+		}
+		creds := []Credential{{"admin", "admin"}, {"admin", "secret"}, {"root", "root"}}
+		rchan := make(chan results.Result, 10)
+		tester := NewCredentialTester(factory, creds, time.Millisecond, rchan)
+		tester.Run(context.Background())
+		base, _ := url.Parse(server.URL)
+		tester.Observe(&results.Result{URL: base.ResolveReference(&url.URL{Path: "/admin/"}), Code: 401, Authenticate: `Basic realm="test"`})
+		tester.Finish()
+		server.Close()
+		close(rchan)
+		for r := range rchan {
+			t.Errorf("%d: unexpected result %v", c.code, r)
+		}
+		if attempts != c.attempts {
+			t.Errorf("%d: expected %d attempts, made %d", c.code, c.attempts, attempts)
+		}
+	}
+}
+
+type noCredentialFactory struct{}
+
+func (noCredentialFactory) Get() client.Client { return nil }
+
+func TestNewCredentialTester_Unsupported(t *testing.T) {
+	if NewCredentialTester(noCredentialFactory{}, nil, 0, nil) != nil {
+		t.Error("Expected nil tester for factory without credential support.")
+	}
+}
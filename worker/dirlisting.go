@@ -0,0 +1,145 @@
+// Copyright 2017 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package worker
+
+import (
+	"bytes"
+	"github.com/Matir/webborer/logging"
+	"github.com/Matir/webborer/results"
+	"github.com/Matir/webborer/util"
+	"github.com/Matir/webborer/workqueue"
+	"golang.org/x/net/html"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// DirListings finds open directory listings, as served by Apache, nginx, IIS
+// and others, and harvests them: each file listed is reported as a finding
+// without being requested, and each subdirectory is added to the scan so its
+// listing is harvested in turn.  Listed files that are queued later, e.g.
+// from the wordlist, are skipped.  One DirListings is shared by the workers
+// of a scan.
+type DirListings struct {
+	adder workqueue.QueueAddFunc
+	rchan chan<- results.Result
+	lock  sync.Mutex
+	// URLs of files already reported from a listing
+	listed map[string]bool
+}
+
+func NewDirListings(adder workqueue.QueueAddFunc, rchan chan<- results.Result) *DirListings {
+	return &DirListings{adder: adder, rchan: rchan, listed: make(map[string]bool)}
+}
+
+// Titles and text of directory listing pages: Apache, nginx and lighttpd
+// ("Index of /dir"), Python's http.server ("Directory listing for /dir") and
+// IIS ("[To Parent Directory]").
+var dirListingRE = regexp.MustCompile(`(?i)<title>\s*(index of|directory listing for) /|\[to parent directory\]`)
+
+func (d *DirListings) Eligible(resp *http.Response) bool {
+	return resp.StatusCode == http.StatusOK && util.MediaType(resp.Header.Get("Content-Type")) == "text/html"
+}
+
+func (d *DirListings) MaxSize() int64 {
+	return maxHTMLWorkerSize
+}
+
+func (d *DirListings) Analyze(resp *http.Response, body []byte, result *results.Result) {
+	if result.URL == nil || !dirListingRE.Match(body) {
+		return
+	}
+	dir := *result.URL
+	if resp.Request != nil && resp.Request.URL != nil {
+		// Entries are relative to where any redirect ended up
+		dir = *resp.Request.URL
+	}
+	if !strings.HasSuffix(dir.Path, "/") {
+		dir.Path += "/"
+	}
+	dir.RawQuery, dir.Fragment = "", ""
+	files, subdirs := listingEntries(&dir, body)
+	result.DirListing = len(files) + len(subdirs)
+	logging.Logf(logging.LogInfo, "Directory listing at %s with %d entries.", dir.String(), result.DirListing)
+	d.adder(subdirs...)
+	for _, u := range files {
+		if !d.markListed(u) {
+			continue
+		}
+		d.rchan <- results.Result{
+			URL:      u,
+			Code:     http.StatusOK,
+			Length:   -1,
+			ListedIn: dir.String(),
+		}
+	}
+}
+
+// Record that u was reported from a listing, returning false if it already
+// was.
+func (d *DirListings) markListed(u *url.URL) bool {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	key := u.String()
+	if d.listed[key] {
+		return false
+	}
+	d.listed[key] = true
+	return true
+}
+
+// Skip files that were already reported from a listing.
+func (d *DirListings) BeforeRequest(task *url.URL) bool {
+	clone := *task
+	clone.RawQuery, clone.Fragment = "", ""
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	return !d.listed[clone.String()]
+}
+
+// The files and subdirectories linked from a listing of dir.  Links that
+// aren't directly inside dir, such as the parent directory and the links
+// that sort the listing, are left out.
+func listingEntries(dir *url.URL, body []byte) (files, subdirs []*url.URL) {
+	tree, err := html.Parse(bytes.NewReader(body))
+	if err != nil {
+		return nil, nil
+	}
+	seen := make(map[string]bool)
+	for _, href := range collectElementAttributes(tree, "a", "href") {
+		ref, err := url.Parse(href)
+		if err != nil || ref.Path == "" {
+			continue
+		}
+		u := dir.ResolveReference(ref)
+		u.RawQuery, u.Fragment = "", ""
+		if u.Scheme != dir.Scheme || u.Host != dir.Host || !strings.HasPrefix(u.Path, dir.Path) {
+			continue
+		}
+		name := strings.TrimSuffix(u.Path[len(dir.Path):], "/")
+		if name == "" || strings.Contains(name, "/") || seen[u.String()] {
+			continue
+		}
+		seen[u.String()] = true
+		if strings.HasSuffix(u.Path, "/") {
+			subdirs = append(subdirs, u)
+		} else {
+			files = append(files, u)
+		}
+	}
+	return files, subdirs
+}
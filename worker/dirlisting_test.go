@@ -0,0 +1,113 @@
+// Copyright 2017 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package worker
+
+import (
+	"github.com/Matir/webborer/results"
+	"net/http"
+	"net/url"
+	"reflect"
+	"testing"
+)
+
+var apacheListing = `<!DOCTYPE HTML PUBLIC "-//W3C//DTD HTML 3.2 Final//EN">
+<html><head><title>Index of /files</title></head><body><h1>Index of /files</h1>
+<table><tr><th><a href="?C=N;O=D">Name</a></th><th><a href="?C=M;O=A">Last modified</a></th></tr>
+<tr><td><a href="/">Parent Directory</a></td></tr>
+<tr><td><a href="backup.sql">backup.sql</a></td></tr>
+<tr><td><a href="old/">old/</a></td></tr>
+<tr><td><a href="notes%20v2.txt">notes v2.txt</a></td></tr>
+<tr><td><a href="http://elsewhere.example.org/files/x">x</a></td></tr>
+</table></body></html>`
+
+var iisListing = `<html><head><title>www.example.com - /files/</title></head><body><H1>www.example.com - /files/</H1><hr>
+<pre><A HREF="/">[To Parent Directory]</A><br><br> 1/1/2017 12:00 AM        &lt;dir&gt; <A HREF="/files/old/">old</A><br> 1/1/2017 12:00 AM 1234 <A HREF="/files/backup.sql">backup.sql</A><br></pre><hr></body></html>`
+
+func TestListingEntries(t *testing.T) {
+	dir, _ := url.Parse("http://www.example.com/files/")
+	for name, body := range map[string]string{"apache": apacheListing, "iis": iisListing} {
+		files, subdirs := listingEntries(dir, []byte(body))
+		got := make([]string, 0)
+		for _, u := range files {
+			got = append(got, u.Path)
+		}
+		expected := []string{"/files/backup.sql"}
+		if name == "apache" {
+			expected = append(expected, "/files/notes v2.txt")
+		}
+		if !reflect.DeepEqual(got, expected) {
+			t.Errorf("%s: expected files %v, got %v", name, expected, got)
+		}
+		if len(subdirs) != 1 || subdirs[0].String() != "http://www.example.com/files/old/" {
+			t.Errorf("%s: expected old/ as only subdirectory, got %v", name, subdirs)
+		}
+	}
+}
+
+func TestDirListings_Analyze(t *testing.T) {
+	added := make([]string, 0)
+	adder := func(f ...*url.URL) {
+		for _, u := range f {
+			added = append(added, u.String())
+		}
+	}
+	rchan := make(chan results.Result, 10)
+	l := NewDirListings(adder, rchan)
+	u, _ := url.Parse("http://www.example.com/files/")
+	resp := &http.Response{StatusCode: 200, Header: make(http.Header)}
+	resp.Header.Set("Content-Type", "text/html; charset=utf-8")
+	if !l.Eligible(resp) {
+		t.Fatal("Expected HTML response to be eligible")
+	}
+	result := &results.Result{URL: u, Code: 200}
+	l.Analyze(resp, []byte(apacheListing), result)
+	if result.DirListing != 3 {
+		t.Errorf("Expected 3 entries, got %d", result.DirListing)
+	}
+	if !reflect.DeepEqual(added, []string{"http://www.example.com/files/old/"}) {
+		t.Errorf("Expected subdirectory to be added, got %v", added)
+	}
+	if len(rchan) != 2 {
+		t.Fatalf("Expected 2 listed files, got %d", len(rchan))
+	}
+	r := <-rchan
+	if r.URL.Path != "/files/backup.sql" || r.ListedIn != "http://www.example.com/files/" || r.Code != 200 {
+		t.Errorf("Unexpected listed result: %+v", r)
+	}
+	listed, _ := url.Parse("http://www.example.com/files/backup.sql#top")
+	if l.BeforeRequest(listed) {
+		t.Error("Expected listed file to be skipped")
+	}
+	if !l.BeforeRequest(u) {
+		t.Error("Expected listing itself to be requested")
+	}
+
+	// Listing the same files again doesn't report them twice
+	l.Analyze(resp, []byte(apacheListing), &results.Result{URL: u, Code: 200})
+	if len(rchan) != 1 {
+		t.Errorf("Expected files to be reported once, got %d more", len(rchan)+1)
+	}
+}
+
+func TestDirListings_NotListing(t *testing.T) {
+	rchan := make(chan results.Result, 10)
+	l := NewDirListings(func(...*url.URL) {}, rchan)
+	u, _ := url.Parse("http://www.example.com/files/")
+	result := &results.Result{URL: u, Code: 200}
+	l.Analyze(&http.Response{StatusCode: 200}, []byte(`<html><title>Files</title><a href="a.txt">a</a></html>`), result)
+	if result.DirListing != 0 || len(rchan) != 0 {
+		t.Errorf("Expected ordinary page not to be a listing, got %d entries", result.DirListing)
+	}
+}
@@ -0,0 +1,86 @@
+// Copyright 2017 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package worker
+
+import (
+	"github.com/Matir/webborer/results"
+	"net/http"
+	"strings"
+)
+
+// Headers that name the server behind a proxy or load balancer
+var backendHeaders = []string{"X-Backend-Server", "X-Backend-Host"}
+
+// Headers that advertise the framework and its version
+var poweredByHeaders = []string{"X-Powered-By", "X-AspNet-Version", "X-AspNetMvc-Version"}
+
+// HeaderAnalyzer notes security-relevant response headers: missing HSTS and
+// CSP, banners giving away server and framework versions, backend server
+// names, and CORS open to any origin.  It never needs the body, so all of its
+// work is done in CheckHeaders.
+type HeaderAnalyzer struct{}
+
+func NewHeaderAnalyzer() *HeaderAnalyzer {
+	return &HeaderAnalyzer{}
+}
+
+func (a *HeaderAnalyzer) Eligible(resp *http.Response) bool {
+	return false
+}
+
+func (a *HeaderAnalyzer) MaxSize() int64 {
+	return 0
+}
+
+func (a *HeaderAnalyzer) Analyze(resp *http.Response, _ []byte, res *results.Result) {
+	a.CheckHeaders(resp, res)
+}
+
+func (a *HeaderAnalyzer) CheckHeaders(resp *http.Response, res *results.Result) {
+	res.HeaderIssues = headerIssues(resp)
+}
+
+func headerIssues(resp *http.Response) []string {
+	var issues []string
+	h := resp.Header
+	if resp.Request != nil && resp.Request.URL.Scheme == "https" && h.Get("Strict-Transport-Security") == "" {
+		issues = append(issues, "missing Strict-Transport-Security")
+	}
+	if isHTMLResponse(resp) && h.Get("Content-Security-Policy") == "" {
+		issues = append(issues, "missing Content-Security-Policy")
+	}
+	// A bare product name is harmless; a version helps pick exploits
+	if server := h.Get("Server"); strings.ContainsAny(server, "0123456789") {
+		issues = append(issues, "verbose Server: "+server)
+	}
+	for _, name := range poweredByHeaders {
+		if v := h.Get(name); v != "" {
+			issues = append(issues, "verbose "+name+": "+v)
+		}
+	}
+	for _, name := range backendHeaders {
+		if v := h.Get(name); v != "" {
+			issues = append(issues, "backend leaked by "+name+": "+v)
+		}
+	}
+	if h.Get("Access-Control-Allow-Origin") == "*" {
+		issues = append(issues, "CORS allows any origin")
+	}
+	return issues
+}
+
+func isHTMLResponse(resp *http.Response) bool {
+	return strings.HasPrefix(strings.ToLower(resp.Header.Get("Content-Type")), "text/html")
+}
@@ -0,0 +1,71 @@
+// Copyright 2017 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package worker
+
+import (
+	"github.com/Matir/webborer/results"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestHeaderIssues(t *testing.T) {
+	cases := []struct {
+		scheme   string
+		ctype    string
+		header   http.Header
+		expected []string
+	}{
+		{"http", "image/png", http.Header{"Server": {"nginx"}}, nil},
+		{"https", "image/png", http.Header{"Strict-Transport-Security": {"max-age=31536000"}}, nil},
+		{"https", "image/png", http.Header{}, []string{"missing Strict-Transport-Security"}},
+		{"http", "text/html; charset=utf-8", http.Header{}, []string{"missing Content-Security-Policy"}},
+		{"http", "text/html", http.Header{"Content-Security-Policy": {"default-src 'self'"}}, nil},
+		{"http", "text/plain", http.Header{"Server": {"Apache/2.4.29 (Ubuntu)"}}, []string{"verbose Server: Apache/2.4.29 (Ubuntu)"}},
+		{"http", "text/plain", http.Header{"X-Powered-By": {"PHP/7.2.1"}, "X-Aspnet-Version": {"4.0.30319"}},
+			[]string{"verbose X-Powered-By: PHP/7.2.1", "verbose X-AspNet-Version: 4.0.30319"}},
+		{"http", "text/plain", http.Header{"X-Backend-Server": {"web03"}}, []string{"backend leaked by X-Backend-Server: web03"}},
+		{"http", "application/json", http.Header{"Access-Control-Allow-Origin": {"*"}}, []string{"CORS allows any origin"}},
+		{"http", "application/json", http.Header{"Access-Control-Allow-Origin": {"https://example.com"}}, nil},
+	}
+	for i, c := range cases {
+		issues := headerIssues(testResponse(c.scheme+"://example.com/", c.ctype, c.header))
+		if !reflect.DeepEqual(issues, c.expected) {
+			t.Errorf("Case %d: expected %v, got %v", i, c.expected, issues)
+		}
+	}
+}
+
+func TestHeaderAnalyzer(t *testing.T) {
+	a := NewHeaderAnalyzer()
+	resp := testResponse("http://example.com/", "image/png", http.Header{})
+	res := &results.Result{}
+	if a.CheckHeaders(resp, res); len(res.HeaderIssues) != 0 {
+		t.Errorf("Expected no issues, got %v", res.HeaderIssues)
+	}
+	resp = testResponse("https://example.com/", "text/html", http.Header{"X-Powered-By": {"Express"}})
+	if a.Eligible(resp) {
+		t.Fatal("Expected the body never to be needed.")
+	}
+	a.CheckHeaders(resp, res)
+	expected := []string{
+		"missing Strict-Transport-Security",
+		"missing Content-Security-Policy",
+		"verbose X-Powered-By: Express",
+	}
+	if !reflect.DeepEqual(res.HeaderIssues, expected) {
+		t.Errorf("Expected %v, got %v", expected, res.HeaderIssues)
+	}
+}
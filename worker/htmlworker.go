@@ -62,7 +62,7 @@ func (w *HTMLWorker) Handle(URL *url.URL, body io.Reader) {
 // Check if this response can be handled by this worker
 func (*HTMLWorker) Eligible(resp *http.Response) bool {
 	ct := resp.Header.Get("Content-type")
-	if strings.ToLower(ct) != "text/html" {
+	if util.MediaType(ct) != "text/html" {
 		return false
 	}
 	// ContentLength is often -1, indicating unknown, so we'll try to parse those
@@ -0,0 +1,161 @@
+// Copyright 2017 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package worker
+
+import (
+	"github.com/Matir/webborer/logging"
+	"github.com/Matir/webborer/util"
+	"github.com/Matir/webborer/workqueue"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+const (
+	maxJSWorkerSize = 10 * 1024 * 1024
+)
+
+// JSWorker finds paths and API routes in JavaScript, where single page apps
+// keep most of the URLs they use, and adds them to the scan.  Anything out of
+// scope is dropped by the queue.
+type JSWorker struct {
+	// Function to add future work
+	adder workqueue.QueueAddFunc
+}
+
+func NewJSWorker(adder workqueue.QueueAddFunc) *JSWorker {
+	return &JSWorker{adder: adder}
+}
+
+var jsMediaTypes = map[string]bool{
+	"application/javascript":   true,
+	"application/x-javascript": true,
+	"application/ecmascript":   true,
+	"text/javascript":          true,
+	"text/ecmascript":          true,
+}
+
+// Check if this response can be handled by this worker: a JavaScript type, or
+// a .js file served as something generic.
+func (*JSWorker) Eligible(resp *http.Response) bool {
+	mt := util.MediaType(resp.Header.Get("Content-Type"))
+	if !jsMediaTypes[mt] {
+		if mt != "" && mt != "text/plain" && mt != "application/octet-stream" {
+			return false
+		}
+		if resp.Request == nil || !(strings.HasSuffix(resp.Request.URL.Path, ".js") || strings.HasSuffix(resp.Request.URL.Path, ".mjs")) {
+			return false
+		}
+	}
+	return resp.ContentLength == -1 || (resp.ContentLength > 0 && resp.ContentLength < maxJSWorkerSize)
+}
+
+// Work on this response
+func (w *JSWorker) Handle(URL *url.URL, body io.Reader) {
+	buf, err := ioutil.ReadAll(io.LimitReader(body, maxJSWorkerSize))
+	if err != nil {
+		logging.Logf(logging.LogInfo, "Error reading JavaScript %s: %s", URL.String(), err.Error())
+	}
+	paths := GetJSPaths(string(buf))
+	foundURLs := make([]*url.URL, 0, len(paths))
+	for _, p := range paths {
+		u, err := url.Parse(p)
+		if err != nil {
+			continue
+		}
+		// Relative paths could be relative to the page that loads the script
+		// instead, but the script is all there is to go on.
+		resolved := URL.ResolveReference(u)
+		foundURLs = append(foundURLs, resolved)
+		foundURLs = append(foundURLs, util.GetParentPaths(resolved)...)
+	}
+	logging.Debugf("Found %d paths in %s.", len(paths), URL.String())
+	w.adder(foundURLs...)
+}
+
+var (
+	jsStringRE    = regexp.MustCompile("\"([^\"\\\\\\n]{1,512})\"|'([^'\\\\\\n]{1,512})'|`([^`\\\\]{1,512})`")
+	jsSourceMapRE = regexp.MustCompile(`[#@]\s*sourceMappingURL=([^\s'"*]+)`)
+)
+
+// Top-level media types, so that strings like "application/json" aren't
+// taken for paths.
+var mediaTypePrefixes = []string{"application/", "audio/", "font/", "image/", "message/", "model/", "multipart/", "text/", "video/"}
+
+// Get the path-like strings in a script: absolute and relative paths, URLs
+// and the source map, if any.
+func GetJSPaths(script string) []string {
+	paths := make([]string, 0)
+	for _, m := range jsStringRE.FindAllStringSubmatch(script, -1) {
+		s := m[1] + m[2] + m[3]
+		if p, ok := jsPath(s); ok {
+			paths = append(paths, p)
+		}
+	}
+	for _, m := range jsSourceMapRE.FindAllStringSubmatch(script, -1) {
+		if !strings.HasPrefix(m[1], "data:") {
+			paths = append(paths, m[1])
+		}
+	}
+	return util.DedupeStrings(paths)
+}
+
+// Check whether a string literal looks like a path, returning the part to
+// request.  Template literals are cut at the first substitution, so
+// `/api/users/${id}` gives /api/users/.
+func jsPath(s string) (string, bool) {
+	if i := strings.Index(s, "${"); i != -1 {
+		s = s[:i]
+	}
+	if s == "" || strings.ContainsAny(s, " \t\r\n<>()[]{}|^*!,;\\\"'`") {
+		return "", false
+	}
+	lower := strings.ToLower(s)
+	switch {
+	case strings.HasPrefix(lower, "http://") || strings.HasPrefix(lower, "https://"):
+		return s, len(s) > len("https://")
+	case strings.HasPrefix(s, "//"):
+		return s, len(s) > 2 && isPathChar(s[2])
+	case strings.Contains(s, ":"):
+		// data:, javascript:, mailto: and the like
+		return "", false
+	case strings.HasPrefix(s, "./") || strings.HasPrefix(s, "../"):
+		return s, true
+	case strings.HasPrefix(s, "/"):
+		return s, len(s) > 1 && isPathChar(s[1])
+	}
+	// A relative path needs a directory, e.g. api/v1/users, and must not be
+	// a media type or a date
+	if !strings.Contains(s, "/") || !isLetter(s[0]) {
+		return "", false
+	}
+	for _, prefix := range mediaTypePrefixes {
+		if strings.HasPrefix(lower, prefix) {
+			return "", false
+		}
+	}
+	return s, true
+}
+
+func isLetter(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isPathChar(c byte) bool {
+	return isLetter(c) || (c >= '0' && c <= '9') || c == '_' || c == '-' || c == '.' || c == '~'
+}
@@ -0,0 +1,115 @@
+// Copyright 2017 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package worker
+
+import (
+	"net/http"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+var smallJSDoc = "fetch(\"/api/v1/users\").then(r => r.json());\n" +
+	"const t = 'application/json', d = '12/31/2024', s = 'hello world';\n" +
+	"axios.get(`/api/orders/${id}/items`);\n" +
+	"var u = \"https://cdn.example.org/lib.js\", m = 'data:image/png;base64,AAAA';\n" +
+	"import x from './chunk.js';\n" +
+	"route('admin/settings');\n" +
+	"//# sourceMappingURL=app.js.map\n"
+
+func TestGetJSPaths(t *testing.T) {
+	expected := []string{
+		"/api/v1/users",
+		"/api/orders/",
+		"https://cdn.example.org/lib.js",
+		"./chunk.js",
+		"admin/settings",
+		"app.js.map",
+	}
+	if got := GetJSPaths(smallJSDoc); !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected %v, got %v", expected, got)
+	}
+}
+
+func TestJSPath(t *testing.T) {
+	cases := map[string]bool{
+		"/login":           true,
+		"//cdn.host/x.js":  true,
+		"../up/there":      true,
+		"api/v2":           true,
+		"/":                false,
+		"/^\\d+$/":         false,
+		"text/html":        false,
+		"12/31/2024":       false,
+		"javascript:void":  false,
+		"no slash":         false,
+		"plainword":        false,
+		"mailto:a@b.c":     false,
+		"http://":          false,
+		"https://host/api": true,
+	}
+	for s, want := range cases {
+		if _, got := jsPath(s); got != want {
+			t.Errorf("jsPath(%q): expected %v, got %v", s, want, got)
+		}
+	}
+}
+
+func TestJSWorker_Handle(t *testing.T) {
+	found := make([]string, 0)
+	adder := func(f ...*url.URL) {
+		for _, u := range f {
+			found = append(found, u.String())
+		}
+	}
+	base, _ := url.Parse("http://www.example.com/static/app.js")
+	NewJSWorker(adder).Handle(base, strings.NewReader(`fetch("/api/v1/users"); load("chunks/a.js");`))
+	expected := []string{
+		"http://www.example.com/api/v1/users",
+		"http://www.example.com/api",
+		"http://www.example.com/api/v1",
+		"http://www.example.com/static/chunks/a.js",
+		"http://www.example.com/static",
+		"http://www.example.com/static/chunks",
+	}
+	if !reflect.DeepEqual(found, expected) {
+		t.Errorf("Expected %v, got %v", expected, found)
+	}
+}
+
+func TestJSWorker_Eligible(t *testing.T) {
+	w := &JSWorker{}
+	resp := func(ctype, path string) *http.Response {
+		u, _ := url.Parse("http://localhost" + path)
+		r := &http.Response{Header: make(http.Header), ContentLength: -1, Request: &http.Request{URL: u}}
+		if ctype != "" {
+			r.Header.Set("Content-Type", ctype)
+		}
+		return r
+	}
+	if !w.Eligible(resp("application/javascript; charset=utf-8", "/app")) {
+		t.Errorf("Expected JavaScript type to be eligible.")
+	}
+	if !w.Eligible(resp("text/plain", "/app.js")) {
+		t.Errorf("Expected .js served as text/plain to be eligible.")
+	}
+	if w.Eligible(resp("text/html", "/app.js")) {
+		t.Errorf("Expected HTML not to be eligible.")
+	}
+	if w.Eligible(resp("", "/index")) {
+		t.Errorf("Expected untyped non-.js file not to be eligible.")
+	}
+}
@@ -0,0 +1,179 @@
+// Copyright 2017 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package worker
+
+import (
+	"fmt"
+	"github.com/Matir/webborer/results"
+	"net"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+const (
+	// Only the first part of a response is searched for leaks
+	maxLeakScanSize = 1024 * 1024
+	// Stop reporting after this many leaks in one response
+	maxLeaksPerResult = 20
+)
+
+var (
+	ipv4Pattern = regexp.MustCompile(`\b\d{1,3}(?:\.\d{1,3}){3}\b`)
+	// Hostnames under suffixes that are only meaningful inside a network.  The
+	// hostname must not be part of a longer dotted name or path (e.g.
+	// settings.local.php) to cut down on false positives.
+	internalHostPattern = regexp.MustCompile(`(?i)(?:^|[^\w./-]|//)((?:[a-z0-9](?:[a-z0-9-]{0,61}[a-z0-9])?\.)+(?:internal|local|localdomain|corp|lan|intranet|private|home\.arpa))(?:[^\w.-]|$)`)
+	// Well-known names of cloud metadata services
+	metadataHosts = []string{
+		"metadata.google.internal",
+		"metadata.azure.com",
+		"instance-data.ec2.internal",
+		"fd00:ec2::254",
+	}
+	privateNets = mustParseCIDRs(
+		"10.0.0.0/8",
+		"172.16.0.0/12",
+		"192.168.0.0/16",
+		"100.64.0.0/10",
+		"169.254.0.0/16",
+	)
+	metadataIP = net.ParseIP("169.254.169.254")
+)
+
+// LeakAnalyzer looks for infrastructure details leaking from the scanned
+// server: private IP addresses, internal hostnames, and cloud metadata
+// service addresses in response headers and bodies.
+type LeakAnalyzer struct{}
+
+func NewLeakAnalyzer() *LeakAnalyzer {
+	return &LeakAnalyzer{}
+}
+
+// The bodies of text responses are searched along with the headers.  Only
+// the headers of other responses are, by CheckHeaders.
+func (a *LeakAnalyzer) Eligible(resp *http.Response) bool {
+	return isTextResponse(resp)
+}
+
+func (a *LeakAnalyzer) MaxSize() int64 {
+	return maxLeakScanSize
+}
+
+func (a *LeakAnalyzer) Analyze(resp *http.Response, body []byte, res *results.Result) {
+	res.Leaks = findLeaks(headerText(resp)+"\n"+string(body), targetHost(resp))
+}
+
+func (a *LeakAnalyzer) CheckHeaders(resp *http.Response, res *results.Result) {
+	res.Leaks = findLeaks(headerText(resp), targetHost(resp))
+}
+
+// Find leaks in text, ignoring references to the target itself.  Each leak
+// is described by the leaked value and what kind of value it is.
+func findLeaks(text, target string) []string {
+	seen := make(map[string]bool)
+	leaks := make([]string, 0)
+	add := func(value, kind string) {
+		key := strings.ToLower(value)
+		if seen[key] || key == target || len(leaks) >= maxLeaksPerResult {
+			return
+		}
+		seen[key] = true
+		leaks = append(leaks, fmt.Sprintf("%s (%s)", value, kind))
+	}
+	lower := strings.ToLower(text)
+	for _, host := range metadataHosts {
+		if strings.Contains(lower, host) {
+			add(host, "cloud metadata")
+		}
+	}
+	for _, m := range ipv4Pattern.FindAllString(text, -1) {
+		ip := net.ParseIP(m)
+		if ip == nil {
+			continue
+		}
+		if ip.Equal(metadataIP) {
+			add(m, "cloud metadata")
+			continue
+		}
+		for _, n := range privateNets {
+			if n.Contains(ip) {
+				add(m, "private IP")
+				break
+			}
+		}
+	}
+	for _, m := range internalHostPattern.FindAllStringSubmatch(text, -1) {
+		if !seen[strings.ToLower(m[1])] {
+			add(m[1], "internal hostname")
+		}
+	}
+	if len(leaks) == 0 {
+		return nil
+	}
+	return leaks
+}
+
+func isTextResponse(resp *http.Response) bool {
+	ctype := resp.Header.Get("Content-Type")
+	if ctype == "" {
+		return true
+	}
+	ctype = strings.ToLower(ctype)
+	if strings.HasPrefix(ctype, "text/") {
+		return true
+	}
+	for _, t := range []string{"json", "xml", "javascript", "yaml"} {
+		if strings.Contains(ctype, t) {
+			return true
+		}
+	}
+	return false
+}
+
+func headerText(resp *http.Response) string {
+	keys := make([]string, 0, len(resp.Header))
+	for k := range resp.Header {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	lines := make([]string, 0, len(keys))
+	for _, k := range keys {
+		for _, v := range resp.Header[k] {
+			lines = append(lines, k+": "+v)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+func targetHost(resp *http.Response) string {
+	if resp.Request == nil || resp.Request.URL == nil {
+		return ""
+	}
+	return strings.ToLower(resp.Request.URL.Hostname())
+}
+
+func mustParseCIDRs(cidrs ...string) []*net.IPNet {
+	nets := make([]*net.IPNet, 0, len(cidrs))
+	for _, c := range cidrs {
+		_, n, err := net.ParseCIDR(c)
+		if err != nil {
+			panic(err)
+		}
+		nets = append(nets, n)
+	}
+	return nets
+}
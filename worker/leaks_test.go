@@ -0,0 +1,89 @@
+// Copyright 2017 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package worker
+
+import (
+	"github.com/Matir/webborer/results"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestFindLeaks(t *testing.T) {
+	cases := []struct {
+		text     string
+		target   string
+		expected []string
+	}{
+		{"nothing to see here", "", nil},
+		{"upstream 10.1.2.3:8080 failed", "", []string{"10.1.2.3 (private IP)"}},
+		{"public 8.8.8.8 and 172.32.0.1", "", nil},
+		{"172.20.0.5 and 192.168.1.1 and 172.20.0.5", "", []string{"172.20.0.5 (private IP)", "192.168.1.1 (private IP)"}},
+		{"curl http://169.254.169.254/latest/meta-data/", "", []string{"169.254.169.254 (cloud metadata)"}},
+		{"host metadata.google.internal", "", []string{"metadata.google.internal (cloud metadata)"}},
+		{"connect to db01.prod.internal failed", "", []string{"db01.prod.internal (internal hostname)"}},
+		{"see http://wiki.corp/page", "", []string{"wiki.corp (internal hostname)"}},
+		{"include settings.local.php or .env.local", "", nil},
+		{"served by 10.0.0.5", "10.0.0.5", nil},
+		{"not an IP: 999.1.1.1", "", nil},
+	}
+	for _, c := range cases {
+		leaks := findLeaks(c.text, c.target)
+		if !reflect.DeepEqual(leaks, c.expected) {
+			t.Errorf("findLeaks(%q): expected %v, got %v", c.text, c.expected, leaks)
+		}
+	}
+}
+
+func TestLeakAnalyzer_Body(t *testing.T) {
+	a := NewLeakAnalyzer()
+	resp := testResponse("http://example.com/", "application/json", nil)
+	if !a.Eligible(resp) {
+		t.Fatal("Expected JSON response to be eligible.")
+	}
+	res := &results.Result{}
+	a.Analyze(resp, []byte(`{"backend": "10.4.0.12"}`), res)
+	expected := []string{"10.4.0.12 (private IP)"}
+	if !reflect.DeepEqual(res.Leaks, expected) {
+		t.Errorf("Expected %v, got %v", expected, res.Leaks)
+	}
+}
+
+func TestLeakAnalyzer_Headers(t *testing.T) {
+	a := NewLeakAnalyzer()
+	header := http.Header{"X-Backend-Server": []string{"app3.example.internal"}}
+	resp := testResponse("http://example.com/", "image/png", header)
+	if a.Eligible(resp) {
+		t.Fatal("Expected binary body not to be searched.")
+	}
+	res := &results.Result{}
+	a.CheckHeaders(resp, res)
+	expected := []string{"app3.example.internal (internal hostname)"}
+	if !reflect.DeepEqual(res.Leaks, expected) {
+		t.Errorf("Expected %v, got %v", expected, res.Leaks)
+	}
+}
+
+func TestLeakAnalyzer_NotEligible(t *testing.T) {
+	a := NewLeakAnalyzer()
+	resp := testResponse("http://example.com/", "image/png", nil)
+	if a.Eligible(resp) {
+		t.Error("Expected image to be ineligible.")
+	}
+	res := &results.Result{}
+	if a.CheckHeaders(resp, res); len(res.Leaks) != 0 {
+		t.Errorf("Expected no leaks, got %v", res.Leaks)
+	}
+}
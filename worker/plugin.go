@@ -0,0 +1,110 @@
+// Copyright 2017 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package worker
+
+import (
+	"github.com/Matir/webborer/logging"
+	"github.com/Matir/webborer/results"
+	"net/http"
+	"net/url"
+)
+
+// A Plugin adds custom logic to the scan, such as a detector for secrets in
+// JavaScript files, without changes to the worker.  A plugin implements any of
+// RequestHook, ResponseHook and ResultHook.  Every worker shares the same
+// plugins, so the hooks must be safe to call concurrently.  Plugins are added
+// to a scan with Scanner.AddPlugin, and the plugins package loads them from
+// Go plugin files.
+type Plugin interface {
+	// Name of the plugin, for logging
+	Name() string
+}
+
+// A RequestHook is called before each request.
+type RequestHook interface {
+	// Whether to request task; returning false skips it.  task must not be
+	// modified.
+	BeforeRequest(task *url.URL) bool
+}
+
+// A ResponseHook examines each response, with up to MaxPluginBodySize bytes
+// of the body, and can add to the result for it, e.g. to Notes.  It may also
+// implement Eligible to only be given some responses, as with an Analyzer.
+type ResponseHook interface {
+	AfterResponse(task *url.URL, resp *http.Response, body []byte, result *results.Result)
+}
+
+// A ResultHook sees each result, including errors, just before it is
+// reported.
+type ResultHook interface {
+	OnResult(result *results.Result)
+}
+
+// Call the ResultHook of each plugin that has one on result.
+func RunResultHooks(plugins []Plugin, result *results.Result) {
+	for _, p := range plugins {
+		if h, ok := p.(ResultHook); ok {
+			h.OnResult(result)
+		}
+	}
+}
+
+// Most of a body to give to a ResponseHook
+const MaxPluginBodySize = 1024 * 1024
+
+// Add the request and response hooks of a plugin to the worker.  Result hooks
+// are run by the scan, as results come from more than the workers.
+func (w *Worker) AddPlugin(p Plugin) {
+	if h, ok := p.(RequestHook); ok {
+		w.requestHooks = append(w.requestHooks, h)
+	}
+	if h, ok := p.(ResponseHook); ok {
+		w.AddAnalyzer(responseHookAnalyzer{h})
+	}
+}
+
+// Whether every RequestHook is happy for task to be requested.
+func (w *Worker) allowRequest(task *url.URL) bool {
+	for _, h := range w.requestHooks {
+		if !h.BeforeRequest(task) {
+			logging.Debugf("Skipping %s at the request of a plugin.", task.String())
+			return false
+		}
+	}
+	return true
+}
+
+// Adapts a ResponseHook to an Analyzer, so it is given the body along with
+// the other analyzers.
+type responseHookAnalyzer struct {
+	hook ResponseHook
+}
+
+func (a responseHookAnalyzer) Eligible(resp *http.Response) bool {
+	if e, ok := a.hook.(interface {
+		Eligible(*http.Response) bool
+	}); ok {
+		return e.Eligible(resp)
+	}
+	return true
+}
+
+func (a responseHookAnalyzer) MaxSize() int64 {
+	return MaxPluginBodySize
+}
+
+func (a responseHookAnalyzer) Analyze(resp *http.Response, body []byte, result *results.Result) {
+	a.hook.AfterResponse(result.URL, resp, body, result)
+}
@@ -0,0 +1,105 @@
+// Copyright 2017 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package worker
+
+import (
+	"bytes"
+	"github.com/Matir/webborer/client"
+	"github.com/Matir/webborer/results"
+	"github.com/Matir/webborer/settings"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// A plugin that skips /skip, notes secrets in JavaScript and tags results.
+type testPlugin struct {
+	requested []string
+}
+
+func (p *testPlugin) Name() string {
+	return "test"
+}
+
+func (p *testPlugin) BeforeRequest(task *url.URL) bool {
+	p.requested = append(p.requested, task.Path)
+	return task.Path != "/skip"
+}
+
+func (p *testPlugin) Eligible(resp *http.Response) bool {
+	return strings.HasSuffix(resp.Request.URL.Path, ".js")
+}
+
+func (p *testPlugin) AfterResponse(task *url.URL, resp *http.Response, body []byte, result *results.Result) {
+	if bytes.Contains(body, []byte("AKIA")) {
+		result.Notes = append(result.Notes, "aws-key in "+task.Path)
+	}
+}
+
+func (p *testPlugin) OnResult(result *results.Result) {
+	result.Notes = append(result.Notes, "seen")
+}
+
+func TestWorker_Plugin(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("var key = 'AKIAEXAMPLE';"))
+	}))
+	defer server.Close()
+	s := &settings.ScanSettings{Timeout: 5 * time.Second}
+	factory, _ := client.NewProxyClientFactory(nil, s.Timeout, "")
+	rchan := make(chan results.Result, 3)
+	w := NewWorker(s, factory, nil, noopUrl, noopInt, rchan)
+	p := &testPlugin{}
+	w.AddPlugin(p)
+	for _, path := range []string{"/app.js", "/skip", "/page"} {
+		u, _ := url.Parse(server.URL + path)
+		w.TryURL(u)
+	}
+	close(rchan)
+	var got []results.Result
+	for r := range rchan {
+		got = append(got, r)
+	}
+	if len(p.requested) != 3 {
+		t.Errorf("Expected BeforeRequest for each task, got %v", p.requested)
+	}
+	if len(got) != 2 {
+		t.Fatalf("Expected /skip to be skipped, got %d results", len(got))
+	}
+	if strings.Join(got[0].Notes, ",") != "aws-key in /app.js" {
+		t.Errorf("Unexpected notes for /app.js: %v", got[0].Notes)
+	}
+	if len(got[1].Notes) != 0 {
+		t.Errorf("Expected no notes for /page, got %v", got[1].Notes)
+	}
+}
+
+func TestRunResultHooks(t *testing.T) {
+	result := &results.Result{}
+	RunResultHooks([]Plugin{&testPlugin{}, namedPlugin{}}, result)
+	if strings.Join(result.Notes, ",") != "seen" {
+		t.Errorf("Expected result hook to be run once, got %v", result.Notes)
+	}
+}
+
+// A plugin with no hooks
+type namedPlugin struct{}
+
+func (namedPlugin) Name() string {
+	return "named"
+}
@@ -17,6 +17,9 @@
 package worker
 
 import (
+	"bufio"
+	"bytes"
+	"context"
 	"fmt"
 	"github.com/Matir/webborer/client"
 	"github.com/Matir/webborer/logging"
@@ -25,12 +28,32 @@ import (
 	"github.com/Matir/webborer/util"
 	"github.com/Matir/webborer/workqueue"
 	"io"
+	"io/ioutil"
+	"math/rand"
 	"net/http"
 	"net/url"
 	"strings"
+	"sync/atomic"
 	"time"
 )
 
+// A RequestCounter counts the requests made by the workers of a scan, for
+// progress reporting.
+type RequestCounter struct {
+	count int64
+}
+
+func (c *RequestCounter) add() {
+	if c != nil {
+		atomic.AddInt64(&c.count, 1)
+	}
+}
+
+// Number of requests made so far.
+func (c *RequestCounter) Count() int64 {
+	return atomic.LoadInt64(&c.count)
+}
+
 type Stoppable interface {
 	Stop()
 }
@@ -40,6 +63,22 @@ type PageWorker interface {
 	Handle(*url.URL, io.Reader)
 }
 
+// An Analyzer examines the body of a response and adds any findings to the
+// result for that response.
+type Analyzer interface {
+	// Whether the analyzer wants to examine this response
+	Eligible(*http.Response) bool
+	// Maximum number of bytes of the body to be provided to Analyze
+	MaxSize() int64
+	Analyze(*http.Response, []byte, *results.Result)
+}
+
+// An Analyzer can also be a HeaderChecker, to examine just the headers of
+// responses whose bodies it isn't eligible for.
+type HeaderChecker interface {
+	CheckHeaders(*http.Response, *results.Result)
+}
+
 // Workers do the work of connecting to the server, issuing the request, and
 // then optionally parsing the response.  Normally a pool of several workers
 // will be used due to network latency.
@@ -52,16 +91,38 @@ type Worker struct {
 	adder workqueue.QueueAddFunc
 	// Function to mark work done
 	done workqueue.QueueDoneFunc
+	// Function to release a URL back to the scheduler, if any
+	release workqueue.QueueReleaseFunc
+	// Function to pause a host that serves challenge pages, if any
+	pause workqueue.QueuePauseFunc
 	// Channel for scan results
 	rchan chan<- results.Result
 	// Settings
 	settings *ss.ScanSettings
-	// HTML worker to parse page
-	pageWorker PageWorker
+	// Requesting fuzzed templates rather than discovering content
+	fuzzing bool
+	// Page workers to find links in pages, such as HTML and JavaScript
+	pageWorkers []PageWorker
+	// Analyzers to add findings to results
+	analyzers []Analyzer
+	// Plugin hooks called before each request
+	requestHooks []RequestHook
+	// Requests paths with a second User-Agent, if any
+	comparer *agentComparer
+	// Context for requests; the worker stops when it is cancelled
+	ctx context.Context
 	// Channel to trigger stopping
 	stop chan bool
-	// Request for redirection
+	// Request for redirection, if a redirect was not followed
 	redir *http.Request
+	// Redirects seen for the current request
+	hops []results.RedirectHop
+	// Whether the redirect was not followed because it left the scope
+	offScope bool
+	// Function to check whether a URL is in scope, if any
+	scope workqueue.QueueScopeFunc
+	// Counts the requests of the scan, if any
+	requests *RequestCounter
 	// Channel to signal worker stopping
 	waitq chan bool
 }
@@ -76,6 +137,7 @@ func NewWorker(settings *ss.ScanSettings,
 	w := &Worker{
 		client:   factory.Get(),
 		settings: settings,
+		fuzzing:  settings.Fuzzing(),
 		src:      src,
 		adder:    adder,
 		done:     done,
@@ -85,17 +147,73 @@ func NewWorker(settings *ss.ScanSettings,
 	}
 
 	// Install redirect handler
-	redirHandler := func(req *http.Request, _ []*http.Request) error {
-		w.redir = req
-		return fmt.Errorf("Stop redirect.")
+	redirHandler := func(req *http.Request, via []*http.Request) error {
+		hop := results.RedirectHop{}
+		if len(via) > 0 {
+			hop.URL = via[len(via)-1].URL.String()
+		}
+		if req.Response != nil {
+			hop.Code = req.Response.StatusCode
+		}
+		w.hops = append(w.hops, hop)
+		// Never follow a redirect out of scope
+		if w.scope != nil && !w.scope(req.URL) {
+			w.offScope = w.settings.ReportOffScopeRedirects
+			w.redir = req
+			return fmt.Errorf("Stop redirect.")
+		}
+		if len(w.hops) > w.settings.FollowRedirects {
+			w.redir = req
+			return fmt.Errorf("Stop redirect.")
+		}
+		return nil
 	}
 	w.client.SetCheckRedirect(redirHandler)
 
 	return w
 }
 
+// Replace the page workers with pw.
 func (w *Worker) SetPageWorker(pw PageWorker) {
-	w.pageWorker = pw
+	w.pageWorkers = []PageWorker{pw}
+}
+
+func (w *Worker) AddPageWorker(pw PageWorker) {
+	w.pageWorkers = append(w.pageWorkers, pw)
+}
+
+func (w *Worker) AddAnalyzer(a Analyzer) {
+	w.analyzers = append(w.analyzers, a)
+}
+
+// Harvest directory listings with l, which may be shared with other workers.
+func (w *Worker) AddDirListings(l *DirListings) {
+	w.AddAnalyzer(l)
+	w.requestHooks = append(w.requestHooks, l)
+}
+
+func (w *Worker) SetPauseFunc(pause workqueue.QueuePauseFunc) {
+	w.pause = pause
+}
+
+func (w *Worker) SetScopeFunc(scope workqueue.QueueScopeFunc) {
+	w.scope = scope
+}
+
+// Count requests with c, which is usually shared by the workers of a scan.
+func (w *Worker) SetRequestCounter(c *RequestCounter) {
+	w.requests = c
+}
+
+func (w *Worker) SetContext(ctx context.Context) {
+	w.ctx = ctx
+}
+
+func (w *Worker) requestContext() context.Context {
+	if w.ctx == nil {
+		return context.Background()
+	}
+	return w.ctx
 }
 
 // Run the worker, processing input from a channel until either signalled to
@@ -108,6 +226,8 @@ func (w *Worker) Run() {
 		select {
 		case <-w.stop:
 			return
+		case <-w.requestContext().Done():
+			return
 		case task, ok := <-w.src:
 			if !ok { // channel closed
 				return
@@ -132,7 +252,7 @@ func (w *Worker) Wait() {
 func (w *Worker) HandleURL(task *url.URL) {
 	logging.Logf(logging.LogDebug, "Trying Raw URL (unmangled): %s", task.String())
 	withMangle := w.TryURL(task)
-	if !util.URLIsDir(task) {
+	if !util.URLIsDir(task) && !w.fuzzing {
 		if withMangle {
 			w.TryMangleURL(task)
 		}
@@ -146,8 +266,15 @@ func (w *Worker) HandleURL(task *url.URL) {
 			}
 		}
 	}
+	// Interrupted tasks aren't done, so they can be tried again on resume
+	if w.requestContext().Err() != nil {
+		return
+	}
 	// Mark as done
 	w.done(1)
+	if w.release != nil {
+		w.release(task)
+	}
 }
 
 func (w *Worker) TryMangleURL(task *url.URL) {
@@ -169,10 +296,24 @@ func (w *Worker) TryMangleURL(task *url.URL) {
 }
 
 func (w *Worker) TryURL(task *url.URL) bool {
+	if !w.allowRequest(task) {
+		return false
+	}
 	logging.Logf(logging.LogInfo, "Trying: %s", task.String())
 	tryMangle := false
 	w.redir = nil
-	if resp, err := w.client.RequestURL(task); err != nil && w.redir == nil {
+	w.hops = nil
+	w.offScope = false
+	ctx := w.requestContext()
+	start := time.Now()
+	resp, err := w.client.RequestURLContext(ctx, task)
+	elapsed := time.Since(start)
+	w.requests.add()
+	if err != nil && ctx.Err() != nil {
+		// Cancelled, not a result
+		return false
+	}
+	if err != nil && w.redir == nil {
 		result := results.Result{URL: task, Error: err}
 		if resp != nil {
 			result.Code = resp.StatusCode
@@ -180,39 +321,185 @@ func (w *Worker) TryURL(task *url.URL) bool {
 		w.rchan <- result
 	} else {
 		defer resp.Body.Close()
-		// Do we keep going?
-		if util.URLIsDir(task) && w.KeepSpidering(resp.StatusCode) {
+		body, _ := resp.Body.(*client.Body)
+		sniffed := w.sniffContentType(task, resp)
+		var redir *url.URL
+		if w.redir != nil {
+			redir = w.redir.URL
+		}
+		result := results.Result{
+			URL:              task,
+			Code:             resp.StatusCode,
+			Redir:            redir,
+			Length:           resp.ContentLength,
+			TransferLength:   resp.ContentLength,
+			ContentType:      resp.Header.Get("Content-Type"),
+			Sniffed:          sniffed,
+			ETag:             resp.Header.Get("ETag"),
+			Authenticate:     resp.Header.Get("WWW-Authenticate"),
+			LastModified:     resp.Header.Get("Last-Modified"),
+			Duration:         elapsed,
+			OffScopeRedirect: w.offScope,
+		}
+		// Links in a page are relative to where the redirects ended up
+		base := task
+		if len(w.hops) > 0 {
+			result.Redirects = w.hops
+			if w.redir == nil {
+				base = resp.Request.URL
+				result.Redirects = append(result.Redirects, results.RedirectHop{URL: base.String(), Code: resp.StatusCode})
+			}
+		}
+		w.processBody(base, resp, &result)
+		measureBody(resp, body, &result)
+		HandleChallenge(w.settings, &result, w.pause)
+		if w.comparer != nil && result.Challenge == "" && w.comparer.selected(task, w.settings.IsPositiveCode(resp.StatusCode)) {
+			result.AgentDiff = w.comparer.compare(ctx, task, resp, redir, w.scope)
+		}
+		// Do we keep going?  Nothing is learned from a challenge page.
+		spider := result.Challenge == "" && w.KeepSpidering(resp.StatusCode)
+		if util.URLIsDir(task) && spider {
 			logging.Logf(logging.LogDebug, "Referring %s back for spidering.", task.String())
 			w.adder(task)
 		}
-		if w.redir != nil {
+		if w.redir != nil && !w.fuzzing {
 			logging.Logf(logging.LogDebug, "Referring redirect %s back.", w.redir.URL.String())
 			w.adder(w.redir.URL)
 		}
-		if w.pageWorker != nil && w.pageWorker.Eligible(resp) {
-			w.pageWorker.Handle(task, resp.Body)
+		w.rchan <- result
+		tryMangle = spider
+	}
+	if delay := pacing(w.settings.SleepTime, w.settings.Jitter); delay > 0 {
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
 		}
-		var redir *url.URL
-		if w.redir != nil {
-			redir = w.redir.URL
+	}
+	return tryMangle
+}
+
+// Record the size of a body that was compressed or sent without a length,
+// reading the rest of it to find out.  The response's ContentLength is set to
+// the decoded size so that later comparisons use it.  Bodies larger than
+// -max-body-size, where the client stops reading, are marked as truncated and
+// left with an unknown length, unless the server gave it.
+func measureBody(resp *http.Response, body *client.Body, result *results.Result) {
+	if body == nil {
+		return
+	}
+	result.Encoding = body.Encoding
+	defer func() {
+		result.Truncated = body.Truncated()
+	}()
+	if body.Encoding == "" && resp.ContentLength >= 0 {
+		return
+	}
+	if resp.Request != nil && resp.Request.Method == "HEAD" {
+		return
+	}
+	io.Copy(ioutil.Discard, resp.Body)
+	transferred, decoded, complete := body.Sizes()
+	if !complete {
+		return
+	}
+	result.TransferLength = transferred
+	if body.Undecoded {
+		return
+	}
+	result.Length = decoded
+	resp.ContentLength = decoded
+}
+
+// How long to wait after a request: delay, randomly lengthened or shortened
+// by up to jitter, and never negative.
+func pacing(delay, jitter time.Duration) time.Duration {
+	if jitter > 0 {
+		delay += time.Duration(rand.Int63n(int64(2*jitter)+1)) - jitter
+	}
+	if delay < 0 {
+		return 0
+	}
+	return delay
+}
+
+// Hand the body of the response to the page workers and any analyzers that
+// are interested in it.  The body is only buffered if more than one of them
+// needs it.
+func (w *Worker) processBody(task *url.URL, resp *http.Response, result *results.Result) {
+	var eligible []Analyzer
+	var maxSize int64
+	for _, a := range w.analyzers {
+		if a.Eligible(resp) {
+			eligible = append(eligible, a)
+			if a.MaxSize() > maxSize {
+				maxSize = a.MaxSize()
+			}
+		} else if hc, ok := a.(HeaderChecker); ok {
+			hc.CheckHeaders(resp, result)
 		}
-		w.rchan <- results.Result{
-			URL:         task,
-			Code:        resp.StatusCode,
-			Redir:       redir,
-			Length:      resp.ContentLength,
-			ContentType: resp.Header.Get("Content-Type"),
+	}
+	var pages []PageWorker
+	for _, pw := range w.pageWorkers {
+		if pw.Eligible(resp) {
+			pages = append(pages, pw)
 		}
-		tryMangle = w.KeepSpidering(resp.StatusCode)
 	}
-	if w.settings.SleepTime != 0 {
-		time.Sleep(w.settings.SleepTime)
+	if len(eligible) == 0 && len(pages) <= 1 {
+		if len(pages) == 1 {
+			pages[0].Handle(task, resp.Body)
+		}
+		return
 	}
-	return tryMangle
+	if len(pages) > 0 && maxSize < maxHTMLWorkerSize {
+		maxSize = maxHTMLWorkerSize
+	}
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxSize))
+	if err != nil {
+		logging.Logf(logging.LogInfo, "Error reading body of %s: %s", task.String(), err.Error())
+	}
+	for _, a := range eligible {
+		if limit := a.MaxSize(); int64(len(body)) > limit {
+			a.Analyze(resp, body[:limit], result)
+		} else {
+			a.Analyze(resp, body, result)
+		}
+	}
+	for _, pw := range pages {
+		pw.Handle(task, bytes.NewReader(body))
+	}
+}
+
+// Replace a missing or generic Content-Type header with one based on the
+// contents of the body, so that page workers and results see the real type.
+// Returns true if the header was replaced.
+func (w *Worker) sniffContentType(task *url.URL, resp *http.Response) bool {
+	if resp.Body == nil || !util.IsGenericContentType(resp.Header.Get("Content-Type")) {
+		return false
+	}
+	buffered := bufio.NewReaderSize(resp.Body, util.SniffLen)
+	resp.Body = struct {
+		io.Reader
+		io.Closer
+	}{buffered, resp.Body}
+	peek, _ := buffered.Peek(util.SniffLen)
+	ctype, sniffed := util.EffectiveContentType(resp.Header.Get("Content-Type"), peek)
+	if !sniffed {
+		return false
+	}
+	logging.Debugf("Sniffed content type %s for %s.", ctype, task.String())
+	if resp.Header == nil {
+		resp.Header = make(http.Header)
+	}
+	resp.Header.Set("Content-Type", ctype)
+	return true
 }
 
-// Should we keep spidering from this code?
+// Should we keep spidering from this code?  Negative codes are never spidered,
+// even if listed in SpiderCodes, and fuzzing never spiders.
 func (w *Worker) KeepSpidering(code int) bool {
+	if w.fuzzing || !w.settings.IsPositiveCode(code) {
+		return false
+	}
 	for _, v := range w.settings.SpiderCodes {
 		if code == v {
 			return true
@@ -221,25 +508,77 @@ func (w *Worker) KeepSpidering(code int) bool {
 	return false
 }
 
-// Starts a batch of workers based on the relevant settings.
-func StartWorkers(settings *ss.ScanSettings,
+// Starts a batch of workers based on the relevant settings, with the hooks of
+// plugins added.  The workers stop when ctx is cancelled.
+func StartWorkers(ctx context.Context,
+	settings *ss.ScanSettings,
 	factory client.ClientFactory,
 	src <-chan *url.URL,
 	adder workqueue.QueueAddFunc,
 	done workqueue.QueueDoneFunc,
-	rchan chan<- results.Result) []*Worker {
+	release workqueue.QueueReleaseFunc,
+	pause workqueue.QueuePauseFunc,
+	scope workqueue.QueueScopeFunc,
+	requests *RequestCounter,
+	rchan chan<- results.Result,
+	plugins []Plugin) []*Worker {
 	count := settings.Workers
 	workers := make([]*Worker, count)
+	var listings *DirListings
+	if settings.DirListings {
+		listings = NewDirListings(adder, rchan)
+	}
 	for i := 0; i < count; i++ {
-		workers[i] = NewWorker(settings, factory, src, adder, done, rchan)
-		workers[i].RunInBackground()
-		if settings.ParseHTML {
-			workers[i].SetPageWorker(NewHTMLWorker(adder))
+		workers[i] = NewConfiguredWorker(settings, factory, src, adder, done, release, rchan)
+		if listings != nil {
+			workers[i].AddDirListings(listings)
+		}
+		for _, p := range plugins {
+			workers[i].AddPlugin(p)
 		}
+		workers[i].SetPauseFunc(pause)
+		workers[i].SetScopeFunc(scope)
+		workers[i].SetRequestCounter(requests)
+		workers[i].SetContext(ctx)
+		workers[i].RunInBackground()
 	}
 	return workers
 }
 
+// Construct a worker with the page workers and analyzers enabled by settings.
+func NewConfiguredWorker(settings *ss.ScanSettings,
+	factory client.ClientFactory,
+	src <-chan *url.URL,
+	adder workqueue.QueueAddFunc,
+	done workqueue.QueueDoneFunc,
+	release workqueue.QueueReleaseFunc,
+	rchan chan<- results.Result) *Worker {
+	w := NewWorker(settings, factory, src, adder, done, rchan)
+	w.release = release
+	if settings.ParseHTML && !w.fuzzing {
+		w.AddPageWorker(NewHTMLWorker(adder))
+	}
+	if settings.ParseJS && !w.fuzzing {
+		w.AddPageWorker(NewJSWorker(adder))
+	}
+	if settings.ArchivePeek {
+		w.AddAnalyzer(NewArchiveAnalyzer(settings.ArchivePeekSize))
+	}
+	if settings.LeakDetect {
+		w.AddAnalyzer(NewLeakAnalyzer())
+	}
+	if settings.HeaderChecks {
+		w.AddAnalyzer(NewHeaderAnalyzer())
+	}
+	if settings.ChallengeDetect {
+		w.AddAnalyzer(NewChallengeAnalyzer())
+	}
+	if settings.CompareAgent != "" {
+		w.comparer = newAgentComparer(factory, settings.CompareAgent, settings.ComparePaths, settings.FollowRedirects)
+	}
+	return w
+}
+
 // Mangle a basename
 func Mangle(basename string) []string {
 	mangleRules := []string{
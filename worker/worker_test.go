@@ -15,19 +15,41 @@
 package worker
 
 import (
+	"compress/gzip"
+	"context"
+	"github.com/Matir/webborer/client"
 	"github.com/Matir/webborer/client/mock"
 	"github.com/Matir/webborer/results"
 	"github.com/Matir/webborer/settings"
 	"io"
+	"io/ioutil"
 	"net/http"
+	"net/http/httptest"
 	"net/url"
+	"reflect"
 	"strings"
 	"testing"
+	"time"
 )
 
 func noopInt(_ int)         {}
 func noopUrl(_ ...*url.URL) {}
 
+// A 200 response for the URL u, with the content type ctype and any other
+// headers in header.
+func testResponse(u, ctype string, header http.Header) *http.Response {
+	if header == nil {
+		header = http.Header{}
+	}
+	header.Set("Content-Type", ctype)
+	req, _ := http.NewRequest("GET", u, nil)
+	return &http.Response{
+		StatusCode: 200,
+		Header:     header,
+		Request:    req,
+	}
+}
+
 func TestNewWorker(t *testing.T) {
 	ss := &settings.ScanSettings{}
 	src := make(chan *url.URL)
@@ -141,12 +163,18 @@ func TestStartWorkers_SingleIteration(t *testing.T) {
 	rchan := make(chan results.Result)
 	u, _ := url.Parse("http://www.example.com")
 	for i, w := range StartWorkers(
+		context.Background(),
 		ss,
 		&mock.MockClientFactory{},
 		schan,
 		noopUrl,
 		noopInt,
-		rchan) {
+		nil,
+		nil,
+		nil,
+		nil,
+		rchan,
+		nil) {
 		// Send the input
 		schan <- u
 		// Read the result
@@ -161,6 +189,47 @@ func TestStartWorkers_SingleIteration(t *testing.T) {
 	}
 }
 
+func TestWorker_Cancelled(t *testing.T) {
+	resp := mock.ResponseFromString("")
+	resp.StatusCode = 200
+	client := &mock.MockClient{ForeverResponse: resp}
+	rchan := make(chan results.Result, 10)
+	done := 0
+	w := &Worker{
+		client:   client,
+		settings: &settings.ScanSettings{Mangle: true, Extensions: []string{"php"}},
+		rchan:    rchan,
+		adder:    noopUrl,
+		done:     func(n int) { done += n },
+		waitq:    make(chan bool),
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	w.SetContext(ctx)
+	w.HandleURL(&url.URL{Scheme: "http", Host: "localhost", Path: "/index"})
+	if len(rchan) != 0 {
+		t.Errorf("Expected no results from cancelled worker, got %d", len(rchan))
+	}
+	if done != 0 {
+		t.Error("Cancelled task should not be marked done.")
+	}
+	// Run returns once cancelled
+	w.RunInBackground()
+	w.Wait()
+}
+
+func TestKeepSpidering(t *testing.T) {
+	w := &Worker{settings: &settings.ScanSettings{
+		SpiderCodes:   []int{200, 403},
+		NegativeCodes: settings.MustParseCodeRanges("403"),
+	}}
+	for code, expected := range map[int]bool{200: true, 403: false, 404: false} {
+		if w.KeepSpidering(code) != expected {
+			t.Errorf("KeepSpidering(%d): expected %v", code, expected)
+		}
+	}
+}
+
 func TestMangle(t *testing.T) {
 	foo := "foo"
 	for _, r := range Mangle(foo) {
@@ -182,7 +251,267 @@ func TestSetPageWorker(t *testing.T) {
 	w := &Worker{}
 	pw := &FakePageWorker{}
 	w.SetPageWorker(pw)
-	if w.pageWorker != pw {
+	if len(w.pageWorkers) != 1 || w.pageWorkers[0] != pw {
 		t.Fatalf("Pageworker not properly set.")
 	}
 }
+
+func TestSniffContentType(t *testing.T) {
+	w := &Worker{}
+	u := &url.URL{Scheme: "http", Host: "localhost", Path: "/data"}
+	resp := mock.ResponseFromString(`{"key": "value"}`)
+	resp.Header = http.Header{"Content-Type": []string{"text/plain"}}
+	if !w.sniffContentType(u, resp) {
+		t.Fatalf("Expected JSON body to be sniffed.")
+	}
+	if ct := resp.Header.Get("Content-Type"); ct != "application/json" {
+		t.Errorf("Expected application/json, got %s", ct)
+	}
+	// Body must still be fully readable after sniffing
+	if body, _ := ioutil.ReadAll(resp.Body); string(body) != `{"key": "value"}` {
+		t.Errorf("Body altered by sniffing: %s", body)
+	}
+
+	resp = mock.ResponseFromString(`{"key": "value"}`)
+	resp.Header = http.Header{"Content-Type": []string{"text/html"}}
+	if w.sniffContentType(u, resp) {
+		t.Errorf("Expected specific content type to be trusted.")
+	}
+}
+
+type countingPageWorker struct {
+	body string
+}
+
+func (*countingPageWorker) Eligible(_ *http.Response) bool {
+	return true
+}
+
+func (pw *countingPageWorker) Handle(_ *url.URL, r io.Reader) {
+	b, _ := ioutil.ReadAll(r)
+	pw.body = string(b)
+}
+
+type fakeAnalyzer struct {
+	seen string
+}
+
+func (*fakeAnalyzer) Eligible(_ *http.Response) bool {
+	return true
+}
+
+func (*fakeAnalyzer) MaxSize() int64 {
+	return 4
+}
+
+func (a *fakeAnalyzer) Analyze(_ *http.Response, body []byte, res *results.Result) {
+	a.seen = string(body)
+	res.ArchiveListing = []string{a.seen}
+}
+
+func TestProcessBody(t *testing.T) {
+	pw := &countingPageWorker{}
+	a := &fakeAnalyzer{}
+	w := &Worker{}
+	w.SetPageWorker(pw)
+	w.AddAnalyzer(a)
+	u := &url.URL{Scheme: "http", Host: "localhost", Path: "/"}
+	res := &results.Result{URL: u}
+	w.processBody(u, mock.ResponseFromString("abcdefgh"), res)
+	if a.seen != "abcd" {
+		t.Errorf("Expected analyzer to see limited body, got %q", a.seen)
+	}
+	if pw.body != "abcdefgh" {
+		t.Errorf("Expected page worker to see full body, got %q", pw.body)
+	}
+	if len(res.ArchiveListing) != 1 {
+		t.Errorf("Expected analyzer to annotate result.")
+	}
+}
+
+type headerOnlyAnalyzer struct {
+	fakeAnalyzer
+	checked bool
+}
+
+func (*headerOnlyAnalyzer) Eligible(_ *http.Response) bool {
+	return false
+}
+
+func (a *headerOnlyAnalyzer) CheckHeaders(_ *http.Response, _ *results.Result) {
+	a.checked = true
+}
+
+func TestProcessBody_CheckHeaders(t *testing.T) {
+	a := &headerOnlyAnalyzer{}
+	w := &Worker{}
+	w.AddAnalyzer(a)
+	u := &url.URL{Scheme: "http", Host: "localhost", Path: "/"}
+	w.processBody(u, mock.ResponseFromString("abcdefgh"), &results.Result{URL: u})
+	if !a.checked || a.seen != "" {
+		t.Errorf("Expected only headers to be checked, checked %v, saw body %q", a.checked, a.seen)
+	}
+}
+
+func redirectServer() *httptest.Server {
+	mux := http.NewServeMux()
+	mux.Handle("/a", http.RedirectHandler("/b", http.StatusMovedPermanently))
+	mux.Handle("/b", http.RedirectHandler("/c", http.StatusFound))
+	mux.HandleFunc("/c", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("done"))
+	})
+	mux.Handle("/away", http.RedirectHandler("http://elsewhere.invalid/", http.StatusFound))
+	return httptest.NewServer(mux)
+}
+
+func tryRedirect(t *testing.T, s *settings.ScanSettings, target string, scope func(*url.URL) bool) results.Result {
+	s.Timeout = 5 * time.Second
+	factory, _ := client.NewProxyClientFactory(nil, s.Timeout, "")
+	rchan := make(chan results.Result, 1)
+	w := NewWorker(s, factory, nil, noopUrl, noopInt, rchan)
+	w.SetScopeFunc(scope)
+	u, _ := url.Parse(target)
+	w.TryURL(u)
+	return <-rchan
+}
+
+func TestWorker_FollowRedirects(t *testing.T) {
+	server := redirectServer()
+	defer server.Close()
+
+	res := tryRedirect(t, &settings.ScanSettings{}, server.URL+"/a", nil)
+	if res.Code != 301 || res.Redir == nil || res.Redir.Path != "/b" {
+		t.Errorf("Expected unfollowed 301 to /b, got %d %v", res.Code, res.Redir)
+	}
+	expected := []results.RedirectHop{{URL: server.URL + "/a", Code: 301}}
+	if !reflect.DeepEqual(res.Redirects, expected) {
+		t.Errorf("Expected %v, got %v", expected, res.Redirects)
+	}
+
+	res = tryRedirect(t, &settings.ScanSettings{FollowRedirects: 2}, server.URL+"/a", nil)
+	if res.Code != 200 || res.Redir != nil {
+		t.Errorf("Expected followed redirects to end in 200, got %d %v", res.Code, res.Redir)
+	}
+	expected = []results.RedirectHop{
+		{URL: server.URL + "/a", Code: 301},
+		{URL: server.URL + "/b", Code: 302},
+		{URL: server.URL + "/c", Code: 200},
+	}
+	if !reflect.DeepEqual(res.Redirects, expected) {
+		t.Errorf("Expected %v, got %v", expected, res.Redirects)
+	}
+
+	res = tryRedirect(t, &settings.ScanSettings{FollowRedirects: 1}, server.URL+"/a", nil)
+	if res.Code != 302 || res.Redir == nil || res.Redir.Path != "/c" || len(res.Redirects) != 2 {
+		t.Errorf("Expected to stop at 302 to /c, got %d %v %v", res.Code, res.Redir, res.Redirects)
+	}
+}
+
+func TestWorker_CompressedLength(t *testing.T) {
+	text := strings.Repeat("the same words again ", 50)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/plain" || !strings.Contains(r.Header.Get("Accept-Encoding"), "gzip") {
+			w.Write([]byte(text))
+			return
+		}
+		w.Header().Set("Content-Encoding", "gzip")
+		zw := gzip.NewWriter(w)
+		zw.Write([]byte(text))
+		zw.Close()
+	}))
+	defer server.Close()
+
+	res := tryRedirect(t, &settings.ScanSettings{}, server.URL+"/gz", nil)
+	if res.Length != int64(len(text)) || res.Encoding != "gzip" {
+		t.Errorf("Expected decoded length %d from gzip, got %d %q", len(text), res.Length, res.Encoding)
+	}
+	if res.TransferLength <= 0 || res.TransferLength >= res.Length {
+		t.Errorf("Expected smaller transfer length, got %d", res.TransferLength)
+	}
+	plain := tryRedirect(t, &settings.ScanSettings{}, server.URL+"/plain", nil)
+	if plain.Length != res.Length || plain.TransferLength != plain.Length || plain.Encoding != "" {
+		t.Errorf("Expected the same length uncompressed, got %+v", plain)
+	}
+}
+
+func TestWorker_OffScopeRedirect(t *testing.T) {
+	server := redirectServer()
+	defer server.Close()
+	serverURL, _ := url.Parse(server.URL)
+	scope := func(u *url.URL) bool { return u.Host == serverURL.Host }
+	s := &settings.ScanSettings{FollowRedirects: 5, ReportOffScopeRedirects: true}
+
+	res := tryRedirect(t, s, server.URL+"/away", scope)
+	if !res.OffScopeRedirect || res.Redir == nil || res.Redir.Host != "elsewhere.invalid" {
+		t.Errorf("Expected off-scope redirect to be reported, got %v %v", res.OffScopeRedirect, res.Redir)
+	}
+	res = tryRedirect(t, s, server.URL+"/a", scope)
+	if res.OffScopeRedirect || res.Code != 200 {
+		t.Errorf("Expected in-scope redirects to be followed, got %d", res.Code)
+	}
+	// Off-scope redirects are never followed, even if not reported
+	s.ReportOffScopeRedirects = false
+	res = tryRedirect(t, s, server.URL+"/away", scope)
+	if res.OffScopeRedirect || res.Code != 302 || res.Redir == nil || res.Redir.Host != "elsewhere.invalid" {
+		t.Errorf("Expected off-scope redirect not to be followed, got %d %v", res.Code, res.Redir)
+	}
+}
+
+func TestPacing(t *testing.T) {
+	if d := pacing(0, 0); d != 0 {
+		t.Errorf("Expected no delay, got %s", d)
+	}
+	if d := pacing(100*time.Millisecond, 0); d != 100*time.Millisecond {
+		t.Errorf("Expected 100ms delay, got %s", d)
+	}
+	varied := false
+	for i := 0; i < 100; i++ {
+		d := pacing(100*time.Millisecond, 50*time.Millisecond)
+		if d < 50*time.Millisecond || d > 150*time.Millisecond {
+			t.Fatalf("Expected delay within 50ms of 100ms, got %s", d)
+		}
+		varied = varied || d != 100*time.Millisecond
+	}
+	if !varied {
+		t.Error("Expected jitter to vary the delay.")
+	}
+	for i := 0; i < 100; i++ {
+		if d := pacing(0, 10*time.Millisecond); d < 0 {
+			t.Fatalf("Expected non-negative delay, got %s", d)
+		}
+	}
+}
+
+func TestWorker_MaxBodySize(t *testing.T) {
+	big := strings.Repeat("x", 4096)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/chunked" {
+			// No Content-Length, so the size is only found by reading
+			w.Write([]byte(big[:2048]))
+			w.(http.Flusher).Flush()
+			w.Write([]byte(big[2048:]))
+			return
+		}
+		w.Write([]byte(big[:100]))
+	}))
+	defer server.Close()
+	s := &settings.ScanSettings{Timeout: 5 * time.Second}
+	factory, _ := client.NewProxyClientFactory(nil, s.Timeout, "")
+	factory.SetMaxBodySize(1024)
+	rchan := make(chan results.Result, 1)
+	w := NewWorker(s, factory, nil, noopUrl, noopInt, rchan)
+	for path, truncated := range map[string]bool{"/chunked": true, "/small": false} {
+		u, _ := url.Parse(server.URL + path)
+		w.TryURL(u)
+		res := <-rchan
+		if res.Truncated != truncated {
+			t.Errorf("%s: expected truncated %v, got %v", path, truncated, res.Truncated)
+		}
+		if !truncated && res.Length != 100 {
+			t.Errorf("%s: expected length 100, got %d", path, res.Length)
+		}
+		if truncated && res.Length != -1 {
+			t.Errorf("%s: expected unknown length, got %d", path, res.Length)
+		}
+	}
+}
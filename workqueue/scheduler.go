@@ -0,0 +1,216 @@
+// Copyright 2017 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package workqueue
+
+import (
+	"context"
+	"net/url"
+	"sync"
+	"time"
+)
+
+type QueueReleaseFunc func(*url.URL)
+
+// Stop handing out work for the host of a URL for a while.
+type QueuePauseFunc func(*url.URL, time.Duration)
+
+// Hand out work for the host of a URL no more often than once per interval.
+type QueueThrottleFunc func(*url.URL, time.Duration)
+
+// HostScheduler sits between the filter and the workers.  It hands out work
+// for different hosts in round-robin order, and limits the number of tasks
+// in progress for any one host so a single slow server doesn't tie up all of
+// the workers.
+type HostScheduler struct {
+	// Channel of URLs to be scheduled
+	src <-chan *url.URL
+	// Channel of URLs for the workers
+	dst chan *url.URL
+	// Maximum tasks in progress per host, 0 for unlimited
+	perHost int
+	// Maximum URLs to hold before blocking input
+	maxQueued int
+	// Queued URLs
+	queue hostRing
+	// Tasks in progress, by host
+	inflight     map[string]int
+	inflightLock sync.Mutex
+	// Hosts not to be handed out until the given time, guarded by inflightLock
+	paused map[string]time.Time
+	// Minimum time between tasks for hosts, guarded by inflightLock
+	interval map[string]time.Duration
+	// Signalled when a task is released
+	wake chan bool
+}
+
+func NewHostScheduler(src <-chan *url.URL, perHost, maxQueued int) *HostScheduler {
+	if maxQueued < 1 {
+		maxQueued = 1
+	}
+	return &HostScheduler{
+		src:       src,
+		dst:       make(chan *url.URL),
+		perHost:   perHost,
+		maxQueued: maxQueued,
+		inflight:  make(map[string]int),
+		paused:    make(map[string]time.Time),
+		interval:  make(map[string]time.Duration),
+		wake:      make(chan bool, 1),
+	}
+}
+
+func (s *HostScheduler) GetWorkChan() <-chan *url.URL {
+	return s.dst
+}
+
+// Get a function for workers to call when they have finished with a URL.
+func (s *HostScheduler) GetReleaseFunc() QueueReleaseFunc {
+	return func(u *url.URL) {
+		s.inflightLock.Lock()
+		if s.inflight[u.Host] > 0 {
+			s.inflight[u.Host]--
+		}
+		s.inflightLock.Unlock()
+		select {
+		case s.wake <- true:
+		default:
+		}
+	}
+}
+
+// Get a function to pause a host, e.g. when it starts serving challenge
+// pages.  Tasks already handed out are not affected.
+func (s *HostScheduler) GetPauseFunc() QueuePauseFunc {
+	return s.Pause
+}
+
+// Hand out no work for the host of u until d has passed.  Pausing a host
+// that is already paused extends the pause if d ends later.
+func (s *HostScheduler) Pause(u *url.URL, d time.Duration) {
+	until := time.Now().Add(d)
+	s.inflightLock.Lock()
+	if until.After(s.paused[u.Host]) {
+		s.paused[u.Host] = until
+	}
+	s.inflightLock.Unlock()
+}
+
+// Get a function to slow down a host, e.g. when it starts rate limiting.
+func (s *HostScheduler) GetThrottleFunc() QueueThrottleFunc {
+	return s.Throttle
+}
+
+// Hand out work for the host of u at most once every d.  Tasks already handed
+// out are not affected, and a d of 0 removes the limit.
+func (s *HostScheduler) Throttle(u *url.URL, d time.Duration) {
+	s.inflightLock.Lock()
+	if d > 0 {
+		s.interval[u.Host] = d
+	} else {
+		delete(s.interval, u.Host)
+	}
+	s.inflightLock.Unlock()
+}
+
+// Run the scheduler until its input is closed or ctx is cancelled.  Once
+// cancelled, queued work is dropped and further input is discarded.
+func (s *HostScheduler) Run(ctx context.Context) {
+	defer close(s.dst)
+	src := s.src
+	for src != nil || s.queue.len() > 0 {
+		in := src
+		if s.queue.len() >= s.maxQueued {
+			in = nil
+		}
+		var dst chan *url.URL
+		var resume <-chan time.Time
+		next, pos, wait := s.peek()
+		if next != nil {
+			dst = s.dst
+		} else if wait > 0 {
+			resume = time.After(wait)
+		}
+		select {
+		case u, ok := <-in:
+			if !ok {
+				src = nil
+				continue
+			}
+			s.push(u)
+		case dst <- next:
+			s.pop(pos)
+		case <-s.wake:
+		case <-resume:
+		case <-ctx.Done():
+			if src != nil {
+				go func() {
+					for range src {
+					}
+				}()
+			}
+			return
+		}
+	}
+}
+
+func (s *HostScheduler) RunInBackground(ctx context.Context) {
+	go s.Run(ctx)
+}
+
+func (s *HostScheduler) push(u *url.URL) {
+	s.queue.push(u)
+}
+
+// Find the next URL for a host that is under its limit and not paused,
+// returning the URL and the position of its host in the ring.  If there is
+// none, also returns how long until the first paused host resumes, or 0 if
+// no hosts are paused.
+func (s *HostScheduler) peek() (*url.URL, int, time.Duration) {
+	s.inflightLock.Lock()
+	defer s.inflightLock.Unlock()
+	now := time.Now()
+	var wait time.Duration
+	u, pos := s.queue.peek(func(host string) bool {
+		if until, ok := s.paused[host]; ok {
+			if left := until.Sub(now); left > 0 {
+				if wait == 0 || left < wait {
+					wait = left
+				}
+				return false
+			}
+			delete(s.paused, host)
+		}
+		return s.perHost == 0 || s.inflight[host] < s.perHost
+	})
+	if u != nil {
+		return u, pos, 0
+	}
+	return nil, 0, wait
+}
+
+// Remove the URL at the head of the queue for the host at pos and mark it as
+// in progress.
+func (s *HostScheduler) pop(pos int) {
+	host := s.queue.pop(pos).Host
+	s.inflightLock.Lock()
+	s.inflight[host]++
+	// A throttled host waits out its interval like a pause
+	if d := s.interval[host]; d > 0 {
+		if until := time.Now().Add(d); until.After(s.paused[host]) {
+			s.paused[host] = until
+		}
+	}
+	s.inflightLock.Unlock()
+}
@@ -0,0 +1,140 @@
+// Copyright 2017 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package workqueue
+
+import (
+	"context"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestHostScheduler_RoundRobin(t *testing.T) {
+	src := make(chan *url.URL, 10)
+	for _, h := range []string{"a", "a", "a", "b", "b", "c"} {
+		src <- &url.URL{Host: h}
+	}
+	close(src)
+	sched := NewHostScheduler(src, 0, 10)
+	// Fill the scheduler before starting to read
+	for len(src) > 0 {
+		sched.push(<-src)
+	}
+	sched.RunInBackground(context.Background())
+	release := sched.GetReleaseFunc()
+	got := ""
+	for u := range sched.GetWorkChan() {
+		got += u.Host
+		release(u)
+	}
+	if got != "abcaba" {
+		t.Errorf("Expected round-robin order abcaba, got %s", got)
+	}
+}
+
+func TestHostScheduler_PerHostLimit(t *testing.T) {
+	src := make(chan *url.URL, 10)
+	for _, h := range []string{"a", "a", "b"} {
+		src <- &url.URL{Host: h}
+	}
+	close(src)
+	sched := NewHostScheduler(src, 1, 10)
+	sched.RunInBackground(context.Background())
+	out := sched.GetWorkChan()
+	first := <-out
+	second := <-out
+	if first.Host == second.Host {
+		t.Fatalf("Expected different hosts while %s is busy, got %s twice.", first.Host, first.Host)
+	}
+	// Whichever host was "a" is at its limit, so nothing more should come
+	select {
+	case u := <-out:
+		t.Fatalf("Expected no work while hosts are busy, got %v", u)
+	case <-time.After(20 * time.Millisecond):
+	}
+	release := sched.GetReleaseFunc()
+	release(first)
+	release(second)
+	if u, ok := <-out; !ok || u.Host != "a" {
+		t.Fatalf("Expected remaining work for a, got %v", u)
+	}
+	if _, ok := <-out; ok {
+		t.Errorf("Expected work channel to be closed.")
+	}
+}
+
+func TestHostScheduler_Cancel(t *testing.T) {
+	src := make(chan *url.URL)
+	sched := NewHostScheduler(src, 1, 1)
+	ctx, cancel := context.WithCancel(context.Background())
+	sched.RunInBackground(ctx)
+	cancel()
+	if _, ok := <-sched.GetWorkChan(); ok {
+		t.Error("Expected work channel to be closed.")
+	}
+	// Input is still drained
+	src <- &url.URL{Host: "a"}
+	close(src)
+}
+
+func TestHostScheduler_Pause(t *testing.T) {
+	src := make(chan *url.URL, 10)
+	for _, h := range []string{"a", "a", "b"} {
+		src <- &url.URL{Host: h}
+	}
+	close(src)
+	sched := NewHostScheduler(src, 0, 10)
+	for len(src) > 0 {
+		sched.push(<-src)
+	}
+	sched.GetPauseFunc()(&url.URL{Host: "a"}, 50*time.Millisecond)
+	start := time.Now()
+	sched.RunInBackground(context.Background())
+	got := ""
+	for u := range sched.GetWorkChan() {
+		got += u.Host
+	}
+	if got != "baa" {
+		t.Errorf("Expected paused host last (baa), got %s", got)
+	}
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+		t.Errorf("Expected paused host to wait, finished after %s", elapsed)
+	}
+}
+
+func TestHostScheduler_Throttle(t *testing.T) {
+	src := make(chan *url.URL, 10)
+	for _, h := range []string{"a", "a", "a", "b", "b"} {
+		src <- &url.URL{Host: h}
+	}
+	close(src)
+	sched := NewHostScheduler(src, 0, 10)
+	for len(src) > 0 {
+		sched.push(<-src)
+	}
+	sched.GetThrottleFunc()(&url.URL{Host: "a"}, 40*time.Millisecond)
+	start := time.Now()
+	sched.RunInBackground(context.Background())
+	got := ""
+	for u := range sched.GetWorkChan() {
+		got += u.Host
+	}
+	if got != "abbaa" {
+		t.Errorf("Expected throttled host to fall behind (abbaa), got %s", got)
+	}
+	if elapsed := time.Since(start); elapsed < 80*time.Millisecond {
+		t.Errorf("Expected throttled host to wait between tasks, finished after %s", elapsed)
+	}
+}
@@ -21,9 +21,11 @@ import (
 
 // Count work to do and work done
 type WorkCounter struct {
-	todo   int64
-	done   int64
-	doneCb func(done, total int64)
+	todo int64
+	done int64
+	// Work expected but not yet added, shown in the total for progress
+	estimated int64
+	doneCb    func(done, total int64)
 	sync.Mutex
 	sync.Cond
 }
@@ -36,6 +38,18 @@ func (ctr *WorkCounter) Add(todo int64) {
 	ctr.Stats()
 }
 
+// Adjust the estimate of work still to be added.  Unlike Add, this only
+// changes the total reported for progress, not when the work is done.
+func (ctr *WorkCounter) Estimate(n int64) {
+	ctr.Lock()
+	defer ctr.Unlock()
+	ctr.estimated += n
+	if ctr.estimated < 0 {
+		ctr.estimated = 0
+	}
+	ctr.Stats()
+}
+
 // Increment the count that is done (output)
 func (ctr *WorkCounter) Done(done int64) {
 	ctr.Lock()
@@ -48,22 +62,29 @@ func (ctr *WorkCounter) Done(done int64) {
 	if ctr.done == ctr.todo {
 		// Mark done
 		logging.Logf(logging.LogInfo, "Work counter thinks we're done.")
-		// These are part of the sync.Cond
-		ctr.L.Lock()
-		defer ctr.L.Unlock()
 		ctr.Broadcast()
 	}
 }
 
+// Get the amount of work done and the total amount of work, including any
+// estimate of work still to be added
+func (ctr *WorkCounter) Counts() (done, total int64) {
+	ctr.Lock()
+	defer ctr.Unlock()
+	return ctr.done, ctr.todo + ctr.estimated
+}
+
 // Update the stats of the counter
 func (ctr *WorkCounter) Stats() {
 	logging.Logf(logging.LogDebug, "WorkCounter: %d/%d", ctr.done, ctr.todo)
 	if ctr.doneCb != nil {
-		ctr.doneCb(ctr.done, ctr.todo)
+		ctr.doneCb(ctr.done, ctr.todo+ctr.estimated)
 	}
 }
 
 // Set the status callback for this workcounter
 func (ctr *WorkCounter) SetStatusCallback(f func(int64, int64)) {
+	ctr.Lock()
+	defer ctr.Unlock()
 	ctr.doneCb = f
 }
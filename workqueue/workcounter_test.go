@@ -52,3 +52,16 @@ func TestWorkCounterDone(t *testing.T) {
 		t.Fatalf("Expected a panic, but it did not!")
 	}
 }
+
+func TestWorkCounterEstimate(t *testing.T) {
+	wc := WorkCounter{}
+	wc.Add(2)
+	wc.Estimate(10)
+	if done, total := wc.Counts(); done != 0 || total != 12 {
+		t.Errorf("Expected 0/12, got %d/%d", done, total)
+	}
+	wc.Estimate(-20)
+	if _, total := wc.Counts(); total != 2 {
+		t.Errorf("Expected estimate not to go below zero, got total %d", total)
+	}
+}
@@ -17,35 +17,45 @@
 package workqueue
 
 import (
+	"context"
 	"github.com/Matir/webborer/client"
 	"github.com/Matir/webborer/logging"
 	"github.com/Matir/webborer/robots"
+	"github.com/Matir/webborer/scope"
 	"github.com/Matir/webborer/util"
 	"net/url"
 	"sync"
+	"sync/atomic"
 )
 
 // WorkQueue is a singleton that maintains the queue of work to be done.
 // It reads from one input channel, verifies that the URL is in scope,
 // queues it, then writes it to the work channel to be done.
-// Internally, it implements a singly-linked list.
+// Internally, it implements a singly-linked list per host, and hosts are
+// served in round-robin order so one large site doesn't starve the others.
 type WorkQueue struct {
 	// Elements to be worked on
-	head *queueNode
-	// End for cheap appends
-	tail *queueNode
-	// Number of items in queue, for stats
-	queueLen int
+	queue hostRing
 	// Channel for URLs to be considered
 	src chan *url.URL
 	// Channel for URLs to be worked on
 	dst chan *url.URL
 	// filter to determine if a URL should be processed
 	filter func(*url.URL) bool
+	// Scope added while running, protected by scopeLock
+	addedScope    []*url.URL
+	scopeLock     sync.RWMutex
+	allowUpgrades bool
+	// Include and exclude rules, also protected by scopeLock
+	rules *scope.Rules
 	// channel to track done
 	started chan bool
 	// counter of work being done
 	ctr WorkCounter
+	// Set when the queue is cancelled, protected by ctr
+	cancelled bool
+	// Number of URLs rejected as out of scope, accessed atomically
+	outOfScope int64
 }
 
 type queueNode struct {
@@ -55,18 +65,107 @@ type queueNode struct {
 	data *url.URL
 }
 
+type hostQueue struct {
+	// Elements to be worked on
+	head *queueNode
+	// End for cheap appends
+	tail *queueNode
+}
+
+// A hostRing keeps a queue of URLs for each host, and serves the hosts in
+// round-robin order.
+type hostRing struct {
+	// Queued URLs, by host
+	hosts map[string]*hostQueue
+	// Hosts with queued URLs, in round-robin order
+	ring []string
+	// Position in ring of the next host to serve
+	next int
+	// Number of URLs queued
+	count int
+}
+
+// Number of URLs queued.
+func (r *hostRing) len() int {
+	return r.count
+}
+
+// Append u to the end of the queue for its host.
+func (r *hostRing) push(u *url.URL) {
+	node := &queueNode{data: u}
+	if r.hosts == nil {
+		r.hosts = make(map[string]*hostQueue)
+	}
+	hq, ok := r.hosts[u.Host]
+	if !ok {
+		hq = &hostQueue{}
+		r.hosts[u.Host] = hq
+		r.ring = append(r.ring, u.Host)
+	}
+	if hq.tail != nil {
+		hq.tail.next = node
+	} else {
+		hq.head = node
+	}
+	hq.tail = node
+	r.count++
+}
+
+// Find the first host, starting with the next to be served, that ready
+// accepts, returning the URL at the front of its queue and the position of
+// the host in the ring.  The URL is nil if no host is ready.
+func (r *hostRing) peek(ready func(host string) bool) (*url.URL, int) {
+	for i := 0; i < len(r.ring); i++ {
+		pos := (r.next + i) % len(r.ring)
+		if ready(r.ring[pos]) {
+			return r.hosts[r.ring[pos]].head.data, pos
+		}
+	}
+	return nil, 0
+}
+
+// Remove the URL at the front of the queue for the host at pos, and serve the
+// host after it next.
+func (r *hostRing) pop(pos int) *url.URL {
+	host := r.ring[pos]
+	hq := r.hosts[host]
+	node := hq.head
+	hq.head = node.next
+	if hq.head == nil {
+		hq.tail = nil
+		delete(r.hosts, host)
+		r.ring = append(r.ring[:pos], r.ring[pos+1:]...)
+		r.next = pos
+	} else {
+		r.next = pos + 1
+	}
+	if r.next >= len(r.ring) {
+		r.next = 0
+	}
+	r.count--
+	return node.data
+}
+
+// Any host is ready to be served by the WorkQueue.
+func anyHost(string) bool {
+	return true
+}
+
 type QueueAddFunc func(...*url.URL)
 type QueueAddCount func(int)
 type QueueDoneFunc func(int)
+type QueueScopeFunc func(*url.URL) bool
 
 func NewWorkQueue(queueSize int, scope []*url.URL, allowUpgrades bool) *WorkQueue {
 	q := &WorkQueue{
-		src:     make(chan *url.URL, queueSize),
-		dst:     make(chan *url.URL, queueSize),
-		filter:  makeScopeFunc(scope, allowUpgrades),
-		started: make(chan bool, 1),
+		src:           make(chan *url.URL, queueSize),
+		dst:           make(chan *url.URL, queueSize),
+		filter:        makeScopeFunc(scope, allowUpgrades),
+		started:       make(chan bool, 1),
+		allowUpgrades: allowUpgrades,
 	}
-	q.ctr.L = &sync.Mutex{}
+	// The condition shares the counter's lock so no update can be missed
+	q.ctr.L = &q.ctr.Mutex
 	return q
 }
 
@@ -85,43 +184,61 @@ func (q *WorkQueue) GetWorkChan() <-chan *url.URL {
 	return q.dst
 }
 
-func (q *WorkQueue) Run() {
+// Run the queue until input is finished or ctx is cancelled.  Once cancelled,
+// queued work is dropped and any further input is discarded, and WaitPipe
+// returns.
+func (q *WorkQueue) Run(ctx context.Context) {
 	defer close(q.dst)
 
 	q.started <- true
 	keepGoing := true
 	for keepGoing {
-		keepGoing = q.runStep()
+		keepGoing = q.runStep(ctx)
+	}
+	if ctx.Err() != nil {
+		q.cancel()
 	}
 }
 
 // Run a single step of the queue, returning true if we should continue
-func (q *WorkQueue) runStep() bool {
-	if q.head != nil {
+func (q *WorkQueue) runStep(ctx context.Context) bool {
+	if q.queue.len() > 0 {
 		// If we have work to send, non-blocking read
 		select {
 		case u, ok := <-q.src:
 			if !ok {
-				for q.head != nil {
-					q.dst <- q.pop()
+				for q.queue.len() > 0 {
+					select {
+					case q.dst <- q.pop():
+					case <-ctx.Done():
+						return false
+					}
 				}
 				return false
 			}
-			if q.filter(u) {
+			if q.InScope(u) {
 				q.push(u)
 			} else {
 				q.reject(u)
 			}
 		case q.dst <- q.peek():
 			q.pop()
+		case <-ctx.Done():
+			return false
 		}
 	} else {
 		// Blocking read and non-blocking send
-		u, ok := <-q.src
+		var u *url.URL
+		var ok bool
+		select {
+		case u, ok = <-q.src:
+		case <-ctx.Done():
+			return false
+		}
 		if !ok {
 			return false
 		}
-		if !q.filter(u) {
+		if !q.InScope(u) {
 			q.reject(u)
 			return true
 		}
@@ -134,18 +251,30 @@ func (q *WorkQueue) runStep() bool {
 	return true
 }
 
-func (q *WorkQueue) RunInBackground() {
-	go q.Run()
+func (q *WorkQueue) RunInBackground(ctx context.Context) {
+	go q.Run(ctx)
+}
+
+// Drop everything and release anyone waiting on the queue.  Input is still
+// read, so that adding work never blocks, until InputFinished is called.
+func (q *WorkQueue) cancel() {
+	q.ctr.Lock()
+	q.cancelled = true
+	q.ctr.Broadcast()
+	q.ctr.Unlock()
+	go func() {
+		for range q.src {
+		}
+	}()
 }
 
 func (q *WorkQueue) WaitPipe() {
 	<-q.started
-	q.ctr.L.Lock()
-	if q.ctr.todo == q.ctr.done {
-		q.ctr.L.Unlock()
-		return
+	q.ctr.Lock()
+	defer q.ctr.Unlock()
+	for q.ctr.todo != q.ctr.done && !q.cancelled {
+		q.ctr.Wait()
 	}
-	q.ctr.Wait()
 }
 
 func (q *WorkQueue) GetAddFunc() QueueAddFunc {
@@ -160,6 +289,17 @@ func (q *WorkQueue) GetAddCount() QueueAddCount {
 	}
 }
 
+// Function to adjust the estimate of work still to be added, for progress
+func (q *WorkQueue) GetEstimateFunc() QueueAddCount {
+	return func(c int) {
+		q.ctr.Estimate(int64(c))
+	}
+}
+
+func (q *WorkQueue) GetScopeFunc() QueueScopeFunc {
+	return q.InScope
+}
+
 func (q *WorkQueue) GetDoneFunc() QueueDoneFunc {
 	return func(c int) {
 		q.ctr.Done(int64(c))
@@ -182,43 +322,72 @@ func (q *WorkQueue) SeedFromRobots(scope []*url.URL, clientFactory client.Client
 	}
 }
 
+// Add to the scope of a running queue.  URLs must still be added with AddURLs
+// to be worked on.
+func (q *WorkQueue) AddScope(urls ...*url.URL) {
+	added := ScopeURLs(urls, q.allowUpgrades)
+	q.scopeLock.Lock()
+	defer q.scopeLock.Unlock()
+	q.addedScope = append(q.addedScope, added...)
+}
+
+// Set the include and exclude rules applied on top of the scope.  This may be
+// done while the queue is running, and applies to URLs not yet checked.
+func (q *WorkQueue) SetRules(rules *scope.Rules) {
+	q.scopeLock.Lock()
+	defer q.scopeLock.Unlock()
+	q.rules = rules
+}
+
+// Whether u is within the scope of the scan, including any added scope, and
+// not excluded by a scope rule.
+func (q *WorkQueue) InScope(u *url.URL) bool {
+	q.scopeLock.RLock()
+	defer q.scopeLock.RUnlock()
+	if q.rules.Excluded(u) != nil {
+		return false
+	}
+	if q.filter(u) || q.rules.Included(u) {
+		return true
+	}
+	for _, scopeURL := range q.addedScope {
+		if util.URLIsSubpath(scopeURL, u) {
+			return true
+		}
+	}
+	return false
+}
+
 func (q *WorkQueue) reject(u *url.URL) {
 	logging.Logf(logging.LogDebug, "Workqueue rejecting %s", u.String())
+	atomic.AddInt64(&q.outOfScope, 1)
 	q.ctr.Done(1)
 }
 
-// Append URL to end of queue
+// Number of URLs that were found but not queued because they were out of
+// scope.
+func (q *WorkQueue) OutOfScopeCount() int64 {
+	return atomic.LoadInt64(&q.outOfScope)
+}
+
+// Append URL to end of the queue for its host
 func (q *WorkQueue) push(u *url.URL) {
-	node := &queueNode{data: u}
-	if q.tail != nil {
-		q.tail.next = node
-	} else {
-		q.head = node
-	}
-	q.tail = node
-	q.queueLen++
+	q.queue.push(u)
 }
 
-// Get URL from front of queue
+// Get URL from front of queue for the next host
 func (q *WorkQueue) pop() *url.URL {
-	node := q.head
-	if node == nil {
+	if q.queue.len() == 0 {
 		return nil
 	}
-	q.head = q.head.next
-	if q.head == nil {
-		q.tail = nil
-	}
-	q.queueLen--
-	return node.data
+	_, pos := q.queue.peek(anyHost)
+	return q.queue.pop(pos)
 }
 
 // Get URL from front of queue without removal
 func (q *WorkQueue) peek() *url.URL {
-	if q.head != nil {
-		return q.head.data
-	}
-	return nil
+	u, _ := q.queue.peek(anyHost)
+	return u
 }
 
 // Get the counter
@@ -226,8 +395,9 @@ func (q *WorkQueue) GetCounter() *WorkCounter {
 	return &q.ctr
 }
 
-// Build a function to check if the target URL is in scope.
-func makeScopeFunc(scope []*url.URL, allowUpgrades bool) func(*url.URL) bool {
+// URLs that are in scope for a scan of scope: the scope itself, plus the https
+// versions of http URLs if upgrades are allowed.
+func ScopeURLs(scope []*url.URL, allowUpgrades bool) []*url.URL {
 	allowedScopes := make([]*url.URL, len(scope))
 	copy(allowedScopes, scope)
 	if allowUpgrades {
@@ -240,6 +410,24 @@ func makeScopeFunc(scope []*url.URL, allowUpgrades bool) func(*url.URL) bool {
 			}
 		}
 	}
+	return allowedScopes
+}
+
+// A scope check like that of a WorkQueue for bases and rules, for use away
+// from the queue, e.g. by a remote agent.
+func NewScopeFunc(bases []*url.URL, allowUpgrades bool, rules *scope.Rules) QueueScopeFunc {
+	filter := makeScopeFunc(bases, allowUpgrades)
+	return func(u *url.URL) bool {
+		if rules.Excluded(u) != nil {
+			return false
+		}
+		return filter(u) || rules.Included(u)
+	}
+}
+
+// Build a function to check if the target URL is in scope.
+func makeScopeFunc(scope []*url.URL, allowUpgrades bool) func(*url.URL) bool {
+	allowedScopes := ScopeURLs(scope, allowUpgrades)
 	return func(target *url.URL) bool {
 		for _, scopeURL := range allowedScopes {
 			if util.URLIsSubpath(scopeURL, target) {
@@ -15,7 +15,9 @@
 package workqueue
 
 import (
+	"context"
 	"fmt"
+	"github.com/Matir/webborer/scope"
 	"net/url"
 	"strconv"
 	"testing"
@@ -26,7 +28,7 @@ func TestWorkqueue_Basic(t *testing.T) {
 
 	queue := NewWorkQueue(5, nil, false)
 	queue.filter = filter
-	queue.RunInBackground()
+	queue.RunInBackground(context.Background())
 	for i := 0; i < 20; i++ {
 		s := fmt.Sprintf("%d", i)
 		u := &url.URL{Path: s}
@@ -54,7 +56,7 @@ func TestWorkqueue_Reject(t *testing.T) {
 
 	queue := NewWorkQueue(5, nil, false)
 	queue.filter = filter
-	queue.RunInBackground()
+	queue.RunInBackground(context.Background())
 	for i := 0; i < 20; i++ {
 		s := fmt.Sprintf("%d", i)
 		u := &url.URL{Path: s}
@@ -71,6 +73,90 @@ func TestWorkqueue_Reject(t *testing.T) {
 	if i > 0 {
 		t.Errorf("Expecting all URLs to be filtered, got output!")
 	}
+	if n := queue.OutOfScopeCount(); n != 20 {
+		t.Errorf("Expected 20 URLs out of scope, got %d", n)
+	}
+}
+
+func TestWorkqueue_AddScope(t *testing.T) {
+	scope := []*url.URL{&url.URL{Scheme: "http", Host: "one", Path: "/"}}
+	queue := NewWorkQueue(5, scope, true)
+	queue.RunInBackground(context.Background())
+	queue.AddScope(&url.URL{Scheme: "http", Host: "two", Path: "/"})
+	queue.AddURLs(
+		&url.URL{Scheme: "http", Host: "one", Path: "/a"},
+		&url.URL{Scheme: "https", Host: "two", Path: "/b"},
+		&url.URL{Scheme: "http", Host: "three", Path: "/c"})
+	queue.InputFinished()
+	var got []string
+	for u := range queue.GetWorkChan() {
+		got = append(got, u.String())
+		queue.GetDoneFunc()(1)
+	}
+	queue.WaitPipe()
+	if len(got) != 2 {
+		t.Errorf("Expected 2 URLs in scope, got %v", got)
+	}
+	if n := queue.OutOfScopeCount(); n != 1 {
+		t.Errorf("Expected 1 URL out of scope, got %d", n)
+	}
+}
+
+func TestWorkqueue_Rules(t *testing.T) {
+	base := &url.URL{Scheme: "http", Host: "one", Path: "/"}
+	queue := NewWorkQueue(5, []*url.URL{base}, false)
+	rules, err := scope.NewRules([]string{"host:*.one"}, []string{"path:/logout"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	queue.SetRules(rules)
+	for target, expected := range map[string]bool{
+		"http://one/a":          true,
+		"http://one/logout":     false,
+		"http://api.one/a":      true,
+		"http://api.one/logout": false,
+		"http://two/a":          false,
+	} {
+		u, _ := url.Parse(target)
+		if queue.InScope(u) != expected {
+			t.Errorf("Expected InScope(%s) to be %v", target, expected)
+		}
+	}
+}
+
+func TestNewScopeFunc(t *testing.T) {
+	base := &url.URL{Scheme: "http", Host: "one", Path: "/app/"}
+	rules, _ := scope.NewRules([]string{"host:api.one"}, []string{"path:/app/logout"})
+	inScope := NewScopeFunc([]*url.URL{base}, true, rules)
+	for target, expected := range map[string]bool{
+		"http://one/app/a":      true,
+		"https://one/app/a":     true,
+		"http://one/app/logout": false,
+		"http://one/other":      false,
+		"http://api.one/x":      true,
+	} {
+		u, _ := url.Parse(target)
+		if inScope(u) != expected {
+			t.Errorf("Expected scope check for %s to be %v", target, expected)
+		}
+	}
+}
+
+func TestScopeURLs(t *testing.T) {
+	scope := []*url.URL{
+		&url.URL{Scheme: "http", Host: "localhost", Path: "/a/"},
+		&url.URL{Scheme: "https", Host: "localhost", Path: "/b/"},
+	}
+	if urls := ScopeURLs(scope, false); len(urls) != 2 {
+		t.Errorf("Expected 2 scope URLs without upgrades, got %v", urls)
+	}
+	urls := ScopeURLs(scope, true)
+	if len(urls) != 3 || urls[2].String() != "https://localhost/a/" {
+		t.Errorf("Expected https upgrade of http scope, got %v", urls)
+	}
+	if scope[0].Scheme != "http" {
+		t.Error("Original scope was modified.")
+	}
 }
 
 func TestWorkqueue_PartialReject(t *testing.T) {
@@ -83,7 +169,7 @@ func TestWorkqueue_PartialReject(t *testing.T) {
 	queue := NewWorkQueue(5, nil, false)
 	queue.peek()
 	queue.filter = filter
-	queue.RunInBackground()
+	queue.RunInBackground(context.Background())
 	for i := 0; i < rounds; i++ {
 		s := fmt.Sprintf("%d", i)
 		u := &url.URL{Path: s}
@@ -141,3 +227,40 @@ func TestMakeScopeFunc(t *testing.T) {
 		}
 	}
 }
+
+func TestWorkqueue_RoundRobin(t *testing.T) {
+	queue := NewWorkQueue(5, nil, false)
+	for _, h := range []string{"a", "a", "b", "a", "c"} {
+		queue.push(&url.URL{Host: h})
+	}
+	got := ""
+	for queue.peek() != nil {
+		peeked := queue.peek()
+		u := queue.pop()
+		if u != peeked {
+			t.Fatalf("pop() returned %v, but peek() returned %v", u, peeked)
+		}
+		got += u.Host
+	}
+	if got != "abcaa" {
+		t.Errorf("Expected round-robin order abcaa, got %s", got)
+	}
+}
+
+func TestWorkqueue_Cancel(t *testing.T) {
+	queue := NewWorkQueue(5, nil, false)
+	queue.filter = func(_ *url.URL) bool { return true }
+	ctx, cancel := context.WithCancel(context.Background())
+	queue.RunInBackground(ctx)
+	queue.AddURLs(&url.URL{Path: "/a"}, &url.URL{Path: "/b"})
+	cancel()
+	// Returns even though work is outstanding
+	queue.WaitPipe()
+	// Adding work doesn't block once cancelled
+	for i := 0; i < 20; i++ {
+		queue.AddURLs(&url.URL{Path: strconv.Itoa(i)})
+	}
+	queue.InputFinished()
+	for range queue.GetWorkChan() {
+	}
+}